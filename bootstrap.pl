@@ -8,6 +8,7 @@
 :-(op(1200, fx, :-)).
 :-(op(1200, fx, ?-)).
 :-(op(1100, xfy, ;)).
+:-(op(1100, xfy, '|')).
 :-(op(1050, xfy, ->)).
 :-(op(1000, xfy, ',')).
 :-(op(900, fy, \+)).
@@ -45,7 +46,7 @@
 :-(op(200, fy, +)).
 :-(op(200, fy, -)).
 :-(op(100, xfx, @)).
-:-(op(50, xfx, :)).
+:-(op(200, xfy, :)).
 
 % true/fail
 
@@ -128,6 +129,12 @@ write(Stream, Term) :- write_term(Stream, Term, [numbervars(true)]).
 :- built_in(write/1).
 write(Term) :- current_output(S), write(S, Term).
 
+:- built_in(writeln/2).
+writeln(Stream, Term) :- write(Stream, Term), nl(Stream).
+
+:- built_in(writeln/1).
+writeln(Term) :- current_output(S), writeln(S, Term).
+
 :- built_in(write_canonical/2).
 write_canonical(Stream, Term) :- write_term(Stream, Term, [quoted(true), ignore_ops(true)]).
 
@@ -140,12 +147,40 @@ writeq(Stream, Term) :- write_term(Stream, Term, [quoted(true), numbervars(true)
 :- built_in(writeq/1).
 writeq(Term) :- current_output(S), writeq(S, Term).
 
+:- built_in(write_clause/2).
+write_clause(Stream, Clause) :- write_term(Stream, Clause, [quoted(true), fullstop(true)]).
+
+:- built_in(write_clause/1).
+write_clause(Clause) :- current_output(S), write_clause(S, Clause).
+
+:- built_in(format/2).
+format(Format, Args) :- current_output(S), format(S, Format, Args).
+
+:- built_in(format/1).
+format(Format) :- format(Format, []).
+
+:- built_in(format_atom/3).
+format_atom(Atom, Format, Args) :- format(atom(Atom), Format, Args).
+
 :- built_in(nl/1).
 nl(Stream) :- write_term(Stream, '\n', []).
 
 :- built_in(nl/0).
 nl :- current_output(S), nl(S).
 
+:- built_in(tab/2).
+tab(Stream, N) :-
+  M is N,
+  (integer(M) -> true; type_error(integer, M)),
+  '$tab'(Stream, M).
+
+:- built_in('$tab'/2).
+'$tab'(_, N) :- N =< 0, !.
+'$tab'(Stream, N) :- put_char(Stream, ' '), M is N - 1, '$tab'(Stream, M).
+
+:- built_in(tab/1).
+tab(N) :- current_output(S), tab(S, N).
+
 :- built_in(put_byte/1).
 put_byte(Byte) :- current_output(S), put_byte(S, Byte).
 
@@ -167,6 +202,15 @@ read(Stream, Term) :- read_term(Stream, Term, []).
 :- built_in(read/1).
 read(Term) :- current_input(S), read(S, Term).
 
+:- built_in(read_terms/2).
+read_terms(Stream, Terms) :-
+  read_term(Stream, Term, []),
+  (   Term == end_of_file
+  ->  Terms = []
+  ;   Terms = [Term|Rest],
+      read_terms(Stream, Rest)
+  ).
+
 :- built_in(get_byte/1).
 get_byte(Byte) :- current_input(S), get_byte(S, Byte).
 
@@ -198,6 +242,9 @@ peek_code(Code) :- current_input(S), peek_code(S, Code).
 :- built_in(halt/0).
 halt :- halt(0).
 
+:- built_in(abort/0).
+abort :- throw('$aborted').
+
 :- built_in(at_end_of_stream/1).
 at_end_of_stream(Stream) :-
   stream_property(Stream, end_of_stream(E)), !,
@@ -230,5 +277,130 @@ nth(N, [_|Rest], Elem) :-
   M is N - 1,
   nth(M, Rest, Elem).
 
+:- built_in(maplist/2).
+maplist(_, []).
+maplist(G, [X|Xs]) :- call(G, X), maplist(G, Xs).
+
+:- built_in(maplist/3).
+maplist(_, [], []).
+maplist(G, [X|Xs], [Y|Ys]) :- call(G, X, Y), maplist(G, Xs, Ys).
+
+:- built_in(maplist/4).
+maplist(_, [], [], []).
+maplist(G, [X|Xs], [Y|Ys], [Z|Zs]) :- call(G, X, Y, Z), maplist(G, Xs, Ys, Zs).
+
+:- built_in(maplist/5).
+maplist(_, [], [], [], []).
+maplist(G, [X|Xs], [Y|Ys], [Z|Zs], [W|Ws]) :- call(G, X, Y, Z, W), maplist(G, Xs, Ys, Zs, Ws).
+
+:- built_in(curry/3).
+curry(G, A, X1) :- call(G, A, X1).
+
+:- built_in(curry/4).
+curry(G, A, X1, X2) :- call(G, A, X1, X2).
+
+:- built_in(curry/5).
+curry(G, A, X1, X2, X3) :- call(G, A, X1, X2, X3).
+
+:- built_in(curry/6).
+curry(G, A, X1, X2, X3, X4) :- call(G, A, X1, X2, X3, X4).
+
+:- built_in(curry/7).
+curry(G, A, X1, X2, X3, X4, X5) :- call(G, A, X1, X2, X3, X4, X5).
+
+:- built_in(curry/8).
+curry(G, A, X1, X2, X3, X4, X5, X6) :- call(G, A, X1, X2, X3, X4, X5, X6).
+
+:- built_in(plus/3).
+plus(X, Y, Z) :- nonvar(X), nonvar(Y), !, Z is X + Y.
+plus(X, Y, Z) :- nonvar(X), nonvar(Z), !, Y is Z - X.
+plus(X, Y, Z) :- nonvar(Y), nonvar(Z), !, X is Z - Y.
+plus(_, _, _) :- instantiation_error.
+
+:- built_in(foldl/4).
+foldl(_, [], V, V).
+foldl(G, [X|Xs], V0, V) :- call(G, X, V0, V1), foldl(G, Xs, V1, V).
+
+:- built_in(foldl/5).
+foldl(_, [], [], V, V).
+foldl(G, [X|Xs], [Y|Ys], V0, V) :- call(G, X, Y, V0, V1), foldl(G, Xs, Ys, V1, V).
+
+:- built_in(foldl/6).
+foldl(_, [], [], [], V, V).
+foldl(G, [X|Xs], [Y|Ys], [Z|Zs], V0, V) :- call(G, X, Y, Z, V0, V1), foldl(G, Xs, Ys, Zs, V1, V).
+
 :- built_in('.'/2).
 [H|T] :- consult([H|T]).
+
+:- built_in(recorda/2).
+recorda(Key, Term) :- recorda(Key, Term, _).
+
+:- built_in(recordz/2).
+recordz(Key, Term) :- recordz(Key, Term, _).
+
+:- built_in(recorded/2).
+recorded(Key, Term) :- recorded(Key, Term, _).
+
+:- dynamic(file_search_path/2).
+
+% errors
+
+:- built_in(instantiation_error/0).
+instantiation_error :- throw(error(instantiation_error, _)).
+
+:- built_in(type_error/2).
+type_error(Type, Culprit) :- throw(error(type_error(Type, Culprit), _)).
+
+:- built_in(domain_error/2).
+domain_error(Domain, Culprit) :- throw(error(domain_error(Domain, Culprit), _)).
+
+:- built_in(existence_error/2).
+existence_error(Type, Culprit) :- throw(error(existence_error(Type, Culprit), _)).
+
+:- built_in(permission_error/3).
+permission_error(Action, Type, Culprit) :- throw(error(permission_error(Action, Type, Culprit), _)).
+
+% messages
+
+:- built_in(print_message/2).
+print_message(Kind, Message) :-
+  '$message_prefix'(Kind, Prefix),
+  !,
+  '$message_lines'(Message, Header, Details),
+  format(user_error, '~a~a~n', [Prefix, Header]),
+  '$print_message_details'(Details).
+print_message(_, _).
+
+:- built_in('$message_prefix'/2).
+'$message_prefix'(error, 'Error: ').
+'$message_prefix'(warning, 'Warning: ').
+'$message_prefix'(informational, '% ').
+
+:- built_in('$print_message_details'/1).
+'$print_message_details'([]).
+'$print_message_details'([Label-Value|Details]) :-
+  format(user_error, '~4|~a:~t~14|~w~n', [Label, Value]),
+  '$print_message_details'(Details).
+
+:- built_in('$message_lines'/3).
+'$message_lines'(error(Formal, Context), Header, Details) :-
+  !,
+  '$error_lines'(Formal, Header, Details0),
+  (var(Context) -> Details = Details0; append(Details0, [context-Context], Details)).
+'$message_lines'(format(Format, Args), Header, []) :-
+  !,
+  format(atom(Header), Format, Args).
+'$message_lines'(Message, 'Unknown message', [message-Message]).
+
+:- built_in('$error_lines'/3).
+'$error_lines'(instantiation_error, 'Arguments are not sufficiently instantiated', []) :- !.
+'$error_lines'(type_error(Type, Culprit), 'Type error', [expected-Type, found-Culprit]) :- !.
+'$error_lines'(domain_error(Domain, Culprit), 'Domain error', [expected-Domain, found-Culprit]) :- !.
+'$error_lines'(existence_error(Type, Culprit), 'Existence error', [type-Type, culprit-Culprit]) :- !.
+'$error_lines'(permission_error(Action, Type, Culprit), 'Permission error', [action-Action, type-Type, culprit-Culprit]) :- !.
+'$error_lines'(representation_error(Flag), 'Representation error', [flag-Flag]) :- !.
+'$error_lines'(evaluation_error(Error), 'Evaluation error', [error-Error]) :- !.
+'$error_lines'(resource_error(Resource), 'Resource error', [resource-Resource]) :- !.
+'$error_lines'(syntax_error(Detail), 'Syntax error', [detail-Detail]) :- !.
+'$error_lines'(system_error, 'System error', []) :- !.
+'$error_lines'(Formal, 'Unknown error', [error-Formal]).
@@ -18,6 +18,7 @@ import (
 
 	"github.com/ichiban/prolog"
 	_ "github.com/ichiban/prolog/dcg"
+	_ "github.com/ichiban/prolog/yall"
 	"github.com/ichiban/prolog/engine"
 )
 
@@ -82,6 +83,9 @@ func main() {
 	i.OnUnknown = func(pi engine.ProcedureIndicator, args []engine.Term, env *engine.Env) {
 		log.Printf("UNKNOWN %s", pi)
 	}
+	i.OnSingletons = func(clause engine.Term, vars []string) {
+		log.Printf("SINGLETONS %s in %s", strings.Join(vars, ", "), clause)
+	}
 	i.Register1("version", func(t engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
 		info, ok := debug.ReadBuildInfo()
 		if !ok {
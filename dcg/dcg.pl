@@ -10,6 +10,19 @@ phrase(GRBody, S0, S) :-
     dcg_body(GRBody, S0, S, Goal),
     call(Goal).
 
+% Parses the codes from Stream with GRBody.
+% The codes are read on demand so that GRBody may succeed before the end of Stream, e.g. with remainder//1.
+
+:- built_in(phrase_from_stream/2).
+phrase_from_stream(GRBody, Stream) :-
+    stream_to_lazy_list(Stream, Codes),
+    phrase(GRBody, Codes).
+
+% Unifies List with the rest of the input.
+
+:- built_in(remainder/3).
+remainder(List, List, []).
+
 % Expands a DCG rule into a Prolog rule, when no error condition applies.
 
 :- built_in(dcg_rule/2).
@@ -1,6 +1,8 @@
 package dcg
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -12,3 +14,87 @@ func Test_install(t *testing.T) {
 	i := prolog.New(nil, nil)
 	assert.NoError(t, i.Exec(`:- [library(dcg)].`))
 }
+
+func TestUseModule(t *testing.T) {
+	i := prolog.New(nil, nil)
+	assert.NoError(t, i.Exec(`:- use_module(library(dcg)).`))
+	assert.NoError(t, i.Exec(`:- use_module(library(dcg)).`))
+	assert.NoError(t, i.QuerySolution(`phrase([a], [a]).`).Err())
+}
+
+func TestCurrentLibrary(t *testing.T) {
+	i := prolog.New(nil, nil)
+	assert.NoError(t, i.QuerySolution(`current_library(dcg).`).Err())
+	assert.Contains(t, prolog.Libraries(), "dcg")
+}
+
+func TestPhraseFromStream(t *testing.T) {
+	i := prolog.New(strings.NewReader("foo bar baz"), nil)
+	assert.NoError(t, i.Exec(`
+:- [library(dcg)].
+
+words([W|Ws]) --> word(W), " ", !, words(Ws).
+words([W]) --> word(W).
+word(W) --> letters(Cs), { atom_codes(W, Cs) }.
+letters([C|Cs]) --> letter(C), letters(Cs).
+letters([C]) --> letter(C).
+letter(C) --> [C], { C \== 0'  }.
+`))
+
+	var s struct {
+		Words []string
+	}
+	assert.NoError(t, i.QuerySolution(`phrase_from_stream(words(Words), user_input).`).Scan(&s))
+	assert.Equal(t, []string{"foo", "bar", "baz"}, s.Words)
+}
+
+// infinite is a reader which never ends.
+type infinite struct{}
+
+func (infinite) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'a'
+	}
+	return len(p), nil
+}
+
+func TestPhraseFromStream_unbounded(t *testing.T) {
+	i := prolog.New(infinite{}, nil)
+	assert.NoError(t, i.Exec(`
+:- [library(dcg)].
+
+as(0) --> [].
+as(N) --> "a", { N > 0, M is N - 1 }, as(M).
+`))
+
+	assert.NoError(t, i.QuerySolution(`phrase_from_stream((as(3), remainder(_)), user_input).`).Err())
+
+	// The rest of the stream is left unread.
+	var s struct {
+		C string
+	}
+	assert.NoError(t, i.QuerySolution(`get_char(C).`).Scan(&s))
+	assert.Equal(t, "a", s.C)
+}
+
+func TestCurlyBrackets(t *testing.T) {
+	var buf bytes.Buffer
+	i := prolog.New(nil, &buf)
+	assert.NoError(t, i.Exec(`
+:- [library(dcg)].
+
+a --> [x], { write(seen), nl }.
+
+p({a}).
+`))
+
+	t.Run("goal in grammar body", func(t *testing.T) {
+		buf.Reset()
+		assert.NoError(t, i.QuerySolution(`phrase(a, [x]).`).Err())
+		assert.Equal(t, "seen\n", buf.String())
+	})
+
+	t.Run("term in clause", func(t *testing.T) {
+		assert.NoError(t, i.QuerySolution(`p(X), functor(X, '{}', 1), arg(1, X, a).`).Err())
+	})
+}
@@ -28,7 +28,7 @@ func (a Atom) Unify(t Term, occursCheck bool, env *Env) (*Env, bool) {
 	switch t := env.Resolve(t).(type) {
 	case Atom:
 		return env, a == t
-	case Variable:
+	case Variable, *lazyList:
 		return t.Unify(a, occursCheck, env)
 	default:
 		return env, false
@@ -54,7 +54,15 @@ func (a Atom) Unparse(emit func(Token), _ *Env, opts ...WriteOption) {
 		o(&wto)
 	}
 
+	// An operator as an atom is enclosed in parentheses where it could be read as an operator, e.g. foo((;)).
+	if wto.ops.priority(a) > wto.priority {
+		emit(Token{Kind: TokenParenL, Val: "("})
+		defer emit(Token{Kind: TokenParenR, Val: ")"})
+	}
+
 	switch {
+	case a == "," && wto.quoted:
+		emit(Token{Kind: TokenQuotedIdent, Val: "','"})
 	case a == ",":
 		emit(Token{Kind: TokenComma, Val: ","})
 	case a == "[]", a == "{}", a == ";", a == "!":
@@ -106,13 +106,54 @@ func TestAtom_Unparse(t *testing.T) {
 	})
 
 	t.Run("comma", func(t *testing.T) {
-		var tokens []Token
-		Atom(",").Unparse(func(token Token) {
-			tokens = append(tokens, token)
-		}, nil, WithQuoted(true))
-		assert.Equal(t, []Token{
-			{Kind: TokenComma, Val: ","},
-		}, tokens)
+		t.Run("quoted", func(t *testing.T) {
+			var tokens []Token
+			Atom(",").Unparse(func(token Token) {
+				tokens = append(tokens, token)
+			}, nil, WithQuoted(true))
+			assert.Equal(t, []Token{
+				{Kind: TokenQuotedIdent, Val: "','"},
+			}, tokens)
+		})
+
+		t.Run("not quoted", func(t *testing.T) {
+			var tokens []Token
+			Atom(",").Unparse(func(token Token) {
+				tokens = append(tokens, token)
+			}, nil, WithQuoted(false))
+			assert.Equal(t, []Token{
+				{Kind: TokenComma, Val: ","},
+			}, tokens)
+		})
+	})
+
+	t.Run("operator", func(t *testing.T) {
+		ops := operators{
+			{priority: 1100, specifier: operatorSpecifierXFY, name: ";"},
+			{priority: 500, specifier: operatorSpecifierYFX, name: "-"},
+		}
+
+		t.Run("as an argument", func(t *testing.T) {
+			var tokens []Token
+			Atom(";").Unparse(func(token Token) {
+				tokens = append(tokens, token)
+			}, nil, withOps(ops), WithPriority(999))
+			assert.Equal(t, []Token{
+				{Kind: TokenParenL, Val: "("},
+				{Kind: TokenIdent, Val: ";"},
+				{Kind: TokenParenR, Val: ")"},
+			}, tokens)
+		})
+
+		t.Run("low priority", func(t *testing.T) {
+			var tokens []Token
+			Atom("-").Unparse(func(token Token) {
+				tokens = append(tokens, token)
+			}, nil, withOps(ops), WithPriority(999))
+			assert.Equal(t, []Token{
+				{Kind: TokenGraphic, Val: "-"},
+			}, tokens)
+		})
 	})
 
 	t.Run("nil", func(t *testing.T) {
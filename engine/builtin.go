@@ -3,13 +3,18 @@ package engine
 import (
 	"bufio"
 	"context"
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash"
+	"hash/fnv"
 	"io"
 	"math"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
+	"time"
 	"unicode"
 	"unicode/utf8"
 )
@@ -18,6 +23,9 @@ import (
 type State struct {
 	VM
 
+	// MaxParseDepth limits the depth of nested expressions in a term to read. If zero, DefaultMaxParseDepth applies.
+	MaxParseDepth int
+
 	// Internal/external expression
 	operators       operators
 	charConversions map[rune]rune
@@ -28,6 +36,17 @@ type State struct {
 	streams       map[Term]*Stream
 	input, output *Stream
 
+	// Global variables set by nb_setval/2. The ones set by b_setval/2 are in Env so that they're undone on
+	// backtracking. They share the key space and the one set last wins.
+	globalVars   map[Atom]globalVar
+	globalSerial Integer
+
+	// Internal database by recorda/3 and recordz/3
+	records []*RecordRef
+
+	// Modules declared by module/2 and their exports. Procedures share a single flat namespace.
+	modules map[Atom][]ProcedureIndicator
+
 	// Misc
 	debug bool
 }
@@ -84,17 +103,55 @@ func (state *State) SetUserOutput(w io.Writer, opts ...StreamOption) {
 	state.output = NewStream(readWriteCloser(w), StreamModeWrite, opts...)
 }
 
+// SetUserError sets the given writer as a stream with an alias of user_error.
+func (state *State) SetUserError(w io.Writer, opts ...StreamOption) {
+	opts = append(opts, WithAlias(state, "user_error"))
+	NewStream(readWriteCloser(w), StreamModeWrite, opts...)
+}
+
+// Clone returns a copy of the state which can be used in another goroutine. The copy has its own database, operators,
+// flags, and global variables while it shares the streams with the original.
+func (state *State) Clone() State {
+	c := *state
+	c.VM = state.VM.clone()
+	c.operators = append(operators(nil), state.operators...)
+	c.charConversions = make(map[rune]rune, len(state.charConversions))
+	for in, out := range state.charConversions {
+		c.charConversions[in] = out
+	}
+	c.streams = make(map[Term]*Stream, len(state.streams))
+	for k, s := range state.streams {
+		c.streams[k] = s
+	}
+	c.globalVars = make(map[Atom]globalVar, len(state.globalVars))
+	for n, v := range state.globalVars {
+		c.globalVars[n] = v
+	}
+	c.records = append([]*RecordRef(nil), state.records...)
+	c.modules = make(map[Atom][]ProcedureIndicator, len(state.modules))
+	for m, pis := range state.modules {
+		c.modules[m] = append([]ProcedureIndicator(nil), pis...)
+	}
+	return c
+}
+
 // Parser creates a new parser from the current State and io.Reader.
 // If non-nil, vars will hold the information on variables it parses.
+// Character conversions apply only if the flag char_conversion is on.
 func (state *State) Parser(r io.Reader, vars *[]ParsedVariable) *Parser {
 	br, ok := r.(*bufio.Reader)
 	if !ok {
 		br = bufio.NewReader(r)
 	}
-	return newParser(br, state.charConversions,
+	var convs map[rune]rune
+	if state.charConvEnabled {
+		convs = state.charConversions
+	}
+	return newParser(br, convs,
 		withOperators(&state.operators),
 		withDoubleQuotes(state.doubleQuotes),
 		withParsedVars(vars),
+		withMaxDepth(state.MaxParseDepth),
 	)
 }
 
@@ -119,6 +176,42 @@ func (state *State) Negation(goal Term, k func(*Env) *Promise, env *Env) *Promis
 	})
 }
 
+// CallWithTimeLimit executes goal as once/1 but throws time_limit_exceeded if it doesn't finish in seconds.
+func (state *State) CallWithTimeLimit(seconds, goal Term, k func(*Env) *Promise, env *Env) *Promise {
+	var d time.Duration
+	switch s := env.Resolve(seconds).(type) {
+	case Variable:
+		return Error(InstantiationError(seconds))
+	case Integer:
+		d = time.Duration(s) * time.Second
+	case Float:
+		d = time.Duration(float64(s) * float64(time.Second))
+	default:
+		return Error(typeErrorNumber(seconds, env))
+	}
+
+	return Delay(func(ctx context.Context) *Promise {
+		limited, cancel := context.WithTimeout(ctx, d)
+		defer cancel()
+
+		var solution *Env
+		ok, err := state.Call(goal, func(env *Env) *Promise {
+			solution = env
+			return Bool(true)
+		}, env).Force(limited)
+		if err != nil {
+			if ctx.Err() == nil && limited.Err() == context.DeadlineExceeded {
+				return Error(timeLimitExceeded(env.Resolve(seconds)))
+			}
+			return Error(err)
+		}
+		if !ok {
+			return Bool(false)
+		}
+		return k(solution)
+	})
+}
+
 // Call executes goal. it succeeds if goal followed by k succeeds. A cut inside goal doesn't affect outside of Call.
 func (state *State) Call(goal Term, k func(*Env) *Promise, env *Env) *Promise {
 	switch g := env.Resolve(goal).(type) {
@@ -146,6 +239,57 @@ func (state *State) Call(goal Term, k func(*Env) *Promise, env *Env) *Promise {
 	}
 }
 
+// Call1 succeeds iff closure with an additional argument succeeds.
+func (state *State) Call1(closure, arg1 Term, k func(*Env) *Promise, env *Env) *Promise {
+	return state.callN(closure, []Term{arg1}, k, env)
+}
+
+// Call2 succeeds iff closure with 2 additional arguments succeeds.
+func (state *State) Call2(closure, arg1, arg2 Term, k func(*Env) *Promise, env *Env) *Promise {
+	return state.callN(closure, []Term{arg1, arg2}, k, env)
+}
+
+// Call3 succeeds iff closure with 3 additional arguments succeeds.
+func (state *State) Call3(closure, arg1, arg2, arg3 Term, k func(*Env) *Promise, env *Env) *Promise {
+	return state.callN(closure, []Term{arg1, arg2, arg3}, k, env)
+}
+
+// Call4 succeeds iff closure with 4 additional arguments succeeds.
+func (state *State) Call4(closure, arg1, arg2, arg3, arg4 Term, k func(*Env) *Promise, env *Env) *Promise {
+	return state.callN(closure, []Term{arg1, arg2, arg3, arg4}, k, env)
+}
+
+// Call5 succeeds iff closure with 5 additional arguments succeeds.
+func (state *State) Call5(closure, arg1, arg2, arg3, arg4, arg5 Term, k func(*Env) *Promise, env *Env) *Promise {
+	return state.callN(closure, []Term{arg1, arg2, arg3, arg4, arg5}, k, env)
+}
+
+// Call6 succeeds iff closure with 6 additional arguments succeeds.
+func (state *State) Call6(closure, arg1, arg2, arg3, arg4, arg5, arg6 Term, k func(*Env) *Promise, env *Env) *Promise {
+	return state.callN(closure, []Term{arg1, arg2, arg3, arg4, arg5, arg6}, k, env)
+}
+
+// Call7 succeeds iff closure with 7 additional arguments succeeds.
+func (state *State) Call7(closure, arg1, arg2, arg3, arg4, arg5, arg6, arg7 Term, k func(*Env) *Promise, env *Env) *Promise {
+	return state.callN(closure, []Term{arg1, arg2, arg3, arg4, arg5, arg6, arg7}, k, env)
+}
+
+func (state *State) callN(closure Term, args []Term, k func(*Env) *Promise, env *Env) *Promise {
+	switch c := env.Resolve(closure).(type) {
+	case Variable:
+		return Error(InstantiationError(closure))
+	case Atom:
+		return state.Call(c.Apply(args...), k, env)
+	case *Compound:
+		as := make([]Term, 0, len(c.Args)+len(args))
+		as = append(as, c.Args...)
+		as = append(as, args...)
+		return state.Call(c.Functor.Apply(as...), k, env)
+	default:
+		return Error(typeErrorCallable(closure, env))
+	}
+}
+
 // Unify unifies t1 and t2 without occurs check (i.e., X = f(X) is allowed).
 func Unify(t1, t2 Term, k func(*Env) *Promise, env *Env) *Promise {
 	env, ok := t1.Unify(t2, false, env)
@@ -215,7 +359,7 @@ func Functor(t, name, arity Term, k func(*Env) *Promise, env *Env) *Promise {
 		case Integer:
 			switch {
 			case arity < 0:
-				return Error(domainErrorNotLessThanZero(arity))
+				return Error(domainErrorNotLessThanZero(arity, env))
 			case arity == 0:
 				return Unify(t, name, k, env)
 			}
@@ -224,7 +368,7 @@ func Functor(t, name, arity Term, k func(*Env) *Promise, env *Env) *Promise {
 			case Variable:
 				return Error(InstantiationError(name))
 			case *Compound:
-				return Error(typeErrorAtomic(name))
+				return Error(typeErrorAtomic(name, env))
 			case Atom:
 				vs := make([]Term, arity)
 				for i := range vs {
@@ -237,10 +381,10 @@ func Functor(t, name, arity Term, k func(*Env) *Promise, env *Env) *Promise {
 					}, k, env)
 				})
 			default:
-				return Error(typeErrorAtom(name))
+				return Error(typeErrorAtom(name, env))
 			}
 		default:
-			return Error(typeErrorInteger(arity))
+			return Error(typeErrorInteger(arity, env))
 		}
 	case *Compound:
 		pattern := Compound{Args: []Term{name, arity}}
@@ -265,20 +409,20 @@ func Arg(nth, t, arg Term, k func(*Env) *Promise, env *Env) *Promise {
 		case Variable:
 			return Error(InstantiationError(nth))
 		case Integer:
-			if n == 0 || int(n) >= len(c.Args) {
-				return Bool(false)
-			}
 			if n < 0 {
-				return Error(domainErrorNotLessThanZero(n))
+				return Error(domainErrorNotLessThanZero(n, env))
+			}
+			if n == 0 || int(n) > len(c.Args) {
+				return Bool(false)
 			}
 			return Delay(func(context.Context) *Promise {
 				return Unify(arg, c.Args[int(n)-1], k, env)
 			})
 		default:
-			return Error(typeErrorInteger(n))
+			return Error(typeErrorInteger(n, env))
 		}
 	default:
-		return Error(typeErrorCompound(t))
+		return Error(typeErrorCompound(t, env))
 	}
 }
 
@@ -288,16 +432,11 @@ func Univ(t, list Term, k func(*Env) *Promise, env *Env) *Promise {
 	case Variable:
 		list = env.Resolve(list)
 		if list == Atom("[]") {
-			return Error(domainErrorNotEmptyList(list))
+			return Error(domainErrorNotEmptyList(list, env))
 		}
 		cons, ok := list.(*Compound)
 		if !ok || cons.Functor != "." || len(cons.Args) != 2 {
-			return Error(typeErrorList(list))
-		}
-
-		f, ok := env.Resolve(cons.Args[0]).(Atom)
-		if !ok {
-			return Error(typeErrorAtom(cons.Args[0]))
+			return Error(typeErrorList(list, env))
 		}
 
 		var args []Term
@@ -308,6 +447,26 @@ func Univ(t, list Term, k func(*Env) *Promise, env *Env) *Promise {
 			return Error(err)
 		}
 
+		head := env.Resolve(cons.Args[0])
+		if h, ok := head.(Variable); ok {
+			return Error(InstantiationError(h))
+		}
+
+		// A list of a single atomic term is the term itself.
+		if len(args) == 0 {
+			if _, ok := head.(*Compound); ok {
+				return Error(typeErrorAtomic(head, env))
+			}
+			return Delay(func(context.Context) *Promise {
+				return Unify(t, head, k, env)
+			})
+		}
+
+		f, ok := head.(Atom)
+		if !ok {
+			return Error(typeErrorAtom(cons.Args[0], env))
+		}
+
 		return Delay(func(context.Context) *Promise {
 			return Unify(t, &Compound{
 				Functor: f,
@@ -356,19 +515,139 @@ func copyTerm(t Term, vars map[Variable]Variable, env *Env) Term {
 	}
 }
 
+// GetDict unifies key and value with a key-value pair of dict.
+func GetDict(key, dict, value Term, k func(*Env) *Promise, env *Env) *Promise {
+	switch key := env.Resolve(key).(type) {
+	case Variable, Atom, Integer:
+		break
+	default:
+		return Error(typeErrorDictKey(key, env))
+	}
+
+	if _, ok := env.Resolve(dict).(Variable); ok {
+		return Error(InstantiationError(dict))
+	}
+	_, pairs, ok := dictPairs(dict, env)
+	if !ok {
+		return Error(typeErrorDict(dict, env))
+	}
+
+	pattern := Compound{Functor: "-", Args: []Term{key, value}}
+	ks := make([]func(context.Context) *Promise, len(pairs))
+	for i := range pairs {
+		p := pairs[i]
+		ks[i] = func(context.Context) *Promise {
+			return Unify(&pattern, p, k, env)
+		}
+	}
+	return Delay(ks...)
+}
+
+// PutDict unifies dictOut with dict of which value for key is replaced or added with value.
+func PutDict(key, dict, value, dictOut Term, k func(*Env) *Promise, env *Env) *Promise {
+	switch key := env.Resolve(key).(type) {
+	case Variable:
+		return Error(InstantiationError(key))
+	case Atom, Integer:
+		break
+	default:
+		return Error(typeErrorDictKey(key, env))
+	}
+
+	if _, ok := env.Resolve(dict).(Variable); ok {
+		return Error(InstantiationError(dict))
+	}
+	tag, pairs, ok := dictPairs(dict, env)
+	if !ok {
+		return Error(typeErrorDict(dict, env))
+	}
+
+	p := &Compound{Functor: "-", Args: []Term{env.Resolve(key), value}}
+	ps := make([]*Compound, 0, len(pairs)+1)
+	for _, q := range pairs {
+		if q.Args[0].Compare(key, env) == 0 {
+			continue
+		}
+		ps = append(ps, q)
+	}
+	ps = append(ps, p)
+	d, err := newDict(tag, ps, env)
+	if err != nil {
+		return Error(SystemError(err))
+	}
+	return Unify(dictOut, d, k, env)
+}
+
+// TermHash unifies hash with a stable hash value of term. It fails if term is not ground.
+func TermHash(term, hash Term, k func(*Env) *Promise, env *Env) *Promise {
+	switch env.Resolve(hash).(type) {
+	case Variable, Integer:
+		break
+	default:
+		return Error(typeErrorInteger(hash, env))
+	}
+
+	h := fnv.New64a()
+	if !writeTermHash(h, term, env) {
+		return Bool(false)
+	}
+	return Delay(func(context.Context) *Promise {
+		return Unify(hash, Integer(h.Sum64()&math.MaxInt64), k, env)
+	})
+}
+
+// writeTermHash writes the canonical structure of t to h. It returns false if t is not ground.
+func writeTermHash(h hash.Hash64, t Term, env *Env) bool {
+	var b [8]byte
+	switch t := env.Resolve(t).(type) {
+	case Variable:
+		return false
+	case Atom:
+		_, _ = h.Write([]byte{'a'})
+		_, _ = h.Write([]byte(t))
+		_, _ = h.Write([]byte{0})
+	case Integer:
+		binary.BigEndian.PutUint64(b[:], uint64(t))
+		_, _ = h.Write([]byte{'i'})
+		_, _ = h.Write(b[:])
+	case Float:
+		binary.BigEndian.PutUint64(b[:], math.Float64bits(float64(t)))
+		_, _ = h.Write([]byte{'f'})
+		_, _ = h.Write(b[:])
+	case *Compound:
+		binary.BigEndian.PutUint64(b[:], uint64(len(t.Args)))
+		_, _ = h.Write([]byte{'c'})
+		_, _ = h.Write([]byte(t.Functor))
+		_, _ = h.Write([]byte{0})
+		_, _ = h.Write(b[:])
+		for _, a := range t.Args {
+			if !writeTermHash(h, a, env) {
+				return false
+			}
+		}
+	default:
+		_, _ = h.Write([]byte{'o'})
+		_, _ = h.Write([]byte(t.String()))
+		_, _ = h.Write([]byte{0})
+	}
+	return true
+}
+
 // Op defines operator with priority and specifier, or removes when priority is 0.
+// Standard operators such as + can be redefined, but ',' can't be modified and '|' can only be an infix operator of
+// priority 1001 or more since the parser depends on them.
 func (state *State) Op(priority, specifier, op Term, k func(*Env) *Promise, env *Env) *Promise {
 	p, ok := env.Resolve(priority).(Integer)
 	if !ok {
-		return Error(typeErrorInteger(priority))
+		return Error(typeErrorInteger(priority, env))
 	}
 	if p < 0 || p > 1200 {
-		return Error(domainErrorOperatorPriority(priority))
+		return Error(domainErrorOperatorPriority(priority, env))
 	}
 
 	s, ok := env.Resolve(specifier).(Atom)
 	if !ok {
-		return Error(typeErrorAtom(specifier))
+		return Error(typeErrorAtom(specifier, env))
 	}
 
 	spec, ok := map[Atom]operatorSpecifier{
@@ -381,17 +660,49 @@ func (state *State) Op(priority, specifier, op Term, k func(*Env) *Promise, env
 		"yfx": operatorSpecifierYFX,
 	}[s]
 	if !ok {
-		return Error(domainErrorOperatorSpecifier(s))
+		return Error(domainErrorOperatorSpecifier(s, env))
 	}
 
 	o, ok := env.Resolve(op).(Atom)
 	if !ok {
-		return Error(typeErrorAtom(op))
+		return Error(typeErrorAtom(op, env))
+	}
+
+	switch o {
+	case ",":
+		if p != 1000 || spec != operatorSpecifierXFY {
+			return Error(permissionErrorModifyOperator(o, env))
+		}
+	case "|":
+		switch spec {
+		case operatorSpecifierXFX, operatorSpecifierXFY, operatorSpecifierYFX:
+			if p != 0 && p < 1001 {
+				return Error(permissionErrorCreateOperator(o, env))
+			}
+		default:
+			return Error(permissionErrorCreateOperator(o, env))
+		}
+	case "[]", "{}":
+		return Error(permissionErrorCreateOperator(o, env))
+	}
+
+	// An atom can't be both infix and postfix.
+	if p > 0 {
+		for _, op := range state.operators {
+			if op.name != o {
+				continue
+			}
+			switch c := op.specifier.class(); {
+			case c == operatorClassInfix && spec.class() == operatorClassPostfix,
+				c == operatorClassPostfix && spec.class() == operatorClassInfix:
+				return Error(permissionErrorCreateOperator(o, env))
+			}
+		}
 	}
 
-	// already defined?
+	// already defined? An operator replaces the one of the same class, e.g. xfy replaces yfx.
 	for i, op := range state.operators {
-		if op.specifier != spec || op.name != o {
+		if op.specifier.class() != spec.class() || op.name != o {
 			continue
 		}
 
@@ -404,6 +715,7 @@ func (state *State) Op(priority, specifier, op Term, k func(*Env) *Promise, env
 		if p == 0 {
 			return k(env)
 		}
+		break
 	}
 
 	// insert
@@ -421,6 +733,26 @@ func (state *State) Op(priority, specifier, op Term, k func(*Env) *Promise, env
 	return k(env)
 }
 
+// Operator is a definition of an operator.
+type Operator struct {
+	Priority  Integer
+	Specifier Atom // one of fx, fy, xf, yf, xfx, xfy, and yfx.
+	Name      Atom
+}
+
+// CurrentOperators returns a copy of the operator table in ascending order of priority.
+func (state *State) CurrentOperators() []Operator {
+	ret := make([]Operator, len(state.operators))
+	for i, op := range state.operators {
+		ret[i] = Operator{
+			Priority:  op.priority,
+			Specifier: op.specifier.term().(Atom),
+			Name:      op.name,
+		}
+	}
+	return ret
+}
+
 // CurrentOp succeeds if operator is defined with priority and specifier.
 func (state *State) CurrentOp(priority, specifier, operator Term, k func(*Env) *Promise, env *Env) *Promise {
 	switch p := env.Resolve(priority).(type) {
@@ -428,10 +760,10 @@ func (state *State) CurrentOp(priority, specifier, operator Term, k func(*Env) *
 		break
 	case Integer:
 		if p < 0 || p > 1200 {
-			return Error(domainErrorOperatorPriority(priority))
+			return Error(domainErrorOperatorPriority(priority, env))
 		}
 	default:
-		return Error(domainErrorOperatorPriority(priority))
+		return Error(domainErrorOperatorPriority(priority, env))
 	}
 
 	switch s := env.Resolve(specifier).(type) {
@@ -447,17 +779,17 @@ func (state *State) CurrentOp(priority, specifier, operator Term, k func(*Env) *
 			"fx":  {},
 			"fy":  {},
 		}[s]; !ok {
-			return Error(domainErrorOperatorSpecifier(s))
+			return Error(domainErrorOperatorSpecifier(s, env))
 		}
 	default:
-		return Error(domainErrorOperatorSpecifier(s))
+		return Error(domainErrorOperatorSpecifier(s, env))
 	}
 
 	switch env.Resolve(operator).(type) {
 	case Variable, Atom:
 		break
 	default:
-		return Error(typeErrorAtom(operator))
+		return Error(typeErrorAtom(operator, env))
 	}
 
 	pattern := Compound{Args: []Term{priority, specifier, operator}}
@@ -473,83 +805,169 @@ func (state *State) CurrentOp(priority, specifier, operator Term, k func(*Env) *
 
 // Assertz appends t to the database.
 func (state *State) Assertz(t Term, k func(*Env) *Promise, env *Env) *Promise {
-	return state.assert(t, false, func(existing clauses, new clauses) clauses {
-		return append(existing, new...)
-	}, k, env)
+	return state.assert(t, false, nil, appendClauses, k, env)
 }
 
 // Asserta prepends t to the database.
 func (state *State) Asserta(t Term, k func(*Env) *Promise, env *Env) *Promise {
-	return state.assert(t, false, func(existing clauses, new clauses) clauses {
-		return append(new, existing...)
-	}, k, env)
+	return state.assert(t, false, nil, prependClauses, k, env)
+}
+
+// Assertz2 appends t to the database and unifies ref with a reference to the clause for Erase.
+func (state *State) Assertz2(t, ref Term, k func(*Env) *Promise, env *Env) *Promise {
+	return state.assertRef(t, ref, appendClauses, k, env)
+}
+
+// Asserta2 prepends t to the database and unifies ref with a reference to the clause for Erase.
+func (state *State) Asserta2(t, ref Term, k func(*Env) *Promise, env *Env) *Promise {
+	return state.assertRef(t, ref, prependClauses, k, env)
 }
 
 // AssertStatic prepends t to the database.
 func (state *State) AssertStatic(t Term, k func(*Env) *Promise, env *Env) *Promise {
-	return state.assert(t, true, func(existing clauses, new clauses) clauses {
-		return append(existing, new...)
-	}, k, env)
+	return state.assert(t, true, nil, appendClauses, k, env)
+}
+
+// AssertzAll appends the clauses in list to the database in order. If any of them can't be asserted, none is.
+// A directive in list is called in order as Assertz does.
+func (state *State) AssertzAll(list Term, k func(*Env) *Promise, env *Env) *Promise {
+	var as []assertion
+	if err := EachList(env.Resolve(list), func(elem Term) error {
+		a, err := state.compileAssertion(elem, false, env)
+		if err != nil {
+			return err
+		}
+		as = append(as, a)
+		return nil
+	}, env); err != nil {
+		return Error(err)
+	}
+	return state.assertAll(as, k, env)
+}
+
+func (state *State) assertAll(as []assertion, k func(*Env) *Promise, env *Env) *Promise {
+	for i, a := range as {
+		if a.directive {
+			rest := as[i+1:]
+			return Delay(func(context.Context) *Promise {
+				return state.Arrive(a.pi, a.args, func(env *Env) *Promise {
+					return state.assertAll(rest, k, env)
+				}, env)
+			})
+		}
+		state.addClauses(a, false, appendClauses)
+	}
+	return k(env)
+}
+
+// assertion is either clauses to be added to the database or a directive to be called.
+type assertion struct {
+	pi        ProcedureIndicator
+	added     clauses
+	directive bool
+	args      []Term
 }
 
-func (state *State) assert(t Term, force bool, merge func(clauses, clauses) clauses, k func(*Env) *Promise, env *Env) *Promise {
+// compileAssertion compiles t into an assertion without modifying the database. Unless force, clauses for a procedure
+// which is not dynamic result in a permission error.
+func (state *State) compileAssertion(t Term, force bool, env *Env) (assertion, error) {
 	pi, args, err := piArgs(t, env)
 	if err != nil {
-		return Error(err)
+		return assertion{}, err
 	}
 
 	switch pi {
 	case ProcedureIndicator{Name: ":-", Arity: 1}: // directive
-		name, args, err := piArgs(args[0], env)
+		pi, args, err := piArgs(args[0], env)
 		if err != nil {
-			return Error(err)
+			return assertion{}, err
 		}
-		return Delay(func(context.Context) *Promise {
-			return state.Arrive(name, args, k, env)
-		})
+		return assertion{pi: pi, directive: true, args: args}, nil
 	case ProcedureIndicator{Name: ":-", Arity: 2}:
 		pi, _, err = piArgs(args[0], env)
 		if err != nil {
-			return Error(err)
+			return assertion{}, err
+		}
+	}
+
+	added, err := compile(t, env)
+	if err != nil {
+		return assertion{}, err
+	}
+
+	switch state.procedures[pi].(type) {
+	case nil, clauses:
+		break
+	case builtin, static:
+		if !force {
+			return assertion{}, permissionErrorModifyStaticProcedure(pi.Term(), env)
 		}
+	default:
+		return assertion{}, permissionErrorModifyStaticProcedure(pi.Term(), env)
 	}
+	return assertion{pi: pi, added: added}, nil
+}
 
+// addClauses adds the clauses of a to the database. A new procedure is static if force, or dynamic otherwise.
+func (state *State) addClauses(a assertion, force bool, merge func(clauses, clauses) clauses) {
 	if state.procedures == nil {
 		state.procedures = map[ProcedureIndicator]procedure{}
 	}
-	p, ok := state.procedures[pi]
-	if !ok {
+	switch existing := state.procedures[a.pi].(type) {
+	case clauses:
+		state.procedures[a.pi] = merge(existing, a.added)
+	case builtin:
+		state.procedures[a.pi] = builtin{merge(existing.clauses, a.added)}
+	case static:
+		state.procedures[a.pi] = static{merge(existing.clauses, a.added)}
+	default:
 		if force {
-			p = static{}
+			state.procedures[a.pi] = static{merge(nil, a.added)}
 		} else {
-			p = clauses{}
+			state.procedures[a.pi] = merge(nil, a.added)
 		}
 	}
+}
 
-	added, err := compile(t, env)
+func appendClauses(existing, new clauses) clauses {
+	return append(existing, new...)
+}
+
+func prependClauses(existing, new clauses) clauses {
+	return append(new, existing...)
+}
+
+func (state *State) assertRef(t, ref Term, merge func(clauses, clauses) clauses, k func(*Env) *Promise, env *Env) *Promise {
+	if _, ok := env.Resolve(ref).(Variable); !ok {
+		return Error(uninstantiationError(ref, env))
+	}
+
+	var r ClauseRef
+	return state.assert(t, false, &r, merge, func(env *Env) *Promise {
+		return Unify(ref, &r, k, env)
+	}, env)
+}
+
+func (state *State) assert(t Term, force bool, ref *ClauseRef, merge func(clauses, clauses) clauses, k func(*Env) *Promise, env *Env) *Promise {
+	a, err := state.compileAssertion(t, force, env)
 	if err != nil {
 		return Error(err)
 	}
 
-	switch existing := p.(type) {
-	case clauses:
-		state.procedures[pi] = merge(existing, added)
-		return k(env)
-	case builtin:
-		if !force {
-			return Error(permissionErrorModifyStaticProcedure(pi.Term()))
-		}
-		state.procedures[pi] = builtin{merge(existing.clauses, added)}
-		return k(env)
-	case static:
-		if !force {
-			return Error(permissionErrorModifyStaticProcedure(pi.Term()))
+	if a.directive {
+		return Delay(func(context.Context) *Promise {
+			return state.Arrive(a.pi, a.args, k, env)
+		})
+	}
+
+	if ref != nil {
+		ref.pi = a.pi
+		for i := range a.added {
+			a.added[i].ref = ref
 		}
-		state.procedures[pi] = static{merge(existing.clauses, added)}
-		return k(env)
-	default:
-		return Error(permissionErrorModifyStaticProcedure(pi.Term()))
 	}
+	state.addClauses(a, force, merge)
+	return k(env)
 }
 
 // BagOf collects all the solutions of goal as instances, which unify with template. instances may contain duplications.
@@ -667,10 +1085,10 @@ func Compare(order, term1, term2 Term, k func(*Env) *Promise, env *Env) *Promise
 		case "<", "=", ">":
 			break
 		default:
-			return Error(domainErrorOrder(order))
+			return Error(domainErrorOrder(order, env))
 		}
 	default:
-		return Error(typeErrorAtom(order))
+		return Error(typeErrorAtom(order, env))
 	}
 
 	d := term1.Compare(term2, env)
@@ -720,16 +1138,16 @@ func (state *State) CurrentPredicate(pi Term, k func(*Env) *Promise, env *Env) *
 		break
 	case *Compound:
 		if pi.Functor != "/" || len(pi.Args) != 2 {
-			return Error(typeErrorPredicateIndicator(pi))
+			return Error(typeErrorPredicateIndicator(pi, env))
 		}
 		if _, ok := env.Resolve(pi.Args[0]).(Atom); !ok {
-			return Error(typeErrorPredicateIndicator(pi))
+			return Error(typeErrorPredicateIndicator(pi, env))
 		}
 		if _, ok := env.Resolve(pi.Args[1]).(Integer); !ok {
-			return Error(typeErrorPredicateIndicator(pi))
+			return Error(typeErrorPredicateIndicator(pi, env))
 		}
 	default:
-		return Error(typeErrorPredicateIndicator(pi))
+		return Error(typeErrorPredicateIndicator(pi, env))
 	}
 
 	ks := make([]func(context.Context) *Promise, 0, len(state.procedures))
@@ -764,7 +1182,7 @@ func (state *State) Retract(t Term, k func(*Env) *Promise, env *Env) *Promise {
 
 	cs, ok := p.(clauses)
 	if !ok {
-		return Error(permissionErrorModifyStaticProcedure(pi.Term()))
+		return Error(permissionErrorModifyStaticProcedure(pi.Term(), env))
 	}
 
 	deleted := 0
@@ -785,6 +1203,39 @@ func (state *State) Retract(t Term, k func(*Env) *Promise, env *Env) *Promise {
 	return Delay(ks...)
 }
 
+// Erase removes the clause or the recorded term referred by ref from the database. It fails if it's already removed.
+func (state *State) Erase(ref Term, k func(*Env) *Promise, env *Env) *Promise {
+	switch r := env.Resolve(ref).(type) {
+	case Variable:
+		return Error(InstantiationError(ref))
+	case *RecordRef:
+		for i, e := range state.records {
+			if e != r {
+				continue
+			}
+			state.records = append(state.records[:i:i], state.records[i+1:]...)
+			return k(env)
+		}
+		return Bool(false)
+	case *ClauseRef:
+		cs, ok := state.procedures[r.pi].(clauses)
+		if !ok {
+			return Bool(false)
+		}
+
+		for i, c := range cs {
+			if c.ref != r {
+				continue
+			}
+			state.procedures[r.pi] = append(cs[:i:i], cs[i+1:]...)
+			return k(env)
+		}
+		return Bool(false)
+	default:
+		return Error(typeErrorDBReference(ref, env))
+	}
+}
+
 // Abolish removes the procedure indicated by pi from the database.
 func (state *State) Abolish(pi Term, k func(*Env) *Promise, env *Env) *Promise {
 	switch pi := env.Resolve(pi).(type) {
@@ -792,7 +1243,7 @@ func (state *State) Abolish(pi Term, k func(*Env) *Promise, env *Env) *Promise {
 		return Error(InstantiationError(pi))
 	case *Compound:
 		if pi.Functor != "/" || len(pi.Args) != 2 {
-			return Error(typeErrorPredicateIndicator(pi))
+			return Error(typeErrorPredicateIndicator(pi, env))
 		}
 
 		name, arity := pi.Args[0], pi.Args[1]
@@ -806,35 +1257,45 @@ func (state *State) Abolish(pi Term, k func(*Env) *Promise, env *Env) *Promise {
 				return Error(InstantiationError(arity))
 			case Integer:
 				if arity < 0 {
-					return Error(domainErrorNotLessThanZero(arity))
+					return Error(domainErrorNotLessThanZero(arity, env))
 				}
 				key := ProcedureIndicator{Name: name, Arity: arity}
 				if _, ok := state.procedures[key].(clauses); !ok {
 					return Error(permissionErrorModifyStaticProcedure(&Compound{
 						Functor: "/",
 						Args:    []Term{name, arity},
-					}))
+					}, env))
 				}
 				delete(state.procedures, key)
 				return k(env)
 			default:
-				return Error(typeErrorInteger(arity))
+				return Error(typeErrorInteger(arity, env))
 			}
 		default:
-			return Error(typeErrorAtom(name))
+			return Error(typeErrorAtom(name, env))
 		}
 	default:
-		return Error(typeErrorPredicateIndicator(pi))
+		return Error(typeErrorPredicateIndicator(pi, env))
 	}
 }
 
-// CurrentInput unifies stream with the current input stream.
+// CurrentInput unifies stream with the current input stream. If stream is an alias, it succeeds if the alias refers to
+// the current input stream.
 func (state *State) CurrentInput(stream Term, k func(*Env) *Promise, env *Env) *Promise {
-	switch env.Resolve(stream).(type) {
+	switch s := env.Resolve(stream).(type) {
 	case Variable, *Stream:
 		break
+	case Atom:
+		v, ok := state.streams[s]
+		if !ok {
+			return Error(domainErrorStream(stream, env))
+		}
+		if v != state.input {
+			return Bool(false)
+		}
+		return k(env)
 	default:
-		return Error(domainErrorStream(stream))
+		return Error(domainErrorStream(stream, env))
 	}
 
 	return Delay(func(context.Context) *Promise {
@@ -842,13 +1303,23 @@ func (state *State) CurrentInput(stream Term, k func(*Env) *Promise, env *Env) *
 	})
 }
 
-// CurrentOutput unifies stream with the current output stream.
+// CurrentOutput unifies stream with the current output stream. If stream is an alias, it succeeds if the alias refers to
+// the current output stream.
 func (state *State) CurrentOutput(stream Term, k func(*Env) *Promise, env *Env) *Promise {
-	switch env.Resolve(stream).(type) {
+	switch s := env.Resolve(stream).(type) {
 	case Variable, *Stream:
 		break
+	case Atom:
+		v, ok := state.streams[s]
+		if !ok {
+			return Error(domainErrorStream(stream, env))
+		}
+		if v != state.output {
+			return Bool(false)
+		}
+		return k(env)
 	default:
-		return Error(domainErrorStream(stream))
+		return Error(domainErrorStream(stream, env))
 	}
 
 	return Delay(func(context.Context) *Promise {
@@ -864,7 +1335,7 @@ func (state *State) SetInput(streamOrAlias Term, k func(*Env) *Promise, env *Env
 	}
 
 	if s.mode != StreamModeRead {
-		return Error(permissionErrorInputStream(streamOrAlias))
+		return Error(permissionErrorInputStream(streamOrAlias, env))
 	}
 
 	state.input = s
@@ -879,7 +1350,7 @@ func (state *State) SetOutput(streamOrAlias Term, k func(*Env) *Promise, env *En
 	}
 
 	if s.mode != StreamModeWrite && s.mode != StreamModeAppend {
-		return Error(permissionErrorOutputStream(streamOrAlias))
+		return Error(permissionErrorOutputStream(streamOrAlias, env))
 	}
 
 	state.output = s
@@ -895,7 +1366,7 @@ func (state *State) Open(SourceSink, mode, stream, options Term, k func(*Env) *P
 	case Atom:
 		n = s
 	default:
-		return Error(domainErrorSourceSink(SourceSink))
+		return Error(domainErrorSourceSink(SourceSink, env))
 	}
 
 	var streamMode StreamMode
@@ -910,14 +1381,14 @@ func (state *State) Open(SourceSink, mode, stream, options Term, k func(*Env) *P
 			"append": StreamModeAppend,
 		}[m]
 		if !ok {
-			return Error(domainErrorIOMode(m))
+			return Error(domainErrorIOMode(m, env))
 		}
 	default:
-		return Error(typeErrorAtom(mode))
+		return Error(typeErrorAtom(mode, env))
 	}
 
 	if _, ok := env.Resolve(stream).(Variable); !ok {
-		return Error(typeErrorVariable(stream))
+		return Error(typeErrorVariable(stream, env))
 	}
 
 	var opts []StreamOption
@@ -955,7 +1426,7 @@ func streamOption(state *State, option Term, env *Env) (StreamOption, error) {
 		return nil, InstantiationError(option)
 	case *Compound:
 		if len(o.Args) != 1 {
-			return nil, domainErrorStreamOption(option)
+			return nil, domainErrorStreamOption(option, env)
 		}
 		switch a := env.Resolve(o.Args[0]).(type) {
 		case Variable:
@@ -966,10 +1437,10 @@ func streamOption(state *State, option Term, env *Env) (StreamOption, error) {
 				arg:     a,
 			}
 		default:
-			return nil, typeErrorAtom(a)
+			return nil, typeErrorAtom(a, env)
 		}
 	default:
-		return nil, domainErrorStreamOption(option)
+		return nil, domainErrorStreamOption(option, env)
 	}
 
 	// alias is a bit different.
@@ -996,8 +1467,14 @@ func streamOption(state *State, option Term, env *Env) (StreamOption, error) {
 		return WithEOFAction(EOFActionEOFCode), nil
 	case optionIndicator{functor: "eof_action", arg: "reset"}:
 		return WithEOFAction(EOFActionReset), nil
+	case optionIndicator{functor: "buffer", arg: "full"}:
+		return WithBuffer(StreamBufferFull), nil
+	case optionIndicator{functor: "buffer", arg: "line"}:
+		return WithBuffer(StreamBufferLine), nil
+	case optionIndicator{functor: "buffer", arg: "false"}:
+		return WithBuffer(StreamBufferFalse), nil
 	default:
-		return nil, domainErrorStreamOption(option)
+		return nil, domainErrorStreamOption(option, env)
 	}
 }
 
@@ -1017,7 +1494,7 @@ func (state *State) Close(streamOrAlias, options Term, k func(*Env) *Promise, en
 			switch option.Functor {
 			case "force":
 				if len(option.Args) != 1 {
-					return domainErrorStreamOption(option)
+					return domainErrorStreamOption(option, env)
 				}
 
 				switch v := env.Resolve(option.Args[0]).(type) {
@@ -1030,15 +1507,15 @@ func (state *State) Close(streamOrAlias, options Term, k func(*Env) *Promise, en
 					case "true":
 						force = true
 					default:
-						return domainErrorStreamOption(option)
+						return domainErrorStreamOption(option, env)
 					}
 				default:
-					return domainErrorStreamOption(option)
+					return domainErrorStreamOption(option, env)
 				}
 			}
 			return nil
 		default:
-			return domainErrorStreamOption(option)
+			return domainErrorStreamOption(option, env)
 		}
 	}, env); err != nil {
 		return Error(err)
@@ -1067,7 +1544,11 @@ func (state *State) FlushOutput(streamOrAlias Term, k func(*Env) *Promise, env *
 	}
 
 	if s.mode != StreamModeWrite && s.mode != StreamModeAppend {
-		return Error(permissionErrorOutputStream(streamOrAlias))
+		return Error(permissionErrorOutputStream(streamOrAlias, env))
+	}
+
+	if err := s.flush(); err != nil {
+		return Error(SystemError(err))
 	}
 
 	if f, ok := s.file.(*os.File); ok {
@@ -1087,11 +1568,11 @@ func (state *State) WriteTerm(streamOrAlias, t, options Term, k func(*Env) *Prom
 	}
 
 	if s.mode != StreamModeWrite && s.mode != StreamModeAppend {
-		return Error(permissionErrorOutputStream(streamOrAlias))
+		return Error(permissionErrorOutputStream(streamOrAlias, env))
 	}
 
 	if s.streamType == StreamTypeBinary {
-		return Error(permissionErrorOutputBinaryStream(streamOrAlias))
+		return Error(permissionErrorOutputBinaryStream(streamOrAlias, env))
 	}
 
 	opts := []WriteOption{withOps(state.operators), WithPriority(1200)}
@@ -1103,7 +1584,7 @@ func (state *State) WriteTerm(streamOrAlias, t, options Term, k func(*Env) *Prom
 		return Error(err)
 	}
 
-	if err := Write(s.file, env.Resolve(t), env, opts...); err != nil {
+	if err := Write(s.writer(), env.Resolve(t), env, opts...); err != nil {
 		return Error(err)
 	}
 
@@ -1121,7 +1602,12 @@ func writeTermOption(state *State, option Term, env *Env) (WriteOption, error) {
 		return nil, InstantiationError(option)
 	case *Compound:
 		if len(option.Args) != 1 {
-			return nil, domainErrorWriteOption(option)
+			return nil, domainErrorWriteOption(option, env)
+		}
+
+		// variable_names takes a list of Name = Var.
+		if option.Functor == "variable_names" {
+			return writeTermVariableNames(option, env)
 		}
 
 		switch v := env.Resolve(option.Args[0]).(type) {
@@ -1130,10 +1616,18 @@ func writeTermOption(state *State, option Term, env *Env) (WriteOption, error) {
 		case Atom:
 			oi = optionIndicator{functor: option.Functor, arg: v}
 		default:
-			return nil, domainErrorWriteOption(option)
+			return nil, domainErrorWriteOption(option, env)
 		}
 	default:
-		return nil, domainErrorWriteOption(option)
+		return nil, domainErrorWriteOption(option, env)
+	}
+
+	// float_format takes an arbitrary atom.
+	if oi.functor == "float_format" {
+		if _, err := strconv.ParseFloat(formatFloat(0, string(oi.arg)), 64); err != nil {
+			return nil, domainErrorWriteOption(option, env)
+		}
+		return WithFloatFormat(string(oi.arg)), nil
 	}
 
 	switch oi {
@@ -1149,16 +1643,498 @@ func writeTermOption(state *State, option Term, env *Env) (WriteOption, error) {
 		return WithNumberVars(true), nil
 	case optionIndicator{functor: "numbervars", arg: "false"}:
 		return WithNumberVars(false), nil
+	case optionIndicator{functor: "fullstop", arg: "true"}:
+		return WithFullStop(true), nil
+	case optionIndicator{functor: "fullstop", arg: "false"}:
+		return WithFullStop(false), nil
 	default:
-		return nil, domainErrorWriteOption(option)
+		return nil, domainErrorWriteOption(option, env)
 	}
 }
 
-// CharCode converts a single-rune Atom char to an Integer code, or vice versa.
-func CharCode(char, code Term, k func(*Env) *Promise, env *Env) *Promise {
-	switch ch := env.Resolve(char).(type) {
-	case Variable:
-		switch cd := env.Resolve(code).(type) {
+func writeTermVariableNames(option *Compound, env *Env) (WriteOption, error) {
+	names := map[Variable]Atom{}
+	if err := EachList(env.Resolve(option.Args[0]), func(elem Term) error {
+		switch e := env.Resolve(elem).(type) {
+		case Variable:
+			return InstantiationError(elem)
+		case *Compound:
+			if e.Functor != "=" || len(e.Args) != 2 {
+				return domainErrorWriteOption(option, env)
+			}
+			var name Atom
+			switch n := env.Resolve(e.Args[0]).(type) {
+			case Variable:
+				return InstantiationError(e.Args[0])
+			case Atom:
+				name = n
+			default:
+				return domainErrorWriteOption(option, env)
+			}
+			if v, ok := env.Resolve(e.Args[1]).(Variable); ok {
+				if _, ok := names[v]; !ok {
+					names[v] = name
+				}
+			}
+			return nil
+		default:
+			return domainErrorWriteOption(option, env)
+		}
+	}, env); err != nil {
+		return nil, err
+	}
+	return WithVariableNames(names), nil
+}
+
+// WriteToCodes unifies codes with the list of character codes of term as written by write/1.
+func (state *State) WriteToCodes(term, codes Term, k func(*Env) *Promise, env *Env) *Promise {
+	out, err := state.writeToString(term, env)
+	if err != nil {
+		return Error(err)
+	}
+	return Unify(codes, codeList(out), k, env)
+}
+
+// WriteToChars unifies chars with the list of characters of term as written by write/1.
+func (state *State) WriteToChars(term, chars Term, k func(*Env) *Promise, env *Env) *Promise {
+	out, err := state.writeToString(term, env)
+	if err != nil {
+		return Error(err)
+	}
+	return Unify(chars, charList(out), k, env)
+}
+
+func (state *State) writeToString(term Term, env *Env) (string, error) {
+	var sb strings.Builder
+	if err := Write(&sb, term, env, withOps(state.operators), WithPriority(1200), WithNumberVars(true)); err != nil {
+		return "", err
+	}
+	return sb.String(), nil
+}
+
+func codeList(s string) Term {
+	rs := []rune(s)
+	cs := make([]Term, len(rs))
+	for i, r := range rs {
+		cs[i] = Integer(r)
+	}
+	return List(cs...)
+}
+
+func charList(s string) Term {
+	rs := []rune(s)
+	cs := make([]Term, len(rs))
+	for i, r := range rs {
+		cs[i] = Atom(r)
+	}
+	return List(cs...)
+}
+
+// Format outputs args according to format to sink which is either a stream, an alias, atom(A), codes(Cs), or chars(Cs).
+// args is either a list of arguments or a single argument which is not a list.
+func (state *State) Format(sink, format, args Term, k func(*Env) *Promise, env *Env) *Promise {
+	f, err := text(format, env)
+	if err != nil {
+		return Error(err)
+	}
+
+	var as []Term
+	switch a := env.Resolve(args).(type) {
+	case Atom:
+		if a != "[]" {
+			as = []Term{a}
+		}
+	case *Compound:
+		if a.Functor != "." || len(a.Args) != 2 {
+			as = []Term{a}
+			break
+		}
+		if err := EachList(a, func(elem Term) error {
+			as = append(as, elem)
+			return nil
+		}, env); err != nil {
+			return Error(err)
+		}
+	default:
+		as = []Term{a}
+	}
+
+	fm := formatter{state: state, args: as, env: env}
+	if err := fm.format(f); err != nil {
+		return Error(err)
+	}
+	out := string(fm.buf)
+
+	if s, ok := env.Resolve(sink).(*Compound); ok && len(s.Args) == 1 {
+		switch s.Functor {
+		case "atom":
+			return Unify(s.Args[0], Atom(out), k, env)
+		case "codes":
+			return Unify(s.Args[0], codeList(out), k, env)
+		case "chars":
+			return Unify(s.Args[0], charList(out), k, env)
+		}
+	}
+
+	s, err := state.stream(sink, env)
+	if err != nil {
+		return Error(err)
+	}
+
+	if s.mode != StreamModeWrite && s.mode != StreamModeAppend {
+		return Error(permissionErrorOutputStream(sink, env))
+	}
+
+	if s.streamType == StreamTypeBinary {
+		return Error(permissionErrorOutputBinaryStream(sink, env))
+	}
+
+	if _, err := write(s.writer(), []byte(out)); err != nil {
+		return Error(SystemError(err))
+	}
+
+	return k(env)
+}
+
+// text returns the text represented by either an atom, a list of codes, or a list of characters.
+func text(t Term, env *Env) (string, error) {
+	switch t := env.Resolve(t).(type) {
+	case Variable:
+		return "", InstantiationError(t)
+	case Atom:
+		if t == "[]" {
+			return "", nil
+		}
+		return string(t), nil
+	case *Compound:
+		var sb strings.Builder
+		if err := EachList(t, func(elem Term) error {
+			switch e := env.Resolve(elem).(type) {
+			case Variable:
+				return InstantiationError(elem)
+			case Integer:
+				_, _ = sb.WriteRune(rune(e))
+				return nil
+			case Atom:
+				rs := []rune(e)
+				if len(rs) != 1 {
+					return typeErrorCharacter(e, env)
+				}
+				_, _ = sb.WriteRune(rs[0])
+				return nil
+			default:
+				return representationError(Atom("character_code"), Atom("invalid character code."))
+			}
+		}, env); err != nil {
+			return "", err
+		}
+		return sb.String(), nil
+	default:
+		return "", typeErrorAtom(t, env)
+	}
+}
+
+// formatter interprets directives of format/3.
+type formatter struct {
+	state *State
+	args  []Term
+	env   *Env
+
+	buf []rune
+
+	// the beginning of the current column and the fill points in it.
+	stop  int
+	fills []formatFill
+}
+
+type formatFill struct {
+	pos  int
+	char rune
+}
+
+func (f *formatter) format(format string) error {
+	rs := []rune(format)
+	for i := 0; i < len(rs); i++ {
+		if rs[i] != '~' {
+			f.buf = append(f.buf, rs[i])
+			continue
+		}
+
+		i++
+		if i == len(rs) {
+			return formatError("truncated format specification")
+		}
+
+		// numeric argument
+		n, ok := -1, false
+		switch {
+		case rs[i] == '*':
+			a, err := f.arg()
+			if err != nil {
+				return err
+			}
+			m, isInt := f.env.Resolve(a).(Integer)
+			if !isInt || m < 0 {
+				return formatError("no or negative integer for `*' argument")
+			}
+			n, ok = int(m), true
+			i++
+		case rs[i] == '`':
+			if i+2 >= len(rs) {
+				return formatError("truncated format specification")
+			}
+			n, ok = int(rs[i+1]), true
+			i += 2
+		default:
+			for ; i < len(rs) && '0' <= rs[i] && rs[i] <= '9'; i++ {
+				if !ok {
+					n, ok = 0, true
+				}
+				n = n*10 + int(rs[i]-'0')
+			}
+		}
+		if i == len(rs) {
+			return formatError("truncated format specification")
+		}
+
+		if err := f.directive(rs[i], n, ok); err != nil {
+			return err
+		}
+	}
+
+	if len(f.args) > 0 {
+		return formatError("too many arguments")
+	}
+	return nil
+}
+
+func (f *formatter) arg() (Term, error) {
+	if len(f.args) == 0 {
+		return nil, formatError("not enough arguments")
+	}
+	var a Term
+	a, f.args = f.args[0], f.args[1:]
+	return a, nil
+}
+
+func (f *formatter) directive(d rune, n int, ok bool) error {
+	switch d {
+	case '~':
+		f.buf = append(f.buf, '~')
+		return nil
+	case 'n':
+		if !ok {
+			n = 1
+		}
+		for j := 0; j < n; j++ {
+			f.buf = append(f.buf, '\n')
+		}
+		f.stop, f.fills = len(f.buf), nil
+		return nil
+	case 't':
+		c := ' '
+		if ok {
+			c = rune(n)
+		}
+		f.fills = append(f.fills, formatFill{pos: len(f.buf), char: c})
+		return nil
+	case '|':
+		if !ok {
+			n = f.column()
+		}
+		f.columnStop(n)
+		return nil
+	case '+':
+		if !ok {
+			n = 8
+		}
+		f.columnStop(f.columnAt(f.stop) + n)
+		return nil
+	}
+
+	if !strings.ContainsRune("wpqaicdDrRefgs", d) {
+		return formatError(fmt.Sprintf("unknown directive ~%c", d))
+	}
+
+	a, err := f.arg()
+	if err != nil {
+		return err
+	}
+
+	switch d {
+	case 'w':
+		return f.write(a, WithNumberVars(true))
+	case 'p', 'q':
+		return f.write(a, WithQuoted(true), WithNumberVars(true))
+	case 'a':
+		switch a := f.env.Resolve(a).(type) {
+		case Variable:
+			return InstantiationError(a)
+		case *Compound:
+			return typeErrorAtomic(a, f.env)
+		default:
+			return f.write(a)
+		}
+	case 'i':
+		return nil
+	case 'c':
+		c, err := f.integer(a)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			n = 1
+		}
+		for j := 0; j < n; j++ {
+			f.buf = append(f.buf, rune(c))
+		}
+		return nil
+	case 'd', 'D':
+		i, err := f.integer(a)
+		if err != nil {
+			return err
+		}
+		f.buf = append(f.buf, []rune(formatInteger(int64(i), n, d == 'D'))...)
+		return nil
+	case 'r', 'R':
+		i, err := f.integer(a)
+		if err != nil {
+			return err
+		}
+		if !ok || n < 2 || n > 36 {
+			return formatError("radix must be between 2 and 36")
+		}
+		s := strconv.FormatInt(int64(i), n)
+		if d == 'R' {
+			s = strings.ToUpper(s)
+		}
+		f.buf = append(f.buf, []rune(s)...)
+		return nil
+	case 'e', 'f', 'g':
+		var x float64
+		switch a := f.env.Resolve(a).(type) {
+		case Variable:
+			return InstantiationError(a)
+		case Integer:
+			x = float64(a)
+		case Float:
+			x = float64(a)
+		default:
+			return typeErrorNumber(a, f.env)
+		}
+		if !ok {
+			n = 6
+		}
+		f.buf = append(f.buf, []rune(strconv.FormatFloat(x, byte(d), n, 64))...)
+		return nil
+	default: // s
+		s, err := text(a, f.env)
+		if err != nil {
+			return err
+		}
+		f.buf = append(f.buf, []rune(s)...)
+		return nil
+	}
+}
+
+func (f *formatter) write(t Term, opts ...WriteOption) error {
+	var sb strings.Builder
+	if err := Write(&sb, t, f.env, append([]WriteOption{withOps(f.state.operators), WithPriority(1200)}, opts...)...); err != nil {
+		return err
+	}
+	f.buf = append(f.buf, []rune(sb.String())...)
+	return nil
+}
+
+func (f *formatter) integer(t Term) (Integer, error) {
+	switch i := f.env.Resolve(t).(type) {
+	case Variable:
+		return 0, InstantiationError(t)
+	case Integer:
+		return i, nil
+	default:
+		return 0, typeErrorInteger(t, f.env)
+	}
+}
+
+// column returns the current column.
+func (f *formatter) column() int {
+	return f.columnAt(len(f.buf))
+}
+
+// columnAt returns the column at pos.
+func (f *formatter) columnAt(pos int) int {
+	for i := pos - 1; i >= 0; i-- {
+		if f.buf[i] == '\n' {
+			return pos - i - 1
+		}
+	}
+	return pos
+}
+
+// columnStop pads the current column to reach col at the fill points. If there's no fill point, it pads at the end.
+func (f *formatter) columnStop(col int) {
+	if pad := col - f.column(); pad > 0 {
+		fills := f.fills
+		if len(fills) == 0 {
+			fills = []formatFill{{pos: len(f.buf), char: ' '}}
+		}
+
+		buf := make([]rune, 0, len(f.buf)+pad)
+		buf = append(buf, f.buf[:f.stop]...)
+		last := f.stop
+		for i, fl := range fills {
+			buf = append(buf, f.buf[last:fl.pos]...)
+			w := pad / len(fills)
+			if i < pad%len(fills) {
+				w++
+			}
+			for j := 0; j < w; j++ {
+				buf = append(buf, fl.char)
+			}
+			last = fl.pos
+		}
+		f.buf = append(buf, f.buf[last:]...)
+	}
+	f.stop, f.fills = len(f.buf), nil
+}
+
+// formatInteger formats i with a decimal point inserted n digits from the right if n > 0.
+// If group is true, the integer part is grouped by three digits with commas.
+func formatInteger(i int64, n int, group bool) string {
+	s := strconv.FormatInt(i, 10)
+	var sign string
+	if s[0] == '-' {
+		sign, s = "-", s[1:]
+	}
+
+	var frac string
+	if n > 0 {
+		if len(s) <= n {
+			s = strings.Repeat("0", n-len(s)+1) + s
+		}
+		s, frac = s[:len(s)-n], "."+s[len(s)-n:]
+	}
+
+	if group {
+		var sb strings.Builder
+		for i, r := range s {
+			if i > 0 && (len(s)-i)%3 == 0 {
+				_, _ = sb.WriteRune(',')
+			}
+			_, _ = sb.WriteRune(r)
+		}
+		s = sb.String()
+	}
+
+	return sign + s + frac
+}
+
+// CharCode converts a single-rune Atom char to an Integer code, or vice versa.
+func CharCode(char, code Term, k func(*Env) *Promise, env *Env) *Promise {
+	switch ch := env.Resolve(char).(type) {
+	case Variable:
+		switch cd := env.Resolve(code).(type) {
 		case Variable:
 			return Error(InstantiationError(&Compound{
 				Functor: ",",
@@ -1175,26 +2151,26 @@ func CharCode(char, code Term, k func(*Env) *Promise, env *Env) *Promise {
 				return Unify(ch, Atom(r), k, env)
 			})
 		default:
-			return Error(typeErrorInteger(code))
+			return Error(typeErrorInteger(code, env))
 		}
 	case Atom:
 		switch code := env.Resolve(code).(type) {
 		case Variable, Integer:
 			break
 		default:
-			return Error(typeErrorInteger(code))
+			return Error(typeErrorInteger(code, env))
 		}
 
 		rs := []rune(ch)
 		if len(rs) != 1 {
-			return Error(typeErrorCharacter(ch))
+			return Error(typeErrorCharacter(ch, env))
 		}
 
 		return Delay(func(context.Context) *Promise {
 			return Unify(code, Integer(rs[0]), k, env)
 		})
 	default:
-		return Error(typeErrorCharacter(ch))
+		return Error(typeErrorCharacter(ch, env))
 	}
 }
 
@@ -1208,11 +2184,11 @@ func (state *State) PutByte(streamOrAlias, byt Term, k func(*Env) *Promise, env
 	}
 
 	if s.mode != StreamModeWrite && s.mode != StreamModeAppend {
-		return Error(permissionErrorOutputStream(streamOrAlias))
+		return Error(permissionErrorOutputStream(streamOrAlias, env))
 	}
 
 	if s.streamType == StreamTypeText {
-		return Error(permissionErrorOutputTextStream(streamOrAlias))
+		return Error(permissionErrorOutputTextStream(streamOrAlias, env))
 	}
 
 	switch b := env.Resolve(byt).(type) {
@@ -1220,16 +2196,16 @@ func (state *State) PutByte(streamOrAlias, byt Term, k func(*Env) *Promise, env
 		return Error(InstantiationError(byt))
 	case Integer:
 		if 0 > b || 255 < b {
-			return Error(typeErrorByte(byt))
+			return Error(typeErrorByte(byt, env))
 		}
 
-		if _, err := write(s.file, []byte{byte(b)}); err != nil {
+		if _, err := write(s.writer(), []byte{byte(b)}); err != nil {
 			return Error(SystemError(err))
 		}
 
 		return k(env)
 	default:
-		return Error(typeErrorByte(byt))
+		return Error(typeErrorByte(byt, env))
 	}
 }
 
@@ -1241,11 +2217,11 @@ func (state *State) PutCode(streamOrAlias, code Term, k func(*Env) *Promise, env
 	}
 
 	if s.mode != StreamModeWrite && s.mode != StreamModeAppend {
-		return Error(permissionErrorOutputStream(streamOrAlias))
+		return Error(permissionErrorOutputStream(streamOrAlias, env))
 	}
 
 	if s.streamType == StreamTypeBinary {
-		return Error(permissionErrorOutputBinaryStream(streamOrAlias))
+		return Error(permissionErrorOutputBinaryStream(streamOrAlias, env))
 	}
 
 	switch c := env.Resolve(code).(type) {
@@ -1258,13 +2234,13 @@ func (state *State) PutCode(streamOrAlias, code Term, k func(*Env) *Promise, env
 			return Error(representationError(Atom("character_code"), Atom(fmt.Sprintf("%s is not a valid unicode code point.", c))))
 		}
 
-		if _, err := write(s.file, []byte(string(r))); err != nil {
+		if _, err := write(s.writer(), []byte(string(r))); err != nil {
 			return Error(SystemError(err))
 		}
 
 		return k(env)
 	default:
-		return Error(typeErrorInteger(code))
+		return Error(typeErrorInteger(code, env))
 	}
 }
 
@@ -1272,9 +2248,12 @@ type readTermOptions struct {
 	singletons    Term
 	variables     Term
 	variableNames Term
+	operators     Term
+	termPosition  Term
 }
 
 // ReadTerm reads from the stream represented by streamOrAlias and unifies with stream.
+// The option term_position/1 reports the position of the term in character offsets from where reading started.
 func (state *State) ReadTerm(streamOrAlias, out, options Term, k func(*Env) *Promise, env *Env) *Promise {
 	s, err := state.stream(streamOrAlias, env)
 	if err != nil {
@@ -1282,11 +2261,11 @@ func (state *State) ReadTerm(streamOrAlias, out, options Term, k func(*Env) *Pro
 	}
 
 	if s.mode != StreamModeRead {
-		return Error(permissionErrorInputStream(streamOrAlias))
+		return Error(permissionErrorInputStream(streamOrAlias, env))
 	}
 
 	if s.streamType == StreamTypeBinary {
-		return Error(permissionErrorInputBinaryStream(streamOrAlias))
+		return Error(permissionErrorInputBinaryStream(streamOrAlias, env))
 	}
 
 	opts := readTermOptions{
@@ -1302,30 +2281,39 @@ func (state *State) ReadTerm(streamOrAlias, out, options Term, k func(*Env) *Pro
 
 	var vars []ParsedVariable
 	p := state.Parser(s.buf, &vars)
+	if opts.operators != nil {
+		ops, err := readTermOperators(opts.operators, env)
+		if err != nil {
+			return Error(err)
+		}
+		withOperators(&ops)(p)
+	}
+	if opts.termPosition != nil {
+		withPositions(true)(p)
+	}
 
 	t, err := p.Term()
 	if err != nil {
 		var (
 			unexpectedRune  *UnexpectedRuneError
 			unexpectedToken *unexpectedTokenError
+			exception       *Exception
 		)
 		switch {
 		case errors.Is(err, io.EOF):
-			return [...]*Promise{
-				EOFActionError: Error(permissionErrorInputPastEndOfStream(streamOrAlias)),
-				EOFActionEOFCode: Delay(func(context.Context) *Promise {
-					return Unify(out, Atom("end_of_file"), k, env)
-				}),
-				EOFActionReset: Delay(func(context.Context) *Promise {
-					return state.ReadTerm(streamOrAlias, out, options, k, env)
-				}),
-			}[s.eofAction]
+			return state.endOfStream(s, streamOrAlias, true, func(context.Context) *Promise {
+				return Unify(out, Atom("end_of_file"), k, env)
+			}, func(context.Context) *Promise {
+				return state.ReadTerm(streamOrAlias, out, options, k, env)
+			}, env)
 		case errors.Is(err, ErrInsufficient):
 			return Error(syntaxErrorInsufficient())
 		case errors.As(err, &unexpectedRune):
 			return Error(syntaxErrorUnexpectedChar(Atom(err.Error())))
 		case errors.As(err, &unexpectedToken):
 			return Error(syntaxErrorUnexpectedToken(Atom(err.Error())))
+		case errors.As(err, &exception):
+			return Error(exception)
 		default:
 			return Error(SystemError(err))
 		}
@@ -1333,7 +2321,8 @@ func (state *State) ReadTerm(streamOrAlias, out, options Term, k func(*Env) *Pro
 
 	var singletons, variables, variableNames []Term
 	for _, v := range vars {
-		if v.Count == 1 {
+		// Variables starting with _ are not reported as singletons since they are meant to appear once.
+		if v.Count == 1 && !strings.HasPrefix(string(v.Name), "_") {
 			singletons = append(singletons, v.Variable)
 		}
 		variables = append(variables, v.Variable)
@@ -1343,15 +2332,20 @@ func (state *State) ReadTerm(streamOrAlias, out, options Term, k func(*Env) *Pro
 		})
 	}
 
-	env, ok := (&Compound{Args: []Term{
+	lhs, rhs := []Term{
 		opts.singletons,
 		opts.variables,
 		opts.variableNames,
-	}}).Unify(&Compound{Args: []Term{
+	}, []Term{
 		List(singletons...),
 		List(variables...),
 		List(variableNames...),
-	}}, false, env)
+	}
+	if opts.termPosition != nil {
+		lhs, rhs = append(lhs, opts.termPosition), append(rhs, p.pos.term())
+	}
+
+	env, ok := (&Compound{Args: lhs}).Unify(&Compound{Args: rhs}, false, env)
 	if !ok {
 		return Bool(false)
 	}
@@ -1367,7 +2361,7 @@ func readTermOption(opts *readTermOptions, option Term, env *Env) error {
 		return InstantiationError(option)
 	case *Compound:
 		if len(option.Args) != 1 {
-			return domainErrorReadOption(option)
+			return domainErrorReadOption(option, env)
 		}
 
 		v := env.Resolve(option.Args[0])
@@ -1378,18 +2372,40 @@ func readTermOption(opts *readTermOptions, option Term, env *Env) error {
 			opts.variables = v
 		case "variable_names":
 			opts.variableNames = v
+		case "operators":
+			opts.operators = v
+		case "term_position":
+			opts.termPosition = v
 		default:
-			return domainErrorReadOption(option)
+			return domainErrorReadOption(option, env)
 		}
 		return nil
 	default:
-		return domainErrorReadOption(option)
+		return domainErrorReadOption(option, env)
 	}
 }
 
+// readTermOperators builds an operator table from a list of op(Priority, Specifier, Operator) which read_term/3
+// uses instead of the global one.
+func readTermOperators(list Term, env *Env) (operators, error) {
+	var s State
+	if err := EachList(list, func(op Term) error {
+		c, ok := env.Resolve(op).(*Compound)
+		if !ok || c.Functor != "op" || len(c.Args) != 3 {
+			return domainErrorReadOption(&Compound{Functor: "operators", Args: []Term{list}}, env)
+		}
+		_, err := s.Op(c.Args[0], c.Args[1], c.Args[2], Success, env).Force(context.Background())
+		return err
+	}, env); err != nil {
+		return nil, err
+	}
+	return s.operators, nil
+}
+
 var readByte = (*bufio.Reader).ReadByte
 
 // GetByte reads a byte from the stream represented by streamOrAlias and unifies it with inByte.
+// At the end of the stream, inByte is -1.
 func (state *State) GetByte(streamOrAlias, inByte Term, k func(*Env) *Promise, env *Env) *Promise {
 	s, err := state.stream(streamOrAlias, env)
 	if err != nil {
@@ -1397,11 +2413,11 @@ func (state *State) GetByte(streamOrAlias, inByte Term, k func(*Env) *Promise, e
 	}
 
 	if s.mode != StreamModeRead {
-		return Error(permissionErrorInputStream(streamOrAlias))
+		return Error(permissionErrorInputStream(streamOrAlias, env))
 	}
 
 	if s.streamType == StreamTypeText {
-		return Error(permissionErrorInputTextStream(streamOrAlias))
+		return Error(permissionErrorInputTextStream(streamOrAlias, env))
 	}
 
 	switch b := env.Resolve(inByte).(type) {
@@ -1409,10 +2425,10 @@ func (state *State) GetByte(streamOrAlias, inByte Term, k func(*Env) *Promise, e
 		break
 	case Integer:
 		if b < 0 || b > 255 {
-			Error(typeErrorInByte(inByte))
+			Error(typeErrorInByte(inByte, env))
 		}
 	default:
-		return Error(typeErrorInByte(inByte))
+		return Error(typeErrorInByte(inByte, env))
 	}
 
 	b, err := readByte(s.buf)
@@ -1422,20 +2438,11 @@ func (state *State) GetByte(streamOrAlias, inByte Term, k func(*Env) *Promise, e
 			return Unify(inByte, Integer(b), k, env)
 		})
 	case io.EOF:
-		switch s.eofAction {
-		case EOFActionError:
-			return Error(permissionErrorInputPastEndOfStream(streamOrAlias))
-		case EOFActionEOFCode:
-			return Delay(func(context.Context) *Promise {
-				return Unify(inByte, Integer(-1), k, env)
-			})
-		case EOFActionReset:
-			return Delay(func(context.Context) *Promise {
-				return state.GetByte(streamOrAlias, inByte, k, env)
-			})
-		default:
-			return Error(SystemError(fmt.Errorf("unknown EOF action: %d", s.eofAction)))
-		}
+		return state.endOfStream(s, streamOrAlias, true, func(context.Context) *Promise {
+			return Unify(inByte, Integer(-1), k, env)
+		}, func(context.Context) *Promise {
+			return state.GetByte(streamOrAlias, inByte, k, env)
+		}, env)
 	default:
 		return Error(err)
 	}
@@ -1444,6 +2451,7 @@ func (state *State) GetByte(streamOrAlias, inByte Term, k func(*Env) *Promise, e
 var readRune = (*bufio.Reader).ReadRune
 
 // GetChar reads a character from the stream represented by streamOrAlias and unifies it with char.
+// At the end of the stream, char is end_of_file.
 func (state *State) GetChar(streamOrAlias, char Term, k func(*Env) *Promise, env *Env) *Promise {
 	s, err := state.stream(streamOrAlias, env)
 	if err != nil {
@@ -1451,22 +2459,22 @@ func (state *State) GetChar(streamOrAlias, char Term, k func(*Env) *Promise, env
 	}
 
 	if s.mode != StreamModeRead {
-		return Error(permissionErrorInputStream(streamOrAlias))
+		return Error(permissionErrorInputStream(streamOrAlias, env))
 	}
 
 	if s.streamType == StreamTypeBinary {
-		return Error(permissionErrorInputBinaryStream(streamOrAlias))
+		return Error(permissionErrorInputBinaryStream(streamOrAlias, env))
 	}
 
 	switch c := env.Resolve(char).(type) {
 	case Variable:
 		break
 	case Atom:
-		if len([]rune(c)) != 1 {
-			return Error(typeErrorInCharacter(char))
+		if c != "end_of_file" && len([]rune(c)) != 1 {
+			return Error(typeErrorInCharacter(char, env))
 		}
 	default:
-		return Error(typeErrorInCharacter(char))
+		return Error(typeErrorInCharacter(char, env))
 	}
 
 	r, _, err := readRune(s.buf)
@@ -1480,20 +2488,11 @@ func (state *State) GetChar(streamOrAlias, char Term, k func(*Env) *Promise, env
 			return Unify(char, Atom(r), k, env)
 		})
 	case io.EOF:
-		switch s.eofAction {
-		case EOFActionError:
-			return Error(permissionErrorInputPastEndOfStream(streamOrAlias))
-		case EOFActionEOFCode:
-			return Delay(func(context.Context) *Promise {
-				return Unify(char, Atom("end_of_file"), k, env)
-			})
-		case EOFActionReset:
-			return Delay(func(context.Context) *Promise {
-				return state.GetChar(streamOrAlias, char, k, env)
-			})
-		default:
-			return Error(SystemError(fmt.Errorf("unknown EOF action: %d", s.eofAction)))
-		}
+		return state.endOfStream(s, streamOrAlias, true, func(context.Context) *Promise {
+			return Unify(char, Atom("end_of_file"), k, env)
+		}, func(context.Context) *Promise {
+			return state.GetChar(streamOrAlias, char, k, env)
+		}, env)
 	default:
 		return Error(SystemError(err))
 	}
@@ -1502,6 +2501,7 @@ func (state *State) GetChar(streamOrAlias, char Term, k func(*Env) *Promise, env
 var peek = (*bufio.Reader).Peek
 
 // PeekByte peeks a byte from the stream represented by streamOrAlias and unifies it with inByte.
+// At the end of the stream, inByte is -1.
 func (state *State) PeekByte(streamOrAlias, inByte Term, k func(*Env) *Promise, env *Env) *Promise {
 	s, err := state.stream(streamOrAlias, env)
 	if err != nil {
@@ -1509,11 +2509,11 @@ func (state *State) PeekByte(streamOrAlias, inByte Term, k func(*Env) *Promise,
 	}
 
 	if s.mode != StreamModeRead {
-		return Error(permissionErrorInputStream(streamOrAlias))
+		return Error(permissionErrorInputStream(streamOrAlias, env))
 	}
 
 	if s.streamType == StreamTypeText {
-		return Error(permissionErrorInputTextStream(streamOrAlias))
+		return Error(permissionErrorInputTextStream(streamOrAlias, env))
 	}
 
 	switch b := env.Resolve(inByte).(type) {
@@ -1521,10 +2521,10 @@ func (state *State) PeekByte(streamOrAlias, inByte Term, k func(*Env) *Promise,
 		break
 	case Integer:
 		if b < 0 || b > 255 {
-			return Error(typeErrorInByte(inByte))
+			return Error(typeErrorInByte(inByte, env))
 		}
 	default:
-		return Error(typeErrorInByte(inByte))
+		return Error(typeErrorInByte(inByte, env))
 	}
 
 	b, err := peek(s.buf, 1)
@@ -1534,20 +2534,11 @@ func (state *State) PeekByte(streamOrAlias, inByte Term, k func(*Env) *Promise,
 			return Unify(inByte, Integer(b[0]), k, env)
 		})
 	case io.EOF:
-		switch s.eofAction {
-		case EOFActionError:
-			return Error(permissionErrorInputPastEndOfStream(streamOrAlias))
-		case EOFActionEOFCode:
-			return Delay(func(context.Context) *Promise {
-				return Unify(inByte, Integer(-1), k, env)
-			})
-		case EOFActionReset:
-			return Delay(func(context.Context) *Promise {
-				return state.PeekByte(streamOrAlias, inByte, k, env)
-			})
-		default:
-			return Error(SystemError(fmt.Errorf("unknown EOF action: %d", s.eofAction)))
-		}
+		return state.endOfStream(s, streamOrAlias, false, func(context.Context) *Promise {
+			return Unify(inByte, Integer(-1), k, env)
+		}, func(context.Context) *Promise {
+			return state.PeekByte(streamOrAlias, inByte, k, env)
+		}, env)
 	default:
 		return Error(SystemError(err))
 	}
@@ -1556,6 +2547,7 @@ func (state *State) PeekByte(streamOrAlias, inByte Term, k func(*Env) *Promise,
 var unreadRune = (*bufio.Reader).UnreadRune
 
 // PeekChar peeks a rune from the stream represented by streamOrAlias and unifies it with char.
+// At the end of the stream, char is end_of_file.
 func (state *State) PeekChar(streamOrAlias, char Term, k func(*Env) *Promise, env *Env) *Promise {
 	s, err := state.stream(streamOrAlias, env)
 	if err != nil {
@@ -1563,22 +2555,22 @@ func (state *State) PeekChar(streamOrAlias, char Term, k func(*Env) *Promise, en
 	}
 
 	if s.mode != StreamModeRead {
-		return Error(permissionErrorInputStream(streamOrAlias))
+		return Error(permissionErrorInputStream(streamOrAlias, env))
 	}
 
 	if s.streamType == StreamTypeBinary {
-		return Error(permissionErrorInputBinaryStream(streamOrAlias))
+		return Error(permissionErrorInputBinaryStream(streamOrAlias, env))
 	}
 
 	switch c := env.Resolve(char).(type) {
 	case Variable:
 		break
 	case Atom:
-		if len([]rune(c)) != 1 {
-			return Error(typeErrorInCharacter(char))
+		if c != "end_of_file" && len([]rune(c)) != 1 {
+			return Error(typeErrorInCharacter(char, env))
 		}
 	default:
-		return Error(typeErrorInCharacter(char))
+		return Error(typeErrorInCharacter(char, env))
 	}
 
 	r, _, err := readRune(s.buf)
@@ -1596,25 +2588,40 @@ func (state *State) PeekChar(streamOrAlias, char Term, k func(*Env) *Promise, en
 			return Unify(char, Atom(r), k, env)
 		})
 	case io.EOF:
-		switch s.eofAction {
-		case EOFActionError:
-			return Error(permissionErrorInputPastEndOfStream(streamOrAlias))
-		case EOFActionEOFCode:
-			return Delay(func(context.Context) *Promise {
-				return Unify(char, Atom("end_of_file"), k, env)
-			})
-		case EOFActionReset:
-			return Delay(func(context.Context) *Promise {
-				return state.PeekChar(streamOrAlias, char, k, env)
-			})
-		default:
-			return Error(SystemError(fmt.Errorf("unknown EOF action: %d", s.eofAction)))
-		}
+		return state.endOfStream(s, streamOrAlias, false, func(context.Context) *Promise {
+			return Unify(char, Atom("end_of_file"), k, env)
+		}, func(context.Context) *Promise {
+			return state.PeekChar(streamOrAlias, char, k, env)
+		}, env)
 	default:
 		return Error(SystemError(err))
 	}
 }
 
+// endOfStream handles an input at the end of stream s. The first input results in eof and, unless it's a peek, makes
+// the stream past end of stream. The inputs after that are up to the eof_action of the stream: error raises an error,
+// eof_code results in eof again, and reset tries the input again as the first one.
+func (state *State) endOfStream(s *Stream, streamOrAlias Term, consume bool, eof, retry func(context.Context) *Promise, env *Env) *Promise {
+	if !s.pastEndOfStream {
+		if consume {
+			s.pastEndOfStream = true
+		}
+		return Delay(eof)
+	}
+
+	switch s.eofAction {
+	case EOFActionError:
+		return Error(permissionErrorInputPastEndOfStream(streamOrAlias, env))
+	case EOFActionEOFCode:
+		return Delay(eof)
+	case EOFActionReset:
+		s.pastEndOfStream = false
+		return Delay(retry)
+	default:
+		return Error(SystemError(fmt.Errorf("unknown EOF action: %d", s.eofAction)))
+	}
+}
+
 var osExit = os.Exit
 
 // Halt exits the process with exit code of n.
@@ -1626,7 +2633,7 @@ func Halt(n Term, k func(*Env) *Promise, env *Env) *Promise {
 		osExit(int(code))
 		return k(env)
 	default:
-		return Error(typeErrorInteger(n))
+		return Error(typeErrorInteger(n, env))
 	}
 }
 
@@ -1641,7 +2648,7 @@ func (state *State) Clause(head, body Term, k func(*Env) *Promise, env *Env) *Pr
 	case Variable, Atom, *Compound:
 		break
 	default:
-		return Error(typeErrorCallable(body))
+		return Error(typeErrorCallable(body, env))
 	}
 
 	p, ok := state.procedures[pi]
@@ -1651,7 +2658,7 @@ func (state *State) Clause(head, body Term, k func(*Env) *Promise, env *Env) *Pr
 
 	cs, ok := p.(clauses)
 	if !ok {
-		return Error(permissionErrorAccessPrivateProcedure(pi.Term()))
+		return Error(permissionErrorAccessPrivateProcedure(pi.Term(), env))
 	}
 
 	ks := make([]func(context.Context) *Promise, len(cs))
@@ -1678,17 +2685,17 @@ func AtomLength(atom, length Term, k func(*Env) *Promise, env *Env) *Promise {
 			break
 		case Integer:
 			if l < 0 {
-				return Error(domainErrorNotLessThanZero(length))
+				return Error(domainErrorNotLessThanZero(length, env))
 			}
 		default:
-			return Error(typeErrorInteger(length))
+			return Error(typeErrorInteger(length, env))
 		}
 
 		return Delay(func(context.Context) *Promise {
 			return Unify(length, Integer(len([]rune(a))), k, env)
 		})
 	default:
-		return Error(typeErrorAtom(atom))
+		return Error(typeErrorAtom(atom, env))
 	}
 }
 
@@ -1714,41 +2721,48 @@ func AtomConcat(atom1, atom2, atom3 Term, k func(*Env) *Promise, env *Env) *Prom
 					return Unify(a1+a2, a3, k, env)
 				})
 			default:
-				return Error(typeErrorAtom(atom2))
+				return Error(typeErrorAtom(atom2, env))
 			}
 		default:
-			return Error(typeErrorAtom(atom1))
+			return Error(typeErrorAtom(atom1, env))
 		}
 	case Atom:
 		switch env.Resolve(atom1).(type) {
 		case Variable, Atom:
 			break
 		default:
-			return Error(typeErrorAtom(atom1))
+			return Error(typeErrorAtom(atom1, env))
 		}
 
 		switch env.Resolve(atom2).(type) {
 		case Variable, Atom:
 			break
 		default:
-			return Error(typeErrorAtom(atom2))
+			return Error(typeErrorAtom(atom2, env))
 		}
 
 		pattern := Compound{Args: []Term{atom1, atom2}}
-		ks := make([]func(context.Context) *Promise, 0, len(a3)+1)
-		for i := range a3 {
-			a1, a2 := a3[:i], a3[i:]
-			ks = append(ks, func(context.Context) *Promise {
-				return Unify(&pattern, &Compound{Args: []Term{a1, a2}}, k, env)
-			})
-		}
+		return atomConcatSplit(a3, 0, &pattern, k, env)
+	default:
+		return Error(typeErrorAtom(atom3, env))
+	}
+}
+
+// atomConcatSplit unifies pattern with the split of whole at the byte offset i and, on backtracking, with the splits
+// at the following rune boundaries one by one so that a long atom doesn't result in a lot of choice points at once.
+func atomConcatSplit(whole Atom, i int, pattern *Compound, k func(*Env) *Promise, env *Env) *Promise {
+	ks := []func(context.Context) *Promise{
+		func(context.Context) *Promise {
+			return Unify(pattern, &Compound{Args: []Term{whole[:i], whole[i:]}}, k, env)
+		},
+	}
+	if i < len(whole) {
+		_, size := utf8.DecodeRuneInString(string(whole[i:]))
 		ks = append(ks, func(context.Context) *Promise {
-			return Unify(&pattern, &Compound{Args: []Term{a3, Atom("")}}, k, env)
+			return atomConcatSplit(whole, i+size, pattern, k, env)
 		})
-		return Delay(ks...)
-	default:
-		return Error(typeErrorAtom(atom3))
 	}
+	return Delay(ks...)
 }
 
 // SubAtom unifies subAtom with a sub atom of atom of length which appears with before runes preceding it and after runes following it.
@@ -1775,14 +2789,35 @@ func SubAtom(atom, before, length, after, subAtom Term, k func(*Env) *Promise, e
 		case Variable, Atom:
 			break
 		default:
-			return Error(typeErrorAtom(subAtom))
+			return Error(typeErrorAtom(subAtom, env))
+		}
+
+		// Narrow down the candidates with the arguments already known so that we don't enumerate every sub atom.
+		// The ones longer than the atom have no candidates at all.
+		iMin, iMax := 0, len(rs)
+		if b, ok := env.Resolve(before).(Integer); ok {
+			if b > Integer(len(rs)) {
+				return Bool(false)
+			}
+			iMin, iMax = int(b), int(b)
+		}
+		lMin, lMax := 0, len(rs)
+		if l, ok := env.Resolve(length).(Integer); ok {
+			if l > Integer(len(rs)) {
+				return Bool(false)
+			}
+			lMin, lMax = int(l), int(l)
+		}
+		if s, ok := env.Resolve(subAtom).(Atom); ok {
+			l := len([]rune(s))
+			lMin, lMax = l, l
 		}
 
 		const subAtomPattern = Atom("$sub_atom_pattern")
 		pattern := subAtomPattern.Apply(before, length, after, subAtom)
 		var ks []func(context.Context) *Promise
-		for i := 0; i <= len(rs); i++ {
-			for j := i; j <= len(rs); j++ {
+		for i := iMin; i <= iMax && i <= len(rs); i++ {
+			for j := i + lMin; j <= i+lMax && j <= len(rs); j++ {
 				before, length, after, subAtom := Integer(i), Integer(j-i), Integer(len(rs)-j), Atom(rs[i:j])
 				ks = append(ks, func(context.Context) *Promise {
 					return Unify(pattern, subAtomPattern.Apply(before, length, after, subAtom), k, env)
@@ -1791,7 +2826,7 @@ func SubAtom(atom, before, length, after, subAtom Term, k func(*Env) *Promise, e
 		}
 		return Delay(ks...)
 	default:
-		return Error(typeErrorAtom(atom))
+		return Error(typeErrorAtom(atom, env))
 	}
 }
 
@@ -1801,11 +2836,11 @@ func checkPositiveInteger(n Term, env *Env) error {
 		return nil
 	case Integer:
 		if b < 0 {
-			return domainErrorNotLessThanZero(n)
+			return domainErrorNotLessThanZero(n, env)
 		}
 		return nil
 	default:
-		return typeErrorInteger(n)
+		return typeErrorInteger(n, env)
 	}
 }
 
@@ -1821,14 +2856,14 @@ func AtomChars(atom, chars Term, k func(*Env) *Promise, env *Env) *Promise {
 				return InstantiationError(elem)
 			case Atom:
 				if len([]rune(e)) != 1 {
-					return typeErrorCharacter(e)
+					return typeErrorCharacter(e, env)
 				}
 				if _, err := sb.WriteString(string(e)); err != nil {
 					return SystemError(err)
 				}
 				return nil
 			default:
-				return typeErrorCharacter(e)
+				return typeErrorCharacter(e, env)
 			}
 		}, env); err != nil {
 			return Error(err)
@@ -1846,7 +2881,7 @@ func AtomChars(atom, chars Term, k func(*Env) *Promise, env *Env) *Promise {
 			return Unify(chars, List(cs...), k, env)
 		})
 	default:
-		return Error(typeErrorAtom(a))
+		return Error(typeErrorAtom(a, env))
 	}
 }
 
@@ -1869,21 +2904,127 @@ func AtomCodes(atom, codes Term, k func(*Env) *Promise, env *Env) *Promise {
 		}, env); err != nil {
 			return Error(err)
 		}
-		return Delay(func(context.Context) *Promise {
-			return Unify(atom, Atom(sb.String()), k, env)
-		})
-	case Atom:
-		rs := []rune(a)
-		cs := make([]Term, len(rs))
-		for i, r := range rs {
-			cs[i] = Integer(r)
+		return Delay(func(context.Context) *Promise {
+			return Unify(atom, Atom(sb.String()), k, env)
+		})
+	case Atom:
+		rs := []rune(a)
+		cs := make([]Term, len(rs))
+		for i, r := range rs {
+			cs[i] = Integer(r)
+		}
+		return Delay(func(context.Context) *Promise {
+			return Unify(codes, List(cs...), k, env)
+		})
+	default:
+		return Error(typeErrorAtom(atom, env))
+	}
+}
+
+// Between succeeds if value is an integer such that lower =< value =< upper. If value is a variable, it enumerates the
+// integers from lower to upper in order. upper can be inf or infinite for no upper bound.
+func Between(lower, upper, value Term, k func(*Env) *Promise, env *Env) *Promise {
+	var low, high Integer
+	switch l := env.Resolve(lower).(type) {
+	case Variable:
+		return Error(InstantiationError(lower))
+	case Integer:
+		low = l
+	default:
+		return Error(typeErrorInteger(lower, env))
+	}
+
+	switch u := env.Resolve(upper).(type) {
+	case Variable:
+		return Error(InstantiationError(upper))
+	case Integer:
+		high = u
+	case Atom:
+		if u != "inf" && u != "infinite" {
+			return Error(typeErrorInteger(upper, env))
+		}
+		high = math.MaxInt64
+	default:
+		return Error(typeErrorInteger(upper, env))
+	}
+
+	switch v := env.Resolve(value).(type) {
+	case Variable:
+		return between(low, high, v, k, env)
+	case Integer:
+		if v < low || v > high {
+			return Bool(false)
+		}
+		return k(env)
+	default:
+		return Error(typeErrorInteger(value, env))
+	}
+}
+
+func between(low, high Integer, value Variable, k func(*Env) *Promise, env *Env) *Promise {
+	if low > high {
+		return Bool(false)
+	}
+	ks := []func(context.Context) *Promise{
+		func(context.Context) *Promise {
+			return Unify(value, low, k, env)
+		},
+	}
+	if low < high {
+		ks = append(ks, func(context.Context) *Promise {
+			return between(low+1, high, value, k, env)
+		})
+	}
+	return Delay(ks...)
+}
+
+// StreamToLazyList unifies list with a list of the character codes in the stream represented by streamOrAlias.
+// The codes are read on demand as the list is unified with other terms.
+func (state *State) StreamToLazyList(streamOrAlias, list Term, k func(*Env) *Promise, env *Env) *Promise {
+	s, err := state.stream(streamOrAlias, env)
+	if err != nil {
+		return Error(err)
+	}
+
+	if s.mode != StreamModeRead {
+		return Error(permissionErrorInputStream(streamOrAlias, env))
+	}
+
+	if s.streamType == StreamTypeBinary {
+		return Error(permissionErrorInputBinaryStream(streamOrAlias, env))
+	}
+
+	return Unify(list, &lazyList{stream: s}, k, env)
+}
+
+// NumList unifies list with a list of integers low, low+step, low+2*step, ... up to high. If step is negative,
+// the integers count down to high.
+func NumList(low, high, step, list Term, k func(*Env) *Promise, env *Env) *Promise {
+	var ns [3]Integer
+	for i, t := range []Term{low, high, step} {
+		switch n := env.Resolve(t).(type) {
+		case Variable:
+			return Error(InstantiationError(t))
+		case Integer:
+			ns[i] = n
+		default:
+			return Error(typeErrorInteger(t, env))
+		}
+	}
+
+	l, h, s := ns[0], ns[1], ns[2]
+	if s == 0 {
+		return Error(domainError("not_zero", step, env, "%s is zero."))
+	}
+
+	var elems []Term
+	for n := l; (s > 0 && n <= h) || (s < 0 && n >= h); n += s {
+		elems = append(elems, n)
+		if next := n + s; (next > n) != (s > 0) { // overflow
+			break
 		}
-		return Delay(func(context.Context) *Promise {
-			return Unify(codes, List(cs...), k, env)
-		})
-	default:
-		return Error(typeErrorAtom(atom))
 	}
+	return Unify(list, List(elems...), k, env)
 }
 
 // NumberChars breaks up an atom representation of a number num into a list of characters and unifies it with chars, or
@@ -1897,7 +3038,7 @@ func NumberChars(num, chars Term, k func(*Env) *Promise, env *Env) *Promise {
 		case Variable, Integer, Float:
 			break
 		default:
-			return Error(typeErrorNumber(n))
+			return Error(typeErrorNumber(n, env))
 		}
 
 		var sb strings.Builder
@@ -1907,14 +3048,14 @@ func NumberChars(num, chars Term, k func(*Env) *Promise, env *Env) *Promise {
 				return InstantiationError(elem)
 			case Atom:
 				if len([]rune(e)) != 1 {
-					return typeErrorCharacter(elem)
+					return typeErrorCharacter(elem, env)
 				}
 				if _, err := sb.WriteString(string(e)); err != nil {
 					return SystemError(err)
 				}
 				return nil
 			default:
-				return typeErrorCharacter(elem)
+				return typeErrorCharacter(elem, env)
 			}
 		}, env); err != nil {
 			return Error(err)
@@ -1928,6 +3069,10 @@ func NumberChars(num, chars Term, k func(*Env) *Promise, env *Env) *Promise {
 		case errNotANumber:
 			return Error(syntaxErrorNotANumber())
 		default:
+			var e *Exception
+			if errors.As(err, &e) {
+				return Error(e)
+			}
 			return Error(SystemError(err))
 		}
 		return Delay(func(context.Context) *Promise {
@@ -1948,7 +3093,7 @@ func NumberChars(num, chars Term, k func(*Env) *Promise, env *Env) *Promise {
 			return Unify(chars, List(cs...), k, env)
 		})
 	default:
-		return Error(typeErrorNumber(num))
+		return Error(typeErrorNumber(num, env))
 	}
 }
 
@@ -1963,7 +3108,7 @@ func NumberCodes(num, codes Term, k func(*Env) *Promise, env *Env) *Promise {
 		case Variable, Integer, Float:
 			break
 		default:
-			return Error(typeErrorNumber(n))
+			return Error(typeErrorNumber(n, env))
 		}
 
 		var sb strings.Builder
@@ -1989,6 +3134,10 @@ func NumberCodes(num, codes Term, k func(*Env) *Promise, env *Env) *Promise {
 		case errNotANumber:
 			return Error(syntaxErrorNotANumber())
 		default:
+			var e *Exception
+			if errors.As(err, &e) {
+				return Error(e)
+			}
 			return Error(SystemError(err))
 		}
 
@@ -2010,7 +3159,7 @@ func NumberCodes(num, codes Term, k func(*Env) *Promise, env *Env) *Promise {
 			return Unify(codes, List(cs...), k, env)
 		})
 	default:
-		return Error(typeErrorNumber(num))
+		return Error(typeErrorNumber(num, env))
 	}
 }
 
@@ -2110,7 +3259,7 @@ func (fs FunctionSet) compare(lhs, rhs Term, k func(*Env) *Promise, pi func(Inte
 			}
 			return k(env)
 		default:
-			return Error(typeErrorEvaluable(r))
+			return Error(typeErrorEvaluable(r, env))
 		}
 	case Float:
 		switch r := r.(type) {
@@ -2125,10 +3274,10 @@ func (fs FunctionSet) compare(lhs, rhs Term, k func(*Env) *Promise, pi func(Inte
 			}
 			return k(env)
 		default:
-			return Error(typeErrorEvaluable(r))
+			return Error(typeErrorEvaluable(r, env))
 		}
 	default:
-		return Error(typeErrorEvaluable(l))
+		return Error(typeErrorEvaluable(l, env))
 	}
 }
 
@@ -2150,7 +3299,7 @@ func (fs FunctionSet) eval(expression Term, env *Env) (_ Term, err error) {
 		return nil, typeErrorEvaluable(&Compound{
 			Functor: "/",
 			Args:    []Term{t, Integer(0)},
-		})
+		}, env)
 	case Integer, Float:
 		return t, nil
 	case *Compound:
@@ -2164,13 +3313,17 @@ func (fs FunctionSet) eval(expression Term, env *Env) (_ Term, err error) {
 						t.Functor,
 						Integer(1),
 					},
-				})
+				}, env)
 			}
 			x, err := fs.eval(t.Args[0], env)
 			if err != nil {
 				return nil, err
 			}
-			return f(x, env)
+			r, err := f(x, env)
+			if err != nil {
+				return nil, err
+			}
+			return checkFloat(r, x)
 		case 2:
 			f, ok := fs.Binary[t.Functor]
 			if !ok {
@@ -2180,7 +3333,7 @@ func (fs FunctionSet) eval(expression Term, env *Env) (_ Term, err error) {
 						t.Functor,
 						Integer(2),
 					},
-				})
+				}, env)
 			}
 			x, err := fs.eval(t.Args[0], env)
 			if err != nil {
@@ -2190,10 +3343,32 @@ func (fs FunctionSet) eval(expression Term, env *Env) (_ Term, err error) {
 			if err != nil {
 				return nil, err
 			}
-			return f(x, y, env)
+			r, err := f(x, y, env)
+			if err != nil {
+				return nil, err
+			}
+			return checkFloat(r, x, y)
+		}
+	}
+	return nil, typeErrorEvaluable(expression, env)
+}
+
+// checkFloat turns NaN and infinity computed from finite args, which aren't Prolog numbers, into evaluation errors.
+func checkFloat(result Term, args ...Term) (Term, error) {
+	for _, a := range args {
+		if f, ok := a.(Float); ok && (math.IsNaN(float64(f)) || math.IsInf(float64(f), 0)) {
+			return result, nil
+		}
+	}
+	if f, ok := result.(Float); ok {
+		switch {
+		case math.IsNaN(float64(f)):
+			return nil, evaluationErrorUndefined()
+		case math.IsInf(float64(f), 0):
+			return nil, evaluationErrorFloatOverflow()
 		}
 	}
-	return nil, typeErrorEvaluable(expression)
+	return result, nil
 }
 
 // DefaultFunctionSet is a FunctionSet with builtin functions.
@@ -2209,7 +3384,7 @@ var DefaultFunctionSet = FunctionSet{
 		"sign":     unaryNumber(sgn, sgnf),
 		"float":    unaryFloat(func(n float64) float64 { return n }),
 		"floor":    unaryFloat(math.Floor),
-		"log":      unaryFloat(math.Log),
+		"log":      unaryFloat(log),
 		"sin":      unaryFloat(math.Sin),
 		"truncate": unaryFloat(math.Trunc),
 		"round":    unaryFloat(math.Round),
@@ -2219,7 +3394,7 @@ var DefaultFunctionSet = FunctionSet{
 		"+":   binaryNumber(func(i, j int64) int64 { return i + j }, func(n, m float64) float64 { return n + m }),
 		"-":   binaryNumber(func(i, j int64) int64 { return i - j }, func(n, m float64) float64 { return n - m }),
 		"*":   binaryNumber(func(i, j int64) int64 { return i * j }, func(n, m float64) float64 { return n * m }),
-		"/":   binaryFloat(func(n float64, m float64) float64 { return n / m }),
+		"/":   divide,
 		"//":  binaryInteger(func(i, j int64) int64 { return i / j }),
 		"rem": binaryInteger(func(i, j int64) int64 { return i % j }),
 		"mod": binaryInteger(func(i, j int64) int64 { return (i%j + j) % j }),
@@ -2231,6 +3406,28 @@ var DefaultFunctionSet = FunctionSet{
 	},
 }
 
+// log is math.Log but its result for 0 is NaN instead of -Inf so that it's undefined.
+func log(n float64) float64 {
+	if n == 0 {
+		return math.NaN()
+	}
+	return math.Log(n)
+}
+
+func divide(x, y Term, env *Env) (Term, error) {
+	switch y := env.Resolve(y).(type) {
+	case Integer:
+		if y == 0 {
+			return nil, evaluationErrorZeroDivisor()
+		}
+	case Float:
+		if y == 0 {
+			return nil, evaluationErrorZeroDivisor()
+		}
+	}
+	return binaryFloat(func(n, m float64) float64 { return n / m })(x, y, env)
+}
+
 func sgn(i int64) int64 {
 	return i>>63 | int64(uint64(-i)>>63)
 }
@@ -2252,7 +3449,7 @@ func unaryInteger(f func(i int64) int64) func(Term, *Env) (Term, error) {
 	return func(x Term, env *Env) (Term, error) {
 		i, ok := env.Resolve(x).(Integer)
 		if !ok {
-			return nil, typeErrorInteger(x)
+			return nil, typeErrorInteger(x, env)
 		}
 
 		return Integer(f(int64(i))), nil
@@ -2263,12 +3460,12 @@ func binaryInteger(f func(i, j int64) int64) func(Term, Term, *Env) (Term, error
 	return func(x, y Term, env *Env) (Term, error) {
 		i, ok := env.Resolve(x).(Integer)
 		if !ok {
-			return nil, typeErrorInteger(x)
+			return nil, typeErrorInteger(x, env)
 		}
 
 		j, ok := env.Resolve(y).(Integer)
 		if !ok {
-			return nil, typeErrorInteger(y)
+			return nil, typeErrorInteger(y, env)
 		}
 
 		return Integer(f(int64(i), int64(j))), nil
@@ -2283,7 +3480,7 @@ func unaryFloat(f func(n float64) float64) func(Term, *Env) (Term, error) {
 		case Float:
 			return Float(f(float64(x))), nil
 		default:
-			return nil, typeErrorEvaluable(x)
+			return nil, typeErrorEvaluable(x, env)
 		}
 	}
 }
@@ -2298,7 +3495,7 @@ func binaryFloat(f func(n float64, m float64) float64) func(Term, Term, *Env) (T
 			case Float:
 				return Float(f(float64(x), float64(y))), nil
 			default:
-				return nil, typeErrorEvaluable(y)
+				return nil, typeErrorEvaluable(y, env)
 			}
 		case Float:
 			switch y := env.Resolve(y).(type) {
@@ -2307,10 +3504,10 @@ func binaryFloat(f func(n float64, m float64) float64) func(Term, Term, *Env) (T
 			case Float:
 				return Float(f(float64(x), float64(y))), nil
 			default:
-				return nil, typeErrorEvaluable(y)
+				return nil, typeErrorEvaluable(y, env)
 			}
 		default:
-			return nil, typeErrorEvaluable(x)
+			return nil, typeErrorEvaluable(x, env)
 		}
 	}
 }
@@ -2323,7 +3520,7 @@ func unaryNumber(fi func(i int64) int64, ff func(n float64) float64) func(Term,
 		case Float:
 			return Float(ff(float64(x))), nil
 		default:
-			return nil, typeErrorEvaluable(x)
+			return nil, typeErrorEvaluable(x, env)
 		}
 	}
 }
@@ -2338,7 +3535,7 @@ func binaryNumber(fi func(i, j int64) int64, ff func(n, m float64) float64) func
 			case Float:
 				return Float(ff(float64(x), float64(y))), nil
 			default:
-				return nil, typeErrorEvaluable(y)
+				return nil, typeErrorEvaluable(y, env)
 			}
 		case Float:
 			switch y := env.Resolve(y).(type) {
@@ -2347,10 +3544,10 @@ func binaryNumber(fi func(i, j int64) int64, ff func(n, m float64) float64) func
 			case Float:
 				return Float(ff(float64(x), float64(y))), nil
 			default:
-				return nil, typeErrorEvaluable(y)
+				return nil, typeErrorEvaluable(y, env)
 			}
 		default:
-			return nil, typeErrorEvaluable(x)
+			return nil, typeErrorEvaluable(x, env)
 		}
 	}
 }
@@ -2366,13 +3563,13 @@ func (state *State) StreamProperty(streamOrAlias, property Term, k func(*Env) *P
 	case Atom: // ISO standard stream_property/2 doesn't take an alias but why not?
 		v, ok := state.streams[s]
 		if !ok {
-			return Error(existenceErrorStream(streamOrAlias))
+			return Error(existenceErrorStream(streamOrAlias, env))
 		}
 		streams = append(streams, v)
 	case *Stream:
 		streams = append(streams, s)
 	default:
-		return Error(domainErrorStreamOrAlias(streamOrAlias))
+		return Error(domainErrorStreamOrAlias(streamOrAlias, env))
 	}
 
 	if err := checkStreamProperty(property, env); err != nil {
@@ -2405,23 +3602,23 @@ func checkStreamProperty(property Term, env *Env) error {
 		case "input", "output":
 			return nil
 		default:
-			return domainErrorStreamProperty(property)
+			return domainErrorStreamProperty(property, env)
 		}
 	case *Compound:
 		if len(p.Args) != 1 {
-			return domainErrorStreamProperty(property)
+			return domainErrorStreamProperty(property, env)
 		}
 		arg := p.Args[0]
 		switch p.Functor {
-		case "file_name", "mode", "alias", "end_of_stream", "eof_action", "reposition":
+		case "file_name", "mode", "alias", "end_of_stream", "eof_action", "reposition", "buffer":
 			return checkAtom(arg, env)
 		case "position":
 			return checkInteger(arg, env)
 		default:
-			return domainErrorStreamProperty(property)
+			return domainErrorStreamProperty(property, env)
 		}
 	default:
-		return domainErrorStreamProperty(property)
+		return domainErrorStreamProperty(property, env)
 	}
 }
 
@@ -2430,7 +3627,7 @@ func checkAtom(t Term, env *Env) error {
 	case Variable, Atom:
 		return nil
 	default:
-		return typeErrorAtom(t)
+		return typeErrorAtom(t, env)
 	}
 }
 
@@ -2439,7 +3636,7 @@ func checkInteger(t Term, env *Env) error {
 	case Variable, Integer:
 		return nil
 	default:
-		return typeErrorAtom(t)
+		return typeErrorAtom(t, env)
 	}
 }
 
@@ -2453,7 +3650,7 @@ func (state *State) SetStreamPosition(streamOrAlias, position Term, k func(*Env)
 	}
 
 	if !s.reposition {
-		return Error(PermissionError("reposition", "stream", streamOrAlias, "%s is not repositionable.", streamOrAlias))
+		return Error(permissionError("reposition", "stream", streamOrAlias, env, "%s is not repositionable."))
 	}
 
 	switch p := env.Resolve(position).(type) {
@@ -2461,17 +3658,88 @@ func (state *State) SetStreamPosition(streamOrAlias, position Term, k func(*Env)
 		return Error(InstantiationError(position))
 	case Integer:
 		if f, ok := s.file.(io.Seeker); ok {
+			if err := s.flush(); err != nil {
+				return Error(SystemError(err))
+			}
+
 			if _, err := seek(f, int64(p), 0); err != nil {
 				return Error(SystemError(err))
 			}
 
 			s.buf.Reset(s.file)
+			s.pastEndOfStream = false
 		}
 
 		return k(env)
 	default:
-		return Error(typeErrorInteger(position))
+		return Error(typeErrorInteger(position, env))
+	}
+}
+
+// Seek moves the position of the stream by offset bytes relative to method, which is bof, current, or eof, and unifies newPos with the resulting position.
+func (state *State) Seek(streamOrAlias, offset, method, newPos Term, k func(*Env) *Promise, env *Env) *Promise {
+	s, err := state.stream(streamOrAlias, env)
+	if err != nil {
+		return Error(err)
+	}
+
+	var o Integer
+	switch off := env.Resolve(offset).(type) {
+	case Variable:
+		return Error(InstantiationError(offset))
+	case Integer:
+		o = off
+	default:
+		return Error(typeErrorInteger(offset, env))
+	}
+
+	var whence int
+	switch m := env.Resolve(method).(type) {
+	case Variable:
+		return Error(InstantiationError(method))
+	case Atom:
+		switch m {
+		case "bof":
+			whence = io.SeekStart
+		case "current":
+			whence = io.SeekCurrent
+		case "eof":
+			whence = io.SeekEnd
+		default:
+			return Error(domainErrorSeekMethod(method, env))
+		}
+	default:
+		return Error(typeErrorAtom(method, env))
 	}
+
+	switch p := env.Resolve(newPos).(type) {
+	case Variable, Integer:
+	default:
+		return Error(typeErrorInteger(p, env))
+	}
+
+	f, ok := s.file.(io.Seeker)
+	if !ok || !s.reposition {
+		return Error(permissionError("reposition", "stream", streamOrAlias, env, "%s is not repositionable."))
+	}
+
+	if err := s.flush(); err != nil {
+		return Error(SystemError(err))
+	}
+
+	if whence == io.SeekCurrent {
+		o -= Integer(s.buf.Buffered())
+	}
+
+	pos, err := seek(f, int64(o), whence)
+	if err != nil {
+		return Error(SystemError(err))
+	}
+
+	s.buf.Reset(s.file)
+	s.pastEndOfStream = false
+
+	return Unify(newPos, Integer(pos), k, env)
 }
 
 // CharConversion registers a character conversion from inChar to outChar, or remove the conversion if inChar = outChar.
@@ -2584,7 +3852,7 @@ func (state *State) SetPrologFlag(flag, value Term, k func(*Env) *Promise, env *
 		case "double_quotes":
 			modify = state.modifyDoubleQuotes
 		default:
-			return Error(domainErrorPrologFlag(f))
+			return Error(domainErrorPrologFlag(f, env))
 		}
 
 		switch v := env.Resolve(value).(type) {
@@ -2599,10 +3867,10 @@ func (state *State) SetPrologFlag(flag, value Term, k func(*Env) *Promise, env *
 			return Error(domainErrorFlagValue(&Compound{
 				Functor: "+",
 				Args:    []Term{flag, value},
-			}))
+			}, env))
 		}
 	default:
-		return Error(typeErrorAtom(f))
+		return Error(typeErrorAtom(f, env))
 	}
 }
 
@@ -2616,7 +3884,7 @@ func (state *State) modifyCharConversion(value Atom) error {
 		return domainErrorFlagValue(&Compound{
 			Functor: "+",
 			Args:    []Term{Atom("char_conversion"), value},
-		})
+		}, nil)
 	}
 	return nil
 }
@@ -2631,7 +3899,7 @@ func (state *State) modifyDebug(value Atom) error {
 		return domainErrorFlagValue(&Compound{
 			Functor: "+",
 			Args:    []Term{Atom("debug"), value},
-		})
+		}, nil)
 	}
 	return nil
 }
@@ -2648,7 +3916,7 @@ func (state *State) modifyUnknown(value Atom) error {
 		return domainErrorFlagValue(&Compound{
 			Functor: "+",
 			Args:    []Term{Atom("unknown"), value},
-		})
+		}, nil)
 	}
 	return nil
 }
@@ -2665,7 +3933,7 @@ func (state *State) modifyDoubleQuotes(value Atom) error {
 		return domainErrorFlagValue(&Compound{
 			Functor: "+",
 			Args:    []Term{Atom("double_quotes"), value},
-		})
+		}, nil)
 	}
 	return nil
 }
@@ -2680,10 +3948,10 @@ func (state *State) CurrentPrologFlag(flag, value Term, k func(*Env) *Promise, e
 		case "bounded", "max_integer", "min_integer", "integer_rounding_function", "char_conversion", "debug", "max_arity", "unknown", "double_quotes":
 			break
 		default:
-			return Error(domainErrorPrologFlag(f))
+			return Error(domainErrorPrologFlag(f, env))
 		}
 	default:
-		return Error(typeErrorAtom(f))
+		return Error(typeErrorAtom(f, env))
 	}
 
 	pattern := Compound{Args: []Term{flag, value}}
@@ -2722,13 +3990,13 @@ func (state *State) stream(streamOrAlias Term, env *Env) (*Stream, error) {
 	case Atom:
 		v, ok := state.streams[s]
 		if !ok {
-			return nil, existenceErrorStream(streamOrAlias)
+			return nil, existenceErrorStream(streamOrAlias, env)
 		}
 		return v, nil
 	case *Stream:
 		return s, nil
 	default:
-		return nil, domainErrorStreamOrAlias(streamOrAlias)
+		return nil, domainErrorStreamOrAlias(streamOrAlias, env)
 	}
 }
 
@@ -2748,7 +4016,7 @@ func (state *State) Dynamic(pi Term, k func(*Env) *Promise, env *Env) *Promise {
 			return nil
 		}
 		if _, ok := p.(clauses); !ok {
-			return permissionErrorModifyStaticProcedure(elem)
+			return permissionErrorModifyStaticProcedure(elem, env)
 		}
 		return nil
 	}, env); err != nil {
@@ -2773,15 +4041,131 @@ func (state *State) BuiltIn(pi Term, k func(*Env) *Promise, env *Env) *Promise {
 			return nil
 		}
 		if _, ok := p.(builtin); !ok {
-			return permissionErrorModifyStaticProcedure(elem)
+			return permissionErrorModifyStaticProcedure(elem, env)
+		}
+		return nil
+	}, env); err != nil {
+		return Error(err)
+	}
+	return k(env)
+}
+
+// controlConstructs are the procedures that can't be redefined.
+var controlConstructs = map[ProcedureIndicator]struct{}{
+	{Name: "true", Arity: 0}:  {},
+	{Name: "fail", Arity: 0}:  {},
+	{Name: "!", Arity: 0}:     {},
+	{Name: ",", Arity: 2}:     {},
+	{Name: ";", Arity: 2}:     {},
+	{Name: "->", Arity: 2}:    {},
+	{Name: "call", Arity: 1}:  {},
+	{Name: "call", Arity: 2}:  {},
+	{Name: "call", Arity: 3}:  {},
+	{Name: "call", Arity: 4}:  {},
+	{Name: "call", Arity: 5}:  {},
+	{Name: "call", Arity: 6}:  {},
+	{Name: "call", Arity: 7}:  {},
+	{Name: "call", Arity: 8}:  {},
+	{Name: "catch", Arity: 3}: {},
+	{Name: "throw", Arity: 1}: {},
+}
+
+// Redefine discards the built-in definition of a procedure indicated by pi so that the following clauses define it
+// anew as a user-defined static procedure. It does nothing for user-defined procedures. Control constructs such as
+// call/1 and ','/2 can't be redefined.
+func (state *State) Redefine(pi Term, k func(*Env) *Promise, env *Env) *Promise {
+	if err := Each(pi, func(elem Term) error {
+		key, err := NewProcedureIndicator(elem, env)
+		if err != nil {
+			return err
+		}
+		if _, ok := controlConstructs[key]; ok {
+			return permissionErrorModifyStaticProcedure(key.Term(), env)
+		}
+		switch state.procedures[key].(type) {
+		case nil, clauses, static:
+			return nil
+		default:
+			state.procedures[key] = static{}
+			return nil
+		}
+	}, env); err != nil {
+		return Error(err)
+	}
+	return k(env)
+}
+
+// Module declares a module named name which exports the procedures indicated by the list exports.
+// Since procedures share a single flat namespace, the exported procedures are visible from everywhere once loaded.
+func (state *State) Module(name, exports Term, k func(*Env) *Promise, env *Env) *Promise {
+	var n Atom
+	switch m := env.Resolve(name).(type) {
+	case Variable:
+		return Error(InstantiationError(name))
+	case Atom:
+		n = m
+	default:
+		return Error(typeErrorAtom(name, env))
+	}
+
+	var pis []ProcedureIndicator
+	if err := EachList(exports, func(elem Term) error {
+		pi, err := NewProcedureIndicator(elem, env)
+		if err != nil {
+			return err
 		}
+		pis = append(pis, pi)
 		return nil
 	}, env); err != nil {
 		return Error(err)
 	}
+
+	if state.modules == nil {
+		state.modules = map[Atom][]ProcedureIndicator{}
+	}
+	state.modules[n] = pis
 	return k(env)
 }
 
+// CurrentModule succeeds if module is either user or a module declared by module/2.
+func (state *State) CurrentModule(module Term, k func(*Env) *Promise, env *Env) *Promise {
+	if err := checkAtom(module, env); err != nil {
+		return Error(err)
+	}
+
+	names := []Atom{"user"}
+	for n := range state.modules {
+		if n != "user" {
+			names = append(names, n)
+		}
+	}
+	sort.Slice(names[1:], func(i, j int) bool {
+		return names[1+i] < names[1+j]
+	})
+
+	ks := make([]func(context.Context) *Promise, len(names))
+	for i := range names {
+		n := names[i]
+		ks[i] = func(context.Context) *Promise {
+			return Unify(module, n, k, env)
+		}
+	}
+	return Delay(ks...)
+}
+
+// Qualified executes goal qualified by module as in module:goal. Since procedures share a single flat namespace,
+// goal is called regardless of module.
+func (state *State) Qualified(module, goal Term, k func(*Env) *Promise, env *Env) *Promise {
+	switch env.Resolve(module).(type) {
+	case Variable:
+		return Error(InstantiationError(module))
+	case Atom:
+		return state.Call(goal, k, env)
+	default:
+		return Error(typeErrorAtom(module, env))
+	}
+}
+
 // ExpandTerm transforms term1 according to term_expansion/2 and unifies with term2.
 func (state *State) ExpandTerm(term1, term2 Term, k func(*Env) *Promise, env *Env) *Promise {
 	const termExpansion = "term_expansion"
@@ -2799,6 +4183,59 @@ func (state *State) ExpandTerm(term1, term2 Term, k func(*Env) *Promise, env *En
 	})
 }
 
+// ExpandGoal transforms goal1 according to goal_expansion/2 and unifies with goal2.
+// Goals inside control constructs such as conjunction, disjunction, if-then and negation are expanded as well.
+func (state *State) ExpandGoal(goal1, goal2 Term, k func(*Env) *Promise, env *Env) *Promise {
+	const goalExpansion = "goal_expansion"
+	if _, ok := state.procedures[ProcedureIndicator{Name: goalExpansion, Arity: 2}]; !ok {
+		return Unify(goal1, goal2, k, env)
+	}
+
+	return Delay(func(ctx context.Context) *Promise {
+		g, env, err := state.expandGoal(ctx, goal1, env)
+		if err != nil {
+			return Error(err)
+		}
+		return Unify(goal2, g, k, env)
+	})
+}
+
+func (state *State) expandGoal(ctx context.Context, goal Term, env *Env) (Term, *Env, error) {
+	switch g := env.Resolve(goal).(type) {
+	case Variable:
+		return g, env, nil
+	case *Compound:
+		switch {
+		case len(g.Args) == 2 && (g.Functor == "," || g.Functor == ";" || g.Functor == "->"),
+			len(g.Args) == 1 && g.Functor == `\+`:
+			c := Compound{Functor: g.Functor, Args: make([]Term, len(g.Args))}
+			for i, a := range g.Args {
+				var err error
+				c.Args[i], env, err = state.expandGoal(ctx, a, env)
+				if err != nil {
+					return nil, env, err
+				}
+			}
+			return &c, env, nil
+		}
+	}
+
+	const goalExpansion = Atom("goal_expansion")
+	v := NewVariable()
+	expanded := env
+	ok, err := state.Call(goalExpansion.Apply(goal, v), func(env *Env) *Promise {
+		expanded = env
+		return Bool(true)
+	}, env).Force(ctx)
+	if err != nil {
+		return nil, env, err
+	}
+	if !ok || expanded.Resolve(v).Compare(goal, expanded) == 0 {
+		return goal, env, nil
+	}
+	return state.expandGoal(ctx, v, expanded)
+}
+
 // Environ succeeds if an environment variable key has value.
 func Environ(key, value Term, k func(*Env) *Promise, env *Env) *Promise {
 	lines := os.Environ()
@@ -2815,3 +4252,167 @@ func Environ(key, value Term, k func(*Env) *Promise, env *Env) *Promise {
 	}
 	return Delay(ks...)
 }
+
+// globalVar is a value set by nb_setval/2 and when it's set.
+type globalVar struct {
+	value  Term
+	serial Integer
+}
+
+// BSetVal associates key with value. The association is undone on backtracking.
+func (state *State) BSetVal(key, value Term, k func(*Env) *Promise, env *Env) *Promise {
+	name, err := globalVarKey(key, env)
+	if err != nil {
+		return Error(err)
+	}
+
+	// The values are chained as '$bval'(Value, Serial, Next) from the variable for the key so that env keeps the history.
+	t := env.Resolve(Variable("$bval/" + name))
+	for {
+		c, ok := t.(*Compound)
+		if !ok {
+			break
+		}
+		t = env.Resolve(c.Args[2])
+	}
+
+	state.globalSerial++
+	return k(env.Bind(t.(Variable), &Compound{
+		Functor: "$bval",
+		Args:    []Term{value, state.globalSerial, NewVariable()},
+	}))
+}
+
+// BGetVal unifies value with the value associated with key by either b_setval/2 or nb_setval/2.
+func (state *State) BGetVal(key, value Term, k func(*Env) *Promise, env *Env) *Promise {
+	return state.NbGetVal(key, value, k, env)
+}
+
+// NbSetVal associates key with a copy of value. The association survives backtracking.
+func (state *State) NbSetVal(key, value Term, k func(*Env) *Promise, env *Env) *Promise {
+	name, err := globalVarKey(key, env)
+	if err != nil {
+		return Error(err)
+	}
+
+	if state.globalVars == nil {
+		state.globalVars = map[Atom]globalVar{}
+	}
+	state.globalSerial++
+	state.globalVars[name] = globalVar{value: copyTerm(value, nil, env), serial: state.globalSerial}
+	return k(env)
+}
+
+// NbGetVal unifies value with the value associated with key by either b_setval/2 or nb_setval/2.
+func (state *State) NbGetVal(key, value Term, k func(*Env) *Promise, env *Env) *Promise {
+	name, err := globalVarKey(key, env)
+	if err != nil {
+		return Error(err)
+	}
+
+	// The one set last wins.
+	var (
+		val    Term
+		serial Integer
+		t      = env.Resolve(Variable("$bval/" + name))
+	)
+	for {
+		c, ok := t.(*Compound)
+		if !ok {
+			break
+		}
+		val, serial, t = c.Args[0], c.Args[1].(Integer), env.Resolve(c.Args[2])
+	}
+	if nb, ok := state.globalVars[name]; ok && nb.serial > serial {
+		val = copyTerm(nb.value, nil, nil)
+	}
+	if val == nil {
+		return Error(ExistenceError("variable", name, "global variable %s does not exist.", name))
+	}
+
+	return Unify(value, val, k, env)
+}
+
+func globalVarKey(key Term, env *Env) (Atom, error) {
+	switch k := env.Resolve(key).(type) {
+	case Variable:
+		return "", InstantiationError(key)
+	case Atom:
+		return k, nil
+	default:
+		return "", typeErrorAtom(key, env)
+	}
+}
+
+// Recorda records a copy of term under key in the internal database before the other terms under the same key and
+// unifies ref with a reference to the record. Only the principal functor of key is significant.
+func (state *State) Recorda(key, term, ref Term, k func(*Env) *Promise, env *Env) *Promise {
+	return state.record(key, term, ref, func(r *RecordRef) {
+		state.records = append([]*RecordRef{r}, state.records...)
+	}, k, env)
+}
+
+// Recordz records a copy of term under key in the internal database after the other terms under the same key and
+// unifies ref with a reference to the record. Only the principal functor of key is significant.
+func (state *State) Recordz(key, term, ref Term, k func(*Env) *Promise, env *Env) *Promise {
+	return state.record(key, term, ref, func(r *RecordRef) {
+		state.records = append(state.records, r)
+	}, k, env)
+}
+
+func (state *State) record(key, term, ref Term, add func(*RecordRef), k func(*Env) *Promise, env *Env) *Promise {
+	key, err := recordKey(key, env)
+	if err != nil {
+		return Error(err)
+	}
+
+	if _, ok := env.Resolve(ref).(Variable); !ok {
+		return Error(uninstantiationError(ref, env))
+	}
+
+	r := RecordRef{key: key, term: copyTerm(term, nil, env)}
+	add(&r)
+	return Unify(ref, &r, k, env)
+}
+
+// Recorded unifies key, term, and ref with the key, a copy of the term, and the reference of each record in the
+// internal database, respectively. If key is a variable, it enumerates the records under any key.
+func (state *State) Recorded(key, term, ref Term, k func(*Env) *Promise, env *Env) *Promise {
+	if _, ok := env.Resolve(key).(Variable); !ok {
+		var err error
+		key, err = recordKey(key, env)
+		if err != nil {
+			return Error(err)
+		}
+	}
+
+	pattern := Compound{Args: []Term{key, term, ref}}
+	records := state.records
+	ks := make([]func(context.Context) *Promise, len(records))
+	for i := range records {
+		r := records[i]
+		ks[i] = func(context.Context) *Promise {
+			return Unify(&pattern, &Compound{Args: []Term{copyTerm(r.key, nil, nil), copyTerm(r.term, nil, nil), r}}, k, env)
+		}
+	}
+	return Delay(ks...)
+}
+
+// recordKey returns the principal functor of key as a term, i.e. an atom, an integer, or a compound with fresh
+// variables as arguments.
+func recordKey(key Term, env *Env) (Term, error) {
+	switch k := env.Resolve(key).(type) {
+	case Variable:
+		return nil, InstantiationError(key)
+	case Atom, Integer:
+		return k, nil
+	case *Compound:
+		args := make([]Term, len(k.Args))
+		for i := range args {
+			args[i] = NewVariable()
+		}
+		return &Compound{Functor: k.Functor, Args: args}, nil
+	default:
+		return nil, typeErrorKey(key, env)
+	}
+}
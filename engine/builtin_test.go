@@ -2,6 +2,7 @@ package engine
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -10,7 +11,9 @@ import (
 	"math"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -74,6 +77,16 @@ func TestState_SetUserInput(t *testing.T) {
 	})
 }
 
+func TestState_SetUserError(t *testing.T) {
+	var state State
+	state.SetUserError(os.Stderr)
+
+	s, ok := state.streams[Atom("user_error")]
+	assert.True(t, ok)
+	assert.Equal(t, os.Stderr, s.file)
+	assert.Equal(t, StreamModeWrite, s.mode)
+}
+
 func TestState_SetUserOutput(t *testing.T) {
 	t.Run("file", func(t *testing.T) {
 		var state State
@@ -159,6 +172,53 @@ func (m *mockCloser) Close() error {
 	return args.Error(0)
 }
 
+func TestState_CallWithTimeLimit(t *testing.T) {
+	var state State
+	state.Register0("loop", func(k func(*Env) *Promise, env *Env) *Promise {
+		return Repeat(func(context.Context) *Promise {
+			return Bool(false)
+		})
+	})
+	state.Register1("foo", func(x Term, k func(*Env) *Promise, env *Env) *Promise {
+		return Delay(func(context.Context) *Promise {
+			return Unify(x, Atom("a"), k, env)
+		}, func(context.Context) *Promise {
+			return Unify(x, Atom("b"), k, env)
+		})
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		x := Variable("X")
+		var c int
+		ok, err := state.CallWithTimeLimit(Integer(1), &Compound{Functor: "foo", Args: []Term{x}}, func(env *Env) *Promise {
+			assert.Equal(t, Atom("a"), env.Resolve(x))
+			c++
+			return Bool(false)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, 1, c)
+	})
+
+	t.Run("time limit exceeded", func(t *testing.T) {
+		ok, err := state.CallWithTimeLimit(Float(0.01), Atom("loop"), Success, nil).Force(context.Background())
+		assert.Equal(t, timeLimitExceeded(Float(0.01)), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("seconds is a variable", func(t *testing.T) {
+		ok, err := state.CallWithTimeLimit(Variable("S"), Atom("loop"), Success, nil).Force(context.Background())
+		assert.Equal(t, InstantiationError(Variable("S")), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("seconds is not a number", func(t *testing.T) {
+		ok, err := state.CallWithTimeLimit(Atom("foo"), Atom("loop"), Success, nil).Force(context.Background())
+		assert.Equal(t, typeErrorNumber(Atom("foo"), nil), err)
+		assert.False(t, ok)
+	})
+}
+
 func TestState_Call(t *testing.T) {
 	var state State
 
@@ -167,7 +227,7 @@ func TestState_Call(t *testing.T) {
 		assert.Equal(t, existenceErrorProcedure(&Compound{
 			Functor: "/",
 			Args:    []Term{Atom("foo"), Integer(0)},
-		}), err)
+		}, nil), err)
 		assert.False(t, ok)
 	})
 
@@ -184,7 +244,7 @@ func TestState_Call(t *testing.T) {
 		assert.Equal(t, existenceErrorProcedure(&Compound{
 			Functor: "/",
 			Args:    []Term{Atom("bar"), Integer(2)},
-		}), err)
+		}, nil), err)
 		assert.False(t, ok)
 	})
 
@@ -225,7 +285,7 @@ func TestState_Call(t *testing.T) {
 	t.Run("not callable", func(t *testing.T) {
 		t.Run("single predicate", func(t *testing.T) {
 			ok, err := state.Call(Integer(0), Success, nil).Force(context.Background())
-			assert.Equal(t, typeErrorCallable(Integer(0)), err)
+			assert.Equal(t, typeErrorCallable(Integer(0), nil), err)
 			assert.False(t, ok)
 		})
 
@@ -244,7 +304,7 @@ func TestState_Call(t *testing.T) {
 						Atom("true"),
 						Integer(0),
 					},
-				}), err)
+				}, nil), err)
 				assert.False(t, ok)
 			})
 
@@ -262,13 +322,78 @@ func TestState_Call(t *testing.T) {
 						Integer(1),
 						Atom("true"),
 					},
-				}), err)
+				}, nil), err)
 				assert.False(t, ok)
 			})
 		})
 	})
 }
 
+func TestState_Call1(t *testing.T) {
+	var state State
+	state.Register2("foo", func(a, b Term, k func(*Env) *Promise, env *Env) *Promise {
+		return Unify(a, b, k, env)
+	})
+
+	t.Run("compound", func(t *testing.T) {
+		ok, err := state.Call1(&Compound{Functor: "foo", Args: []Term{Atom("a")}}, Atom("a"), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("atom", func(t *testing.T) {
+		ok, err := state.Call2(Atom("foo"), Atom("a"), Atom("b"), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("unknown procedure", func(t *testing.T) {
+		// foo/2 exists but call/4 extends foo(a) to foo/3.
+		pi := ProcedureIndicator{Name: "foo", Arity: 3}
+
+		t.Run("error", func(t *testing.T) {
+			ok, err := state.Call2(&Compound{Functor: "foo", Args: []Term{Atom("a")}}, Atom("b"), Atom("c"), Success, nil).Force(context.Background())
+			assert.Equal(t, existenceErrorProcedure(pi.Term(), nil), err)
+			assert.False(t, ok)
+		})
+
+		t.Run("warning", func(t *testing.T) {
+			state := state
+			state.unknown = unknownWarning
+			var warned []ProcedureIndicator
+			state.OnUnknown = func(pi ProcedureIndicator, _ []Term, _ *Env) {
+				warned = append(warned, pi)
+			}
+
+			ok, err := state.Call2(&Compound{Functor: "foo", Args: []Term{Atom("a")}}, Atom("b"), Atom("c"), Success, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.False(t, ok)
+			assert.Equal(t, []ProcedureIndicator{pi}, warned)
+		})
+
+		t.Run("fail", func(t *testing.T) {
+			state := state
+			state.unknown = unknownFail
+
+			ok, err := state.Call2(&Compound{Functor: "foo", Args: []Term{Atom("a")}}, Atom("b"), Atom("c"), Success, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.False(t, ok)
+		})
+	})
+
+	t.Run("closure is a variable", func(t *testing.T) {
+		ok, err := state.Call1(Variable("G"), Atom("a"), Success, nil).Force(context.Background())
+		assert.Equal(t, InstantiationError(Variable("G")), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("closure is not callable", func(t *testing.T) {
+		ok, err := state.Call1(Integer(0), Atom("a"), Success, nil).Force(context.Background())
+		assert.Equal(t, typeErrorCallable(Integer(0), nil), err)
+		assert.False(t, ok)
+	})
+}
+
 func TestUnify(t *testing.T) {
 	t.Run("unifiable", func(t *testing.T) {
 		x := Variable("X")
@@ -512,13 +637,13 @@ func TestFunctor(t *testing.T) {
 				Args: []Term{
 					Atom("a"),
 				},
-			}), err)
+			}, nil), err)
 			assert.False(t, ok)
 		})
 
 		t.Run("name is not an atom", func(t *testing.T) {
 			ok, err := Functor(NewVariable(), Integer(0), Integer(2), Success, nil).Force(context.Background())
-			assert.Equal(t, typeErrorAtom(Integer(0)), err)
+			assert.Equal(t, typeErrorAtom(Integer(0), nil), err)
 			assert.False(t, ok)
 		})
 
@@ -531,13 +656,13 @@ func TestFunctor(t *testing.T) {
 
 		t.Run("arity is not an integer", func(t *testing.T) {
 			ok, err := Functor(NewVariable(), Atom("f"), Float(2.0), Success, nil).Force(context.Background())
-			assert.Equal(t, typeErrorInteger(Float(2.0)), err)
+			assert.Equal(t, typeErrorInteger(Float(2.0), nil), err)
 			assert.False(t, ok)
 		})
 
 		t.Run("arity is negative", func(t *testing.T) {
 			ok, err := Functor(NewVariable(), Atom("f"), Integer(-2), Success, nil).Force(context.Background())
-			assert.Equal(t, domainErrorNotLessThanZero(Integer(-2)), err)
+			assert.Equal(t, domainErrorNotLessThanZero(Integer(-2), nil), err)
 			assert.False(t, ok)
 		})
 	})
@@ -553,7 +678,7 @@ func TestArg(t *testing.T) {
 
 	t.Run("term is not a compound", func(t *testing.T) {
 		ok, err := Arg(NewVariable(), Atom("foo"), NewVariable(), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorCompound(Atom("foo")), err)
+		assert.Equal(t, typeErrorCompound(Atom("foo"), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -576,6 +701,15 @@ func TestArg(t *testing.T) {
 			assert.True(t, ok)
 		})
 
+		t.Run("last", func(t *testing.T) {
+			ok, err := Arg(Integer(3), &Compound{
+				Functor: "f",
+				Args:    []Term{Atom("a"), Atom("b"), Atom("c")},
+			}, Atom("c"), Success, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+		})
+
 		t.Run("ng", func(t *testing.T) {
 			ok, err := Arg(Integer(4), &Compound{
 				Functor: "f",
@@ -590,7 +724,7 @@ func TestArg(t *testing.T) {
 				Functor: "f",
 				Args:    []Term{Atom("a"), Atom("b"), Atom("c")},
 			}, Atom("b"), Success, nil).Force(context.Background())
-			assert.Equal(t, domainErrorNotLessThanZero(Integer(-2)), err)
+			assert.Equal(t, domainErrorNotLessThanZero(Integer(-2), nil), err)
 			assert.False(t, ok)
 		})
 	})
@@ -600,7 +734,7 @@ func TestArg(t *testing.T) {
 			Functor: "f",
 			Args:    []Term{Atom("a"), Atom("b"), Atom("c")},
 		}, Atom("b"), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorInteger(Atom("foo")), err)
+		assert.Equal(t, typeErrorInteger(Atom("foo"), nil), err)
 		assert.False(t, ok)
 	})
 }
@@ -623,21 +757,60 @@ func TestUniv(t *testing.T) {
 		t.Run("list is empty", func(t *testing.T) {
 			v := NewVariable()
 			ok, err := Univ(v, List(), Success, nil).Force(context.Background())
-			assert.Equal(t, domainErrorNotEmptyList(Atom("[]")), err)
+			assert.Equal(t, domainErrorNotEmptyList(Atom("[]"), nil), err)
 			assert.False(t, ok)
 		})
 
 		t.Run("list is not a list", func(t *testing.T) {
 			v := NewVariable()
 			ok, err := Univ(v, Atom("list"), Success, nil).Force(context.Background())
-			assert.Equal(t, typeErrorList(Atom("list")), err)
+			assert.Equal(t, typeErrorList(Atom("list"), nil), err)
 			assert.False(t, ok)
 		})
 
 		t.Run("list's first element is not an atom", func(t *testing.T) {
 			v := NewVariable()
 			ok, err := Univ(v, List(Integer(0), Atom("a"), Atom("b")), Success, nil).Force(context.Background())
-			assert.Equal(t, typeErrorAtom(Integer(0)), err)
+			assert.Equal(t, typeErrorAtom(Integer(0), nil), err)
+			assert.False(t, ok)
+		})
+
+		t.Run("list's first element is a variable", func(t *testing.T) {
+			v, f := NewVariable(), Variable("F")
+			ok, err := Univ(v, List(f, Atom("a")), Success, nil).Force(context.Background())
+			assert.Equal(t, InstantiationError(f), err)
+			assert.False(t, ok)
+		})
+
+		t.Run("operator", func(t *testing.T) {
+			v := NewVariable()
+			ok, err := Univ(v, List(Atom("+"), Integer(1), Integer(2)), func(env *Env) *Promise {
+				assert.Equal(t, &Compound{
+					Functor: "+",
+					Args:    []Term{Integer(1), Integer(2)},
+				}, env.Resolve(v))
+				return Bool(true)
+			}, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+		})
+
+		t.Run("atomic", func(t *testing.T) {
+			for _, a := range []Term{Atom("foo"), Integer(1), Float(1)} {
+				v := NewVariable()
+				ok, err := Univ(v, List(a), func(env *Env) *Promise {
+					assert.Equal(t, a, env.Resolve(v))
+					return Bool(true)
+				}, nil).Force(context.Background())
+				assert.NoError(t, err)
+				assert.True(t, ok)
+			}
+		})
+
+		t.Run("compound without arguments", func(t *testing.T) {
+			v, c := NewVariable(), &Compound{Functor: "f", Args: []Term{Atom("a")}}
+			ok, err := Univ(v, List(c), Success, nil).Force(context.Background())
+			assert.Equal(t, typeErrorAtomic(c, nil), err)
 			assert.False(t, ok)
 		})
 
@@ -658,10 +831,76 @@ func TestUniv(t *testing.T) {
 		assert.True(t, ok)
 	})
 
+	t.Run("term is an operator compound", func(t *testing.T) {
+		l := Variable("L")
+		ok, err := Univ(&Compound{
+			Functor: "+",
+			Args:    []Term{Integer(1), Integer(2)},
+		}, l, func(env *Env) *Promise {
+			assert.Equal(t, List(Atom("+"), Integer(1), Integer(2)), env.Resolve(l))
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
 	t.Run("term is neither a variable nor a compound", func(t *testing.T) {
 		ok, err := Univ(Atom("foo"), List(Atom("foo")), Success, nil).Force(context.Background())
 		assert.NoError(t, err)
 		assert.True(t, ok)
+
+		l := Variable("L")
+		ok, err = Univ(Atom("foo"), l, func(env *Env) *Promise {
+			assert.Equal(t, List(Atom("foo")), env.Resolve(l))
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+}
+
+func TestTermHash(t *testing.T) {
+	hashOf := func(term Term, env *Env) Term {
+		h := Variable("Hash")
+		var ret Term
+		ok, err := TermHash(term, h, func(env *Env) *Promise {
+			ret = env.Resolve(h)
+			return Bool(true)
+		}, env).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		return ret
+	}
+
+	t.Run("equal ground terms", func(t *testing.T) {
+		env := NewEnv().Bind("X", Atom("b"))
+		h1 := hashOf(&Compound{Functor: "f", Args: []Term{Atom("a"), Atom("b"), Integer(1), Float(1)}}, nil)
+		h2 := hashOf(&Compound{Functor: "f", Args: []Term{Atom("a"), Variable("X"), Integer(1), Float(1)}}, env)
+		assert.Equal(t, h1, h2)
+		assert.GreaterOrEqual(t, int64(h1.(Integer)), int64(0))
+	})
+
+	t.Run("different terms", func(t *testing.T) {
+		assert.NotEqual(t, hashOf(Atom("a"), nil), hashOf(Atom("b"), nil))
+		assert.NotEqual(t, hashOf(Integer(1), nil), hashOf(Float(1), nil))
+		assert.NotEqual(t, hashOf(Atom("1"), nil), hashOf(Integer(1), nil))
+		assert.NotEqual(t, hashOf(&Compound{Functor: "f", Args: []Term{Atom("ab")}}, nil), hashOf(&Compound{Functor: "f", Args: []Term{Atom("a"), Atom("b")}}, nil))
+	})
+
+	t.Run("stable", func(t *testing.T) {
+		assert.Equal(t, hashOf(List(Atom("a"), Integer(1)), nil), hashOf(List(Atom("a"), Integer(1)), nil))
+	})
+
+	t.Run("not ground", func(t *testing.T) {
+		ok, err := TermHash(&Compound{Functor: "f", Args: []Term{Variable("X")}}, Variable("Hash"), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("hash is not an integer", func(t *testing.T) {
+		ok, err := TermHash(Atom("a"), Atom("foo"), Success, nil).Force(context.Background())
+		assert.Equal(t, typeErrorInteger(Atom("foo"), nil), err)
+		assert.False(t, ok)
 	})
 }
 
@@ -676,6 +915,147 @@ func TestCopyTerm(t *testing.T) {
 	}, env).Force(context.Background())
 	assert.NoError(t, err)
 	assert.True(t, ok)
+
+	t.Run("shared variables", func(t *testing.T) {
+		x := Variable("X")
+		b := Variable("B")
+		out := Variable("Out")
+		ok, err := CopyTerm(&Compound{Functor: "f", Args: []Term{x, x}}, out, func(env *Env) *Promise {
+			return Unify(out, &Compound{Functor: "f", Args: []Term{Atom("a"), b}}, func(env *Env) *Promise {
+				assert.Equal(t, Atom("a"), env.Resolve(b))
+				return Bool(true)
+			}, env)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("original variables stay unbound", func(t *testing.T) {
+		x := Variable("X")
+		out := Variable("Out")
+		ok, err := CopyTerm(&Compound{Functor: "f", Args: []Term{x, x}}, out, func(env *Env) *Promise {
+			return Unify(out, &Compound{Functor: "f", Args: []Term{Atom("a"), Atom("a")}}, func(env *Env) *Promise {
+				assert.Equal(t, x, env.Resolve(x))
+				return Bool(true)
+			}, env)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+}
+
+func TestGetDict(t *testing.T) {
+	d, err := newDict(Atom("point"), []*Compound{
+		{Functor: "-", Args: []Term{Atom("y"), Integer(2)}},
+		{Functor: "-", Args: []Term{Atom("x"), Integer(1)}},
+	}, nil)
+	assert.NoError(t, err)
+
+	t.Run("key", func(t *testing.T) {
+		v := Variable("V")
+		ok, err := GetDict(Atom("y"), d, v, func(env *Env) *Promise {
+			assert.Equal(t, Integer(2), env.Resolve(v))
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("enumerate", func(t *testing.T) {
+		k, v := Variable("K"), Variable("V")
+		var pairs []Term
+		ok, err := GetDict(k, d, v, func(env *Env) *Promise {
+			pairs = append(pairs, env.Resolve(k), env.Resolve(v))
+			return Bool(false)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, []Term{Atom("x"), Integer(1), Atom("y"), Integer(2)}, pairs)
+	})
+
+	t.Run("no such key", func(t *testing.T) {
+		ok, err := GetDict(Atom("z"), d, Variable("V"), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("key is neither a variable, an atom, nor an integer", func(t *testing.T) {
+		ok, err := GetDict(Float(1), d, Variable("V"), Success, nil).Force(context.Background())
+		assert.Equal(t, typeErrorDictKey(Float(1), nil), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("dict is a variable", func(t *testing.T) {
+		ok, err := GetDict(Atom("x"), Variable("D"), Variable("V"), Success, nil).Force(context.Background())
+		assert.Equal(t, InstantiationError(Variable("D")), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("dict is not a dict", func(t *testing.T) {
+		ok, err := GetDict(Atom("x"), Atom("foo"), Variable("V"), Success, nil).Force(context.Background())
+		assert.Equal(t, typeErrorDict(Atom("foo"), nil), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("dict is a compound dict/2", func(t *testing.T) {
+		c := &Compound{Functor: "dict", Args: []Term{Atom("point"), List(&Compound{Functor: "-", Args: []Term{Atom("x"), Integer(1)}})}}
+		ok, err := GetDict(Atom("x"), c, Variable("V"), Success, nil).Force(context.Background())
+		assert.Equal(t, typeErrorDict(c, nil), err)
+		assert.False(t, ok)
+	})
+}
+
+func TestPutDict(t *testing.T) {
+	d, err := newDict(Atom("point"), []*Compound{
+		{Functor: "-", Args: []Term{Atom("x"), Integer(1)}},
+		{Functor: "-", Args: []Term{Atom("y"), Integer(2)}},
+	}, nil)
+	assert.NoError(t, err)
+
+	t.Run("add", func(t *testing.T) {
+		out := Variable("Out")
+		ok, err := PutDict(Atom("a"), d, Integer(0), out, func(env *Env) *Promise {
+			assert.Equal(t, &Compound{
+				Functor: dictFunctor,
+				Args: []Term{Atom("point"), List(
+					&Compound{Functor: "-", Args: []Term{Atom("a"), Integer(0)}},
+					&Compound{Functor: "-", Args: []Term{Atom("x"), Integer(1)}},
+					&Compound{Functor: "-", Args: []Term{Atom("y"), Integer(2)}},
+				)},
+			}, env.Resolve(out))
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		out := Variable("Out")
+		ok, err := PutDict(Atom("x"), d, Integer(3), out, func(env *Env) *Promise {
+			assert.Equal(t, &Compound{
+				Functor: dictFunctor,
+				Args: []Term{Atom("point"), List(
+					&Compound{Functor: "-", Args: []Term{Atom("x"), Integer(3)}},
+					&Compound{Functor: "-", Args: []Term{Atom("y"), Integer(2)}},
+				)},
+			}, env.Resolve(out))
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("key is a variable", func(t *testing.T) {
+		ok, err := PutDict(Variable("K"), d, Integer(3), Variable("Out"), Success, nil).Force(context.Background())
+		assert.Equal(t, InstantiationError(Variable("K")), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("dict is not a dict", func(t *testing.T) {
+		ok, err := PutDict(Atom("x"), Atom("foo"), Integer(3), Variable("Out"), Success, nil).Force(context.Background())
+		assert.Equal(t, typeErrorDict(Atom("foo"), nil), err)
+		assert.False(t, ok)
+	})
 }
 
 func TestState_Op(t *testing.T) {
@@ -758,81 +1138,256 @@ func TestState_Op(t *testing.T) {
 	t.Run("priority is not an integer", func(t *testing.T) {
 		var state State
 		ok, err := state.Op(Atom("foo"), Atom("xfx"), Atom("+"), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorInteger(Atom("foo")), err)
+		assert.Equal(t, typeErrorInteger(Atom("foo"), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("priority is negative", func(t *testing.T) {
 		var state State
 		ok, err := state.Op(Integer(-1), Atom("xfx"), Atom("+"), Success, nil).Force(context.Background())
-		assert.Equal(t, domainErrorOperatorPriority(Integer(-1)), err)
+		assert.Equal(t, domainErrorOperatorPriority(Integer(-1), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("priority is more than 1200", func(t *testing.T) {
 		var state State
 		ok, err := state.Op(Integer(1201), Atom("xfx"), Atom("+"), Success, nil).Force(context.Background())
-		assert.Equal(t, domainErrorOperatorPriority(Integer(1201)), err)
+		assert.Equal(t, domainErrorOperatorPriority(Integer(1201), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("specifier is not an atom", func(t *testing.T) {
 		var state State
 		ok, err := state.Op(Integer(1000), Integer(0), Atom("+"), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorAtom(Integer(0)), err)
+		assert.Equal(t, typeErrorAtom(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("specifier is not a valid operator specifier", func(t *testing.T) {
 		var state State
 		ok, err := state.Op(Integer(1000), Atom("foo"), Atom("+"), Success, nil).Force(context.Background())
-		assert.Equal(t, domainErrorOperatorSpecifier(Atom("foo")), err)
+		assert.Equal(t, domainErrorOperatorSpecifier(Atom("foo"), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("operator is not an atom", func(t *testing.T) {
 		var state State
 		ok, err := state.Op(Integer(1000), Atom("xfx"), Integer(0), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorAtom(Integer(0)), err)
+		assert.Equal(t, typeErrorAtom(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
-}
 
-func TestState_CurrentOp(t *testing.T) {
-	state := State{
-		operators: operators{
-			{
-				priority:  900,
-				specifier: operatorSpecifierXFX,
-				name:      "+++",
+	t.Run("redefine", func(t *testing.T) {
+		state := State{
+			operators: operators{
+				{
+					priority:  400,
+					specifier: operatorSpecifierYFX,
+					name:      "*",
+				},
+				{
+					priority:  500,
+					specifier: operatorSpecifierYFX,
+					name:      "+",
+				},
 			},
+		}
+		ok, err := state.Op(Integer(100), Atom("yfx"), Atom("+"), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		assert.Equal(t, operators{
 			{
-				priority:  1000,
-				specifier: operatorSpecifierXFX,
-				name:      "++",
+				priority:  100,
+				specifier: operatorSpecifierYFX,
+				name:      "+",
 			},
 			{
-				priority:  1100,
-				specifier: operatorSpecifierXFX,
-				name:      "+",
+				priority:  400,
+				specifier: operatorSpecifierYFX,
+				name:      "*",
 			},
-		},
-	}
+		}, state.operators)
+	})
 
-	t.Run("single solution", func(t *testing.T) {
-		ok, err := state.CurrentOp(Integer(1100), Atom("xfx"), Atom("+"), Success, nil).Force(context.Background())
+	t.Run("replace the same class", func(t *testing.T) {
+		state := State{
+			operators: operators{
+				{
+					priority:  200,
+					specifier: operatorSpecifierFY,
+					name:      "-",
+				},
+				{
+					priority:  500,
+					specifier: operatorSpecifierYFX,
+					name:      "-",
+				},
+			},
+		}
+		ok, err := state.Op(Integer(700), Atom("xfy"), Atom("-"), Success, nil).Force(context.Background())
 		assert.NoError(t, err)
 		assert.True(t, ok)
+
+		assert.Equal(t, operators{
+			{
+				priority:  200,
+				specifier: operatorSpecifierFY,
+				name:      "-",
+			},
+			{
+				priority:  700,
+				specifier: operatorSpecifierXFY,
+				name:      "-",
+			},
+		}, state.operators)
 	})
 
-	t.Run("multiple solutions", func(t *testing.T) {
-		var (
-			priority, specifier, operator = Variable("Priority"), Variable("Specifier"), Variable("Operator")
-			c                             int
-		)
-		ok, err := state.CurrentOp(priority, specifier, operator, func(env *Env) *Promise {
-			switch c {
-			case 0:
+	t.Run("infix and postfix", func(t *testing.T) {
+		state := State{
+			operators: operators{
+				{
+					priority:  500,
+					specifier: operatorSpecifierYFX,
+					name:      "-",
+				},
+			},
+		}
+		ok, err := state.Op(Integer(100), Atom("xf"), Atom("-"), Success, nil).Force(context.Background())
+		assert.Equal(t, permissionErrorCreateOperator(Atom("-"), nil), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("comma", func(t *testing.T) {
+		t.Run("define", func(t *testing.T) {
+			var state State
+			ok, err := state.Op(Integer(1000), Atom("xfy"), Atom(","), Success, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+		})
+
+		t.Run("modify", func(t *testing.T) {
+			var state State
+			ok, err := state.Op(Integer(900), Atom("xfy"), Atom(","), Success, nil).Force(context.Background())
+			assert.Equal(t, permissionErrorModifyOperator(Atom(","), nil), err)
+			assert.False(t, ok)
+		})
+
+		t.Run("remove", func(t *testing.T) {
+			var state State
+			ok, err := state.Op(Integer(0), Atom("xfy"), Atom(","), Success, nil).Force(context.Background())
+			assert.Equal(t, permissionErrorModifyOperator(Atom(","), nil), err)
+			assert.False(t, ok)
+		})
+	})
+
+	t.Run("bar", func(t *testing.T) {
+		t.Run("infix", func(t *testing.T) {
+			var state State
+			ok, err := state.Op(Integer(1100), Atom("xfy"), Atom("|"), Success, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+		})
+
+		t.Run("remove", func(t *testing.T) {
+			var state State
+			ok, err := state.Op(Integer(0), Atom("xfy"), Atom("|"), Success, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+		})
+
+		t.Run("priority less than 1001", func(t *testing.T) {
+			var state State
+			ok, err := state.Op(Integer(1000), Atom("xfy"), Atom("|"), Success, nil).Force(context.Background())
+			assert.Equal(t, permissionErrorCreateOperator(Atom("|"), nil), err)
+			assert.False(t, ok)
+		})
+
+		t.Run("prefix", func(t *testing.T) {
+			var state State
+			ok, err := state.Op(Integer(1100), Atom("fy"), Atom("|"), Success, nil).Force(context.Background())
+			assert.Equal(t, permissionErrorCreateOperator(Atom("|"), nil), err)
+			assert.False(t, ok)
+		})
+	})
+
+	t.Run("empty list", func(t *testing.T) {
+		var state State
+		ok, err := state.Op(Integer(1000), Atom("xfy"), Atom("[]"), Success, nil).Force(context.Background())
+		assert.Equal(t, permissionErrorCreateOperator(Atom("[]"), nil), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("curly brackets", func(t *testing.T) {
+		var state State
+		ok, err := state.Op(Integer(1000), Atom("xfy"), Atom("{}"), Success, nil).Force(context.Background())
+		assert.Equal(t, permissionErrorCreateOperator(Atom("{}"), nil), err)
+		assert.False(t, ok)
+	})
+}
+
+func TestState_CurrentOperators(t *testing.T) {
+	state := State{
+		operators: operators{
+			{
+				priority:  200,
+				specifier: operatorSpecifierFY,
+				name:      "-",
+			},
+			{
+				priority:  500,
+				specifier: operatorSpecifierYFX,
+				name:      "-",
+			},
+		},
+	}
+
+	ops := state.CurrentOperators()
+	assert.Equal(t, []Operator{
+		{Priority: 200, Specifier: "fy", Name: "-"},
+		{Priority: 500, Specifier: "yfx", Name: "-"},
+	}, ops)
+
+	// it's a copy.
+	ops[0].Priority = 0
+	assert.Equal(t, Integer(200), state.operators[0].priority)
+}
+
+func TestState_CurrentOp(t *testing.T) {
+	state := State{
+		operators: operators{
+			{
+				priority:  900,
+				specifier: operatorSpecifierXFX,
+				name:      "+++",
+			},
+			{
+				priority:  1000,
+				specifier: operatorSpecifierXFX,
+				name:      "++",
+			},
+			{
+				priority:  1100,
+				specifier: operatorSpecifierXFX,
+				name:      "+",
+			},
+		},
+	}
+
+	t.Run("single solution", func(t *testing.T) {
+		ok, err := state.CurrentOp(Integer(1100), Atom("xfx"), Atom("+"), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("multiple solutions", func(t *testing.T) {
+		var (
+			priority, specifier, operator = Variable("Priority"), Variable("Specifier"), Variable("Operator")
+			c                             int
+		)
+		ok, err := state.CurrentOp(priority, specifier, operator, func(env *Env) *Promise {
+			switch c {
+			case 0:
 				assert.Equal(t, Integer(900), env.Resolve(priority))
 				assert.Equal(t, Atom("xfx"), env.Resolve(specifier))
 				assert.Equal(t, Atom("+++"), env.Resolve(operator))
@@ -854,16 +1409,55 @@ func TestState_CurrentOp(t *testing.T) {
 		assert.False(t, ok)
 	})
 
+	t.Run("prefix and infix", func(t *testing.T) {
+		state := State{
+			operators: operators{
+				{
+					priority:  200,
+					specifier: operatorSpecifierFY,
+					name:      "-",
+				},
+				{
+					priority:  500,
+					specifier: operatorSpecifierYFX,
+					name:      "-",
+				},
+			},
+		}
+
+		var (
+			priority, specifier = Variable("Priority"), Variable("Specifier")
+			c                   int
+		)
+		ok, err := state.CurrentOp(priority, specifier, Atom("-"), func(env *Env) *Promise {
+			switch c {
+			case 0:
+				assert.Equal(t, Integer(200), env.Resolve(priority))
+				assert.Equal(t, Atom("fy"), env.Resolve(specifier))
+			case 1:
+				assert.Equal(t, Integer(500), env.Resolve(priority))
+				assert.Equal(t, Atom("yfx"), env.Resolve(specifier))
+			default:
+				assert.Fail(t, "unreachable")
+			}
+			c++
+			return Bool(false)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, 2, c)
+	})
+
 	t.Run("priority is not an operator priority", func(t *testing.T) {
 		t.Run("priority is not an integer", func(t *testing.T) {
 			ok, err := state.CurrentOp(Atom("foo"), Atom("xfx"), Atom("+"), Success, nil).Force(context.Background())
-			assert.Equal(t, domainErrorOperatorPriority(Atom("foo")), err)
+			assert.Equal(t, domainErrorOperatorPriority(Atom("foo"), nil), err)
 			assert.False(t, ok)
 		})
 
 		t.Run("priority is negative", func(t *testing.T) {
 			ok, err := state.CurrentOp(Integer(-1), Atom("xfx"), Atom("+"), Success, nil).Force(context.Background())
-			assert.Equal(t, domainErrorOperatorPriority(Integer(-1)), err)
+			assert.Equal(t, domainErrorOperatorPriority(Integer(-1), nil), err)
 			assert.False(t, ok)
 		})
 	})
@@ -871,20 +1465,20 @@ func TestState_CurrentOp(t *testing.T) {
 	t.Run("specifier is not an operator specifier", func(t *testing.T) {
 		t.Run("specifier is not an atom", func(t *testing.T) {
 			ok, err := state.CurrentOp(Integer(1100), Integer(0), Atom("+"), Success, nil).Force(context.Background())
-			assert.Equal(t, domainErrorOperatorSpecifier(Integer(0)), err)
+			assert.Equal(t, domainErrorOperatorSpecifier(Integer(0), nil), err)
 			assert.False(t, ok)
 		})
 
 		t.Run("specifier is a non-specifier atom", func(t *testing.T) {
 			ok, err := state.CurrentOp(Integer(1100), Atom("foo"), Atom("+"), Success, nil).Force(context.Background())
-			assert.Equal(t, domainErrorOperatorSpecifier(Atom("foo")), err)
+			assert.Equal(t, domainErrorOperatorSpecifier(Atom("foo"), nil), err)
 			assert.False(t, ok)
 		})
 	})
 
 	t.Run("operator is not an atom", func(t *testing.T) {
 		ok, err := state.CurrentOp(Integer(1100), Atom("xfx"), Integer(0), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorAtom(Integer(0)), err)
+		assert.Equal(t, typeErrorAtom(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 }
@@ -1023,6 +1617,21 @@ func TestState_BagOf(t *testing.T) {
 		})
 	})
 
+	t.Run("goal fails", func(t *testing.T) {
+		state := State{
+			VM: VM{
+				procedures: map[ProcedureIndicator]procedure{
+					{Name: "fail", Arity: 0}: predicate0(func(f func(*Env) *Promise, env *Env) *Promise {
+						return Bool(false)
+					}),
+				},
+			},
+		}
+		ok, err := state.BagOf(NewVariable(), Atom("fail"), NewVariable(), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+
 	t.Run("goal is a variable", func(t *testing.T) {
 		goal := Variable("Goal")
 
@@ -1035,7 +1644,7 @@ func TestState_BagOf(t *testing.T) {
 	t.Run("goal is neither a variable nor a callable term", func(t *testing.T) {
 		var state State
 		ok, err := state.BagOf(NewVariable(), Integer(0), NewVariable(), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorCallable(Integer(0)), err)
+		assert.Equal(t, typeErrorCallable(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -1282,6 +1891,21 @@ func TestState_SetOf(t *testing.T) {
 		})
 	})
 
+	t.Run("goal fails", func(t *testing.T) {
+		state := State{
+			VM: VM{
+				procedures: map[ProcedureIndicator]procedure{
+					{Name: "fail", Arity: 0}: predicate0(func(f func(*Env) *Promise, env *Env) *Promise {
+						return Bool(false)
+					}),
+				},
+			},
+		}
+		ok, err := state.SetOf(NewVariable(), Atom("fail"), NewVariable(), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+
 	t.Run("goal is a variable", func(t *testing.T) {
 		goal := Variable("Goal")
 
@@ -1294,7 +1918,7 @@ func TestState_SetOf(t *testing.T) {
 	t.Run("goal is neither a variable nor a callable term", func(t *testing.T) {
 		var state State
 		ok, err := state.SetOf(NewVariable(), Integer(0), NewVariable(), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorCallable(Integer(0)), err)
+		assert.Equal(t, typeErrorCallable(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 }
@@ -1373,7 +1997,7 @@ func TestState_FindAll(t *testing.T) {
 	t.Run("goal is neither a variable nor a callable term", func(t *testing.T) {
 		var state State
 		ok, err := state.FindAll(NewVariable(), Integer(0), NewVariable(), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorCallable(Integer(0)), err)
+		assert.Equal(t, typeErrorCallable(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -1396,6 +2020,27 @@ func TestState_FindAll(t *testing.T) {
 		assert.NoError(t, err)
 		assert.True(t, ok)
 	})
+
+	t.Run("goal doesn't leave bindings", func(t *testing.T) {
+		state := State{
+			VM: VM{
+				procedures: map[ProcedureIndicator]procedure{
+					{Name: "=", Arity: 2}: predicate2(Unify),
+				},
+			},
+		}
+		x, instances := Variable("X"), Variable("Instances")
+		ok, err := state.FindAll(x, &Compound{
+			Functor: "=",
+			Args:    []Term{x, Atom("a")},
+		}, instances, func(env *Env) *Promise {
+			assert.Equal(t, List(Atom("a")), env.Resolve(instances))
+			assert.Equal(t, x, env.Resolve(x))
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
 }
 
 func TestCompare(t *testing.T) {
@@ -1444,13 +2089,13 @@ func TestCompare(t *testing.T) {
 
 	t.Run("order is neither a variable nor an atom", func(t *testing.T) {
 		ok, err := Compare(Integer(0), NewVariable(), NewVariable(), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorAtom(Integer(0)), err)
+		assert.Equal(t, typeErrorAtom(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("order is an atom but not <, =, or >", func(t *testing.T) {
 		ok, err := Compare(Atom("foo"), NewVariable(), NewVariable(), Success, nil).Force(context.Background())
-		assert.Equal(t, domainErrorOrder(Atom("foo")), err)
+		assert.Equal(t, domainErrorOrder(Atom("foo"), nil), err)
 		assert.False(t, ok)
 	})
 }
@@ -1495,6 +2140,22 @@ func TestState_Catch(t *testing.T) {
 		assert.True(t, ok)
 	})
 
+	t.Run("bindings of goal are discarded", func(t *testing.T) {
+		x := Variable("X")
+		ok, err := state.Catch(&Compound{
+			Functor: ",",
+			Args: []Term{
+				&Compound{Functor: "=", Args: []Term{x, Atom("a")}},
+				&Compound{Functor: "throw", Args: []Term{Atom("e")}},
+			},
+		}, Atom("e"), Atom("true"), func(env *Env) *Promise {
+			assert.Equal(t, x, env.Resolve(x))
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
 	t.Run("not match", func(t *testing.T) {
 		ok, err := state.Catch(&Compound{
 			Functor: "throw",
@@ -1598,7 +2259,7 @@ func TestState_CurrentPredicate(t *testing.T) {
 		t.Run("atom", func(t *testing.T) {
 			var state State
 			ok, err := state.CurrentPredicate(Atom("foo"), Success, nil).Force(context.Background())
-			assert.Equal(t, typeErrorPredicateIndicator(Atom("foo")), err)
+			assert.Equal(t, typeErrorPredicateIndicator(Atom("foo"), nil), err)
 			assert.False(t, ok)
 		})
 
@@ -1612,7 +2273,7 @@ func TestState_CurrentPredicate(t *testing.T) {
 				assert.Equal(t, typeErrorPredicateIndicator(&Compound{
 					Functor: "f",
 					Args:    []Term{Atom("a")},
-				}), err)
+				}, nil), err)
 				assert.False(t, ok)
 			})
 
@@ -1625,7 +2286,7 @@ func TestState_CurrentPredicate(t *testing.T) {
 				assert.Equal(t, typeErrorPredicateIndicator(&Compound{
 					Functor: "/",
 					Args:    []Term{Integer(0), Integer(0)},
-				}), err)
+				}, nil), err)
 				assert.False(t, ok)
 			})
 
@@ -1638,7 +2299,7 @@ func TestState_CurrentPredicate(t *testing.T) {
 				assert.Equal(t, typeErrorPredicateIndicator(&Compound{
 					Functor: "/",
 					Args:    []Term{Atom("foo"), Atom("bar")},
-				}), err)
+				}, nil), err)
 				assert.False(t, ok)
 			})
 		})
@@ -1735,7 +2396,7 @@ func TestState_Assertz(t *testing.T) {
 	t.Run("clause is neither a variable, nor callable", func(t *testing.T) {
 		var state State
 		ok, err := state.Assertz(Integer(0), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorCallable(Integer(0)), err)
+		assert.Equal(t, typeErrorCallable(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -1757,7 +2418,7 @@ func TestState_Assertz(t *testing.T) {
 			Functor: ":-",
 			Args:    []Term{Integer(0), Atom("true")},
 		}, Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorCallable(Integer(0)), err)
+		assert.Equal(t, typeErrorCallable(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -1779,7 +2440,7 @@ func TestState_Assertz(t *testing.T) {
 			Functor: ":-",
 			Args:    []Term{Integer(0)},
 		}, Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorCallable(Integer(0)), err)
+		assert.Equal(t, typeErrorCallable(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -1804,7 +2465,7 @@ func TestState_Assertz(t *testing.T) {
 				Atom("true"),
 				Integer(0),
 			},
-		}), err)
+		}, nil), err)
 		assert.False(t, ok)
 	})
 
@@ -1824,7 +2485,7 @@ func TestState_Assertz(t *testing.T) {
 				Atom("foo"),
 				Integer(0),
 			},
-		}), err)
+		}, nil), err)
 		assert.False(t, ok)
 	})
 
@@ -1844,7 +2505,97 @@ func TestState_Assertz(t *testing.T) {
 				Atom("foo"),
 				Integer(0),
 			},
-		}), err)
+		}, nil), err)
+		assert.False(t, ok)
+	})
+}
+
+func TestState_AssertzAll(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var state State
+
+		ok, err := state.AssertzAll(List(
+			&Compound{Functor: "foo", Args: []Term{Integer(1)}},
+			&Compound{Functor: "foo", Args: []Term{Integer(2)}},
+		), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		cs, ok := state.procedures[ProcedureIndicator{Name: "foo", Arity: 1}].(clauses)
+		assert.True(t, ok)
+		assert.Len(t, cs, 2)
+		assert.Equal(t, &Compound{Functor: "foo", Args: []Term{Integer(1)}}, cs[0].raw)
+		assert.Equal(t, &Compound{Functor: "foo", Args: []Term{Integer(2)}}, cs[1].raw)
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		var state State
+
+		ok, err := state.AssertzAll(List(
+			&Compound{Functor: "foo", Args: []Term{Integer(1)}},
+			Integer(2),
+		), Success, nil).Force(context.Background())
+		assert.Equal(t, typeErrorCallable(Integer(2), nil), err)
+		assert.False(t, ok)
+
+		_, ok = state.procedures[ProcedureIndicator{Name: "foo", Arity: 1}]
+		assert.False(t, ok)
+	})
+
+	t.Run("static", func(t *testing.T) {
+		state := State{
+			VM: VM{
+				procedures: map[ProcedureIndicator]procedure{
+					{Name: "bar", Arity: 0}: static{},
+				},
+			},
+		}
+
+		ok, err := state.AssertzAll(List(
+			&Compound{Functor: "foo", Args: []Term{Integer(1)}},
+			Atom("bar"),
+		), Success, nil).Force(context.Background())
+		assert.Equal(t, permissionErrorModifyStaticProcedure(&Compound{Functor: "/", Args: []Term{Atom("bar"), Integer(0)}}, nil), err)
+		assert.False(t, ok)
+
+		_, ok = state.procedures[ProcedureIndicator{Name: "foo", Arity: 1}]
+		assert.False(t, ok)
+	})
+
+	t.Run("directive", func(t *testing.T) {
+		var called bool
+		state := State{
+			VM: VM{
+				procedures: map[ProcedureIndicator]procedure{
+					{Name: "bar", Arity: 0}: predicate0(func(k func(*Env) *Promise, env *Env) *Promise {
+						called = true
+						return k(env)
+					}),
+				},
+			},
+		}
+
+		ok, err := state.AssertzAll(List(
+			&Compound{Functor: "foo", Args: []Term{Integer(1)}},
+			&Compound{Functor: ":-", Args: []Term{Atom("bar")}},
+		), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.True(t, called)
+
+		_, ok = state.procedures[ProcedureIndicator{Name: ":-", Arity: 1}]
+		assert.False(t, ok)
+		cs, ok := state.procedures[ProcedureIndicator{Name: "foo", Arity: 1}].(clauses)
+		assert.True(t, ok)
+		assert.Len(t, cs, 1)
+	})
+
+	t.Run("partial list", func(t *testing.T) {
+		var state State
+
+		list := ListRest(Variable("Rest"), &Compound{Functor: "foo", Args: []Term{Integer(1)}})
+		ok, err := state.AssertzAll(list, Success, nil).Force(context.Background())
+		assert.Equal(t, InstantiationError(list), err)
 		assert.False(t, ok)
 	})
 }
@@ -2016,7 +2767,7 @@ func TestState_Asserta(t *testing.T) {
 	t.Run("clause is neither a variable, nor callable", func(t *testing.T) {
 		var state State
 		ok, err := state.Asserta(Integer(0), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorCallable(Integer(0)), err)
+		assert.Equal(t, typeErrorCallable(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -2038,7 +2789,7 @@ func TestState_Asserta(t *testing.T) {
 			Functor: ":-",
 			Args:    []Term{Integer(0), Atom("true")},
 		}, Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorCallable(Integer(0)), err)
+		assert.Equal(t, typeErrorCallable(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -2048,7 +2799,7 @@ func TestState_Asserta(t *testing.T) {
 			Functor: ":-",
 			Args:    []Term{Atom("foo"), Integer(0)},
 		}, Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorCallable(Integer(0)), err)
+		assert.Equal(t, typeErrorCallable(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -2070,7 +2821,7 @@ func TestState_Asserta(t *testing.T) {
 			Functor: ":-",
 			Args:    []Term{Integer(0)},
 		}, Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorCallable(Integer(0)), err)
+		assert.Equal(t, typeErrorCallable(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -2093,7 +2844,7 @@ func TestState_Asserta(t *testing.T) {
 			Args: []Term{
 				Atom("true"),
 				Integer(0)},
-		}), err)
+		}, nil), err)
 		assert.False(t, ok)
 	})
 
@@ -2113,7 +2864,7 @@ func TestState_Asserta(t *testing.T) {
 				Atom("foo"),
 				Integer(0),
 			},
-		}), err)
+		}, nil), err)
 		assert.False(t, ok)
 	})
 
@@ -2133,7 +2884,7 @@ func TestState_Asserta(t *testing.T) {
 				Atom("foo"),
 				Integer(0),
 			},
-		}), err)
+		}, nil), err)
 		assert.False(t, ok)
 	})
 
@@ -2241,7 +2992,7 @@ func TestState_AssertStatic(t *testing.T) {
 	t.Run("clause is neither a variable, nor callable", func(t *testing.T) {
 		var state State
 		ok, err := state.AssertStatic(Integer(0), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorCallable(Integer(0)), err)
+		assert.Equal(t, typeErrorCallable(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -2263,7 +3014,7 @@ func TestState_AssertStatic(t *testing.T) {
 			Functor: ":-",
 			Args:    []Term{Integer(0), Atom("true")},
 		}, Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorCallable(Integer(0)), err)
+		assert.Equal(t, typeErrorCallable(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -2285,7 +3036,7 @@ func TestState_AssertStatic(t *testing.T) {
 			Functor: ":-",
 			Args:    []Term{Integer(0)},
 		}, Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorCallable(Integer(0)), err)
+		assert.Equal(t, typeErrorCallable(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -2310,7 +3061,7 @@ func TestState_AssertStatic(t *testing.T) {
 				Atom("true"),
 				Integer(0),
 			},
-		}), err)
+		}, nil), err)
 		assert.False(t, ok)
 	})
 
@@ -2378,28 +3129,90 @@ func TestState_AssertStatic(t *testing.T) {
 				Atom("foo"),
 				Integer(0),
 			},
-		}), err)
+		}, nil), err)
 		assert.False(t, ok)
 	})
 }
 
-func TestState_Retract(t *testing.T) {
-	t.Run("retract the first one", func(t *testing.T) {
-		state := State{
-			VM: VM{
-				procedures: map[ProcedureIndicator]procedure{
-					{Name: "foo", Arity: 1}: clauses{
-						{raw: &Compound{Functor: "foo", Args: []Term{Atom("a")}}},
-						{raw: &Compound{Functor: "foo", Args: []Term{Atom("b")}}},
-						{raw: &Compound{Functor: "foo", Args: []Term{Atom("c")}}},
-					},
-				},
-			},
-		}
+func TestState_Erase(t *testing.T) {
+	var state State
 
-		ok, err := state.Retract(&Compound{
-			Functor: "foo",
-			Args:    []Term{Variable("X")},
+	refs := make([]Term, 3)
+	for i, name := range []Atom{"a", "b", "c"} {
+		ok, err := state.Assertz2(&Compound{Functor: "foo", Args: []Term{name}}, Variable("Ref"), func(env *Env) *Promise {
+			refs[i] = env.Resolve(Variable("Ref"))
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	}
+
+	var d Term
+	ok, err := state.Asserta2(&Compound{Functor: "foo", Args: []Term{Atom("d")}}, Variable("Ref"), func(env *Env) *Promise {
+		d = env.Resolve(Variable("Ref"))
+		return Bool(true)
+	}, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	t.Run("ok", func(t *testing.T) {
+		ok, err := state.Erase(refs[1], Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = state.Erase(d, Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		cs := state.procedures[ProcedureIndicator{Name: "foo", Arity: 1}].(clauses)
+		assert.Len(t, cs, 2)
+		assert.Equal(t, &Compound{Functor: "foo", Args: []Term{Atom("a")}}, cs[0].raw)
+		assert.Equal(t, &Compound{Functor: "foo", Args: []Term{Atom("c")}}, cs[1].raw)
+	})
+
+	t.Run("already erased", func(t *testing.T) {
+		ok, err := state.Erase(refs[1], Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("ref is a variable", func(t *testing.T) {
+		ok, err := state.Erase(Variable("Ref"), Success, nil).Force(context.Background())
+		assert.Equal(t, InstantiationError(Variable("Ref")), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("ref is not a clause reference", func(t *testing.T) {
+		ok, err := state.Erase(Atom("foo"), Success, nil).Force(context.Background())
+		assert.Equal(t, typeErrorDBReference(Atom("foo"), nil), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("ref is already instantiated on assertion", func(t *testing.T) {
+		ok, err := state.Assertz2(&Compound{Functor: "foo", Args: []Term{Atom("e")}}, refs[0], Success, nil).Force(context.Background())
+		assert.Equal(t, uninstantiationError(refs[0], nil), err)
+		assert.False(t, ok)
+		assert.Len(t, state.procedures[ProcedureIndicator{Name: "foo", Arity: 1}], 2)
+	})
+}
+
+func TestState_Retract(t *testing.T) {
+	t.Run("retract the first one", func(t *testing.T) {
+		state := State{
+			VM: VM{
+				procedures: map[ProcedureIndicator]procedure{
+					{Name: "foo", Arity: 1}: clauses{
+						{raw: &Compound{Functor: "foo", Args: []Term{Atom("a")}}},
+						{raw: &Compound{Functor: "foo", Args: []Term{Atom("b")}}},
+						{raw: &Compound{Functor: "foo", Args: []Term{Atom("c")}}},
+					},
+				},
+			},
+		}
+
+		ok, err := state.Retract(&Compound{
+			Functor: "foo",
+			Args:    []Term{Variable("X")},
 		}, Success, nil).Force(context.Background())
 		assert.NoError(t, err)
 		assert.True(t, ok)
@@ -2410,6 +3223,87 @@ func TestState_Retract(t *testing.T) {
 		}, state.procedures[ProcedureIndicator{Name: "foo", Arity: 1}])
 	})
 
+	t.Run("retract a rule", func(t *testing.T) {
+		rule := &Compound{
+			Functor: ":-",
+			Args: []Term{
+				&Compound{Functor: "foo", Args: []Term{Variable("X")}},
+				&Compound{Functor: "bar", Args: []Term{Variable("X")}},
+			},
+		}
+		state := State{
+			VM: VM{
+				procedures: map[ProcedureIndicator]procedure{
+					{Name: "foo", Arity: 1}: clauses{
+						{raw: &Compound{Functor: "foo", Args: []Term{Atom("a")}}},
+						{raw: rule},
+					},
+				},
+			},
+		}
+
+		t.Run("body doesn't match", func(t *testing.T) {
+			ok, err := state.Retract(&Compound{
+				Functor: ":-",
+				Args: []Term{
+					&Compound{Functor: "foo", Args: []Term{Variable("Y")}},
+					&Compound{Functor: "baz", Args: []Term{Variable("Y")}},
+				},
+			}, Success, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.False(t, ok)
+		})
+
+		t.Run("head and body match", func(t *testing.T) {
+			ok, err := state.Retract(&Compound{
+				Functor: ":-",
+				Args: []Term{
+					&Compound{Functor: "foo", Args: []Term{Variable("Y")}},
+					&Compound{Functor: "bar", Args: []Term{Variable("Y")}},
+				},
+			}, Success, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+
+			assert.Equal(t, clauses{
+				{raw: &Compound{Functor: "foo", Args: []Term{Atom("a")}}},
+			}, state.procedures[ProcedureIndicator{Name: "foo", Arity: 1}])
+		})
+	})
+
+	t.Run("retract the last one", func(t *testing.T) {
+		state := State{
+			VM: VM{
+				procedures: map[ProcedureIndicator]procedure{
+					{Name: "foo", Arity: 1}: clauses{
+						{raw: &Compound{Functor: "foo", Args: []Term{Atom("a")}}},
+					},
+				},
+			},
+		}
+
+		ok, err := state.Retract(&Compound{
+			Functor: "foo",
+			Args:    []Term{Variable("X")},
+		}, Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		// The procedure stays defined as a dynamic procedure without clauses.
+		assert.Equal(t, clauses{}, state.procedures[ProcedureIndicator{Name: "foo", Arity: 1}])
+
+		ok, err = state.CurrentPredicate(&Compound{
+			Functor: "/",
+			Args:    []Term{Atom("foo"), Integer(1)},
+		}, Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = state.Arrive(ProcedureIndicator{Name: "foo", Arity: 1}, []Term{Variable("X")}, Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+
 	t.Run("retract the specific one", func(t *testing.T) {
 		state := State{
 			VM: VM{
@@ -2470,7 +3364,7 @@ func TestState_Retract(t *testing.T) {
 	t.Run("not callable", func(t *testing.T) {
 		var state State
 		ok, err := state.Retract(Integer(0), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorCallable(Integer(0)), err)
+		assert.Equal(t, typeErrorCallable(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -2498,7 +3392,7 @@ func TestState_Retract(t *testing.T) {
 		assert.Equal(t, permissionErrorModifyStaticProcedure(&Compound{
 			Functor: "/",
 			Args:    []Term{Atom("foo"), Integer(0)},
-		}), err)
+		}, nil), err)
 		assert.False(t, ok)
 	})
 
@@ -2590,7 +3484,7 @@ func TestState_Abolish(t *testing.T) {
 	t.Run("pi is neither a variable nor a predicate indicator", func(t *testing.T) {
 		var state State
 		ok, err := state.Abolish(Integer(0), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorPredicateIndicator(Integer(0)), err)
+		assert.Equal(t, typeErrorPredicateIndicator(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -2600,7 +3494,7 @@ func TestState_Abolish(t *testing.T) {
 			Functor: "/",
 			Args:    []Term{Integer(0), Integer(2)},
 		}, Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorAtom(Integer(0)), err)
+		assert.Equal(t, typeErrorAtom(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -2610,7 +3504,7 @@ func TestState_Abolish(t *testing.T) {
 			Functor: "/",
 			Args:    []Term{Atom("foo"), Atom("bar")},
 		}, Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorInteger(Atom("bar")), err)
+		assert.Equal(t, typeErrorInteger(Atom("bar"), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -2620,7 +3514,7 @@ func TestState_Abolish(t *testing.T) {
 			Functor: "/",
 			Args:    []Term{Atom("foo"), Integer(-2)},
 		}, Success, nil).Force(context.Background())
-		assert.Equal(t, domainErrorNotLessThanZero(Integer(-2)), err)
+		assert.Equal(t, domainErrorNotLessThanZero(Integer(-2), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -2639,7 +3533,7 @@ func TestState_Abolish(t *testing.T) {
 		assert.Equal(t, permissionErrorModifyStaticProcedure(&Compound{
 			Functor: "/",
 			Args:    []Term{Atom("foo"), Integer(0)},
-		}), err)
+		}, nil), err)
 		assert.False(t, ok)
 	})
 }
@@ -2656,10 +3550,33 @@ func TestState_CurrentInput(t *testing.T) {
 		assert.True(t, ok)
 	})
 
+	t.Run("alias", func(t *testing.T) {
+		var s, other Stream
+		state := State{
+			input: &s,
+			streams: map[Term]*Stream{
+				Atom("user_input"): &s,
+				Atom("other"):      &other,
+			},
+		}
+
+		ok, err := state.CurrentInput(Atom("user_input"), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = state.CurrentInput(Atom("other"), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+		ok, err = state.CurrentInput(Atom("foo"), Success, nil).Force(context.Background())
+		assert.Equal(t, domainErrorStream(Atom("foo"), nil), err)
+		assert.False(t, ok)
+	})
+
 	t.Run("stream is neither a variable nor a stream", func(t *testing.T) {
 		var state State
 		ok, err := state.CurrentInput(Integer(0), Success, nil).Force(context.Background())
-		assert.Equal(t, domainErrorStream(Integer(0)), err)
+		assert.Equal(t, domainErrorStream(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 }
@@ -2676,10 +3593,33 @@ func TestState_CurrentOutput(t *testing.T) {
 		assert.True(t, ok)
 	})
 
+	t.Run("alias", func(t *testing.T) {
+		var s, other Stream
+		state := State{
+			output: &s,
+			streams: map[Term]*Stream{
+				Atom("user_output"): &s,
+				Atom("other"):       &other,
+			},
+		}
+
+		ok, err := state.CurrentOutput(Atom("user_output"), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		ok, err = state.CurrentOutput(Atom("other"), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+
+		ok, err = state.CurrentOutput(Atom("foo"), Success, nil).Force(context.Background())
+		assert.Equal(t, domainErrorStream(Atom("foo"), nil), err)
+		assert.False(t, ok)
+	})
+
 	t.Run("stream is neither a variable nor a stream", func(t *testing.T) {
 		var state State
 		ok, err := state.CurrentOutput(Integer(0), Success, nil).Force(context.Background())
-		assert.Equal(t, domainErrorStream(Integer(0)), err)
+		assert.Equal(t, domainErrorStream(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 }
@@ -2725,14 +3665,14 @@ func TestState_SetInput(t *testing.T) {
 	t.Run("streamOrAlias is neither a variable, nor a stream term or alias", func(t *testing.T) {
 		var state State
 		ok, err := state.SetInput(Integer(0), Success, nil).Force(context.Background())
-		assert.Equal(t, domainErrorStreamOrAlias(Integer(0)), err)
+		assert.Equal(t, domainErrorStreamOrAlias(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("streamOrAlias is not associated with an open stream", func(t *testing.T) {
 		var state State
 		ok, err := state.SetInput(Atom("x"), Success, nil).Force(context.Background())
-		assert.Equal(t, existenceErrorStream(Atom("x")), err)
+		assert.Equal(t, existenceErrorStream(Atom("x"), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -2742,7 +3682,7 @@ func TestState_SetInput(t *testing.T) {
 			Bind(v, NewStream(os.Stdout, StreamModeWrite))
 		var state State
 		ok, err := state.SetInput(v, Success, env).Force(context.Background())
-		assert.Equal(t, permissionErrorInputStream(v), err)
+		assert.Equal(t, permissionErrorInputStream(v, env), err)
 		assert.False(t, ok)
 	})
 }
@@ -2785,14 +3725,14 @@ func TestState_SetOutput(t *testing.T) {
 	t.Run("streamOrAlias is neither a variable, nor a stream term or alias", func(t *testing.T) {
 		var state State
 		ok, err := state.SetOutput(Integer(0), Success, nil).Force(context.Background())
-		assert.Equal(t, domainErrorStreamOrAlias(Integer(0)), err)
+		assert.Equal(t, domainErrorStreamOrAlias(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("streamOrAlias is not associated with an open stream", func(t *testing.T) {
 		var state State
 		ok, err := state.SetOutput(Atom("x"), Success, nil).Force(context.Background())
-		assert.Equal(t, existenceErrorStream(Atom("x")), err)
+		assert.Equal(t, existenceErrorStream(Atom("x"), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -2803,7 +3743,7 @@ func TestState_SetOutput(t *testing.T) {
 
 		var state State
 		ok, err := state.SetOutput(s, Success, env).Force(context.Background())
-		assert.Equal(t, permissionErrorOutputStream(s), err)
+		assert.Equal(t, permissionErrorOutputStream(s, env), err)
 		assert.False(t, ok)
 	})
 }
@@ -3100,6 +4040,63 @@ func TestState_Open(t *testing.T) {
 		assert.True(t, ok)
 	})
 
+	t.Run("buffer", func(t *testing.T) {
+		tests := []struct {
+			buffer                  Atom
+			afterChar, afterNewline string
+		}{
+			{buffer: "false", afterChar: "a", afterNewline: "a\n"},
+			{buffer: "line", afterChar: "", afterNewline: "a\n"},
+			{buffer: "full", afterChar: "", afterNewline: ""},
+		}
+
+		for _, tt := range tests {
+			t.Run(string(tt.buffer), func(t *testing.T) {
+				f, err := ioutil.TempFile("", "open_test_buffer")
+				assert.NoError(t, err)
+				assert.NoError(t, f.Close())
+				defer func() {
+					assert.NoError(t, os.Remove(f.Name()))
+				}()
+
+				content := func() string {
+					b, err := ioutil.ReadFile(f.Name())
+					assert.NoError(t, err)
+					return string(b)
+				}
+
+				v := Variable("Stream")
+				ok, err := state.Open(Atom(f.Name()), Atom("write"), v, List(&Compound{
+					Functor: "buffer",
+					Args:    []Term{tt.buffer},
+				}), func(env *Env) *Promise {
+					s := env.Resolve(v).(*Stream)
+					assert.Equal(t, tt.buffer, Atom(s.buffer.String()))
+
+					ok, err := state.PutCode(s, Integer('a'), Success, env).Force(context.Background())
+					assert.NoError(t, err)
+					assert.True(t, ok)
+					assert.Equal(t, tt.afterChar, content())
+
+					ok, err = state.PutCode(s, Integer('\n'), Success, env).Force(context.Background())
+					assert.NoError(t, err)
+					assert.True(t, ok)
+					assert.Equal(t, tt.afterNewline, content())
+
+					ok, err = state.FlushOutput(s, Success, env).Force(context.Background())
+					assert.NoError(t, err)
+					assert.True(t, ok)
+					assert.Equal(t, "a\n", content())
+
+					assert.NoError(t, s.Close())
+					return Bool(true)
+				}, nil).Force(context.Background())
+				assert.NoError(t, err)
+				assert.True(t, ok)
+			})
+		}
+	})
+
 	t.Run("sourceSink is a variable", func(t *testing.T) {
 		sourceSink := Variable("Source_Sink")
 
@@ -3148,42 +4145,42 @@ func TestState_Open(t *testing.T) {
 	t.Run("mode is neither a variable nor an atom", func(t *testing.T) {
 		var state State
 		ok, err := state.Open(Atom("/dev/null"), Integer(0), Variable("Stream"), List(), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorAtom(Integer(0)), err)
+		assert.Equal(t, typeErrorAtom(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("options is neither a partial list nor a list", func(t *testing.T) {
 		var state State
 		ok, err := state.Open(Atom("/dev/null"), Atom("read"), Variable("Stream"), Atom("list"), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorList(Atom("list")), err)
+		assert.Equal(t, typeErrorList(Atom("list"), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("stream is not a variable", func(t *testing.T) {
 		var state State
 		ok, err := state.Open(Atom("/dev/null"), Atom("read"), Atom("stream"), List(), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorVariable(Atom("stream")), err)
+		assert.Equal(t, typeErrorVariable(Atom("stream"), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("sourceSink is neither a variable nor a source/sink", func(t *testing.T) {
 		var state State
 		ok, err := state.Open(Integer(0), Atom("read"), Variable("Stream"), List(), Success, nil).Force(context.Background())
-		assert.Equal(t, domainErrorSourceSink(Integer(0)), err)
+		assert.Equal(t, domainErrorSourceSink(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("mode is an atom but not an input/output mode", func(t *testing.T) {
 		var state State
 		ok, err := state.Open(Atom("/dev/null"), Atom("foo"), Variable("Stream"), List(), Success, nil).Force(context.Background())
-		assert.Equal(t, domainErrorIOMode(Atom("foo")), err)
+		assert.Equal(t, domainErrorIOMode(Atom("foo"), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("an element E of the options list is neither a variable nor a stream-option", func(t *testing.T) {
 		var state State
 		ok, err := state.Open(Atom("/dev/null"), Atom("read"), Variable("Stream"), List(Atom("foo")), Success, nil).Force(context.Background())
-		assert.Equal(t, domainErrorStreamOption(Atom("foo")), err)
+		assert.Equal(t, domainErrorStreamOption(Atom("foo"), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -3194,7 +4191,7 @@ func TestState_Open(t *testing.T) {
 
 		var state State
 		ok, err := state.Open(Atom(f.Name()), Atom("read"), Variable("Stream"), List(), Success, nil).Force(context.Background())
-		assert.Equal(t, existenceErrorSourceSink(Atom(f.Name())), err)
+		assert.Equal(t, existenceErrorSourceSink(Atom(f.Name()), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -3272,6 +4269,29 @@ func TestState_Close(t *testing.T) {
 		})
 	})
 
+	t.Run("buffered output", func(t *testing.T) {
+		f, err := ioutil.TempFile("", "close_test_buffered")
+		assert.NoError(t, err)
+		assert.NoError(t, f.Close())
+		defer func() {
+			assert.NoError(t, os.Remove(f.Name()))
+		}()
+
+		s, err := Open(Atom(f.Name()), StreamModeWrite, WithBuffer(StreamBufferFull))
+		assert.NoError(t, err)
+
+		var state State
+		ok, err := state.WriteTerm(s, Atom("test"), List(), func(env *Env) *Promise {
+			return state.Close(s, List(), Success, env)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		b, err := ioutil.ReadFile(f.Name())
+		assert.NoError(t, err)
+		assert.Equal(t, "test", string(b))
+	})
+
 	t.Run("force false", func(t *testing.T) {
 		t.Run("ok", func(t *testing.T) {
 			s, err := Open(Atom(f.Name()), StreamModeRead)
@@ -3396,28 +4416,28 @@ func TestState_Close(t *testing.T) {
 	t.Run("options is neither a partial list nor a list", func(t *testing.T) {
 		var state State
 		ok, err := state.Close(&Stream{}, Atom("foo"), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorList(Atom("foo")), err)
+		assert.Equal(t, typeErrorList(Atom("foo"), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("streamOrAlias is neither a variable nor a stream-term or alias", func(t *testing.T) {
 		var state State
 		ok, err := state.Close(Integer(0), List(), Success, nil).Force(context.Background())
-		assert.Equal(t, domainErrorStreamOrAlias(Integer(0)), err)
+		assert.Equal(t, domainErrorStreamOrAlias(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("an element E of the Options list is neither a variable nor a stream-option", func(t *testing.T) {
 		var state State
 		ok, err := state.Close(&Stream{}, List(Atom("foo")), Success, nil).Force(context.Background())
-		assert.Equal(t, domainErrorStreamOption(Atom("foo")), err)
+		assert.Equal(t, domainErrorStreamOption(Atom("foo"), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("streamOrAlias is not associated with an open stream", func(t *testing.T) {
 		var state State
 		ok, err := state.Close(Atom("foo"), List(), Success, nil).Force(context.Background())
-		assert.Equal(t, existenceErrorStream(Atom("foo")), err)
+		assert.Equal(t, existenceErrorStream(Atom("foo"), nil), err)
 		assert.False(t, ok)
 	})
 }
@@ -3478,14 +4498,14 @@ func TestState_FlushOutput(t *testing.T) {
 	t.Run("streamOrAlias is neither a variable nor a stream-term or alias", func(t *testing.T) {
 		var state State
 		ok, err := state.FlushOutput(Integer(0), Success, nil).Force(context.Background())
-		assert.Equal(t, domainErrorStreamOrAlias(Integer(0)), err)
+		assert.Equal(t, domainErrorStreamOrAlias(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("streamOrAlias is not associated with an open stream", func(t *testing.T) {
 		var state State
 		ok, err := state.FlushOutput(Atom("foo"), Success, nil).Force(context.Background())
-		assert.Equal(t, existenceErrorStream(Atom("foo")), err)
+		assert.Equal(t, existenceErrorStream(Atom("foo"), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -3494,7 +4514,7 @@ func TestState_FlushOutput(t *testing.T) {
 
 		var state State
 		ok, err := state.FlushOutput(s, Success, nil).Force(context.Background())
-		assert.Equal(t, permissionErrorOutputStream(s), err)
+		assert.Equal(t, permissionErrorOutputStream(s, nil), err)
 		assert.False(t, ok)
 	})
 }
@@ -3634,6 +4654,33 @@ func TestState_WriteTerm(t *testing.T) {
 		})
 	})
 
+	t.Run("float_format", func(t *testing.T) {
+		t.Run("ok", func(t *testing.T) {
+			var m mockTerm
+			m.On("Unparse", mock.Anything, (*Env)(nil), mock.Anything).Once()
+			defer m.AssertExpectations(t)
+
+			ok, err := state.WriteTerm(s, &m, List(&Compound{
+				Functor: "float_format",
+				Args:    []Term{Atom("%.15g")},
+			}), Success, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+
+			assert.Equal(t, "%.15g", m.floatFormat)
+		})
+
+		t.Run("not a float format", func(t *testing.T) {
+			option := &Compound{
+				Functor: "float_format",
+				Args:    []Term{Atom("%d")},
+			}
+			ok, err := state.WriteTerm(s, Atom("foo"), List(option), Success, nil).Force(context.Background())
+			assert.Equal(t, domainErrorWriteOption(option, nil), err)
+			assert.False(t, ok)
+		})
+	})
+
 	t.Run("streamOrAlias is a variable", func(t *testing.T) {
 		streamOrAlias := Variable("Stream")
 
@@ -3665,17 +4712,87 @@ func TestState_WriteTerm(t *testing.T) {
 		})
 	})
 
+	t.Run("variable_names", func(t *testing.T) {
+		x, y := Variable("_1"), Variable("_2")
+		term := &Compound{Functor: "f", Args: []Term{x, y, x, Variable("_3")}}
+
+		t.Run("ok", func(t *testing.T) {
+			var buf bytes.Buffer
+			s := NewStream(readWriteCloser(&buf), StreamModeWrite)
+
+			var state State
+			ok, err := state.WriteTerm(s, term, List(&Compound{
+				Functor: "variable_names",
+				Args: []Term{List(
+					&Compound{Functor: "=", Args: []Term{Atom("X"), x}},
+					&Compound{Functor: "=", Args: []Term{Atom("Y"), y}},
+					&Compound{Functor: "=", Args: []Term{Atom("Z"), x}},
+				)},
+			}), Success, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+			assert.NoError(t, s.flush())
+
+			assert.Equal(t, "f(X, Y, X, _3)", buf.String())
+		})
+
+		t.Run("not a name", func(t *testing.T) {
+			option := &Compound{
+				Functor: "variable_names",
+				Args:    []Term{List(&Compound{Functor: "=", Args: []Term{Integer(0), x}})},
+			}
+
+			var state State
+			ok, err := state.WriteTerm(s, term, List(option), Success, nil).Force(context.Background())
+			assert.Equal(t, domainErrorWriteOption(option, nil), err)
+			assert.False(t, ok)
+		})
+
+		t.Run("name is a variable", func(t *testing.T) {
+			n := Variable("N")
+
+			var state State
+			ok, err := state.WriteTerm(s, term, List(&Compound{
+				Functor: "variable_names",
+				Args:    []Term{List(&Compound{Functor: "=", Args: []Term{n, x}})},
+			}), Success, nil).Force(context.Background())
+			assert.Equal(t, InstantiationError(n), err)
+			assert.False(t, ok)
+		})
+	})
+
+	t.Run("fullstop", func(t *testing.T) {
+		var buf bytes.Buffer
+		s := NewStream(readWriteCloser(&buf), StreamModeWrite)
+
+		state := State{
+			operators: operators{
+				{priority: 1200, specifier: operatorSpecifierXFX, name: ":-"},
+				{priority: 200, specifier: operatorSpecifierFY, name: "-"},
+			},
+		}
+		ok, err := state.WriteTerm(s, &Compound{Functor: ":-", Args: []Term{
+			&Compound{Functor: "foo", Args: []Term{Atom("a")}},
+			&Compound{Functor: "-", Args: []Term{Atom("b")}},
+		}}, List(&Compound{Functor: "fullstop", Args: []Term{Atom("true")}}), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.NoError(t, s.flush())
+
+		assert.Equal(t, "foo(a):- -b .\n", buf.String())
+	})
+
 	t.Run("streamOrAlias is neither a variable nor a stream term or alias", func(t *testing.T) {
 		var state State
 		ok, err := state.WriteTerm(Integer(0), Atom("foo"), List(), Success, nil).Force(context.Background())
-		assert.Equal(t, domainErrorStreamOrAlias(Integer(0)), err)
+		assert.Equal(t, domainErrorStreamOrAlias(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("options is neither a partial list nor a list", func(t *testing.T) {
 		var state State
 		ok, err := state.WriteTerm(s, Atom("foo"), Atom("options"), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorList(Atom("options")), err)
+		assert.Equal(t, typeErrorList(Atom("options"), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -3688,14 +4805,14 @@ func TestState_WriteTerm(t *testing.T) {
 		assert.Equal(t, domainErrorWriteOption(&Compound{
 			Functor: "unknown",
 			Args:    []Term{Atom("option")},
-		}), err)
+		}, nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("streamOrAlias is not associated with an open stream", func(t *testing.T) {
 		var state State
 		ok, err := state.WriteTerm(Atom("stream"), Atom("foo"), List(), Success, nil).Force(context.Background())
-		assert.Equal(t, existenceErrorStream(Atom("stream")), err)
+		assert.Equal(t, existenceErrorStream(Atom("stream"), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -3704,7 +4821,7 @@ func TestState_WriteTerm(t *testing.T) {
 
 		var state State
 		ok, err := state.WriteTerm(s, Atom("foo"), List(), Success, nil).Force(context.Background())
-		assert.Equal(t, permissionErrorOutputStream(s), err)
+		assert.Equal(t, permissionErrorOutputStream(s, nil), err)
 		assert.False(t, ok)
 	})
 
@@ -3714,7 +4831,7 @@ func TestState_WriteTerm(t *testing.T) {
 
 		var state State
 		ok, err := state.WriteTerm(s, Atom("foo"), List(), Success, nil).Force(context.Background())
-		assert.Equal(t, permissionErrorOutputBinaryStream(s), err)
+		assert.Equal(t, permissionErrorOutputBinaryStream(s, nil), err)
 		assert.False(t, ok)
 	})
 }
@@ -3759,6 +4876,23 @@ func TestCharCode(t *testing.T) {
 		assert.True(t, ok)
 	})
 
+	t.Run("fully bound", func(t *testing.T) {
+		t.Run("ok", func(t *testing.T) {
+			ok, err := CharCode(Atom("a"), Integer(97), func(env *Env) *Promise {
+				assert.Nil(t, env)
+				return Bool(true)
+			}, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+		})
+
+		t.Run("ng", func(t *testing.T) {
+			ok, err := CharCode(Atom("a"), Integer(98), Success, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.False(t, ok)
+		})
+	})
+
 	t.Run("query char", func(t *testing.T) {
 		v := Variable("Char")
 
@@ -3794,13 +4928,13 @@ func TestCharCode(t *testing.T) {
 	t.Run("char is neither a variable nor a one character atom", func(t *testing.T) {
 		t.Run("atom", func(t *testing.T) {
 			ok, err := CharCode(Atom("foo"), NewVariable(), Success, nil).Force(context.Background())
-			assert.Equal(t, typeErrorCharacter(Atom("foo")), err)
+			assert.Equal(t, typeErrorCharacter(Atom("foo"), nil), err)
 			assert.False(t, ok)
 		})
 
 		t.Run("non-atom", func(t *testing.T) {
 			ok, err := CharCode(Integer(0), NewVariable(), Success, nil).Force(context.Background())
-			assert.Equal(t, typeErrorCharacter(Integer(0)), err)
+			assert.Equal(t, typeErrorCharacter(Integer(0), nil), err)
 			assert.False(t, ok)
 		})
 	})
@@ -3808,13 +4942,13 @@ func TestCharCode(t *testing.T) {
 	t.Run("code is neither a variable nor an integer", func(t *testing.T) {
 		t.Run("char is variable", func(t *testing.T) {
 			ok, err := CharCode(NewVariable(), Atom("foo"), Success, nil).Force(context.Background())
-			assert.Equal(t, typeErrorInteger(Atom("foo")), err)
+			assert.Equal(t, typeErrorInteger(Atom("foo"), nil), err)
 			assert.False(t, ok)
 		})
 
 		t.Run("char is a character", func(t *testing.T) {
 			ok, err := CharCode(Atom("a"), Atom("x"), Success, nil).Force(context.Background())
-			assert.Equal(t, typeErrorInteger(Atom("x")), err)
+			assert.Equal(t, typeErrorInteger(Atom("x"), nil), err)
 			assert.False(t, ok)
 		})
 	})
@@ -3911,14 +5045,14 @@ func TestState_PutByte(t *testing.T) {
 
 		var state State
 		ok, err := state.PutByte(s, Atom("byte"), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorByte(Atom("byte")), err)
+		assert.Equal(t, typeErrorByte(Atom("byte"), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("streamOrAlias is neither a variable nor a stream term or alias", func(t *testing.T) {
 		var state State
 		ok, err := state.PutByte(Integer(0), Integer(97), Success, nil).Force(context.Background())
-		assert.Equal(t, domainErrorStreamOrAlias(Integer(0)), err)
+		assert.Equal(t, domainErrorStreamOrAlias(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -3929,7 +5063,7 @@ func TestState_PutByte(t *testing.T) {
 
 		var state State
 		ok, err := state.PutByte(s, Integer(97), Success, env).Force(context.Background())
-		assert.Equal(t, permissionErrorOutputStream(s), err)
+		assert.Equal(t, permissionErrorOutputStream(s, env), err)
 		assert.False(t, ok)
 	})
 
@@ -3940,7 +5074,7 @@ func TestState_PutByte(t *testing.T) {
 
 		var state State
 		ok, err := state.PutByte(s, Integer(97), Success, env).Force(context.Background())
-		assert.Equal(t, permissionErrorOutputTextStream(s), err)
+		assert.Equal(t, permissionErrorOutputTextStream(s, env), err)
 		assert.False(t, ok)
 	})
 }
@@ -4021,21 +5155,21 @@ func TestState_PutCode(t *testing.T) {
 	t.Run("code is neither a variable nor an integer", func(t *testing.T) {
 		var state State
 		ok, err := state.PutCode(NewStream(os.Stdout, StreamModeWrite), Atom("code"), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorInteger(Atom("code")), err)
+		assert.Equal(t, typeErrorInteger(Atom("code"), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("streamOrAlias is neither a variable nor a stream term or alias", func(t *testing.T) {
 		var state State
 		ok, err := state.PutCode(Integer(0), Integer(97), Success, nil).Force(context.Background())
-		assert.Equal(t, domainErrorStreamOrAlias(Integer(0)), err)
+		assert.Equal(t, domainErrorStreamOrAlias(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("streamOrAlias is not associated with an open stream", func(t *testing.T) {
 		var state State
 		ok, err := state.PutCode(Atom("foo"), Integer(97), Success, nil).Force(context.Background())
-		assert.Equal(t, existenceErrorStream(Atom("foo")), err)
+		assert.Equal(t, existenceErrorStream(Atom("foo"), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -4046,7 +5180,7 @@ func TestState_PutCode(t *testing.T) {
 
 		var state State
 		ok, err := state.PutCode(s, Integer(97), Success, env).Force(context.Background())
-		assert.Equal(t, permissionErrorOutputStream(s), err)
+		assert.Equal(t, permissionErrorOutputStream(s, env), err)
 		assert.False(t, ok)
 	})
 
@@ -4060,7 +5194,7 @@ func TestState_PutCode(t *testing.T) {
 
 		var state State
 		ok, err := state.PutCode(s, Integer(97), Success, env).Force(context.Background())
-		assert.Equal(t, permissionErrorOutputBinaryStream(s), err)
+		assert.Equal(t, permissionErrorOutputBinaryStream(s, env), err)
 		assert.False(t, ok)
 	})
 
@@ -4135,14 +5269,75 @@ func TestState_ReadTerm(t *testing.T) {
 		assert.True(t, ok)
 	})
 
-	t.Run("singletons", func(t *testing.T) {
-		s, err := Open("testdata/vars.txt", StreamModeRead)
-		assert.NoError(t, err)
-		defer func() {
-			assert.NoError(t, s.Close())
-		}()
+	t.Run("operators", func(t *testing.T) {
+		state := State{
+			operators: operators{
+				{priority: 500, specifier: operatorSpecifierYFX, name: "+"},
+			},
+		}
+		options := List(&Compound{
+			Functor: "operators",
+			Args: []Term{List(&Compound{
+				Functor: "op",
+				Args:    []Term{Integer(700), Atom("xfx"), Atom("~")},
+			})},
+		})
 
-		v, singletons := Variable("Term"), Variable("Singletons")
+		t.Run("ok", func(t *testing.T) {
+			s := NewStream(readWriteCloser(strings.NewReader("1 ~ 2.")), StreamModeRead)
+
+			v := Variable("Term")
+			ok, err := state.ReadTerm(s, v, options, func(env *Env) *Promise {
+				assert.Equal(t, &Compound{Functor: "~", Args: []Term{Integer(1), Integer(2)}}, env.Resolve(v))
+				return Bool(true)
+			}, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+
+			// The global operators are intact.
+			assert.Len(t, state.operators, 1)
+		})
+
+		t.Run("global operators are not used", func(t *testing.T) {
+			s := NewStream(readWriteCloser(strings.NewReader("1 + 2.")), StreamModeRead)
+
+			ok, err := state.ReadTerm(s, Variable("Term"), options, Success, nil).Force(context.Background())
+			assert.Error(t, err)
+			assert.False(t, ok)
+		})
+
+		t.Run("not an operator definition", func(t *testing.T) {
+			s := NewStream(readWriteCloser(strings.NewReader("1 ~ 2.")), StreamModeRead)
+
+			option := &Compound{Functor: "operators", Args: []Term{List(Atom("~"))}}
+			ok, err := state.ReadTerm(s, Variable("Term"), List(option), Success, nil).Force(context.Background())
+			assert.Equal(t, domainErrorReadOption(option, nil), err)
+			assert.False(t, ok)
+		})
+
+		t.Run("invalid operator definition", func(t *testing.T) {
+			s := NewStream(readWriteCloser(strings.NewReader("1 ~ 2.")), StreamModeRead)
+
+			ok, err := state.ReadTerm(s, Variable("Term"), List(&Compound{
+				Functor: "operators",
+				Args: []Term{List(&Compound{
+					Functor: "op",
+					Args:    []Term{Integer(1201), Atom("xfx"), Atom("~")},
+				})},
+			}), Success, nil).Force(context.Background())
+			assert.Equal(t, domainErrorOperatorPriority(Integer(1201), nil), err)
+			assert.False(t, ok)
+		})
+	})
+
+	t.Run("singletons", func(t *testing.T) {
+		s, err := Open("testdata/vars.txt", StreamModeRead)
+		assert.NoError(t, err)
+		defer func() {
+			assert.NoError(t, s.Close())
+		}()
+
+		v, singletons := Variable("Term"), Variable("Singletons")
 
 		var state State
 		ok, err := state.ReadTerm(s, v, List(&Compound{
@@ -4169,6 +5364,51 @@ func TestState_ReadTerm(t *testing.T) {
 		assert.True(t, ok)
 	})
 
+	t.Run("singletons and variable_names", func(t *testing.T) {
+		s, err := Open("testdata/singletons.txt", StreamModeRead)
+		assert.NoError(t, err)
+		defer func() {
+			assert.NoError(t, s.Close())
+		}()
+
+		v, singletons, variableNames := Variable("Term"), Variable("Singletons"), Variable("VariableNames")
+
+		var state State
+		ok, err := state.ReadTerm(s, v, List(&Compound{
+			Functor: "singletons",
+			Args:    []Term{singletons},
+		}, &Compound{
+			Functor: "variable_names",
+			Args:    []Term{variableNames},
+		}), func(env *Env) *Promise {
+			c, ok := env.Resolve(v).(*Compound)
+			assert.True(t, ok)
+			assert.Equal(t, Atom("f"), c.Functor)
+			assert.Len(t, c.Args, 4)
+
+			x, ok := c.Args[0].(Variable)
+			assert.True(t, ok)
+
+			y, ok := c.Args[1].(Variable)
+			assert.True(t, ok)
+
+			z, ok := c.Args[2].(Variable)
+			assert.True(t, ok)
+			assert.Equal(t, z, c.Args[3])
+
+			assert.Equal(t, List(x), env.Resolve(singletons))
+			assert.Equal(t, List(
+				&Compound{Functor: "=", Args: []Term{Atom("X"), x}},
+				&Compound{Functor: "=", Args: []Term{Atom("_Y"), y}},
+				&Compound{Functor: "=", Args: []Term{Atom("Z"), z}},
+			), env.Resolve(variableNames))
+
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
 	t.Run("variables", func(t *testing.T) {
 		s, err := Open("testdata/vars.txt", StreamModeRead)
 		assert.NoError(t, err)
@@ -4246,6 +5486,49 @@ func TestState_ReadTerm(t *testing.T) {
 		assert.True(t, ok)
 	})
 
+	t.Run("term_position", func(t *testing.T) {
+		s := NewStream(readWriteCloser(strings.NewReader("foo(bar, [X|T]) :- {'é'}, (- 1), \"ab\".")), StreamModeRead)
+
+		v, pos := Variable("Term"), Variable("Pos")
+
+		state := State{
+			operators: operators{
+				{priority: 1200, specifier: operatorSpecifierXFX, name: ":-"},
+				{priority: 1000, specifier: operatorSpecifierXFY, name: ","},
+				{priority: 200, specifier: operatorSpecifierFY, name: "-"},
+			},
+		}
+		ok, err := state.ReadTerm(s, v, List(&Compound{
+			Functor: "term_position",
+			Args:    []Term{pos},
+		}), func(env *Env) *Promise {
+			assert.Equal(t, &Compound{Functor: "term_position", Args: []Term{Integer(0), Integer(37), Integer(16), Integer(18), List(
+				&Compound{Functor: "term_position", Args: []Term{Integer(0), Integer(15), Integer(0), Integer(3), List(
+					&Compound{Functor: "-", Args: []Term{Integer(4), Integer(7)}},
+					&Compound{Functor: "list_position", Args: []Term{Integer(9), Integer(14), List(
+						&Compound{Functor: "-", Args: []Term{Integer(10), Integer(11)}},
+					), &Compound{Functor: "-", Args: []Term{Integer(12), Integer(13)}}}},
+				)}},
+				&Compound{Functor: "term_position", Args: []Term{Integer(19), Integer(37), Integer(24), Integer(25), List(
+					&Compound{Functor: "brace_term_position", Args: []Term{Integer(19), Integer(24),
+						&Compound{Functor: "-", Args: []Term{Integer(20), Integer(23)}},
+					}},
+					&Compound{Functor: "term_position", Args: []Term{Integer(26), Integer(37), Integer(31), Integer(32), List(
+						&Compound{Functor: "parentheses_term_position", Args: []Term{Integer(26), Integer(31),
+							&Compound{Functor: "term_position", Args: []Term{Integer(27), Integer(30), Integer(27), Integer(28), List(
+								&Compound{Functor: "-", Args: []Term{Integer(29), Integer(30)}},
+							)}},
+						}},
+						&Compound{Functor: "string_position", Args: []Term{Integer(33), Integer(37)}},
+					)}},
+				)}},
+			)}}, env.Resolve(pos))
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
 	t.Run("multiple reads", func(t *testing.T) {
 		s, err := Open("testdata/multi.txt", StreamModeRead)
 		assert.NoError(t, err)
@@ -4313,14 +5596,14 @@ func TestState_ReadTerm(t *testing.T) {
 	t.Run("streamOrAlias is neither a variable nor a stream term or alias", func(t *testing.T) {
 		var state State
 		ok, err := state.ReadTerm(Integer(0), NewVariable(), List(), Success, nil).Force(context.Background())
-		assert.Equal(t, domainErrorStreamOrAlias(Integer(0)), err)
+		assert.Equal(t, domainErrorStreamOrAlias(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("options is neither a partial list nor a list", func(t *testing.T) {
 		var state State
 		ok, err := state.ReadTerm(NewStream(os.Stdin, StreamModeRead), NewVariable(), Atom("options"), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorList(Atom("options")), err)
+		assert.Equal(t, typeErrorList(Atom("options"), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -4333,14 +5616,14 @@ func TestState_ReadTerm(t *testing.T) {
 		assert.Equal(t, domainErrorReadOption(&Compound{
 			Functor: "unknown",
 			Args:    []Term{Atom("option")},
-		}), err)
+		}, nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("streamOrAlias is not associated with an open stream", func(t *testing.T) {
 		var state State
 		ok, err := state.ReadTerm(Atom("foo"), NewVariable(), List(), Success, nil).Force(context.Background())
-		assert.Equal(t, existenceErrorStream(Atom("foo")), err)
+		assert.Equal(t, existenceErrorStream(Atom("foo"), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -4351,7 +5634,7 @@ func TestState_ReadTerm(t *testing.T) {
 
 		var state State
 		ok, err := state.ReadTerm(s, NewVariable(), List(), Success, env).Force(context.Background())
-		assert.Equal(t, permissionErrorInputStream(s), err)
+		assert.Equal(t, permissionErrorInputStream(s, env), err)
 		assert.False(t, ok)
 	})
 
@@ -4365,7 +5648,7 @@ func TestState_ReadTerm(t *testing.T) {
 
 		var state State
 		ok, err := state.ReadTerm(s, NewVariable(), List(), Success, env).Force(context.Background())
-		assert.Equal(t, permissionErrorInputBinaryStream(s), err)
+		assert.Equal(t, permissionErrorInputBinaryStream(s, env), err)
 		assert.False(t, ok)
 	})
 
@@ -4374,6 +5657,7 @@ func TestState_ReadTerm(t *testing.T) {
 			WithEOFAction(EOFActionError),
 		)
 		assert.NoError(t, err)
+		stream.pastEndOfStream = true
 		defer func() {
 			assert.NoError(t, stream.Close())
 		}()
@@ -4384,10 +5668,33 @@ func TestState_ReadTerm(t *testing.T) {
 
 		var state State
 		ok, err := state.ReadTerm(s, NewVariable(), List(), Success, env).Force(context.Background())
-		assert.Equal(t, permissionErrorInputPastEndOfStream(s), err)
+		assert.Equal(t, permissionErrorInputPastEndOfStream(s, env), err)
 		assert.False(t, ok)
 	})
 
+	t.Run("streamOrAlias has stream properties end_of_stream(at) and eof_action(error)", func(t *testing.T) {
+		stream, err := Open("testdata/empty.txt", StreamModeRead,
+			WithEOFAction(EOFActionError),
+		)
+		assert.NoError(t, err)
+		defer func() {
+			assert.NoError(t, stream.Close())
+		}()
+
+		s, v := Variable("Stream"), Variable("Term")
+		env := NewEnv().
+			Bind(s, stream)
+
+		var state State
+		ok, err := state.ReadTerm(s, v, List(), func(env *Env) *Promise {
+			assert.Equal(t, Atom("end_of_file"), env.Resolve(v))
+			return Bool(true)
+		}, env).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.True(t, stream.pastEndOfStream)
+	})
+
 	t.Run("one or more characters were input, but they cannot be parsed as a sequence of tokens", func(t *testing.T) {
 		s, err := Open("testdata/unexpected_token.txt", StreamModeRead)
 		assert.NoError(t, err)
@@ -4509,21 +5816,21 @@ func TestState_GetByte(t *testing.T) {
 
 		var state State
 		ok, err := state.GetByte(s, Atom("inByte"), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorInByte(Atom("inByte")), err)
+		assert.Equal(t, typeErrorInByte(Atom("inByte"), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("streamOrAlias is neither a variable nor a stream-term or alias", func(t *testing.T) {
 		var state State
 		ok, err := state.GetByte(Integer(0), Variable("InByte"), Success, nil).Force(context.Background())
-		assert.Equal(t, domainErrorStreamOrAlias(Integer(0)), err)
+		assert.Equal(t, domainErrorStreamOrAlias(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("streamOrAlias is not associated with an open stream", func(t *testing.T) {
 		var state State
 		ok, err := state.GetByte(Atom("foo"), Variable("InByte"), Success, nil).Force(context.Background())
-		assert.Equal(t, existenceErrorStream(Atom("foo")), err)
+		assert.Equal(t, existenceErrorStream(Atom("foo"), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -4534,7 +5841,7 @@ func TestState_GetByte(t *testing.T) {
 
 		var state State
 		ok, err := state.GetByte(streamOrAlias, Variable("InByte"), Success, env).Force(context.Background())
-		assert.Equal(t, permissionErrorInputStream(streamOrAlias), err)
+		assert.Equal(t, permissionErrorInputStream(streamOrAlias, env), err)
 		assert.False(t, ok)
 	})
 
@@ -4545,7 +5852,7 @@ func TestState_GetByte(t *testing.T) {
 
 		var state State
 		ok, err := state.GetByte(streamOrAlias, Variable("InByte"), Success, env).Force(context.Background())
-		assert.Equal(t, permissionErrorInputTextStream(streamOrAlias), err)
+		assert.Equal(t, permissionErrorInputTextStream(streamOrAlias, env), err)
 		assert.False(t, ok)
 	})
 
@@ -4555,6 +5862,7 @@ func TestState_GetByte(t *testing.T) {
 			WithEOFAction(EOFActionError),
 		)
 		assert.NoError(t, err)
+		s.pastEndOfStream = true
 		defer func() {
 			assert.NoError(t, s.Close())
 		}()
@@ -4565,7 +5873,7 @@ func TestState_GetByte(t *testing.T) {
 
 		var state State
 		ok, err := state.GetByte(streamOrAlias, Variable("InByte"), Success, env).Force(context.Background())
-		assert.Equal(t, permissionErrorInputPastEndOfStream(streamOrAlias), err)
+		assert.Equal(t, permissionErrorInputPastEndOfStream(streamOrAlias, env), err)
 		assert.False(t, ok)
 	})
 }
@@ -4657,14 +5965,14 @@ func TestState_GetChar(t *testing.T) {
 	t.Run("char is neither a variable nor an in-character", func(t *testing.T) {
 		var state State
 		ok, err := state.GetChar(NewStream(os.Stdin, StreamModeRead), Integer(0), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorInCharacter(Integer(0)), err)
+		assert.Equal(t, typeErrorInCharacter(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("streamOrAlias is neither a variable nor a stream term or alias", func(t *testing.T) {
 		var state State
 		ok, err := state.GetChar(Integer(0), Variable("Char"), Success, nil).Force(context.Background())
-		assert.Equal(t, domainErrorStreamOrAlias(Integer(0)), err)
+		assert.Equal(t, domainErrorStreamOrAlias(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -4675,7 +5983,7 @@ func TestState_GetChar(t *testing.T) {
 
 		var state State
 		ok, err := state.GetChar(streamOrAlias, Variable("Char"), Success, env).Force(context.Background())
-		assert.Equal(t, permissionErrorInputStream(streamOrAlias), err)
+		assert.Equal(t, permissionErrorInputStream(streamOrAlias, env), err)
 		assert.False(t, ok)
 	})
 
@@ -4689,7 +5997,7 @@ func TestState_GetChar(t *testing.T) {
 
 		var state State
 		ok, err := state.GetChar(streamOrAlias, Variable("Char"), Success, env).Force(context.Background())
-		assert.Equal(t, permissionErrorInputBinaryStream(streamOrAlias), err)
+		assert.Equal(t, permissionErrorInputBinaryStream(streamOrAlias, env), err)
 		assert.False(t, ok)
 	})
 
@@ -4698,6 +6006,7 @@ func TestState_GetChar(t *testing.T) {
 			WithEOFAction(EOFActionError),
 		)
 		assert.NoError(t, err)
+		s.pastEndOfStream = true
 		defer func() {
 			assert.NoError(t, s.Close())
 		}()
@@ -4708,7 +6017,7 @@ func TestState_GetChar(t *testing.T) {
 
 		var state State
 		ok, err := state.GetChar(streamOrAlias, Variable("Char"), Success, env).Force(context.Background())
-		assert.Equal(t, permissionErrorInputPastEndOfStream(streamOrAlias), err)
+		assert.Equal(t, permissionErrorInputPastEndOfStream(streamOrAlias, env), err)
 		assert.False(t, ok)
 	})
 
@@ -4831,14 +6140,14 @@ func TestState_PeekByte(t *testing.T) {
 
 		var state State
 		ok, err := state.PeekByte(s, Atom("byte"), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorInByte(Atom("byte")), err)
+		assert.Equal(t, typeErrorInByte(Atom("byte"), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("streamOrAlias is neither a variable nor a stream term or alias", func(t *testing.T) {
 		var state State
 		ok, err := state.PeekByte(Integer(0), Variable("Byte"), Success, nil).Force(context.Background())
-		assert.Equal(t, domainErrorStreamOrAlias(Integer(0)), err)
+		assert.Equal(t, domainErrorStreamOrAlias(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -4849,7 +6158,7 @@ func TestState_PeekByte(t *testing.T) {
 
 		var state State
 		ok, err := state.PeekByte(streamOrAlias, Variable("Byte"), Success, env).Force(context.Background())
-		assert.Equal(t, permissionErrorInputStream(streamOrAlias), err)
+		assert.Equal(t, permissionErrorInputStream(streamOrAlias, env), err)
 		assert.False(t, ok)
 	})
 
@@ -4860,7 +6169,7 @@ func TestState_PeekByte(t *testing.T) {
 
 		var state State
 		ok, err := state.PeekByte(streamOrAlias, Variable("Byte"), Success, env).Force(context.Background())
-		assert.Equal(t, permissionErrorInputTextStream(streamOrAlias), err)
+		assert.Equal(t, permissionErrorInputTextStream(streamOrAlias, env), err)
 		assert.False(t, ok)
 	})
 
@@ -4870,6 +6179,7 @@ func TestState_PeekByte(t *testing.T) {
 			WithEOFAction(EOFActionError),
 		)
 		assert.NoError(t, err)
+		s.pastEndOfStream = true
 		defer func() {
 			assert.NoError(t, s.Close())
 		}()
@@ -4880,7 +6190,7 @@ func TestState_PeekByte(t *testing.T) {
 
 		var state State
 		ok, err := state.PeekByte(streamOrAlias, Variable("Byte"), Success, env).Force(context.Background())
-		assert.Equal(t, permissionErrorInputPastEndOfStream(streamOrAlias), err)
+		assert.Equal(t, permissionErrorInputPastEndOfStream(streamOrAlias, env), err)
 		assert.False(t, ok)
 	})
 }
@@ -4911,6 +6221,23 @@ func TestState_PeekChar(t *testing.T) {
 		assert.True(t, ok)
 	})
 
+	t.Run("interleaved with get_char", func(t *testing.T) {
+		s := NewStream(readWriteCloser(strings.NewReader("😀❗😀")), StreamModeRead)
+
+		var state State
+		c := Variable("Char")
+		for _, r := range []Atom{"😀", "❗", "😀", "end_of_file"} {
+			ok, err := state.PeekChar(s, c, func(env *Env) *Promise {
+				assert.Equal(t, r, env.Resolve(c))
+				return state.PeekChar(s, c, func(env *Env) *Promise {
+					return state.GetChar(s, c, Success, env)
+				}, env)
+			}, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+		}
+	})
+
 	t.Run("valid stream alias", func(t *testing.T) {
 		s, err := Open("testdata/smile.txt", StreamModeRead)
 		assert.NoError(t, err)
@@ -5003,14 +6330,14 @@ func TestState_PeekChar(t *testing.T) {
 	t.Run("char is neither a variable nor an in-character", func(t *testing.T) {
 		var state State
 		ok, err := state.PeekChar(NewStream(os.Stdin, StreamModeRead), Integer(0), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorInCharacter(Integer(0)), err)
+		assert.Equal(t, typeErrorInCharacter(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("streamOrAlias is neither a variable nor a stream term or alias", func(t *testing.T) {
 		var state State
 		ok, err := state.PeekChar(Integer(0), Variable("Char"), Success, nil).Force(context.Background())
-		assert.Equal(t, domainErrorStreamOrAlias(Integer(0)), err)
+		assert.Equal(t, domainErrorStreamOrAlias(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -5021,7 +6348,7 @@ func TestState_PeekChar(t *testing.T) {
 
 		var state State
 		ok, err := state.PeekChar(streamOrAlias, Variable("Char"), Success, env).Force(context.Background())
-		assert.Equal(t, permissionErrorInputStream(streamOrAlias), err)
+		assert.Equal(t, permissionErrorInputStream(streamOrAlias, env), err)
 		assert.False(t, ok)
 	})
 
@@ -5035,7 +6362,7 @@ func TestState_PeekChar(t *testing.T) {
 
 		var state State
 		ok, err := state.PeekChar(streamOrAlias, Variable("Char"), Success, env).Force(context.Background())
-		assert.Equal(t, permissionErrorInputBinaryStream(streamOrAlias), err)
+		assert.Equal(t, permissionErrorInputBinaryStream(streamOrAlias, env), err)
 		assert.False(t, ok)
 	})
 
@@ -5044,6 +6371,7 @@ func TestState_PeekChar(t *testing.T) {
 			WithEOFAction(EOFActionError),
 		)
 		assert.NoError(t, err)
+		s.pastEndOfStream = true
 		defer func() {
 			assert.NoError(t, s.Close())
 		}()
@@ -5054,7 +6382,7 @@ func TestState_PeekChar(t *testing.T) {
 
 		var state State
 		ok, err := state.PeekChar(streamOrAlias, Variable("Char"), Success, env).Force(context.Background())
-		assert.Equal(t, permissionErrorInputPastEndOfStream(streamOrAlias), err)
+		assert.Equal(t, permissionErrorInputPastEndOfStream(streamOrAlias, env), err)
 		assert.False(t, ok)
 	})
 
@@ -5104,7 +6432,7 @@ func Test_Halt(t *testing.T) {
 
 	t.Run("n is neither a variable nor an integer", func(t *testing.T) {
 		ok, err := Halt(Atom("foo"), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorInteger(Atom("foo")), err)
+		assert.Equal(t, typeErrorInteger(Atom("foo"), nil), err)
 		assert.False(t, ok)
 	})
 }
@@ -5156,6 +6484,45 @@ func TestState_Clause(t *testing.T) {
 		assert.False(t, ok)
 	})
 
+	t.Run("cut", func(t *testing.T) {
+		x, y, body := Variable("X"), Variable("Y"), Variable("Body")
+
+		var state State
+		ok, err := state.Assertz(&Compound{
+			Functor: ":-",
+			Args: []Term{
+				&Compound{Functor: "p", Args: []Term{x}},
+				&Compound{Functor: ",", Args: []Term{
+					&Compound{Functor: "q", Args: []Term{x}},
+					Atom("!"),
+				}},
+			},
+		}, Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		for i := 0; i < 2; i++ {
+			ok, err = state.Clause(&Compound{Functor: "p", Args: []Term{y}}, body, func(env *Env) *Promise {
+				b, ok := env.Resolve(body).(*Compound)
+				assert.True(t, ok)
+				assert.Equal(t, Atom(","), b.Functor)
+				assert.Equal(t, Atom("!"), env.Resolve(b.Args[1]))
+
+				q, ok := env.Resolve(b.Args[0]).(*Compound)
+				assert.True(t, ok)
+				assert.Equal(t, Atom("q"), q.Functor)
+				assert.Equal(t, env.Resolve(y), env.Resolve(q.Args[0]))
+				assert.NotEqual(t, x, env.Resolve(q.Args[0]))
+
+				// modifying the returned body doesn't affect the stored clause.
+				q.Args[0] = Atom("a")
+				return Bool(true)
+			}, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+		}
+	})
+
 	t.Run("head is a variable", func(t *testing.T) {
 		head := Variable("Head")
 
@@ -5168,7 +6535,7 @@ func TestState_Clause(t *testing.T) {
 	t.Run("head is neither a variable nor a predication", func(t *testing.T) {
 		var state State
 		ok, err := state.Clause(Integer(0), Atom("true"), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorCallable(Integer(0)), err)
+		assert.Equal(t, typeErrorCallable(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -5191,14 +6558,14 @@ func TestState_Clause(t *testing.T) {
 		assert.Equal(t, permissionErrorAccessPrivateProcedure(&Compound{
 			Functor: "/",
 			Args:    []Term{Atom("green"), Integer(1)},
-		}), err)
+		}, nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("body is neither a variable nor a callable term", func(t *testing.T) {
 		var state State
 		ok, err := state.Clause(Atom("foo"), Integer(0), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorCallable(Integer(0)), err)
+		assert.Equal(t, typeErrorCallable(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 }
@@ -5225,19 +6592,38 @@ func TestAtomLength(t *testing.T) {
 
 	t.Run("atom is neither a variable nor an atom", func(t *testing.T) {
 		ok, err := AtomLength(Integer(2), Integer(0), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorAtom(Integer(2)), err)
+		assert.Equal(t, typeErrorAtom(Integer(2), nil), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("atom is a compound with bound variables", func(t *testing.T) {
+		x, y := Variable("X"), Variable("Y")
+		env := NewEnv().
+			Bind(x, Atom("x")).
+			Bind(y, Float(2.0))
+		ok, err := AtomLength(&Compound{Functor: "f", Args: []Term{x, y}}, Integer(0), Success, env).Force(context.Background())
+		assert.Equal(t, TypeError("atom", &Compound{Functor: "f", Args: []Term{Atom("x"), Float(2.0)}}, "f(x, 2.0) is not an atom."), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("length is a variable bound to a float", func(t *testing.T) {
+		length := Variable("Length")
+		env := NewEnv().
+			Bind(length, Float(2.0))
+		ok, err := AtomLength(Atom("😀"), length, Success, env).Force(context.Background())
+		assert.Equal(t, TypeError("integer", Float(2.0), "2.0 is not an integer."), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("length is neither a variable nor an integer", func(t *testing.T) {
 		ok, err := AtomLength(Atom("😀"), Atom("1"), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorInteger(Atom("1")), err)
+		assert.Equal(t, typeErrorInteger(Atom("1"), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("length is an integer less than zero", func(t *testing.T) {
 		ok, err := AtomLength(Atom("😀"), Integer(-1), Success, nil).Force(context.Background())
-		assert.Equal(t, domainErrorNotLessThanZero(Integer(-1)), err)
+		assert.Equal(t, domainErrorNotLessThanZero(Integer(-1), nil), err)
 		assert.False(t, ok)
 	})
 }
@@ -5281,6 +6667,22 @@ func TestAtomConcat(t *testing.T) {
 		assert.False(t, ok)
 	})
 
+	t.Run("atom3 is a multibyte atom", func(t *testing.T) {
+		var splits [][2]Term
+		v1, v2 := Variable("V1"), Variable("V2")
+		ok, err := AtomConcat(v1, v2, Atom("日本"), func(env *Env) *Promise {
+			splits = append(splits, [2]Term{env.Resolve(v1), env.Resolve(v2)})
+			return Bool(false)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, [][2]Term{
+			{Atom(""), Atom("日本")},
+			{Atom("日"), Atom("本")},
+			{Atom("日本"), Atom("")},
+		}, splits)
+	})
+
 	t.Run("atom1 and atom3 are variables", func(t *testing.T) {
 		atom1, atom3 := Variable("Atom1"), Variable("Atom3")
 
@@ -5306,13 +6708,13 @@ func TestAtomConcat(t *testing.T) {
 	t.Run("atom1 is neither a variable nor an atom", func(t *testing.T) {
 		t.Run("atom3 is a variable", func(t *testing.T) {
 			ok, err := AtomConcat(Integer(1), Atom("bar"), Variable("Atom3"), Success, nil).Force(context.Background())
-			assert.Equal(t, typeErrorAtom(Integer(1)), err)
+			assert.Equal(t, typeErrorAtom(Integer(1), nil), err)
 			assert.False(t, ok)
 		})
 
 		t.Run("atom3 is an atom", func(t *testing.T) {
 			ok, err := AtomConcat(Integer(1), Atom("bar"), Atom("foobar"), Success, nil).Force(context.Background())
-			assert.Equal(t, typeErrorAtom(Integer(1)), err)
+			assert.Equal(t, typeErrorAtom(Integer(1), nil), err)
 			assert.False(t, ok)
 		})
 	})
@@ -5320,25 +6722,60 @@ func TestAtomConcat(t *testing.T) {
 	t.Run("atom2 is neither a variable nor an atom", func(t *testing.T) {
 		t.Run("atom3 is a variable", func(t *testing.T) {
 			ok, err := AtomConcat(Atom("foo"), Integer(2), Variable("Atom3"), Success, nil).Force(context.Background())
-			assert.Equal(t, typeErrorAtom(Integer(2)), err)
+			assert.Equal(t, typeErrorAtom(Integer(2), nil), err)
 			assert.False(t, ok)
 		})
 
 		t.Run("atom3 is an atom", func(t *testing.T) {
 			ok, err := AtomConcat(Atom("foo"), Integer(2), Atom("foobar"), Success, nil).Force(context.Background())
-			assert.Equal(t, typeErrorAtom(Integer(2)), err)
+			assert.Equal(t, typeErrorAtom(Integer(2), nil), err)
 			assert.False(t, ok)
 		})
 	})
 
 	t.Run("atom3 is neither a variable nor an atom", func(t *testing.T) {
 		ok, err := AtomConcat(Atom("foo"), Atom("bar"), Integer(3), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorAtom(Integer(3)), err)
+		assert.Equal(t, typeErrorAtom(Integer(3), nil), err)
 		assert.False(t, ok)
 	})
 }
 
+func BenchmarkAtomConcat(b *testing.B) {
+	atom := Atom(strings.Repeat("a", 10000))
+	v1, v2 := Variable("V1"), Variable("V2")
+	var solutions int
+	next := func(*Env) *Promise {
+		solutions++
+		return Bool(false)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	start := time.Now()
+	for i := 0; i < b.N; i++ {
+		_, _ = AtomConcat(v1, v2, atom, next, nil).Force(context.Background())
+	}
+	b.ReportMetric(float64(time.Since(start).Nanoseconds())/float64(solutions), "ns/solution")
+}
+
 func TestSubAtom(t *testing.T) {
+	t.Run("larger than the atom", func(t *testing.T) {
+		for _, n := range []Integer{4, math.MaxInt64} {
+			t.Run(n.String(), func(t *testing.T) {
+				ok, err := SubAtom(Atom("abc"), NewVariable(), n, NewVariable(), NewVariable(), Success, nil).Force(context.Background())
+				assert.NoError(t, err)
+				assert.False(t, ok)
+
+				ok, err = SubAtom(Atom("abc"), n, NewVariable(), NewVariable(), NewVariable(), Success, nil).Force(context.Background())
+				assert.NoError(t, err)
+				assert.False(t, ok)
+
+				ok, err = SubAtom(Atom("abc"), NewVariable(), NewVariable(), n, NewVariable(), Success, nil).Force(context.Background())
+				assert.NoError(t, err)
+				assert.False(t, ok)
+			})
+		}
+	})
+
 	t.Run("multiple solutions", func(t *testing.T) {
 		before, length, after := Variable("Before"), Variable("Length"), Variable("After")
 		var c int
@@ -5370,6 +6807,43 @@ func TestSubAtom(t *testing.T) {
 		assert.False(t, ok)
 	})
 
+	t.Run("enumerate all sub atoms", func(t *testing.T) {
+		before, length, after, subAtom := Variable("Before"), Variable("Length"), Variable("After"), Variable("SubAtom")
+		expected := []Term{
+			&Compound{Args: []Term{Integer(0), Integer(0), Integer(3), Atom("")}},
+			&Compound{Args: []Term{Integer(0), Integer(1), Integer(2), Atom("a")}},
+			&Compound{Args: []Term{Integer(0), Integer(2), Integer(1), Atom("ab")}},
+			&Compound{Args: []Term{Integer(0), Integer(3), Integer(0), Atom("abc")}},
+			&Compound{Args: []Term{Integer(1), Integer(0), Integer(2), Atom("")}},
+			&Compound{Args: []Term{Integer(1), Integer(1), Integer(1), Atom("b")}},
+			&Compound{Args: []Term{Integer(1), Integer(2), Integer(0), Atom("bc")}},
+			&Compound{Args: []Term{Integer(2), Integer(0), Integer(1), Atom("")}},
+			&Compound{Args: []Term{Integer(2), Integer(1), Integer(0), Atom("c")}},
+			&Compound{Args: []Term{Integer(3), Integer(0), Integer(0), Atom("")}},
+		}
+		var c int
+		ok, err := SubAtom(Atom("abc"), before, length, after, subAtom, func(env *Env) *Promise {
+			assert.Equal(t, expected[c], env.Simplify(&Compound{Args: []Term{before, length, after, subAtom}}))
+			c++
+			return Bool(false)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, len(expected), c)
+	})
+
+	t.Run("known length", func(t *testing.T) {
+		before, after, subAtom := Variable("Before"), Variable("After"), Variable("SubAtom")
+		var subAtoms []Term
+		ok, err := SubAtom(Atom("abc"), before, Integer(2), after, subAtom, func(env *Env) *Promise {
+			subAtoms = append(subAtoms, env.Resolve(subAtom))
+			return Bool(false)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, []Term{Atom("ab"), Atom("bc")}, subAtoms)
+	})
+
 	t.Run("get the first char", func(t *testing.T) {
 		char := Variable("Char")
 		ok, err := SubAtom(Atom("a"), Integer(0), Integer(1), Integer(0), char, func(env *Env) *Promise {
@@ -5389,49 +6863,49 @@ func TestSubAtom(t *testing.T) {
 
 	t.Run("atom is neither a variable nor an atom", func(t *testing.T) {
 		ok, err := SubAtom(Integer(0), Variable("Before"), Variable("Length"), Variable("After"), Variable("SubAtom"), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorAtom(Integer(0)), err)
+		assert.Equal(t, typeErrorAtom(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("subAtom is neither a variable nor an atom", func(t *testing.T) {
 		ok, err := SubAtom(Atom("foo"), Variable("Before"), Variable("Length"), Variable("After"), Integer(0), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorAtom(Integer(0)), err)
+		assert.Equal(t, typeErrorAtom(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("before is neither a variable nor an integer", func(t *testing.T) {
 		ok, err := SubAtom(Atom("foo"), Atom("before"), Variable("Length"), Variable("After"), Variable("SubAtom"), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorInteger(Atom("before")), err)
+		assert.Equal(t, typeErrorInteger(Atom("before"), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("length is neither a variable nor an integer", func(t *testing.T) {
 		ok, err := SubAtom(Atom("foo"), Variable("Before"), Atom("length"), Variable("After"), Variable("SubAtom"), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorInteger(Atom("length")), err)
+		assert.Equal(t, typeErrorInteger(Atom("length"), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("after is neither a variable nor an integer", func(t *testing.T) {
 		ok, err := SubAtom(Atom("foo"), Variable("Before"), Variable("Length"), Atom("after"), Variable("SubAtom"), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorInteger(Atom("after")), err)
+		assert.Equal(t, typeErrorInteger(Atom("after"), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("before is an integer less than zero", func(t *testing.T) {
 		ok, err := SubAtom(Atom("foo"), Integer(-1), Variable("Length"), Variable("After"), Variable("SubAtom"), Success, nil).Force(context.Background())
-		assert.Equal(t, domainErrorNotLessThanZero(Integer(-1)), err)
+		assert.Equal(t, domainErrorNotLessThanZero(Integer(-1), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("length is an integer less than zero", func(t *testing.T) {
 		ok, err := SubAtom(Atom("foo"), Variable("Before"), Integer(-1), Variable("After"), Variable("SubAtom"), Success, nil).Force(context.Background())
-		assert.Equal(t, domainErrorNotLessThanZero(Integer(-1)), err)
+		assert.Equal(t, domainErrorNotLessThanZero(Integer(-1), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("after is an integer less than zero", func(t *testing.T) {
 		ok, err := SubAtom(Atom("foo"), Variable("Before"), Variable("Length"), Integer(-1), Variable("SubAtom"), Success, nil).Force(context.Background())
-		assert.Equal(t, domainErrorNotLessThanZero(Integer(-1)), err)
+		assert.Equal(t, domainErrorNotLessThanZero(Integer(-1), nil), err)
 		assert.False(t, ok)
 	})
 }
@@ -5484,26 +6958,26 @@ func TestAtomChars(t *testing.T) {
 
 	t.Run("atom is neither a variable nor an atom", func(t *testing.T) {
 		ok, err := AtomChars(Integer(0), NewVariable(), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorAtom(Integer(0)), err)
+		assert.Equal(t, typeErrorAtom(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("atom is a variable and List is neither a list nor a partial list", func(t *testing.T) {
 		ok, err := AtomChars(NewVariable(), Atom("chars"), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorList(Atom("chars")), err)
+		assert.Equal(t, typeErrorList(Atom("chars"), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("atom is a variable and an element E of the list List is neither a variable nor a one-character atom", func(t *testing.T) {
 		t.Run("not a one-character atom", func(t *testing.T) {
 			ok, err := AtomChars(NewVariable(), List(Atom("chars")), Success, nil).Force(context.Background())
-			assert.Equal(t, typeErrorCharacter(Atom("chars")), err)
+			assert.Equal(t, typeErrorCharacter(Atom("chars"), nil), err)
 			assert.False(t, ok)
 		})
 
 		t.Run("not an atom", func(t *testing.T) {
 			ok, err := AtomChars(NewVariable(), List(Integer(0)), Success, nil).Force(context.Background())
-			assert.Equal(t, typeErrorCharacter(Integer(0)), err)
+			assert.Equal(t, typeErrorCharacter(Integer(0), nil), err)
 			assert.False(t, ok)
 		})
 	})
@@ -5554,13 +7028,13 @@ func TestAtomCodes(t *testing.T) {
 
 	t.Run("atom is neither a variable nor an atom", func(t *testing.T) {
 		ok, err := AtomCodes(Integer(0), List(Integer(102), Integer(111), Integer(111)), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorAtom(Integer(0)), err)
+		assert.Equal(t, typeErrorAtom(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("atom is a variable and List is neither a list nor a partial list", func(t *testing.T) {
 		ok, err := AtomCodes(NewVariable(), Atom("codes"), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorList(Atom("codes")), err)
+		assert.Equal(t, typeErrorList(Atom("codes"), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -5608,6 +7082,37 @@ func TestNumberChars(t *testing.T) {
 		})
 	})
 
+	t.Run("round trip", func(t *testing.T) {
+		for _, tc := range []struct {
+			num   Float
+			chars Term
+		}{
+			{num: 1.0e-10, chars: List(Atom("1"), Atom("."), Atom("0"), Atom("e"), Atom("-"), Atom("1"), Atom("0"))},
+			{num: -0.5, chars: List(Atom("-"), Atom("0"), Atom("."), Atom("5"))},
+			{num: 3.14159, chars: List(Atom("3"), Atom("."), Atom("1"), Atom("4"), Atom("1"), Atom("5"), Atom("9"))},
+		} {
+			t.Run(tc.num.String(), func(t *testing.T) {
+				num := Variable("Num")
+				ok, err := NumberChars(num, tc.chars, func(env *Env) *Promise {
+					assert.Equal(t, tc.num, env.Resolve(num))
+					return Bool(true)
+				}, nil).Force(context.Background())
+				assert.NoError(t, err)
+				assert.True(t, ok)
+
+				chars := Variable("Chars")
+				ok, err = NumberChars(tc.num, chars, func(env *Env) *Promise {
+					return NumberChars(num, chars, func(env *Env) *Promise {
+						assert.Equal(t, tc.num, env.Resolve(num))
+						return Bool(true)
+					}, env)
+				}, nil).Force(context.Background())
+				assert.NoError(t, err)
+				assert.True(t, ok)
+			})
+		}
+	})
+
 	t.Run("num is a variable and chars is a partial list or list with an element which is a variable", func(t *testing.T) {
 		t.Run("partial list", func(t *testing.T) {
 			codes := ListRest(Variable("Rest"),
@@ -5630,19 +7135,19 @@ func TestNumberChars(t *testing.T) {
 
 	t.Run("num is neither a variable nor a number", func(t *testing.T) {
 		ok, err := NumberChars(Atom("23.4"), List(Atom("2"), Atom("3"), Atom("."), Atom("4")), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorNumber(Atom("23.4")), err)
+		assert.Equal(t, typeErrorNumber(Atom("23.4"), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("num is a variable and chars is neither a list nor partial list", func(t *testing.T) {
 		ok, err := NumberChars(NewVariable(), Atom("23.4"), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorList(Atom("23.4")), err)
+		assert.Equal(t, typeErrorList(Atom("23.4"), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("an element E of the list chars is neither a variable nor a one-character atom", func(t *testing.T) {
 		ok, err := NumberChars(NewVariable(), List(Integer(2), Atom("3"), Atom("."), Atom("4")), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorCharacter(Integer(2)), err)
+		assert.Equal(t, typeErrorCharacter(Integer(2), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -5653,6 +7158,115 @@ func TestNumberChars(t *testing.T) {
 	})
 }
 
+func TestState_StreamToLazyList(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		s := NewStream(readWriteCloser(strings.NewReader("abc")), StreamModeRead)
+		l, rest := Variable("List"), Variable("Rest")
+
+		var state State
+		ok, err := state.StreamToLazyList(s, l, func(env *Env) *Promise {
+			env, ok := ListRest(rest, Integer('a'), Integer('b')).Unify(l, false, env)
+			assert.True(t, ok)
+
+			// Only the codes unified so far are read.
+			r, _, err := s.buf.ReadRune()
+			assert.NoError(t, err)
+			assert.Equal(t, 'c', r)
+
+			_, ok = Atom("[]").Unify(rest, false, env)
+			assert.True(t, ok)
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("end of stream", func(t *testing.T) {
+		s := NewStream(readWriteCloser(strings.NewReader("ab")), StreamModeRead)
+		l := Variable("List")
+
+		var state State
+		ok, err := state.StreamToLazyList(s, l, func(env *Env) *Promise {
+			_, ok := List(Integer('a'), Integer('b')).Unify(l, false, env)
+			return Bool(ok)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("output stream", func(t *testing.T) {
+		s := NewStream(os.Stdout, StreamModeWrite)
+
+		var state State
+		ok, err := state.StreamToLazyList(s, Variable("List"), Success, nil).Force(context.Background())
+		assert.Equal(t, permissionErrorInputStream(s, nil), err)
+		assert.False(t, ok)
+	})
+}
+
+func TestBetween(t *testing.T) {
+	tests := []struct {
+		title               string
+		lower, upper, value Term
+		err                 error
+		values              []Term
+	}{
+		{title: "enumerate", lower: Integer(1), upper: Integer(3), value: Variable("X"), values: []Term{Integer(1), Integer(2), Integer(3)}},
+		{title: "single", lower: Integer(3), upper: Integer(3), value: Variable("X"), values: []Term{Integer(3)}},
+		{title: "empty", lower: Integer(3), upper: Integer(1), value: Variable("X")},
+		{title: "infinite", lower: Integer(math.MaxInt64 - 1), upper: Atom("inf"), value: Variable("X"), values: []Term{Integer(math.MaxInt64 - 1), Integer(math.MaxInt64)}},
+		{title: "in range", lower: Integer(1), upper: Integer(3), value: Integer(2), values: []Term{Integer(2)}},
+		{title: "out of range", lower: Integer(1), upper: Integer(3), value: Integer(4)},
+		{title: "lower is a variable", lower: Variable("L"), upper: Integer(3), value: Variable("X"), err: InstantiationError(Variable("L"))},
+		{title: "upper is a variable", lower: Integer(1), upper: Variable("U"), value: Variable("X"), err: InstantiationError(Variable("U"))},
+		{title: "lower is not an integer", lower: Float(1), upper: Integer(3), value: Variable("X"), err: typeErrorInteger(Float(1), nil)},
+		{title: "upper is not an integer", lower: Integer(1), upper: Atom("foo"), value: Variable("X"), err: typeErrorInteger(Atom("foo"), nil)},
+		{title: "value is not an integer", lower: Integer(1), upper: Integer(3), value: Atom("foo"), err: typeErrorInteger(Atom("foo"), nil)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			var values []Term
+			ok, err := Between(tt.lower, tt.upper, tt.value, func(env *Env) *Promise {
+				values = append(values, env.Resolve(tt.value))
+				return Bool(false)
+			}, nil).Force(context.Background())
+			assert.Equal(t, tt.err, err)
+			assert.False(t, ok)
+			assert.Equal(t, tt.values, values)
+		})
+	}
+}
+
+func TestNumList(t *testing.T) {
+	tests := []struct {
+		title           string
+		low, high, step Term
+		list            Term
+		err             error
+	}{
+		{title: "ascending", low: Integer(1), high: Integer(10), step: Integer(3), list: List(Integer(1), Integer(4), Integer(7), Integer(10))},
+		{title: "descending", low: Integer(10), high: Integer(1), step: Integer(-4), list: List(Integer(10), Integer(6), Integer(2))},
+		{title: "empty", low: Integer(5), high: Integer(1), step: Integer(1), list: List()},
+		{title: "overflow", low: Integer(math.MaxInt64 - 1), high: Integer(math.MaxInt64), step: Integer(2), list: List(Integer(math.MaxInt64 - 1))},
+		{title: "zero step", low: Integer(1), high: Integer(10), step: Integer(0), err: DomainError("not_zero", Integer(0), "%s is zero.", Integer(0))},
+		{title: "low is a variable", low: Variable("L"), high: Integer(10), step: Integer(1), err: InstantiationError(Variable("L"))},
+		{title: "high is not an integer", low: Integer(1), high: Float(10), step: Integer(1), err: typeErrorInteger(Float(10), nil)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			l := Variable("L")
+			ok, err := NumList(tt.low, tt.high, tt.step, l, func(env *Env) *Promise {
+				assert.Equal(t, tt.list, env.Resolve(l))
+				return Bool(true)
+			}, nil).Force(context.Background())
+			assert.Equal(t, tt.err, err)
+			assert.Equal(t, tt.err == nil, ok)
+		})
+	}
+}
+
 func TestNumberCodes(t *testing.T) {
 	t.Run("number to codes", func(t *testing.T) {
 		codes := Variable("Codes")
@@ -5676,6 +7290,16 @@ func TestNumberCodes(t *testing.T) {
 		assert.True(t, ok)
 	})
 
+	t.Run("integer too large", func(t *testing.T) {
+		var codes []Term
+		for _, r := range "99999999999999999999" {
+			codes = append(codes, Integer(r))
+		}
+		ok, err := NumberCodes(Variable("Num"), List(codes...), Success, nil).Force(context.Background())
+		assert.Equal(t, representationError(Atom("max_integer"), Atom("99999999999999999999 is too large.")), err)
+		assert.False(t, ok)
+	})
+
 	t.Run("both provided", func(t *testing.T) {
 		t.Run("33.0", func(t *testing.T) {
 			ok, err := NumberCodes(Float(33.0), List(Integer(51), Integer(51), Integer(46), Integer(48)), Success, nil).Force(context.Background())
@@ -5696,6 +7320,42 @@ func TestNumberCodes(t *testing.T) {
 		})
 	})
 
+	t.Run("round trip", func(t *testing.T) {
+		for _, tc := range []struct {
+			num   Float
+			codes string
+		}{
+			{num: 1.0e-10, codes: "1.0e-10"},
+			{num: -0.5, codes: "-0.5"},
+			{num: 3.14159, codes: "3.14159"},
+		} {
+			t.Run(tc.codes, func(t *testing.T) {
+				cs := make([]Term, 0, len(tc.codes))
+				for _, r := range tc.codes {
+					cs = append(cs, Integer(r))
+				}
+
+				num := Variable("Num")
+				ok, err := NumberCodes(num, List(cs...), func(env *Env) *Promise {
+					assert.Equal(t, tc.num, env.Resolve(num))
+					return Bool(true)
+				}, nil).Force(context.Background())
+				assert.NoError(t, err)
+				assert.True(t, ok)
+
+				codes := Variable("Codes")
+				ok, err = NumberCodes(tc.num, codes, func(env *Env) *Promise {
+					return NumberCodes(num, codes, func(env *Env) *Promise {
+						assert.Equal(t, tc.num, env.Resolve(num))
+						return Bool(true)
+					}, env)
+				}, nil).Force(context.Background())
+				assert.NoError(t, err)
+				assert.True(t, ok)
+			})
+		}
+	})
+
 	t.Run("num is a variable and codes is a partial list or list with an element which is a variable", func(t *testing.T) {
 		t.Run("partial list", func(t *testing.T) {
 			codes := ListRest(Variable("Rest"),
@@ -5718,13 +7378,13 @@ func TestNumberCodes(t *testing.T) {
 
 	t.Run("num is neither a variable nor a number", func(t *testing.T) {
 		ok, err := NumberCodes(Atom("23.4"), List(Integer(50), Integer(51), Integer(46), Integer(52)), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorNumber(Atom("23.4")), err)
+		assert.Equal(t, typeErrorNumber(Atom("23.4"), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("num is a variable and codes is neither a list nor partial list", func(t *testing.T) {
 		ok, err := NumberCodes(NewVariable(), Atom("23.4"), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorList(Atom("23.4")), err)
+		assert.Equal(t, typeErrorList(Atom("23.4"), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -5812,19 +7472,27 @@ func TestFunctionSet_Is(t *testing.T) {
 		ok, err = DefaultFunctionSet.Is(Float(2), &Compound{Functor: "/", Args: []Term{Float(4), Float(2)}}, Success, nil).Force(context.Background())
 		assert.NoError(t, err)
 		assert.True(t, ok)
-	})
 
-	t.Run("integer division", func(t *testing.T) {
+		ok, err = DefaultFunctionSet.Is(NewVariable(), &Compound{Functor: "/", Args: []Term{Integer(1), Integer(0)}}, Success, nil).Force(context.Background())
+		assert.Equal(t, evaluationErrorZeroDivisor(), err)
+		assert.False(t, ok)
+
+		ok, err = DefaultFunctionSet.Is(NewVariable(), &Compound{Functor: "/", Args: []Term{Float(1), Float(0)}}, Success, nil).Force(context.Background())
+		assert.Equal(t, evaluationErrorZeroDivisor(), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("integer division", func(t *testing.T) {
 		ok, err := DefaultFunctionSet.Is(Integer(2), &Compound{Functor: "//", Args: []Term{Integer(4), Integer(2)}}, Success, nil).Force(context.Background())
 		assert.NoError(t, err)
 		assert.True(t, ok)
 
 		ok, err = DefaultFunctionSet.Is(NewVariable(), &Compound{Functor: "//", Args: []Term{Integer(4), Float(2)}}, Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorInteger(Float(2)), err)
+		assert.Equal(t, typeErrorInteger(Float(2), nil), err)
 		assert.False(t, ok)
 
 		ok, err = DefaultFunctionSet.Is(NewVariable(), &Compound{Functor: "//", Args: []Term{Float(4), Integer(2)}}, Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorInteger(Float(4)), err)
+		assert.Equal(t, typeErrorInteger(Float(4), nil), err)
 		assert.False(t, ok)
 
 		ok, err = DefaultFunctionSet.Is(NewVariable(), &Compound{Functor: "//", Args: []Term{Integer(4), Integer(0)}}, Success, nil).Force(context.Background())
@@ -5838,11 +7506,11 @@ func TestFunctionSet_Is(t *testing.T) {
 		assert.True(t, ok)
 
 		ok, err = DefaultFunctionSet.Is(NewVariable(), &Compound{Functor: "rem", Args: []Term{Integer(-21), Float(4)}}, Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorInteger(Float(4)), err)
+		assert.Equal(t, typeErrorInteger(Float(4), nil), err)
 		assert.False(t, ok)
 
 		ok, err = DefaultFunctionSet.Is(NewVariable(), &Compound{Functor: "rem", Args: []Term{Float(-21), Integer(4)}}, Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorInteger(Float(-21)), err)
+		assert.Equal(t, typeErrorInteger(Float(-21), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -5852,11 +7520,11 @@ func TestFunctionSet_Is(t *testing.T) {
 		assert.True(t, ok)
 
 		ok, err = DefaultFunctionSet.Is(NewVariable(), &Compound{Functor: "mod", Args: []Term{Integer(-21), Float(4)}}, Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorInteger(Float(4)), err)
+		assert.Equal(t, typeErrorInteger(Float(4), nil), err)
 		assert.False(t, ok)
 
 		ok, err = DefaultFunctionSet.Is(NewVariable(), &Compound{Functor: "mod", Args: []Term{Float(-21), Integer(4)}}, Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorInteger(Float(-21)), err)
+		assert.Equal(t, typeErrorInteger(Float(-21), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -5936,6 +7604,10 @@ func TestFunctionSet_Is(t *testing.T) {
 		ok, err = DefaultFunctionSet.Is(Float(1.0), &Compound{Functor: "exp", Args: []Term{Float(0)}}, Success, nil).Force(context.Background())
 		assert.NoError(t, err)
 		assert.True(t, ok)
+
+		ok, err = DefaultFunctionSet.Is(NewVariable(), &Compound{Functor: "exp", Args: []Term{Integer(1000)}}, Success, nil).Force(context.Background())
+		assert.Equal(t, evaluationErrorFloatOverflow(), err)
+		assert.False(t, ok)
 	})
 
 	t.Run("square root", func(t *testing.T) {
@@ -5946,6 +7618,10 @@ func TestFunctionSet_Is(t *testing.T) {
 		ok, err = DefaultFunctionSet.Is(Float(1.0), &Compound{Functor: "sqrt", Args: []Term{Float(1)}}, Success, nil).Force(context.Background())
 		assert.NoError(t, err)
 		assert.True(t, ok)
+
+		ok, err = DefaultFunctionSet.Is(NewVariable(), &Compound{Functor: "sqrt", Args: []Term{Integer(-1)}}, Success, nil).Force(context.Background())
+		assert.Equal(t, evaluationErrorUndefined(), err)
+		assert.False(t, ok)
 	})
 
 	t.Run("sign", func(t *testing.T) {
@@ -6026,6 +7702,14 @@ func TestFunctionSet_Is(t *testing.T) {
 		ok, err = DefaultFunctionSet.Is(Float(0), &Compound{Functor: "log", Args: []Term{Float(1)}}, Success, nil).Force(context.Background())
 		assert.NoError(t, err)
 		assert.True(t, ok)
+
+		ok, err = DefaultFunctionSet.Is(NewVariable(), &Compound{Functor: "log", Args: []Term{Integer(0)}}, Success, nil).Force(context.Background())
+		assert.Equal(t, evaluationErrorUndefined(), err)
+		assert.False(t, ok)
+
+		ok, err = DefaultFunctionSet.Is(NewVariable(), &Compound{Functor: "log", Args: []Term{Float(-1)}}, Success, nil).Force(context.Background())
+		assert.Equal(t, evaluationErrorUndefined(), err)
+		assert.False(t, ok)
 	})
 
 	t.Run("sine", func(t *testing.T) {
@@ -6064,15 +7748,15 @@ func TestFunctionSet_Is(t *testing.T) {
 		assert.True(t, ok)
 
 		ok, err = DefaultFunctionSet.Is(NewVariable(), &Compound{Functor: ">>", Args: []Term{Float(4), Integer(1)}}, Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorInteger(Float(4)), err)
+		assert.Equal(t, typeErrorInteger(Float(4), nil), err)
 		assert.False(t, ok)
 
 		ok, err = DefaultFunctionSet.Is(NewVariable(), &Compound{Functor: ">>", Args: []Term{Integer(4), Float(1)}}, Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorInteger(Float(1)), err)
+		assert.Equal(t, typeErrorInteger(Float(1), nil), err)
 		assert.False(t, ok)
 
 		ok, err = DefaultFunctionSet.Is(NewVariable(), &Compound{Functor: ">>", Args: []Term{Float(4), Float(1)}}, Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorInteger(Float(4)), err)
+		assert.Equal(t, typeErrorInteger(Float(4), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -6082,15 +7766,15 @@ func TestFunctionSet_Is(t *testing.T) {
 		assert.True(t, ok)
 
 		ok, err = DefaultFunctionSet.Is(NewVariable(), &Compound{Functor: "<<", Args: []Term{Float(4), Integer(1)}}, Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorInteger(Float(4)), err)
+		assert.Equal(t, typeErrorInteger(Float(4), nil), err)
 		assert.False(t, ok)
 
 		ok, err = DefaultFunctionSet.Is(NewVariable(), &Compound{Functor: "<<", Args: []Term{Integer(4), Float(1)}}, Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorInteger(Float(1)), err)
+		assert.Equal(t, typeErrorInteger(Float(1), nil), err)
 		assert.False(t, ok)
 
 		ok, err = DefaultFunctionSet.Is(NewVariable(), &Compound{Functor: "<<", Args: []Term{Float(4), Float(1)}}, Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorInteger(Float(4)), err)
+		assert.Equal(t, typeErrorInteger(Float(4), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -6100,15 +7784,15 @@ func TestFunctionSet_Is(t *testing.T) {
 		assert.True(t, ok)
 
 		ok, err = DefaultFunctionSet.Is(NewVariable(), &Compound{Functor: "/\\", Args: []Term{Float(5), Integer(1)}}, Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorInteger(Float(5)), err)
+		assert.Equal(t, typeErrorInteger(Float(5), nil), err)
 		assert.False(t, ok)
 
 		ok, err = DefaultFunctionSet.Is(NewVariable(), &Compound{Functor: "/\\", Args: []Term{Integer(5), Float(1)}}, Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorInteger(Float(1)), err)
+		assert.Equal(t, typeErrorInteger(Float(1), nil), err)
 		assert.False(t, ok)
 
 		ok, err = DefaultFunctionSet.Is(NewVariable(), &Compound{Functor: "/\\", Args: []Term{Float(5), Float(1)}}, Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorInteger(Float(5)), err)
+		assert.Equal(t, typeErrorInteger(Float(5), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -6118,15 +7802,15 @@ func TestFunctionSet_Is(t *testing.T) {
 		assert.True(t, ok)
 
 		ok, err = DefaultFunctionSet.Is(NewVariable(), &Compound{Functor: "\\/", Args: []Term{Float(4), Integer(1)}}, Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorInteger(Float(4)), err)
+		assert.Equal(t, typeErrorInteger(Float(4), nil), err)
 		assert.False(t, ok)
 
 		ok, err = DefaultFunctionSet.Is(NewVariable(), &Compound{Functor: "\\/", Args: []Term{Integer(4), Float(1)}}, Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorInteger(Float(1)), err)
+		assert.Equal(t, typeErrorInteger(Float(1), nil), err)
 		assert.False(t, ok)
 
 		ok, err = DefaultFunctionSet.Is(NewVariable(), &Compound{Functor: "\\/", Args: []Term{Float(4), Float(1)}}, Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorInteger(Float(4)), err)
+		assert.Equal(t, typeErrorInteger(Float(4), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -6136,7 +7820,7 @@ func TestFunctionSet_Is(t *testing.T) {
 		assert.True(t, ok)
 
 		ok, err = DefaultFunctionSet.Is(NewVariable(), &Compound{Functor: "\\", Args: []Term{Float(0)}}, Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorInteger(Float(0)), err)
+		assert.Equal(t, typeErrorInteger(Float(0), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -6153,7 +7837,7 @@ func TestFunctionSet_Is(t *testing.T) {
 		assert.Equal(t, typeErrorEvaluable(&Compound{
 			Functor: "/",
 			Args:    []Term{Atom("foo"), Integer(0)},
-		}), err)
+		}, nil), err)
 		assert.False(t, ok)
 	})
 }
@@ -6357,6 +8041,7 @@ func TestState_StreamProperty(t *testing.T) {
 			&Compound{Functor: "end_of_stream", Args: []Term{Atom("at")}},
 			&Compound{Functor: "reposition", Args: []Term{Atom("true")}},
 			&Compound{Functor: "type", Args: []Term{Atom("text")}},
+			&Compound{Functor: "buffer", Args: []Term{Atom("false")}},
 		}
 
 		s, err := Open(Atom(f.Name()), StreamModeRead)
@@ -6389,6 +8074,7 @@ func TestState_StreamProperty(t *testing.T) {
 			&Compound{Functor: "end_of_stream", Args: []Term{Atom("at")}},
 			&Compound{Functor: "reposition", Args: []Term{Atom("false")}},
 			&Compound{Functor: "type", Args: []Term{Atom("text")}},
+			&Compound{Functor: "buffer", Args: []Term{Atom("false")}},
 		}
 
 		s, err := Open(Atom(f.Name()), StreamModeRead)
@@ -6422,6 +8108,7 @@ func TestState_StreamProperty(t *testing.T) {
 			&Compound{Functor: "end_of_stream", Args: []Term{Atom("at")}},
 			&Compound{Functor: "reposition", Args: []Term{Atom("true")}},
 			&Compound{Functor: "type", Args: []Term{Atom("text")}},
+			&Compound{Functor: "buffer", Args: []Term{Atom("false")}},
 		}
 
 		s, err := Open(Atom(f.Name()), StreamModeWrite)
@@ -6492,26 +8179,73 @@ func TestState_StreamProperty(t *testing.T) {
 			assert.NoError(t, err)
 			assert.True(t, ok)
 		})
+
+		t.Run("position of output", func(t *testing.T) {
+			t.Run("buffered file", func(t *testing.T) {
+				f, err := os.CreateTemp("", "")
+				assert.NoError(t, err)
+				defer func() {
+					assert.NoError(t, os.Remove(f.Name()))
+				}()
+				assert.NoError(t, f.Close())
+
+				s, err := Open(Atom(f.Name()), StreamModeWrite, WithBuffer(StreamBufferFull))
+				assert.NoError(t, err)
+				defer func() {
+					assert.NoError(t, s.Close())
+				}()
+
+				var state State
+				ok, err := state.PutCode(s, Integer('a'), Success, nil).Force(context.Background())
+				assert.NoError(t, err)
+				assert.True(t, ok)
+
+				ok, err = state.StreamProperty(s, &Compound{
+					Functor: "position",
+					Args:    []Term{Integer(1)},
+				}, Success, nil).Force(context.Background())
+				assert.NoError(t, err)
+				assert.True(t, ok)
+			})
+
+			t.Run("non-file", func(t *testing.T) {
+				s := NewStream(readWriteCloser(&bytes.Buffer{}), StreamModeWrite)
+
+				var state State
+				for _, c := range "abc" {
+					ok, err := state.PutCode(s, Integer(c), Success, nil).Force(context.Background())
+					assert.NoError(t, err)
+					assert.True(t, ok)
+				}
+
+				ok, err := state.StreamProperty(s, &Compound{
+					Functor: "position",
+					Args:    []Term{Integer(3)},
+				}, Success, nil).Force(context.Background())
+				assert.NoError(t, err)
+				assert.True(t, ok)
+			})
+		})
 	})
 
 	t.Run("streamOrAlias is neither a variable, a stream-term, nor an alias", func(t *testing.T) {
 		var state State
 		ok, err := state.StreamProperty(Integer(0), NewVariable(), Success, nil).Force(context.Background())
-		assert.Equal(t, domainErrorStreamOrAlias(Integer(0)), err)
+		assert.Equal(t, domainErrorStreamOrAlias(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("property is neither a variable nor a stream property", func(t *testing.T) {
 		var state State
 		ok, err := state.StreamProperty(NewVariable(), Atom("property"), Success, nil).Force(context.Background())
-		assert.Equal(t, domainErrorStreamProperty(Atom("property")), err)
+		assert.Equal(t, domainErrorStreamProperty(Atom("property"), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("streamOrAlias is not associated with an open stream", func(t *testing.T) {
 		var state State
 		ok, err := state.StreamProperty(Atom("foo"), NewVariable(), Success, nil).Force(context.Background())
-		assert.Equal(t, existenceErrorStream(Atom("foo")), err)
+		assert.Equal(t, existenceErrorStream(Atom("foo"), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -6677,6 +8411,36 @@ func TestState_SetStreamPosition(t *testing.T) {
 		assert.True(t, ok)
 	})
 
+	t.Run("buffered output", func(t *testing.T) {
+		f, err := os.CreateTemp("", "")
+		assert.NoError(t, err)
+		assert.NoError(t, f.Close())
+		defer func() {
+			assert.NoError(t, os.Remove(f.Name()))
+		}()
+
+		s, err := Open(Atom(f.Name()), StreamModeWrite, WithReposition(true), WithBuffer(StreamBufferFull))
+		assert.NoError(t, err)
+
+		_, err = s.writer().Write([]byte("abcdef"))
+		assert.NoError(t, err)
+		_, err = s.writer().Write([]byte("x"))
+		assert.NoError(t, err)
+
+		var state State
+		ok, err := state.SetStreamPosition(s, Integer(6), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		_, err = s.writer().Write([]byte("Z"))
+		assert.NoError(t, err)
+		assert.NoError(t, s.Close())
+
+		b, err := os.ReadFile(f.Name())
+		assert.NoError(t, err)
+		assert.Equal(t, "abcdefZ", string(b))
+	})
+
 	t.Run("seek failed", func(t *testing.T) {
 		seek = func(f io.Seeker, offset int64, whence int) (int64, error) {
 			return 0, errors.New("failed")
@@ -6724,14 +8488,14 @@ func TestState_SetStreamPosition(t *testing.T) {
 	t.Run("streamOrAlias is neither a variable nor a stream term or alias", func(t *testing.T) {
 		var state State
 		ok, err := state.SetStreamPosition(Integer(2), Integer(0), Success, nil).Force(context.Background())
-		assert.Equal(t, domainErrorStreamOrAlias(Integer(2)), err)
+		assert.Equal(t, domainErrorStreamOrAlias(Integer(2), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("streamOrAlias is not associated with an open stream", func(t *testing.T) {
 		var state State
 		ok, err := state.SetStreamPosition(Atom("foo"), Integer(0), Success, nil).Force(context.Background())
-		assert.Equal(t, existenceErrorStream(Atom("foo")), err)
+		assert.Equal(t, existenceErrorStream(Atom("foo"), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -6746,7 +8510,136 @@ func TestState_SetStreamPosition(t *testing.T) {
 
 		var state State
 		ok, err := state.SetStreamPosition(s, Integer(0), Success, env).Force(context.Background())
-		assert.Equal(t, PermissionError("reposition", "stream", s, "Stream is not repositionable."), err)
+		assert.Equal(t, permissionError("reposition", "stream", stream, nil, "%s is not repositionable."), err)
+		assert.False(t, ok)
+	})
+}
+
+func TestState_Seek(t *testing.T) {
+	f, err := os.CreateTemp("", "")
+	assert.NoError(t, err)
+	defer func() {
+		assert.NoError(t, os.Remove(f.Name()))
+	}()
+	_, err = f.WriteString("abcdef")
+	assert.NoError(t, err)
+	assert.NoError(t, f.Close())
+
+	t.Run("ok", func(t *testing.T) {
+		tests := []struct {
+			title  string
+			offset Integer
+			method Atom
+			pos    Integer
+			char   Atom
+		}{
+			{title: "bof", offset: 2, method: "bof", pos: 2, char: "c"},
+			{title: "current", offset: 1, method: "current", pos: 2, char: "c"},
+			{title: "eof", offset: -2, method: "eof", pos: 4, char: "e"},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.title, func(t *testing.T) {
+				s, err := Open(Atom(f.Name()), StreamModeRead)
+				assert.NoError(t, err)
+				defer func() {
+					assert.NoError(t, s.Close())
+				}()
+
+				var state State
+
+				// Fill the read buffer so that current takes the buffered bytes into account.
+				ok, err := state.GetChar(s, Atom("a"), Success, nil).Force(context.Background())
+				assert.NoError(t, err)
+				assert.True(t, ok)
+
+				ok, err = state.Seek(s, tt.offset, tt.method, tt.pos, func(env *Env) *Promise {
+					return state.GetChar(s, tt.char, Success, env)
+				}, nil).Force(context.Background())
+				assert.NoError(t, err)
+				assert.True(t, ok)
+			})
+		}
+	})
+
+	t.Run("seek failed", func(t *testing.T) {
+		seek = func(f io.Seeker, offset int64, whence int) (int64, error) {
+			return 0, errors.New("failed")
+		}
+		defer func() {
+			seek = io.Seeker.Seek
+		}()
+
+		s, err := Open(Atom(f.Name()), StreamModeRead)
+		assert.NoError(t, err)
+		defer func() {
+			assert.NoError(t, s.Close())
+		}()
+
+		var state State
+		ok, err := state.Seek(s, Integer(0), Atom("bof"), Variable("Pos"), Success, nil).Force(context.Background())
+		assert.Error(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("offset is a variable", func(t *testing.T) {
+		s, err := Open(Atom(f.Name()), StreamModeRead)
+		assert.NoError(t, err)
+		defer func() {
+			assert.NoError(t, s.Close())
+		}()
+
+		var state State
+		ok, err := state.Seek(s, Variable("Offset"), Atom("bof"), Variable("Pos"), Success, nil).Force(context.Background())
+		assert.Equal(t, InstantiationError(Variable("Offset")), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("offset is neither a variable nor an integer", func(t *testing.T) {
+		s, err := Open(Atom(f.Name()), StreamModeRead)
+		assert.NoError(t, err)
+		defer func() {
+			assert.NoError(t, s.Close())
+		}()
+
+		var state State
+		ok, err := state.Seek(s, Atom("foo"), Atom("bof"), Variable("Pos"), Success, nil).Force(context.Background())
+		assert.Equal(t, typeErrorInteger(Atom("foo"), nil), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("method is a variable", func(t *testing.T) {
+		s, err := Open(Atom(f.Name()), StreamModeRead)
+		assert.NoError(t, err)
+		defer func() {
+			assert.NoError(t, s.Close())
+		}()
+
+		var state State
+		ok, err := state.Seek(s, Integer(0), Variable("Method"), Variable("Pos"), Success, nil).Force(context.Background())
+		assert.Equal(t, InstantiationError(Variable("Method")), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("method is not a seek method", func(t *testing.T) {
+		s, err := Open(Atom(f.Name()), StreamModeRead)
+		assert.NoError(t, err)
+		defer func() {
+			assert.NoError(t, s.Close())
+		}()
+
+		var state State
+		ok, err := state.Seek(s, Integer(0), Atom("foo"), Variable("Pos"), Success, nil).Force(context.Background())
+		assert.Equal(t, domainErrorSeekMethod(Atom("foo"), nil), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("stream is not repositionable", func(t *testing.T) {
+		s := NewStream(readWriteCloser(&bytes.Buffer{}), StreamModeRead)
+
+		var state State
+		ok, err := state.Seek(s, Integer(0), Atom("bof"), Variable("Pos"), Success, nil).Force(context.Background())
+		assert.Equal(t, PermissionError("reposition", "stream", s, "%s is not repositionable.", s), err)
 		assert.False(t, ok)
 	})
 }
@@ -6775,6 +8668,28 @@ func TestState_CharConversion(t *testing.T) {
 		assert.False(t, ok)
 	})
 
+	t.Run("parse", func(t *testing.T) {
+		state := State{
+			charConversions: map[rune]rune{
+				'a': 'b',
+			},
+		}
+
+		t.Run("enabled", func(t *testing.T) {
+			state.charConvEnabled = true
+			term, err := state.Parser(strings.NewReader("a."), nil).Term()
+			assert.NoError(t, err)
+			assert.Equal(t, Atom("b"), term)
+		})
+
+		t.Run("disabled", func(t *testing.T) {
+			state.charConvEnabled = false
+			term, err := state.Parser(strings.NewReader("a."), nil).Term()
+			assert.NoError(t, err)
+			assert.Equal(t, Atom("a"), term)
+		})
+	})
+
 	t.Run("inChar is a variable", func(t *testing.T) {
 		inChar := Variable("In")
 
@@ -7081,14 +8996,14 @@ func TestState_SetPrologFlag(t *testing.T) {
 	t.Run("flag is neither a variable nor an atom", func(t *testing.T) {
 		var state State
 		ok, err := state.SetPrologFlag(Integer(0), Atom("fail"), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorAtom(Integer(0)), err)
+		assert.Equal(t, typeErrorAtom(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("flag is an atom but an invalid flag for the processor", func(t *testing.T) {
 		var state State
 		ok, err := state.SetPrologFlag(Atom("foo"), Atom("fail"), Success, nil).Force(context.Background())
-		assert.Equal(t, domainErrorPrologFlag(Atom("foo")), err)
+		assert.Equal(t, domainErrorPrologFlag(Atom("foo"), nil), err)
 		assert.False(t, ok)
 	})
 
@@ -7098,7 +9013,7 @@ func TestState_SetPrologFlag(t *testing.T) {
 		assert.Equal(t, domainErrorFlagValue(&Compound{
 			Functor: "+",
 			Args:    []Term{Atom("unknown"), Integer(0)},
-		}), err)
+		}, nil), err)
 		assert.False(t, ok)
 	})
 
@@ -7193,14 +9108,14 @@ func TestState_CurrentPrologFlag(t *testing.T) {
 	t.Run("flag is neither a variable nor an atom", func(t *testing.T) {
 		var state State
 		ok, err := state.CurrentPrologFlag(Integer(0), Atom("error"), Success, nil).Force(context.Background())
-		assert.Equal(t, typeErrorAtom(Integer(0)), err)
+		assert.Equal(t, typeErrorAtom(Integer(0), nil), err)
 		assert.False(t, ok)
 	})
 
 	t.Run("flag is an atom but an invalid flag for the processor", func(t *testing.T) {
 		var state State
 		ok, err := state.CurrentPrologFlag(Atom("foo"), Atom("error"), Success, nil).Force(context.Background())
-		assert.Equal(t, domainErrorPrologFlag(Atom("foo")), err)
+		assert.Equal(t, domainErrorPrologFlag(Atom("foo"), nil), err)
 		assert.False(t, ok)
 	})
 }
@@ -7268,7 +9183,7 @@ func TestState_Dynamic(t *testing.T) {
 				Atom("foo"),
 				Integer(1),
 			},
-		}), err)
+		}, nil), err)
 		assert.False(t, ok)
 	})
 }
@@ -7336,7 +9251,97 @@ func TestState_BuiltIn(t *testing.T) {
 				Atom("foo"),
 				Integer(1),
 			},
-		}), err)
+		}, nil), err)
+		assert.False(t, ok)
+	})
+}
+
+func TestState_Redefine(t *testing.T) {
+	pi := &Compound{
+		Functor: "/",
+		Args: []Term{
+			Atom("foo"),
+			Integer(1),
+		},
+	}
+
+	t.Run("built-in", func(t *testing.T) {
+		state := State{
+			VM: VM{
+				procedures: map[ProcedureIndicator]procedure{
+					{Name: "foo", Arity: 1}: builtin{clauses{{}}},
+				},
+			},
+		}
+		ok, err := state.Redefine(pi, Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		assert.Equal(t, static{}, state.procedures[ProcedureIndicator{Name: "foo", Arity: 1}])
+	})
+
+	t.Run("implemented in Go", func(t *testing.T) {
+		state := State{
+			VM: VM{
+				procedures: map[ProcedureIndicator]procedure{
+					{Name: "foo", Arity: 1}: predicate1(func(_ Term, k func(*Env) *Promise, env *Env) *Promise {
+						return k(env)
+					}),
+				},
+			},
+		}
+		ok, err := state.Redefine(pi, Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		assert.Equal(t, static{}, state.procedures[ProcedureIndicator{Name: "foo", Arity: 1}])
+	})
+
+	t.Run("user-defined", func(t *testing.T) {
+		state := State{
+			VM: VM{
+				procedures: map[ProcedureIndicator]procedure{
+					{Name: "foo", Arity: 1}: clauses{{}},
+				},
+			},
+		}
+		ok, err := state.Redefine(pi, Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		assert.Equal(t, clauses{{}}, state.procedures[ProcedureIndicator{Name: "foo", Arity: 1}])
+	})
+
+	t.Run("control construct", func(t *testing.T) {
+		for _, pi := range []ProcedureIndicator{
+			{Name: "call", Arity: 1},
+			{Name: ",", Arity: 2},
+			{Name: ";", Arity: 2},
+			{Name: "!", Arity: 0},
+			{Name: "->", Arity: 2},
+			{Name: "catch", Arity: 3},
+		} {
+			t.Run(pi.String(), func(t *testing.T) {
+				state := State{
+					VM: VM{
+						procedures: map[ProcedureIndicator]procedure{
+							pi: builtin{clauses{{}}},
+						},
+					},
+				}
+				ok, err := state.Redefine(pi.Term(), Success, nil).Force(context.Background())
+				assert.Equal(t, permissionErrorModifyStaticProcedure(pi.Term(), nil), err)
+				assert.False(t, ok)
+
+				assert.Equal(t, builtin{clauses{{}}}, state.procedures[pi])
+			})
+		}
+	})
+
+	t.Run("not a procedure indicator", func(t *testing.T) {
+		var state State
+		ok, err := state.Redefine(Atom("foo"), Success, nil).Force(context.Background())
+		assert.Error(t, err)
 		assert.False(t, ok)
 	})
 }
@@ -7403,6 +9408,62 @@ func TestState_ExpandTerm(t *testing.T) {
 	})
 }
 
+func TestState_ExpandGoal(t *testing.T) {
+	t.Run("goal_expansion/2 is undefined", func(t *testing.T) {
+		var state State
+		ok, err := state.ExpandGoal(Atom("foo"), Atom("foo"), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("goal_expansion/2 is defined", func(t *testing.T) {
+		state := State{
+			VM: VM{
+				procedures: map[ProcedureIndicator]procedure{
+					{Name: "goal_expansion", Arity: 2}: predicate2(func(t1, t2 Term, k func(*Env) *Promise, env *Env) *Promise {
+						switch env.Resolve(t1) {
+						case Atom("foo"):
+							return Unify(t2, Atom("bar"), k, env)
+						case Atom("bar"):
+							return Unify(t2, Atom("baz"), k, env)
+						default:
+							return Bool(false)
+						}
+					}),
+				},
+			},
+		}
+
+		t.Run("simple goal", func(t *testing.T) {
+			ok, err := state.ExpandGoal(Atom("foo"), Atom("baz"), Success, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+		})
+
+		t.Run("control constructs", func(t *testing.T) {
+			goal := Variable("Goal")
+			ok, err := state.ExpandGoal(&Compound{
+				Functor: ";",
+				Args: []Term{
+					&Compound{Functor: "->", Args: []Term{Atom("foo"), Atom("qux")}},
+					&Compound{Functor: `\+`, Args: []Term{Atom("bar")}},
+				},
+			}, goal, func(env *Env) *Promise {
+				assert.Equal(t, &Compound{
+					Functor: ";",
+					Args: []Term{
+						&Compound{Functor: "->", Args: []Term{Atom("baz"), Atom("qux")}},
+						&Compound{Functor: `\+`, Args: []Term{Atom("baz")}},
+					},
+				}, env.Simplify(goal))
+				return Bool(true)
+			}, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+		})
+	})
+}
+
 func TestEnviron(t *testing.T) {
 	os.Clearenv()
 	assert.NoError(t, os.Setenv("FOO", "foo"))
@@ -7430,3 +9491,468 @@ func TestEnviron(t *testing.T) {
 	assert.NoError(t, err)
 	assert.True(t, ok)
 }
+
+func TestState_BSetVal(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var state State
+		v := Variable("V")
+		ok, err := state.BSetVal(Atom("foo"), Integer(1), func(env *Env) *Promise {
+			return state.BSetVal(Atom("foo"), Integer(2), func(env *Env) *Promise {
+				return state.BGetVal(Atom("foo"), v, func(env *Env) *Promise {
+					assert.Equal(t, Integer(2), env.Resolve(v))
+					return Bool(true)
+				}, env)
+			}, env)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("backtrack", func(t *testing.T) {
+		var state State
+		v := Variable("V")
+		ok, err := Delay(func(context.Context) *Promise {
+			return state.BSetVal(Atom("foo"), Integer(1), Failure, nil)
+		}, func(context.Context) *Promise {
+			return state.BGetVal(Atom("foo"), v, Success, nil)
+		}).Force(context.Background())
+		assert.Equal(t, ExistenceError("variable", Atom("foo"), "global variable %s does not exist.", Atom("foo")), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("nb_getval", func(t *testing.T) {
+		var state State
+		v := Variable("V")
+		ok, err := state.BSetVal(Atom("foo"), Integer(1), func(env *Env) *Promise {
+			return state.NbGetVal(Atom("foo"), v, func(env *Env) *Promise {
+				assert.Equal(t, Integer(1), env.Resolve(v))
+				return Bool(true)
+			}, env)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("overridden by nb_setval", func(t *testing.T) {
+		var state State
+		v := Variable("V")
+		ok, err := state.BSetVal(Atom("foo"), Integer(1), func(env *Env) *Promise {
+			return state.NbSetVal(Atom("foo"), Integer(2), func(env *Env) *Promise {
+				return state.BGetVal(Atom("foo"), v, func(env *Env) *Promise {
+					assert.Equal(t, Integer(2), env.Resolve(v))
+					return Bool(true)
+				}, env)
+			}, env)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("backtrack to nb_setval", func(t *testing.T) {
+		var state State
+		v := Variable("V")
+		ok, err := state.NbSetVal(Atom("foo"), Integer(1), func(env *Env) *Promise {
+			return Delay(func(context.Context) *Promise {
+				return state.BSetVal(Atom("foo"), Integer(2), Failure, env)
+			}, func(context.Context) *Promise {
+				return state.BGetVal(Atom("foo"), v, func(env *Env) *Promise {
+					assert.Equal(t, Integer(1), env.Resolve(v))
+					return Bool(true)
+				}, env)
+			})
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("key is a variable", func(t *testing.T) {
+		var state State
+		ok, err := state.BSetVal(Variable("K"), Integer(1), Success, nil).Force(context.Background())
+		assert.Equal(t, InstantiationError(Variable("K")), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("key is not an atom", func(t *testing.T) {
+		var state State
+		ok, err := state.BSetVal(Integer(0), Integer(1), Success, nil).Force(context.Background())
+		assert.Equal(t, typeErrorAtom(Integer(0), nil), err)
+		assert.False(t, ok)
+	})
+}
+
+func TestState_NbSetVal(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var state State
+		x, v := Variable("X"), Variable("V")
+		ok, err := Delay(func(context.Context) *Promise {
+			return state.NbSetVal(Atom("foo"), &Compound{Functor: "f", Args: []Term{x}}, Failure, nil)
+		}, func(context.Context) *Promise {
+			return state.NbGetVal(Atom("foo"), v, func(env *Env) *Promise {
+				c, ok := env.Resolve(v).(*Compound)
+				assert.True(t, ok)
+				assert.Equal(t, Atom("f"), c.Functor)
+				assert.NotEqual(t, x, c.Args[0])
+				return Bool(true)
+			}, nil)
+		}).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("b_getval", func(t *testing.T) {
+		var state State
+		v := Variable("V")
+		ok, err := state.NbSetVal(Atom("foo"), Integer(1), func(env *Env) *Promise {
+			return state.BGetVal(Atom("foo"), v, func(env *Env) *Promise {
+				assert.Equal(t, Integer(1), env.Resolve(v))
+				return Bool(true)
+			}, env)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("key is a variable", func(t *testing.T) {
+		var state State
+		ok, err := state.NbSetVal(Variable("K"), Integer(1), Success, nil).Force(context.Background())
+		assert.Equal(t, InstantiationError(Variable("K")), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("not set", func(t *testing.T) {
+		var state State
+		ok, err := state.NbGetVal(Atom("foo"), Variable("V"), Success, nil).Force(context.Background())
+		assert.Equal(t, ExistenceError("variable", Atom("foo"), "global variable %s does not exist.", Atom("foo")), err)
+		assert.False(t, ok)
+	})
+}
+
+func TestState_Recorded(t *testing.T) {
+	var state State
+
+	for _, r := range []struct {
+		recordz   bool
+		key, term Term
+	}{
+		{recordz: true, key: Atom("foo"), term: Atom("a")},
+		{recordz: true, key: &Compound{Functor: "foo", Args: []Term{Integer(1)}}, term: Atom("b")},
+		{recordz: true, key: Atom("foo"), term: &Compound{Functor: "c", Args: []Term{Variable("X")}}},
+		{recordz: false, key: Atom("foo"), term: Atom("d")},
+		{recordz: true, key: Integer(1), term: Atom("e")},
+	} {
+		record := state.Recorda
+		if r.recordz {
+			record = state.Recordz
+		}
+		ok, err := record(r.key, r.term, Variable("Ref"), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	}
+
+	recorded := func(key Term) []Term {
+		var terms []Term
+		_, err := state.Recorded(key, Variable("Term"), Variable("Ref"), func(env *Env) *Promise {
+			terms = append(terms, env.Simplify(Variable("Term")))
+			return Bool(false)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		return terms
+	}
+
+	t.Run("in order", func(t *testing.T) {
+		terms := recorded(Atom("foo"))
+		assert.Len(t, terms, 3)
+		assert.Equal(t, Atom("d"), terms[0])
+		assert.Equal(t, Atom("a"), terms[1])
+		c, ok := terms[2].(*Compound)
+		assert.True(t, ok)
+		assert.Equal(t, Atom("c"), c.Functor)
+		// The recorded term is a copy.
+		assert.NotEqual(t, Variable("X"), c.Args[0])
+	})
+
+	t.Run("principal functor", func(t *testing.T) {
+		assert.Equal(t, []Term{Atom("b")}, recorded(&Compound{Functor: "foo", Args: []Term{Atom("bar")}}))
+		assert.Equal(t, []Term{Atom("e")}, recorded(Integer(1)))
+		assert.Empty(t, recorded(Atom("bar")))
+	})
+
+	t.Run("any key", func(t *testing.T) {
+		assert.Len(t, recorded(Variable("Key")), 5)
+	})
+
+	t.Run("erase", func(t *testing.T) {
+		var ref Term
+		_, err := state.Recorded(Atom("foo"), Atom("a"), Variable("Ref"), func(env *Env) *Promise {
+			ref = env.Resolve(Variable("Ref"))
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+
+		ok, err := state.Erase(ref, Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		assert.Len(t, recorded(Atom("foo")), 2)
+
+		ok, err = state.Erase(ref, Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("key is a variable", func(t *testing.T) {
+		ok, err := state.Recordz(Variable("Key"), Atom("a"), Variable("Ref"), Success, nil).Force(context.Background())
+		assert.Equal(t, InstantiationError(Variable("Key")), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("key is not a key", func(t *testing.T) {
+		ok, err := state.Recordz(Float(1.0), Atom("a"), Variable("Ref"), Success, nil).Force(context.Background())
+		assert.Equal(t, typeErrorKey(Float(1.0), nil), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("ref is not a variable", func(t *testing.T) {
+		ok, err := state.Recordz(Atom("foo"), Atom("a"), Atom("ref"), Success, nil).Force(context.Background())
+		assert.Equal(t, uninstantiationError(Atom("ref"), nil), err)
+		assert.False(t, ok)
+	})
+}
+
+func TestState_Module(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		var state State
+		ok, err := state.Module(Atom("foo"), List(
+			&Compound{Functor: "/", Args: []Term{Atom("bar"), Integer(1)}},
+			&Compound{Functor: "/", Args: []Term{Atom("baz"), Integer(2)}},
+		), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+
+		assert.Equal(t, []ProcedureIndicator{
+			{Name: "bar", Arity: 1},
+			{Name: "baz", Arity: 2},
+		}, state.modules["foo"])
+	})
+
+	t.Run("name is a variable", func(t *testing.T) {
+		var state State
+		ok, err := state.Module(Variable("M"), List(), Success, nil).Force(context.Background())
+		assert.Equal(t, InstantiationError(Variable("M")), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("name is not an atom", func(t *testing.T) {
+		var state State
+		ok, err := state.Module(Integer(0), List(), Success, nil).Force(context.Background())
+		assert.Equal(t, typeErrorAtom(Integer(0), nil), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("export is not a procedure indicator", func(t *testing.T) {
+		var state State
+		ok, err := state.Module(Atom("foo"), List(Atom("bar")), Success, nil).Force(context.Background())
+		assert.Equal(t, typeErrorPredicateIndicator(Atom("bar"), nil), err)
+		assert.False(t, ok)
+	})
+}
+
+func TestState_CurrentModule(t *testing.T) {
+	t.Run("enumerate", func(t *testing.T) {
+		state := State{
+			modules: map[Atom][]ProcedureIndicator{
+				"foo": nil,
+				"bar": nil,
+			},
+		}
+
+		var names []Atom
+		m := Variable("M")
+		ok, err := state.CurrentModule(m, func(env *Env) *Promise {
+			names = append(names, env.Resolve(m).(Atom))
+			return Bool(false)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+		assert.Equal(t, []Atom{"user", "bar", "foo"}, names)
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		var state State
+		ok, err := state.CurrentModule(Atom("foo"), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.False(t, ok)
+	})
+
+	t.Run("not an atom", func(t *testing.T) {
+		var state State
+		ok, err := state.CurrentModule(Integer(0), Success, nil).Force(context.Background())
+		assert.Equal(t, typeErrorAtom(Integer(0), nil), err)
+		assert.False(t, ok)
+	})
+}
+
+func TestState_Qualified(t *testing.T) {
+	var state State
+	state.Register1("foo", func(t Term, k func(*Env) *Promise, env *Env) *Promise {
+		return Unify(t, Atom("a"), k, env)
+	})
+
+	t.Run("ok", func(t *testing.T) {
+		x := Variable("X")
+		ok, err := state.Qualified(Atom("bar"), &Compound{Functor: "foo", Args: []Term{x}}, func(env *Env) *Promise {
+			assert.Equal(t, Atom("a"), env.Resolve(x))
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("module is a variable", func(t *testing.T) {
+		ok, err := state.Qualified(Variable("M"), Atom("true"), Success, nil).Force(context.Background())
+		assert.Equal(t, InstantiationError(Variable("M")), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("module is not an atom", func(t *testing.T) {
+		ok, err := state.Qualified(Integer(0), Atom("true"), Success, nil).Force(context.Background())
+		assert.Equal(t, typeErrorAtom(Integer(0), nil), err)
+		assert.False(t, ok)
+	})
+}
+
+func TestState_Format(t *testing.T) {
+	state := State{
+		operators: operators{
+			{priority: 500, specifier: operatorSpecifierYFX, name: "+"},
+		},
+	}
+
+	tests := []struct {
+		title  string
+		format Term
+		args   Term
+		out    Atom
+	}{
+		{title: "text", format: Atom("hello"), args: List(), out: "hello"},
+		{title: "codes", format: List(Integer('h'), Integer('i')), args: List(), out: "hi"},
+		{title: "single argument", format: Atom("~a"), args: Atom("foo"), out: "foo"},
+		{title: "w", format: Atom("~w"), args: List(&Compound{Functor: "+", Args: []Term{Atom("a"), Atom("B c")}}), out: "a+B c"},
+		{title: "q", format: Atom("~q"), args: List(Atom("B c")), out: "'B c'"},
+		{title: "d", format: Atom("~d ~2d ~D"), args: List(Integer(42), Integer(5), Integer(-1234567)), out: "42 0.05 -1,234,567"},
+		{title: "f", format: Atom("~2f ~e"), args: List(Float(3.14159), Integer(1)), out: "3.14 1.000000e+00"},
+		{title: "r", format: Atom("~8r ~16R"), args: List(Integer(8), Integer(255)), out: "10 FF"},
+		{title: "s", format: Atom("~s"), args: List(List(Integer('a'), Integer('b'))), out: "ab"},
+		{title: "c", format: Atom("~3c"), args: List(Integer('x')), out: "xxx"},
+		{title: "n and tilde", format: Atom("~~~n"), args: List(), out: "~\n"},
+		{title: "i and *", format: Atom("~i~*c"), args: List(Atom("skipped"), Integer(2), Integer('y')), out: "yy"},
+		{title: "column", format: Atom("~a~10|~a"), args: List(Atom("abc"), Atom("def")), out: "abc       def"},
+		{title: "right aligned column", format: Atom("~t~a~10|"), args: List(Atom("abc")), out: "       abc"},
+		{title: "centered column", format: Atom("~t~a~t~9|"), args: List(Atom("abc")), out: "   abc   "},
+		{title: "fill character", format: Atom("~a~`-t~8+~a"), args: List(Atom("ab"), Atom("c")), out: "ab------c"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			a := Variable("A")
+			ok, err := state.Format(&Compound{Functor: "atom", Args: []Term{a}}, tt.format, tt.args, func(env *Env) *Promise {
+				assert.Equal(t, tt.out, env.Resolve(a))
+				return Bool(true)
+			}, nil).Force(context.Background())
+			assert.NoError(t, err)
+			assert.True(t, ok)
+		})
+	}
+
+	t.Run("codes", func(t *testing.T) {
+		ok, err := state.Format(&Compound{Functor: "codes", Args: []Term{List(Integer('o'), Integer('k'))}}, Atom("ok"), List(), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("chars", func(t *testing.T) {
+		ok, err := state.Format(&Compound{Functor: "chars", Args: []Term{List(Atom("o"), Atom("k"))}}, Atom("ok"), List(), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		var buf bytes.Buffer
+		s := NewStream(readWriteCloser(&buf), StreamModeWrite)
+		ok, err := state.Format(s, Atom("~a, ~a"), List(Atom("hello"), Atom("world")), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, "hello, world", buf.String())
+	})
+
+	t.Run("not enough arguments", func(t *testing.T) {
+		ok, err := state.Format(&Compound{Functor: "atom", Args: []Term{Variable("A")}}, Atom("~a ~a"), List(Atom("a")), Success, nil).Force(context.Background())
+		assert.Equal(t, formatError("not enough arguments"), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("too many arguments", func(t *testing.T) {
+		ok, err := state.Format(&Compound{Functor: "atom", Args: []Term{Variable("A")}}, Atom("~a"), List(Atom("a"), Atom("b")), Success, nil).Force(context.Background())
+		assert.Equal(t, formatError("too many arguments"), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("unknown directive", func(t *testing.T) {
+		ok, err := state.Format(&Compound{Functor: "atom", Args: []Term{Variable("A")}}, Atom("~y"), List(), Success, nil).Force(context.Background())
+		assert.Equal(t, formatError("unknown directive ~y"), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("not an integer", func(t *testing.T) {
+		ok, err := state.Format(&Compound{Functor: "atom", Args: []Term{Variable("A")}}, Atom("~d"), List(Atom("a")), Success, nil).Force(context.Background())
+		assert.Equal(t, typeErrorInteger(Atom("a"), nil), err)
+		assert.False(t, ok)
+	})
+
+	t.Run("format is a variable", func(t *testing.T) {
+		ok, err := state.Format(&Compound{Functor: "atom", Args: []Term{Variable("A")}}, Variable("F"), List(), Success, nil).Force(context.Background())
+		assert.Equal(t, InstantiationError(Variable("F")), err)
+		assert.False(t, ok)
+	})
+}
+
+func TestState_WriteToCodes(t *testing.T) {
+	state := State{
+		operators: operators{
+			{priority: 500, specifier: operatorSpecifierYFX, name: "+"},
+		},
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		codes := Variable("Codes")
+		term := &Compound{Functor: "foo", Args: []Term{Integer(1), List(Atom("a"), Atom("b"))}}
+		ok, err := state.WriteToCodes(term, codes, func(env *Env) *Promise {
+			var sb strings.Builder
+			assert.NoError(t, EachList(codes, func(elem Term) error {
+				_, _ = sb.WriteRune(rune(env.Resolve(elem).(Integer)))
+				return nil
+			}, env))
+			assert.Equal(t, "foo(1, [a, b])", sb.String())
+			return Bool(true)
+		}, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("operators", func(t *testing.T) {
+		ok, err := state.WriteToCodes(&Compound{Functor: "+", Args: []Term{Integer(1), Atom("B c")}}, List(
+			Integer('1'), Integer('+'), Integer('B'), Integer(' '), Integer('c'),
+		), Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+}
+
+func TestState_WriteToChars(t *testing.T) {
+	var state State
+	ok, err := state.WriteToChars(&Compound{Functor: "f", Args: []Term{Atom("a")}}, List(
+		Atom("f"), Atom("("), Atom("a"), Atom(")"),
+	), Success, nil).Force(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
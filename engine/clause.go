@@ -3,6 +3,8 @@ package engine
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
 )
 
 type clauses []clause
@@ -75,6 +77,7 @@ type (
 
 type clause struct {
 	pi       ProcedureIndicator
+	ref      *ClauseRef
 	raw      Term
 	xrTable  []Term
 	piTable  []ProcedureIndicator
@@ -108,7 +111,7 @@ func compile(t Term, env *Env) (clauses, error) {
 				c.raw = t
 				cs = append(cs, c)
 			case errNotCallable:
-				return nil, typeErrorCallable(body)
+				return nil, typeErrorCallable(body, env)
 			default:
 				return nil, err
 			}
@@ -121,12 +124,12 @@ func compile(t Term, env *Env) (clauses, error) {
 			c.raw = t
 			return append(cs, c), nil
 		case errNotCallable:
-			return nil, typeErrorCallable(body)
+			return nil, typeErrorCallable(body, env)
 		default:
 			return nil, err
 		}
 	default:
-		return nil, typeErrorCallable(t)
+		return nil, typeErrorCallable(t, env)
 	}
 
 	switch c, err := compileClause(t, nil, env); err {
@@ -134,7 +137,7 @@ func compile(t Term, env *Env) (clauses, error) {
 		c.raw = t
 		return []clause{c}, nil
 	case errNotCallable:
-		return nil, typeErrorCallable(t)
+		return nil, typeErrorCallable(t, env)
 	default:
 		return nil, err
 	}
@@ -208,6 +211,12 @@ func (c *clause) compilePred(p Term, env *Env) error {
 		c.bytecode = append(c.bytecode, instruction{opcode: opCall, operand: c.piOffset(ProcedureIndicator{Name: p, Arity: 0})})
 		return nil
 	case *Compound:
+		// Procedures share a single flat namespace so that Module:Goal is compiled as Goal.
+		if p.Functor == ":" && len(p.Args) == 2 {
+			if _, ok := env.Resolve(p.Args[0]).(Atom); ok {
+				return c.compilePred(p.Args[1], env)
+			}
+		}
 		for _, a := range p.Args {
 			c.compileArg(a, env)
 		}
@@ -262,3 +271,44 @@ func (c *clause) piOffset(o ProcedureIndicator) byte {
 	c.piTable = append(c.piTable, o)
 	return byte(len(c.piTable) - 1)
 }
+
+// ClauseRef is a reference to a clause in the database given by asserta/2 or assertz/2.
+type ClauseRef struct {
+	pi ProcedureIndicator
+}
+
+func (r *ClauseRef) String() string {
+	var sb strings.Builder
+	_ = Write(&sb, r, nil)
+	return sb.String()
+}
+
+// Unify unifies the clause reference with t.
+func (r *ClauseRef) Unify(t Term, occursCheck bool, env *Env) (*Env, bool) {
+	switch t := env.Resolve(t).(type) {
+	case *ClauseRef:
+		return env, r == t
+	case Variable:
+		return t.Unify(r, occursCheck, env)
+	default:
+		return env, false
+	}
+}
+
+// Unparse emits tokens that represent the clause reference.
+func (r *ClauseRef) Unparse(emit func(Token), _ *Env, _ ...WriteOption) {
+	emit(Token{Kind: TokenIdent, Val: fmt.Sprintf("<clause>(%p)", r)})
+}
+
+// Compare compares the clause reference to another term.
+func (r *ClauseRef) Compare(t Term, env *Env) int64 {
+	switch t := env.Resolve(t).(type) {
+	case *ClauseRef:
+		if r == t {
+			return 0
+		}
+		return 1
+	default:
+		return 1
+	}
+}
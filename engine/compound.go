@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"errors"
 	"fmt"
 	"sort"
 	"strings"
@@ -36,7 +37,7 @@ func (c *Compound) Unify(t Term, occursCheck bool, env *Env) (*Env, bool) {
 			}
 		}
 		return env, true
-	case Variable:
+	case Variable, *lazyList:
 		return t.Unify(c, occursCheck, env)
 	default:
 		return env, false
@@ -60,7 +61,7 @@ func (c *Compound) Unparse(emit func(Token), env *Env, opts ...WriteOption) {
 		return
 	}
 
-	if op := wto.ops.find(c.Functor, len(c.Args)); op != nil {
+	if op := wto.ops.find(c.Functor, len(c.Args)); op != nil && !c.negativeNumberLike(wto.ops, env) {
 		[...]func(operator, func(Token), *Env, ...WriteOption){
 			operatorSpecifierFX:  c.unparseFX,
 			operatorSpecifierFY:  c.unparseFY,
@@ -73,6 +74,10 @@ func (c *Compound) Unparse(emit func(Token), env *Env, opts ...WriteOption) {
 		return
 	}
 
+	if c.Functor == dictFunctor && len(c.Args) == 2 && c.unparseDict(emit, env, opts...) {
+		return
+	}
+
 	if n, ok := env.Resolve(c.Args[0]).(Integer); ok && wto.numberVars && c.Functor == "$VAR" && len(c.Args) == 1 {
 		c.unparseNumberVar(n, emit)
 		return
@@ -81,6 +86,39 @@ func (c *Compound) Unparse(emit func(Token), env *Env, opts ...WriteOption) {
 	c.unparse(emit, env, opts...)
 }
 
+// negativeNumberLike checks if the compound is in a form of -(T) where T is written starting with a non-negative number
+// e.g. -(1) or -(1^2). It'd be read as a negative number if it's written in operator notation.
+func (c *Compound) negativeNumberLike(ops operators, env *Env) bool {
+	if c.Functor != "-" || len(c.Args) != 1 {
+		return false
+	}
+	return startsWithNonNegativeNumber(c.Args[0], ops, env)
+}
+
+func startsWithNonNegativeNumber(t Term, ops operators, env *Env) bool {
+	switch t := env.Resolve(t).(type) {
+	case Integer:
+		return t >= 0
+	case Float:
+		return t >= 0
+	case *Compound:
+		// The left operand of an infix or postfix operator is written first.
+		for _, op := range ops {
+			if op.name != t.Functor {
+				continue
+			}
+			switch {
+			case len(t.Args) == 2 && (op.specifier == operatorSpecifierXFX || op.specifier == operatorSpecifierXFY || op.specifier == operatorSpecifierYFX),
+				len(t.Args) == 1 && (op.specifier == operatorSpecifierXF || op.specifier == operatorSpecifierYF):
+				return startsWithNonNegativeNumber(t.Args[0], ops, env)
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
 func (c *Compound) unparseFX(op operator, emit func(Token), env *Env, opts ...WriteOption) {
 	wto := defaultWriteTermOptions
 	for _, o := range opts {
@@ -91,8 +129,8 @@ func (c *Compound) unparseFX(op operator, emit func(Token), env *Env, opts ...Wr
 		emit(Token{Kind: TokenParenL, Val: "("})
 		defer emit(Token{Kind: TokenParenR, Val: ")"})
 	}
-	c.Functor.Unparse(emit, env, opts...)
-	env.Resolve(c.Args[0]).Unparse(emit, env, append(opts, WithPriority(int(op.priority-1)))...)
+	c.unparseFunctor(emit, env, opts...)
+	unparseOperand(c.Args[0], int(op.priority-1), emit, env, opts...)
 }
 
 func (c *Compound) unparseFY(op operator, emit func(Token), env *Env, opts ...WriteOption) {
@@ -105,8 +143,8 @@ func (c *Compound) unparseFY(op operator, emit func(Token), env *Env, opts ...Wr
 		emit(Token{Kind: TokenParenL, Val: "("})
 		defer emit(Token{Kind: TokenParenR, Val: ")"})
 	}
-	c.Functor.Unparse(emit, env, opts...)
-	env.Resolve(c.Args[0]).Unparse(emit, env, append(opts, WithPriority(int(op.priority)))...)
+	c.unparseFunctor(emit, env, opts...)
+	unparseOperand(c.Args[0], int(op.priority), emit, env, opts...)
 }
 
 func (c *Compound) unparseXF(op operator, emit func(Token), env *Env, opts ...WriteOption) {
@@ -119,8 +157,8 @@ func (c *Compound) unparseXF(op operator, emit func(Token), env *Env, opts ...Wr
 		emit(Token{Kind: TokenParenL, Val: "("})
 		defer emit(Token{Kind: TokenParenR, Val: ")"})
 	}
-	env.Resolve(c.Args[0]).Unparse(emit, env, append(opts, WithPriority(int(op.priority-1)))...)
-	c.Functor.Unparse(emit, env, opts...)
+	unparseOperand(c.Args[0], int(op.priority-1), emit, env, opts...)
+	c.unparseFunctor(emit, env, opts...)
 }
 
 func (c *Compound) unparseYF(op operator, emit func(Token), env *Env, opts ...WriteOption) {
@@ -133,8 +171,8 @@ func (c *Compound) unparseYF(op operator, emit func(Token), env *Env, opts ...Wr
 		emit(Token{Kind: TokenParenL, Val: "("})
 		defer emit(Token{Kind: TokenParenR, Val: ")"})
 	}
-	env.Resolve(c.Args[0]).Unparse(emit, env, append(opts, WithPriority(int(op.priority)))...)
-	c.Functor.Unparse(emit, env, opts...)
+	unparseOperand(c.Args[0], int(op.priority), emit, env, opts...)
+	c.unparseFunctor(emit, env, opts...)
 }
 
 func (c *Compound) unparseXFX(op operator, emit func(Token), env *Env, opts ...WriteOption) {
@@ -147,9 +185,9 @@ func (c *Compound) unparseXFX(op operator, emit func(Token), env *Env, opts ...W
 		emit(Token{Kind: TokenParenL, Val: "("})
 		defer emit(Token{Kind: TokenParenR, Val: ")"})
 	}
-	env.Resolve(c.Args[0]).Unparse(emit, env, append(opts, WithPriority(int(op.priority)-1))...)
-	c.Functor.Unparse(emit, env, opts...)
-	env.Resolve(c.Args[1]).Unparse(emit, env, append(opts, WithPriority(int(op.priority)-1))...)
+	unparseOperand(c.Args[0], int(op.priority)-1, emit, env, opts...)
+	c.unparseFunctor(emit, env, opts...)
+	unparseOperand(c.Args[1], int(op.priority)-1, emit, env, opts...)
 }
 
 func (c *Compound) unparseXFY(op operator, emit func(Token), env *Env, opts ...WriteOption) {
@@ -162,9 +200,9 @@ func (c *Compound) unparseXFY(op operator, emit func(Token), env *Env, opts ...W
 		emit(Token{Kind: TokenParenL, Val: "("})
 		defer emit(Token{Kind: TokenParenR, Val: ")"})
 	}
-	env.Resolve(c.Args[0]).Unparse(emit, env, append(opts, WithPriority(int(op.priority)-1))...)
-	c.Functor.Unparse(emit, env, opts...)
-	env.Resolve(c.Args[1]).Unparse(emit, env, append(opts, WithPriority(int(op.priority)))...)
+	unparseOperand(c.Args[0], int(op.priority)-1, emit, env, opts...)
+	c.unparseFunctor(emit, env, opts...)
+	unparseOperand(c.Args[1], int(op.priority), emit, env, opts...)
 }
 
 func (c *Compound) unparseYFX(op operator, emit func(Token), env *Env, opts ...WriteOption) {
@@ -177,9 +215,28 @@ func (c *Compound) unparseYFX(op operator, emit func(Token), env *Env, opts ...W
 		emit(Token{Kind: TokenParenL, Val: "("})
 		defer emit(Token{Kind: TokenParenR, Val: ")"})
 	}
-	env.Resolve(c.Args[0]).Unparse(emit, env, append(opts, WithPriority(int(op.priority)))...)
-	c.Functor.Unparse(emit, env, opts...)
-	env.Resolve(c.Args[1]).Unparse(emit, env, append(opts, WithPriority(int(op.priority)-1))...)
+	unparseOperand(c.Args[0], int(op.priority), emit, env, opts...)
+	c.unparseFunctor(emit, env, opts...)
+	unparseOperand(c.Args[1], int(op.priority)-1, emit, env, opts...)
+}
+
+// unparseFunctor emits the functor of an operator.
+func (c *Compound) unparseFunctor(emit func(Token), env *Env, opts ...WriteOption) {
+	if c.Functor == "," {
+		emit(Token{Kind: TokenComma, Val: ","})
+		return
+	}
+	c.Functor.Unparse(emit, env, append(opts, WithPriority(1200))...)
+}
+
+// unparseOperand emits an operand of an operator. An atom which is also an operator is always enclosed in parentheses,
+// e.g. - (-), since it would be read as an operator otherwise.
+func unparseOperand(t Term, priority int, emit func(Token), env *Env, opts ...WriteOption) {
+	t = env.Resolve(t)
+	if _, ok := t.(Atom); ok {
+		priority = 0
+	}
+	t.Unparse(emit, env, append(opts, WithPriority(priority))...)
 }
 
 func (c *Compound) unparseList(emit func(Token), env *Env, opts ...WriteOption) {
@@ -188,6 +245,7 @@ func (c *Compound) unparseList(emit func(Token), env *Env, opts ...WriteOption)
 		o(&wto)
 	}
 
+	opts = append(opts, WithPriority(999))
 	emit(Token{Kind: TokenBracketL, Val: "["})
 	env.Resolve(c.Args[0]).Unparse(emit, env, opts...)
 	t := env.Resolve(c.Args[1])
@@ -210,8 +268,50 @@ func (c *Compound) unparseList(emit func(Token), env *Env, opts ...WriteOption)
 
 func (c *Compound) unparseBlock(emit func(Token), env *Env, opts ...WriteOption) {
 	emit(Token{Kind: TokenBraceL, Val: "{"})
-	env.Resolve(c.Args[0]).Unparse(emit, env, opts...)
+	env.Resolve(c.Args[0]).Unparse(emit, env, append(opts, WithPriority(1200))...)
+	emit(Token{Kind: TokenBraceR, Val: "}"})
+}
+
+// unparseDict emits tokens of a dict in the form of Tag{Key1: Value1, ...}. It emits nothing and returns false if the
+// compound is not a dict or it can't be read back in that form, e.g. its tag is a quoted atom.
+func (c *Compound) unparseDict(emit func(Token), env *Env, opts ...WriteOption) bool {
+	tag, pairs, ok := dictPairs(c, env)
+	if !ok {
+		return false
+	}
+	if _, ok := env.Resolve(tag).(Variable); !ok && !isUnquotedAtom(tag, env) {
+		return false
+	}
+	for _, p := range pairs {
+		switch k := env.Resolve(p.Args[0]).(type) {
+		case Atom:
+			if !isUnquotedAtom(k, env) {
+				return false
+			}
+		case Integer:
+			if k < 0 {
+				return false
+			}
+		}
+	}
+
+	env.Resolve(tag).Unparse(emit, env, append(opts, WithPriority(0))...)
+	emit(Token{Kind: TokenBraceL, Val: "{"})
+	for i, p := range pairs {
+		if i > 0 {
+			emit(Token{Kind: TokenComma, Val: ","})
+		}
+		env.Resolve(p.Args[0]).Unparse(emit, env, append(opts, WithPriority(0))...)
+		emit(Token{Kind: TokenGraphic, Val: ":"})
+		env.Resolve(p.Args[1]).Unparse(emit, env, append(opts, WithPriority(999))...)
+	}
 	emit(Token{Kind: TokenBraceR, Val: "}"})
+	return true
+}
+
+func isUnquotedAtom(t Term, env *Env) bool {
+	a, ok := env.Resolve(t).(Atom)
+	return ok && unquotedAtomPattern.MatchString(string(a))
 }
 
 func (c *Compound) unparseNumberVar(n Integer, emit func(Token)) {
@@ -227,7 +327,13 @@ func (c *Compound) unparseNumberVar(n Integer, emit func(Token)) {
 }
 
 func (c *Compound) unparse(emit func(Token), env *Env, opts ...WriteOption) {
-	c.Functor.Unparse(emit, env, opts...)
+	if c.Functor == "," {
+		// A bare comma followed by arguments would read back as a punctuation.
+		emit(Token{Kind: TokenQuotedIdent, Val: "','"})
+	} else {
+		c.Functor.Unparse(emit, env, append(opts, WithPriority(1200))...)
+	}
+	opts = append(opts, WithPriority(999))
 	emit(Token{Kind: TokenParenL, Val: "("})
 	env.Resolve(c.Args[0]).Unparse(emit, env, opts...)
 	for _, arg := range c.Args[1:] {
@@ -316,19 +422,19 @@ func EachList(list Term, f func(elem Term) error, env *Env) error {
 			return InstantiationError(whole)
 		case Atom:
 			if l != "[]" {
-				return typeErrorList(l)
+				return typeErrorList(l, env)
 			}
 			return nil
 		case *Compound:
 			if l.Functor != "." || len(l.Args) != 2 {
-				return typeErrorList(l)
+				return typeErrorList(l, env)
 			}
 			if err := f(l.Args[0]); err != nil {
 				return err
 			}
 			list = l.Args[1]
 		default:
-			return typeErrorList(l)
+			return typeErrorList(l, env)
 		}
 	}
 }
@@ -377,3 +483,59 @@ func Each(any Term, f func(elem Term) error, env *Env) error {
 	}
 	return EachSeq(any, ",", f, env)
 }
+
+// dictFunctor is the functor reserved for dicts. A dict Tag{Key1: Value1, ...} is represented as a compound
+// '$dict'(Tag, [Key1-Value1, ...]) and written back as Tag{Key1: Value1, ...}.
+const dictFunctor = Atom("$dict")
+
+// newDict returns a dict '$dict'(Tag, [Key1-Value1, ...]) of which pairs are sorted by key so that dicts with the same
+// key-value pairs unify regardless of the order they're written.
+func newDict(tag Term, pairs []*Compound, env *Env) (Term, error) {
+	ps := make([]*Compound, len(pairs))
+	copy(ps, pairs)
+	sort.SliceStable(ps, func(i, j int) bool {
+		return ps[i].Args[0].Compare(ps[j].Args[0], env) < 0
+	})
+	ts := make([]Term, len(ps))
+	for i, p := range ps {
+		if i > 0 && ps[i-1].Args[0].Compare(p.Args[0], env) == 0 {
+			return nil, fmt.Errorf("duplicate key: %s", p.Args[0])
+		}
+		ts[i] = p
+	}
+	return &Compound{
+		Functor: dictFunctor,
+		Args:    []Term{tag, List(ts...)},
+	}, nil
+}
+
+// dictPairs returns the tag and the key-value pairs of dict. It returns false if dict is not a dict.
+func dictPairs(dict Term, env *Env) (Term, []*Compound, bool) {
+	d, ok := env.Resolve(dict).(*Compound)
+	if !ok || d.Functor != dictFunctor || len(d.Args) != 2 {
+		return nil, nil, false
+	}
+	var pairs []*Compound
+	if err := EachList(d.Args[1], func(elem Term) error {
+		p, ok := env.Resolve(elem).(*Compound)
+		if !ok || p.Functor != "-" || len(p.Args) != 2 || !isDictKey(p.Args[0], env) {
+			return errNotADict
+		}
+		pairs = append(pairs, p)
+		return nil
+	}, env); err != nil {
+		return nil, nil, false
+	}
+	return d.Args[0], pairs, true
+}
+
+var errNotADict = errors.New("not a dict")
+
+func isDictKey(t Term, env *Env) bool {
+	switch env.Resolve(t).(type) {
+	case Atom, Integer:
+		return true
+	default:
+		return false
+	}
+}
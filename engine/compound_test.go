@@ -84,6 +84,51 @@ func TestCompound_Unify(t *testing.T) {
 }
 
 func TestCompound_Unparse(t *testing.T) {
+	t.Run("dict", func(t *testing.T) {
+		t.Run("tag and keys are unquoted", func(t *testing.T) {
+			d, err := newDict(Variable("T"), []*Compound{
+				{Functor: "-", Args: []Term{Atom("x"), Integer(1)}},
+				{Functor: "-", Args: []Term{Integer(2), Atom("a")}},
+			}, nil)
+			assert.NoError(t, err)
+
+			var ret []Token
+			d.Unparse(func(token Token) {
+				ret = append(ret, token)
+			}, nil)
+			assert.Equal(t, []Token{
+				{Kind: TokenVariable, Val: "T"},
+				{Kind: TokenBraceL, Val: "{"},
+				{Kind: TokenInteger, Val: "2"},
+				{Kind: TokenGraphic, Val: ":"},
+				{Kind: TokenIdent, Val: "a"},
+				{Kind: TokenComma, Val: ","},
+				{Kind: TokenIdent, Val: "x"},
+				{Kind: TokenGraphic, Val: ":"},
+				{Kind: TokenInteger, Val: "1"},
+				{Kind: TokenBraceR, Val: "}"},
+			}, ret)
+		})
+
+		t.Run("tag is quoted", func(t *testing.T) {
+			d, err := newDict(Atom("Point"), nil, nil)
+			assert.NoError(t, err)
+
+			var ret []Token
+			d.Unparse(func(token Token) {
+				ret = append(ret, token)
+			}, nil, WithQuoted(true))
+			assert.Equal(t, []Token{
+				{Kind: TokenQuotedIdent, Val: "'$dict'"},
+				{Kind: TokenParenL, Val: "("},
+				{Kind: TokenQuotedIdent, Val: "'Point'"},
+				{Kind: TokenComma, Val: ","},
+				{Kind: TokenIdent, Val: "[]"},
+				{Kind: TokenParenR, Val: ")"},
+			}, ret)
+		})
+	})
+
 	t.Run("list", func(t *testing.T) {
 		t.Run("proper", func(t *testing.T) {
 			var ret []Token
@@ -116,6 +161,38 @@ func TestCompound_Unparse(t *testing.T) {
 				{Kind: TokenBracketR, Val: "]"},
 			}, ret)
 		})
+
+		t.Run("partial", func(t *testing.T) {
+			env := NewEnv().Bind("T", ListRest(Variable("U"), Atom("b")))
+
+			var ret []Token
+			ListRest(Variable("T"), Atom("a")).Unparse(func(token Token) {
+				ret = append(ret, token)
+			}, env)
+			assert.Equal(t, []Token{
+				{Kind: TokenBracketL, Val: "["},
+				{Kind: TokenIdent, Val: "a"},
+				{Kind: TokenComma, Val: ","},
+				{Kind: TokenIdent, Val: "b"},
+				{Kind: TokenBar, Val: "|"},
+				{Kind: TokenVariable, Val: "U"},
+				{Kind: TokenBracketR, Val: "]"},
+			}, ret)
+		})
+
+		t.Run("improper", func(t *testing.T) {
+			var ret []Token
+			ListRest(Integer(2), Integer(1)).Unparse(func(token Token) {
+				ret = append(ret, token)
+			}, nil)
+			assert.Equal(t, []Token{
+				{Kind: TokenBracketL, Val: "["},
+				{Kind: TokenInteger, Val: "1"},
+				{Kind: TokenBar, Val: "|"},
+				{Kind: TokenInteger, Val: "2"},
+				{Kind: TokenBracketR, Val: "]"},
+			}, ret)
+		})
 	})
 
 	t.Run("block", func(t *testing.T) {
@@ -134,6 +211,25 @@ func TestCompound_Unparse(t *testing.T) {
 		}, ret)
 	})
 
+	t.Run("comma without operators", func(t *testing.T) {
+		var ret []Token
+		c := Compound{
+			Functor: ",",
+			Args:    []Term{Atom("a"), Atom("b")},
+		}
+		c.Unparse(func(token Token) {
+			ret = append(ret, token)
+		}, nil)
+		assert.Equal(t, []Token{
+			{Kind: TokenQuotedIdent, Val: "','"},
+			{Kind: TokenParenL, Val: "("},
+			{Kind: TokenIdent, Val: "a"},
+			{Kind: TokenComma, Val: ","},
+			{Kind: TokenIdent, Val: "b"},
+			{Kind: TokenParenR, Val: ")"},
+		}, ret)
+	})
+
 	t.Run("unary operator", func(t *testing.T) {
 		t.Run("FX", func(t *testing.T) {
 			c := Compound{
@@ -266,6 +362,32 @@ func TestCompound_Unparse(t *testing.T) {
 		})
 	})
 
+	t.Run("operator of another arity", func(t *testing.T) {
+		c := Compound{
+			Functor: "+",
+			Args:    []Term{Atom("a"), Atom("b"), Atom("c")},
+		}
+		ops := operators{
+			{priority: 200, specifier: operatorSpecifierFY, name: `+`},
+			{priority: 500, specifier: operatorSpecifierYFX, name: `+`},
+		}
+
+		var tokens []Token
+		c.Unparse(func(token Token) {
+			tokens = append(tokens, token)
+		}, nil, withOps(ops), WithPriority(1200))
+		assert.Equal(t, []Token{
+			{Kind: TokenGraphic, Val: "+"},
+			{Kind: TokenParenL, Val: "("},
+			{Kind: TokenIdent, Val: "a"},
+			{Kind: TokenComma, Val: ","},
+			{Kind: TokenIdent, Val: "b"},
+			{Kind: TokenComma, Val: ","},
+			{Kind: TokenIdent, Val: "c"},
+			{Kind: TokenParenR, Val: ")"},
+		}, tokens)
+	})
+
 	t.Run("binary operator", func(t *testing.T) {
 		t.Run("XFX", func(t *testing.T) {
 			c := Compound{
@@ -369,6 +491,33 @@ func TestCompound_Unparse(t *testing.T) {
 		})
 	})
 
+	t.Run("minus of a term starting with a number", func(t *testing.T) {
+		ops := operators{
+			{priority: 200, specifier: operatorSpecifierXFX, name: "^"},
+			{priority: 200, specifier: operatorSpecifierFY, name: "-"},
+		}
+
+		c := Compound{
+			Functor: "-",
+			Args: []Term{
+				&Compound{Functor: "^", Args: []Term{Integer(1), Integer(2)}},
+			},
+		}
+
+		var tokens []Token
+		c.Unparse(func(token Token) {
+			tokens = append(tokens, token)
+		}, nil, withOps(ops), WithPriority(1200))
+		assert.Equal(t, []Token{
+			{Kind: TokenGraphic, Val: "-"},
+			{Kind: TokenParenL, Val: "("},
+			{Kind: TokenInteger, Val: "1"},
+			{Kind: TokenGraphic, Val: "^"},
+			{Kind: TokenInteger, Val: "2"},
+			{Kind: TokenParenR, Val: ")"},
+		}, tokens)
+	})
+
 	t.Run("ignore_ops", func(t *testing.T) {
 		c := Compound{
 			Functor: "+",
@@ -503,7 +652,7 @@ func TestEachList(t *testing.T) {
 
 	t.Run("atom", func(t *testing.T) {
 		var ret []Term
-		assert.Equal(t, typeErrorList(Atom("a")), EachList(Atom("a"), func(elem Term) error {
+		assert.Equal(t, typeErrorList(Atom("a"), nil), EachList(Atom("a"), func(elem Term) error {
 			ret = append(ret, elem)
 			return nil
 		}, nil))
@@ -515,7 +664,7 @@ func TestEachList(t *testing.T) {
 		assert.Equal(t, typeErrorList(&Compound{
 			Functor: "f",
 			Args:    []Term{Atom("a")},
-		}), EachList(&Compound{
+		}, nil), EachList(&Compound{
 			Functor: "f",
 			Args:    []Term{Atom("a")},
 		}, func(elem Term) error {
@@ -527,7 +676,7 @@ func TestEachList(t *testing.T) {
 
 	t.Run("integer", func(t *testing.T) {
 		var ret []Term
-		assert.Equal(t, typeErrorList(Integer(1)), EachList(Integer(1), func(elem Term) error {
+		assert.Equal(t, typeErrorList(Integer(1), nil), EachList(Integer(1), func(elem Term) error {
 			ret = append(ret, elem)
 			return nil
 		}, nil))
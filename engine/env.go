@@ -130,6 +130,23 @@ func (e *Env) balance() {
 	}
 }
 
+// Bindings returns the variables bound in the environment and the terms they resolve to.
+// A variable bound to a chain of unbound variables resolves to the last variable of the chain.
+func (e *Env) Bindings() map[Variable]Term {
+	ret := map[Variable]Term{}
+	var walk func(node *Env)
+	walk = func(node *Env) {
+		if node == nil {
+			return
+		}
+		walk(node.left)
+		ret[node.variable] = e.Simplify(node.variable)
+		walk(node.right)
+	}
+	walk(e)
+	return ret
+}
+
 // Resolve follows the variable chain and returns the first non-variable term or the last free variable.
 func (e *Env) Resolve(t Term) Term {
 	var stop []Variable
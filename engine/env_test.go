@@ -46,3 +46,24 @@ func TestEnv_Lookup(t *testing.T) {
 		})
 	}
 }
+
+func TestEnv_Bindings(t *testing.T) {
+	t.Run("empty", func(t *testing.T) {
+		var env *Env
+		assert.Equal(t, map[Variable]Term{}, env.Bindings())
+	})
+
+	t.Run("chains", func(t *testing.T) {
+		env := NewEnv().
+			Bind("A", Variable("B")).
+			Bind("B", Atom("b")).
+			Bind("C", &Compound{Functor: "f", Args: []Term{Variable("A"), Variable("D")}}).
+			Bind("D", Variable("E"))
+		assert.Equal(t, map[Variable]Term{
+			"A": Atom("b"),
+			"B": Atom("b"),
+			"C": &Compound{Functor: "f", Args: []Term{Atom("b"), Variable("E")}},
+			"D": Variable("E"),
+		}, env.Bindings())
+	})
+}
@@ -26,60 +26,96 @@ func InstantiationError(culprit Term) *Exception {
 	}
 }
 
-func typeErrorAtom(culprit Term) *Exception {
-	return TypeError("atom", culprit, "%s is not an atom.", culprit)
+func uninstantiationError(culprit Term, env *Env) *Exception {
+	culprit = env.Simplify(culprit)
+	return &Exception{
+		Term: &Compound{
+			Functor: "error",
+			Args: []Term{
+				&Compound{Functor: "uninstantiation_error", Args: []Term{culprit}},
+				Atom(fmt.Sprintf("%s is instantiated.", culprit)),
+			},
+		},
+	}
+}
+
+func typeErrorAtom(culprit Term, env *Env) *Exception {
+	return typeError("atom", culprit, env, "%s is not an atom.")
+}
+
+func typeErrorByte(culprit Term, env *Env) *Exception {
+	return typeError("byte", culprit, env, "%s is not a byte.")
+}
+
+func typeErrorCallable(culprit Term, env *Env) *Exception {
+	return typeError("callable", culprit, env, "%s is not callable.")
+}
+
+func typeErrorCharacter(culprit Term, env *Env) *Exception {
+	return typeError("character", culprit, env, "%s is not a character.")
 }
 
-func typeErrorByte(culprit Term) *Exception {
-	return TypeError("byte", culprit, "%s is not a byte.", culprit)
+func typeErrorInByte(culprit Term, env *Env) *Exception {
+	return typeError("in_byte", culprit, env, "%s is not a byte.")
 }
 
-func typeErrorCallable(culprit Term) *Exception {
-	return TypeError("callable", culprit, "%s is not callable.", culprit)
+func typeErrorInCharacter(culprit Term, env *Env) *Exception {
+	return typeError("in_character", culprit, env, "%s is not a character.")
 }
 
-func typeErrorCharacter(culprit Term) *Exception {
-	return TypeError("character", culprit, "%s is not a character.", culprit)
+func typeErrorDBReference(culprit Term, env *Env) *Exception {
+	return typeError("db_reference", culprit, env, "%s is not a database reference.")
 }
 
-func typeErrorInByte(culprit Term) *Exception {
-	return TypeError("in_byte", culprit, "%s is not a byte.", culprit)
+func typeErrorKey(culprit Term, env *Env) *Exception {
+	return typeError("key", culprit, env, "%s is not a key.")
 }
 
-func typeErrorInCharacter(culprit Term) *Exception {
-	return TypeError("in_character", culprit, "%s is not a character.", culprit)
+func typeErrorDict(culprit Term, env *Env) *Exception {
+	return typeError("dict", culprit, env, "%s is not a dict.")
 }
 
-func typeErrorEvaluable(culprit Term) *Exception {
-	return TypeError("evaluable", culprit, "%s is not evaluable.", culprit)
+func typeErrorDictKey(culprit Term, env *Env) *Exception {
+	return typeError("dict_key", culprit, env, "%s is not a dict key.")
 }
 
-func typeErrorInteger(culprit Term) *Exception {
-	return TypeError("integer", culprit, "%s is not an integer.", culprit)
+func typeErrorEvaluable(culprit Term, env *Env) *Exception {
+	return typeError("evaluable", culprit, env, "%s is not evaluable.")
 }
 
-func typeErrorList(culprit Term) *Exception {
-	return TypeError("list", culprit, "%s is not a list.", culprit)
+func typeErrorInteger(culprit Term, env *Env) *Exception {
+	return typeError("integer", culprit, env, "%s is not an integer.")
 }
 
-func typeErrorNumber(culprit Term) *Exception {
-	return TypeError("number", culprit, "%s is not a number.", culprit)
+func typeErrorList(culprit Term, env *Env) *Exception {
+	return typeError("list", culprit, env, "%s is not a list.")
 }
 
-func typeErrorPredicateIndicator(culprit Term) *Exception {
-	return TypeError("predicate_indicator", culprit, "%s is not a predicate indicator.", culprit)
+func typeErrorNumber(culprit Term, env *Env) *Exception {
+	return typeError("number", culprit, env, "%s is not a number.")
 }
 
-func typeErrorVariable(culprit Term) *Exception {
-	return TypeError("variable", culprit, "%s is not a variable.", culprit)
+func typeErrorPredicateIndicator(culprit Term, env *Env) *Exception {
+	return typeError("predicate_indicator", culprit, env, "%s is not a predicate indicator.")
 }
 
-func typeErrorCompound(culprit Term) *Exception {
-	return TypeError("compound", culprit, "%s is not a compound.", culprit)
+func typeErrorVariable(culprit Term, env *Env) *Exception {
+	return typeError("variable", culprit, env, "%s is not a variable.")
 }
 
-func typeErrorAtomic(culprit Term) *Exception {
-	return TypeError("atomic", culprit, "%s is not atomic.", culprit)
+func typeErrorCompound(culprit Term, env *Env) *Exception {
+	return typeError("compound", culprit, env, "%s is not a compound.")
+}
+
+func typeErrorAtomic(culprit Term, env *Env) *Exception {
+	return typeError("atomic", culprit, env, "%s is not atomic.")
+}
+
+// typeError creates a type error exception of which context message is format applied to culprit. The culprit is resolved by env
+// so that it's reported as it is, e.g. f(x) instead of f(_1) where _1 is bound to x.
+func typeError(validType Atom, culprit Term, env *Env, format string) *Exception {
+	culprit = env.Simplify(culprit)
+	return TypeError(validType, culprit, format, culprit)
 }
 
 // TypeError creates a new type error exception.
@@ -98,64 +134,75 @@ func TypeError(validType Atom, culprit Term, format string, args ...interface{})
 	}
 }
 
-func domainErrorFlagValue(culprit Term) *Exception {
-	return DomainError("flag_value", culprit, "%s is not a flag value.", culprit)
+func domainErrorFlagValue(culprit Term, env *Env) *Exception {
+	return domainError("flag_value", culprit, env, "%s is not a flag value.")
+}
+
+func domainErrorIOMode(culprit Term, env *Env) *Exception {
+	return domainError("io_mode", culprit, env, "%s is not an I/O mode.")
+}
+
+func domainErrorNotEmptyList(culprit Term, env *Env) *Exception {
+	return domainError("not_empty_list", culprit, env, "%s is an empty list.")
 }
 
-func domainErrorIOMode(culprit Term) *Exception {
-	return DomainError("io_mode", culprit, "%s is not an I/O mode.", culprit)
+func domainErrorNotLessThanZero(culprit Term, env *Env) *Exception {
+	return domainError("not_less_than_zero", culprit, env, "%s is less than zero.")
 }
 
-func domainErrorNotEmptyList(culprit Term) *Exception {
-	return DomainError("not_empty_list", culprit, "%s is an empty list.", culprit)
+func domainErrorOperatorPriority(culprit Term, env *Env) *Exception {
+	return domainError("operator_priority", culprit, env, "%s is not between 0 and 1200.")
 }
 
-func domainErrorNotLessThanZero(culprit Term) *Exception {
-	return DomainError("not_less_than_zero", culprit, "%s is less than zero.", culprit)
+func domainErrorOperatorSpecifier(culprit Term, env *Env) *Exception {
+	return domainError("operator_specifier", culprit, env, "%s is neither xf, yf, xfx, xfy, yfx, fx, nor fy.")
 }
 
-func domainErrorOperatorPriority(culprit Term) *Exception {
-	return DomainError("operator_priority", culprit, "%s is not between 0 and 1200.", culprit)
+func domainErrorPrologFlag(culprit Term, env *Env) *Exception {
+	return domainError("prolog_flag", culprit, env, "%s is not a prolog flag.")
 }
 
-func domainErrorOperatorSpecifier(culprit Term) *Exception {
-	return DomainError("operator_specifier", culprit, "%s is neither xf, yf, xfx, xfy, yfx, fx, nor fy.", culprit)
+func domainErrorReadOption(culprit Term, env *Env) *Exception {
+	return domainError("read_option", culprit, env, "%s is not a read option.")
 }
 
-func domainErrorPrologFlag(culprit Term) *Exception {
-	return DomainError("prolog_flag", culprit, "%s is not a prolog flag.", culprit)
+func domainErrorSeekMethod(culprit Term, env *Env) *Exception {
+	return domainError("seek_method", culprit, env, "%s is neither bof, current, nor eof.")
 }
 
-func domainErrorReadOption(culprit Term) *Exception {
-	return DomainError("read_option", culprit, "%s is not a read option.", culprit)
+func domainErrorSourceSink(culprit Term, env *Env) *Exception {
+	return domainError("source_sink", culprit, env, "%s is not a source/sink.")
 }
 
-func domainErrorSourceSink(culprit Term) *Exception {
-	return DomainError("source_sink", culprit, "%s is not a source/sink.", culprit)
+func domainErrorStream(culprit Term, env *Env) *Exception {
+	return domainError("stream", culprit, env, "%s is not a stream.")
 }
 
-func domainErrorStream(culprit Term) *Exception {
-	return DomainError("stream", culprit, "%s is not a stream.", culprit)
+func domainErrorStreamOption(culprit Term, env *Env) *Exception {
+	return domainError("stream_option", culprit, env, "%s is not a stream option.")
 }
 
-func domainErrorStreamOption(culprit Term) *Exception {
-	return DomainError("stream_option", culprit, "%s is not a stream option.", culprit)
+func domainErrorStreamOrAlias(culprit Term, env *Env) *Exception {
+	return domainError("stream_or_alias", culprit, env, "%s is neither a stream nor an alias.")
 }
 
-func domainErrorStreamOrAlias(culprit Term) *Exception {
-	return DomainError("stream_or_alias", culprit, "%s is neither a stream nor an alias.", culprit)
+func domainErrorStreamProperty(culprit Term, env *Env) *Exception {
+	return domainError("stream_property", culprit, env, "%s is not a stream property.")
 }
 
-func domainErrorStreamProperty(culprit Term) *Exception {
-	return DomainError("stream_property", culprit, "%s is not a stream property.", culprit)
+func domainErrorWriteOption(culprit Term, env *Env) *Exception {
+	return domainError("write_option", culprit, env, "%s is not a write option.")
 }
 
-func domainErrorWriteOption(culprit Term) *Exception {
-	return DomainError("write_option", culprit, "%s is not a write option.", culprit)
+func domainErrorOrder(culprit Term, env *Env) *Exception {
+	return domainError("order", culprit, env, "%s is neither <, =, nor >.")
 }
 
-func domainErrorOrder(culprit Term) *Exception {
-	return DomainError("order", culprit, "%s is neither <, =, nor >.", culprit)
+// domainError creates a domain error exception of which context message is format applied to culprit. The culprit is resolved by env
+// so that it's reported as it is, e.g. f(x) instead of f(_1) where _1 is bound to x.
+func domainError(validDomain Atom, culprit Term, env *Env, format string) *Exception {
+	culprit = env.Simplify(culprit)
+	return DomainError(validDomain, culprit, format, culprit)
 }
 
 // DomainError creates a new domain error exception.
@@ -174,16 +221,23 @@ func DomainError(validDomain Atom, culprit Term, format string, args ...interfac
 	}
 }
 
-func existenceErrorProcedure(culprit Term) *Exception {
-	return ExistenceError("procedure", culprit, "procedure %s is not defined.", culprit)
+func existenceErrorProcedure(culprit Term, env *Env) *Exception {
+	return existenceError("procedure", culprit, env, "procedure %s does not exist.")
+}
+
+func existenceErrorSourceSink(culprit Term, env *Env) *Exception {
+	return existenceError("source_sink", culprit, env, "file %s does not exist.")
 }
 
-func existenceErrorSourceSink(culprit Term) *Exception {
-	return ExistenceError("source_sink", culprit, "file %s doesn't exist.", culprit)
+func existenceErrorStream(culprit Term, env *Env) *Exception {
+	return existenceError("stream", culprit, env, "stream %s does not exist.")
 }
 
-func existenceErrorStream(culprit Term) *Exception {
-	return ExistenceError("stream", culprit, "stream %s doesn't exist.", culprit)
+// existenceError creates a existence error exception of which context message is format applied to culprit. The culprit is resolved by env
+// so that it's reported as it is, e.g. f(x) instead of f(_1) where _1 is bound to x.
+func existenceError(objectType Atom, culprit Term, env *Env, format string) *Exception {
+	culprit = env.Simplify(culprit)
+	return ExistenceError(objectType, culprit, format, culprit)
 }
 
 // ExistenceError creates a new existence error exception.
@@ -202,40 +256,55 @@ func ExistenceError(objectType Atom, culprit Term, format string, args ...interf
 	}
 }
 
-func permissionErrorModifyStaticProcedure(culprit Term) *Exception {
-	return PermissionError("modify", "static_procedure", culprit, "%s is static.", culprit)
+func permissionErrorModifyStaticProcedure(culprit Term, env *Env) *Exception {
+	return permissionError("modify", "static_procedure", culprit, env, "%s is static.")
+}
+
+func permissionErrorModifyOperator(culprit Term, env *Env) *Exception {
+	return permissionError("modify", "operator", culprit, env, "%s is not modifiable.")
+}
+
+func permissionErrorCreateOperator(culprit Term, env *Env) *Exception {
+	return permissionError("create", "operator", culprit, env, "%s can't be an operator.")
 }
 
-func permissionErrorAccessPrivateProcedure(culprit Term) *Exception {
-	return PermissionError("access", "private_procedure", culprit, "%s is private.", culprit)
+func permissionErrorAccessPrivateProcedure(culprit Term, env *Env) *Exception {
+	return permissionError("access", "private_procedure", culprit, env, "%s is private.")
 }
 
-func permissionErrorOutputStream(culprit Term) *Exception {
-	return PermissionError("output", "stream", culprit, "%s is not an output stream.", culprit)
+func permissionErrorOutputStream(culprit Term, env *Env) *Exception {
+	return permissionError("output", "stream", culprit, env, "%s is not an output stream.")
 }
 
-func permissionErrorOutputBinaryStream(culprit Term) *Exception {
-	return PermissionError("output", "binary_stream", culprit, "%s is a binary stream.", culprit)
+func permissionErrorOutputBinaryStream(culprit Term, env *Env) *Exception {
+	return permissionError("output", "binary_stream", culprit, env, "%s is a binary stream.")
 }
 
-func permissionErrorOutputTextStream(culprit Term) *Exception {
-	return PermissionError("output", "text_stream", culprit, "%s is a text stream.", culprit)
+func permissionErrorOutputTextStream(culprit Term, env *Env) *Exception {
+	return permissionError("output", "text_stream", culprit, env, "%s is a text stream.")
 }
 
-func permissionErrorInputStream(culprit Term) *Exception {
-	return PermissionError("input", "stream", culprit, "%s is not an input stream.", culprit)
+func permissionErrorInputStream(culprit Term, env *Env) *Exception {
+	return permissionError("input", "stream", culprit, env, "%s is not an input stream.")
 }
 
-func permissionErrorInputBinaryStream(culprit Term) *Exception {
-	return PermissionError("input", "binary_stream", culprit, "%s is a binary stream.", culprit)
+func permissionErrorInputBinaryStream(culprit Term, env *Env) *Exception {
+	return permissionError("input", "binary_stream", culprit, env, "%s is a binary stream.")
 }
 
-func permissionErrorInputTextStream(culprit Term) *Exception {
-	return PermissionError("input", "text_stream", culprit, "%s is a text stream.", culprit)
+func permissionErrorInputTextStream(culprit Term, env *Env) *Exception {
+	return permissionError("input", "text_stream", culprit, env, "%s is a text stream.")
 }
 
-func permissionErrorInputPastEndOfStream(culprit Term) *Exception {
-	return PermissionError("input", "past_end_of_stream", culprit, "%s has past end of stream.", culprit)
+func permissionErrorInputPastEndOfStream(culprit Term, env *Env) *Exception {
+	return permissionError("input", "past_end_of_stream", culprit, env, "%s is past end of stream.")
+}
+
+// permissionError creates a permission error exception of which context message is format applied to culprit. The culprit is resolved by env
+// so that it's reported as it is, e.g. f(x) instead of f(_1) where _1 is bound to x.
+func permissionError(operation, permissionType Atom, culprit Term, env *Env, format string) *Exception {
+	culprit = env.Simplify(culprit)
+	return PermissionError(operation, permissionType, culprit, format, culprit)
 }
 
 // PermissionError creates a new permission error exception.
@@ -273,6 +342,14 @@ func evaluationErrorZeroDivisor() *Exception {
 	return evaluationError(Atom("zero_divisor"), Atom("divided by zero."))
 }
 
+func evaluationErrorUndefined() *Exception {
+	return evaluationError(Atom("undefined"), Atom("undefined."))
+}
+
+func evaluationErrorFloatOverflow() *Exception {
+	return evaluationError(Atom("float_overflow"), Atom("float overflow."))
+}
+
 func evaluationError(error, info Term) *Exception {
 	return &Exception{
 		Term: &Compound{
@@ -303,6 +380,10 @@ func resourceError(resource, info Term) *Exception {
 	}
 }
 
+func resourceErrorParseDepth(max int) *Exception {
+	return resourceError(Atom("parse_depth"), Atom(fmt.Sprintf("Term is nested deeper than %d.", max)))
+}
+
 func syntaxErrorNotANumber() *Exception {
 	return syntaxError(Atom("not_a_number"), Atom("Not a number."))
 }
@@ -334,6 +415,33 @@ func syntaxError(detail, info Term) *Exception {
 	}
 }
 
+func timeLimitExceeded(limit Term) *Exception {
+	return &Exception{
+		Term: &Compound{
+			Functor: "error",
+			Args: []Term{
+				Atom("time_limit_exceeded"),
+				Atom(fmt.Sprintf("%s seconds exceeded.", limit)),
+			},
+		},
+	}
+}
+
+func formatError(msg string) *Exception {
+	return &Exception{
+		Term: &Compound{
+			Functor: "error",
+			Args: []Term{
+				&Compound{
+					Functor: "format",
+					Args:    []Term{Atom(msg)},
+				},
+				Atom(msg),
+			},
+		},
+	}
+}
+
 // SystemError creates a new system error exception.
 func SystemError(err error) *Exception {
 	return &Exception{
@@ -1,6 +1,7 @@
 package engine
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
 )
@@ -27,16 +28,38 @@ func (f Float) Unify(t Term, occursCheck bool, env *Env) (*Env, bool) {
 }
 
 // Unparse emits tokens that represent the float.
-func (f Float) Unparse(emit func(Token), _ *Env, _ ...WriteOption) {
+func (f Float) Unparse(emit func(Token), _ *Env, opts ...WriteOption) {
+	wto := defaultWriteTermOptions
+	for _, o := range opts {
+		o(&wto)
+	}
+
 	if f < 0 {
 		emit(Token{Kind: TokenSign, Val: "-"})
 		f *= -1
 	}
-	s := strconv.FormatFloat(float64(f), 'f', -1, 64)
-	if !strings.ContainsRune(s, '.') {
-		s += ".0"
+	emit(Token{Kind: TokenFloat, Val: formatFloat(f, wto.floatFormat)})
+}
+
+// formatFloat formats f with format, or in the shortest representation if format is empty.
+// The result always contains a dot so that it's read as a float.
+func formatFloat(f Float, format string) string {
+	if format == "" {
+		s := strconv.FormatFloat(float64(f), 'f', -1, 64)
+		if !strings.ContainsRune(s, '.') {
+			s += ".0"
+		}
+		return s
+	}
+
+	s := fmt.Sprintf(format, float64(f))
+	if strings.ContainsRune(s, '.') {
+		return s
+	}
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		return s[:i] + ".0" + s[i:]
 	}
-	emit(Token{Kind: TokenFloat, Val: s})
+	return s + ".0"
 }
 
 // Compare compares the float to another term.
@@ -1,6 +1,8 @@
 package engine
 
 import (
+	"bufio"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -27,6 +29,38 @@ func TestFloat_Unparse(t *testing.T) {
 			{Kind: TokenFloat, Val: "33.0"},
 		}, tokens)
 	})
+
+	t.Run("float_format", func(t *testing.T) {
+		var tokens []Token
+		Float(1.0/3).Unparse(func(token Token) {
+			tokens = append(tokens, token)
+		}, nil, WithFloatFormat("%.3f"))
+		assert.Equal(t, []Token{
+			{Kind: TokenFloat, Val: "0.333"},
+		}, tokens)
+	})
+
+	t.Run("float_format without a dot", func(t *testing.T) {
+		var tokens []Token
+		Float(1e20).Unparse(func(token Token) {
+			tokens = append(tokens, token)
+		}, nil, WithFloatFormat("%g"))
+		assert.Equal(t, []Token{
+			{Kind: TokenFloat, Val: "1.0e+20"},
+		}, tokens)
+	})
+
+	t.Run("round trip", func(t *testing.T) {
+		for _, f := range []Float{0.1, 1.0 / 3, 1e-10, 123456789.123456789, 5e-324} {
+			var sb strings.Builder
+			assert.NoError(t, Write(&sb, f, nil))
+
+			p := newParser(bufio.NewReader(strings.NewReader(sb.String())), nil)
+			n, err := p.Number()
+			assert.NoError(t, err)
+			assert.Equal(t, f, n)
+		}
+	})
 }
 
 func TestFloat_Compare(t *testing.T) {
@@ -0,0 +1,43 @@
+package engine
+
+// lazyList is a list of the character codes in a stream. The codes are read on demand, one at a time, as the list is
+// unified with other terms. Both the end of the stream and a read error end the list.
+type lazyList struct {
+	stream *Stream
+	value  Term // either [] or [Code|Rest] once read.
+}
+
+// force reads the next code, if not yet, and returns the list it represents.
+func (l *lazyList) force() Term {
+	if l.value == nil {
+		r, _, err := readRune(l.stream.buf)
+		if err != nil {
+			l.value = Atom("[]")
+		} else {
+			l.value = &Compound{Functor: ".", Args: []Term{Integer(r), &lazyList{stream: l.stream}}}
+		}
+	}
+	return l.value
+}
+
+func (l *lazyList) String() string {
+	return l.force().String()
+}
+
+// Unify unifies the list with t.
+func (l *lazyList) Unify(t Term, occursCheck bool, env *Env) (*Env, bool) {
+	if v, ok := env.Resolve(t).(Variable); ok {
+		return v.Unify(l, occursCheck, env)
+	}
+	return l.force().Unify(t, occursCheck, env)
+}
+
+// Unparse emits tokens that represent the list.
+func (l *lazyList) Unparse(emit func(Token), env *Env, opts ...WriteOption) {
+	l.force().Unparse(emit, env, opts...)
+}
+
+// Compare compares the list to another term.
+func (l *lazyList) Compare(t Term, env *Env) int64 {
+	return l.force().Compare(t, env)
+}
@@ -5,8 +5,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
 // Lexer turns bytes into tokens.
@@ -16,6 +18,19 @@ type Lexer struct {
 	tokens          []Token
 	pos             int
 	width           int
+	layout          bool
+
+	// start is the byte offset of the token being lexed and offsets are the ones of the lexed tokens.
+	start   int
+	offsets []int
+	offset  int
+
+	// chars is the number of runes read so far. charStart, charOffsets, and charOffset are the character offsets
+	// counterparts of start, offsets, and offset.
+	chars       int
+	charStart   int
+	charOffsets []int
+	charOffset  int
 }
 
 // NewLexer create a lexer with an input and char conversions.
@@ -41,12 +56,47 @@ func (l *Lexer) Next() (Token, error) {
 	if len(l.tokens) > 0 {
 		var t Token
 		t, l.tokens = l.tokens[0], l.tokens[1:]
+		l.offset, l.offsets = l.offsets[0], l.offsets[1:]
+		l.charOffset, l.charOffsets = l.charOffsets[0], l.charOffsets[1:]
 		return t, nil
 	}
 
 	return Token{}, errors.New("no match")
 }
 
+// Pos returns the byte offset of the token last returned by Next.
+func (l *Lexer) Pos() int {
+	return l.offset
+}
+
+// charPos returns the character offset of the token last returned by Next.
+func (l *Lexer) charPos() int {
+	return l.charOffset
+}
+
+// PositionedToken is a token with its byte offset in the input.
+type PositionedToken struct {
+	Token
+	Pos int
+}
+
+// Tokenize returns the tokens in input with their byte offsets. Layout text and comments are skipped.
+// It's meant for tools like syntax highlighters which don't need to parse the input.
+func Tokenize(input string) ([]PositionedToken, error) {
+	l := NewLexer(bufio.NewReader(strings.NewReader(input)), nil)
+	var ts []PositionedToken
+	for {
+		t, err := l.Next()
+		if err != nil {
+			return ts, err
+		}
+		if t.Kind == TokenEOS {
+			return ts, nil
+		}
+		ts = append(ts, PositionedToken{Token: t, Pos: l.Pos()})
+	}
+}
+
 const etx = 0x2
 
 func (l *Lexer) next() (rune, error) {
@@ -62,22 +112,34 @@ func (l *Lexer) next() (rune, error) {
 	}
 	l.width = w
 	l.pos += l.width
+	l.chars++
 	return r, nil
 }
 
 func (l *Lexer) backup() {
 	_ = l.input.UnreadRune()
 	l.pos -= l.width
+	l.chars--
 }
 
 func (l *Lexer) emit(t Token) {
+	l.layout = false
 	l.tokens = append(l.tokens, t)
+	l.offsets = append(l.offsets, l.start)
+	l.charOffsets = append(l.charOffsets, l.charStart)
+	l.start += len(t.Val) // in case another token follows e.g. 1. as an integer and a period.
+	l.charStart += utf8.RuneCountInString(t.Val)
 }
 
 // Token is a smallest meaningful unit of prolog program.
 type Token struct {
 	Kind TokenKind
 	Val  string
+
+	// layout is true if the token is an open parenthesis or curly bracket preceded by whitespaces or comments.
+	// ISO distinguishes it from an open parenthesis right after a functor, a.k.a. open CT.
+	// Likewise, a curly bracket right after a tag starts a dict.
+	layout bool
 }
 
 func (t Token) String() string {
@@ -187,11 +249,13 @@ var initSingleRunes = [...]TokenKind{
 }
 
 func (l *Lexer) init(r rune) (lexState, error) {
+	l.start = l.pos - l.width
+	l.charStart = l.chars - 1
 	r = l.conv(r)
 
 	if int(r) < len(initSingleRunes) { // A rune can be bigger than the size of the array.
 		if k := initSingleRunes[r]; k != TokenEOS {
-			l.emit(Token{Kind: k, Val: string(r)})
+			l.emit(Token{Kind: k, Val: string(r), layout: k == TokenParenL && l.layout})
 			return nil, nil
 		}
 	}
@@ -201,6 +265,7 @@ func (l *Lexer) init(r rune) (lexState, error) {
 		l.emit(Token{Kind: TokenEOS})
 		return nil, nil
 	case unicode.IsSpace(r):
+		l.layout = true
 		return l.init, nil
 	case r == '%':
 		return l.singleLineComment(l.init)
@@ -389,11 +454,11 @@ func (l *Lexer) curlyBracket(r rune) (lexState, error) {
 	r = l.conv(r)
 	switch {
 	case r == '}':
-		l.emit(Token{Kind: TokenIdent, Val: "{}"})
+		l.emit(Token{Kind: TokenIdent, Val: "{}", layout: l.layout})
 		return nil, nil
 	default:
 		l.backup()
-		l.emit(Token{Kind: TokenBraceL, Val: "{"})
+		l.emit(Token{Kind: TokenBraceL, Val: "{", layout: l.layout})
 		return nil, nil
 	}
 }
@@ -546,17 +611,26 @@ var integerCharEscapeRunes = [...]rune{
 	'v':  '\v',
 	'\\': '\\',
 	'\'': '\'',
+	'"':  '"',
+	'`':  '`',
 }
 
 func (l *Lexer) integerCharEscape(b *strings.Builder) (lexState, error) {
 	return func(r rune) (lexState, error) {
 		r = l.conv(r)
 
-		if r == etx {
+		switch {
+		case r == etx:
 			return nil, ErrInsufficient
+		case r == 'x':
+			return l.integerCharEscapeCode(b, &strings.Builder{}, 16)
+		case isOctal(r):
+			var d strings.Builder
+			_, _ = d.WriteRune(r)
+			return l.integerCharEscapeCode(b, &d, 8)
 		}
 
-		if int(r) > len(integerCharEscapeRunes) || integerCharEscapeRunes[r] == 0 {
+		if int(r) >= len(integerCharEscapeRunes) || integerCharEscapeRunes[r] == 0 {
 			return nil, UnexpectedRuneError{rune: r}
 		}
 		_, _ = b.WriteRune(integerCharEscapeRunes[r])
@@ -566,6 +640,32 @@ func (l *Lexer) integerCharEscape(b *strings.Builder) (lexState, error) {
 	}, nil
 }
 
+// integerCharEscapeCode reads digits of a hexadecimal or octal escape sequence terminated by a backslash.
+func (l *Lexer) integerCharEscapeCode(b, digits *strings.Builder, base int) (lexState, error) {
+	return func(r rune) (lexState, error) {
+		r = l.conv(r)
+
+		switch {
+		case r == etx:
+			return nil, ErrInsufficient
+		case base == 16 && isHex(r), base == 8 && isOctal(r):
+			_, _ = digits.WriteRune(r)
+			return l.integerCharEscapeCode(b, digits, base)
+		case r == '\\' && digits.Len() > 0:
+			n, err := strconv.ParseInt(digits.String(), base, 32)
+			if err != nil || !utf8.ValidRune(rune(n)) {
+				return nil, UnexpectedRuneError{rune: r}
+			}
+			_, _ = b.WriteRune(rune(n))
+
+			l.emit(Token{Kind: TokenInteger, Val: b.String()})
+			return nil, nil
+		default:
+			return nil, UnexpectedRuneError{rune: r}
+		}
+	}, nil
+}
+
 func (l *Lexer) integerDecimal(b *strings.Builder) (lexState, error) {
 	return func(r rune) (lexState, error) {
 		r = l.conv(r)
@@ -686,8 +786,10 @@ func (l *Lexer) singleLineComment(ctx lexState) (lexState, error) {
 		r = l.conv(r)
 		switch r {
 		case etx:
-			return nil, ErrInsufficient
+			// A single line comment can be terminated by the end of input.
+			return ctx(r)
 		case '\n':
+			l.layout = true
 			return ctx, nil
 		default:
 			return l.singleLineComment(ctx)
@@ -733,6 +835,7 @@ func (l *Lexer) multiLineCommentEnd(ctx lexState) (lexState, error) {
 		case etx:
 			return nil, ErrInsufficient
 		case '/':
+			l.layout = true
 			return ctx, nil
 		default:
 			return l.multiLineCommentBody(ctx)
@@ -321,6 +321,22 @@ func TestLexer_Next(t *testing.T) {
 		assert.Equal(t, Token{Kind: TokenEOS}, token)
 	})
 
+	t.Run("single line comment at the end of input", func(t *testing.T) {
+		l := NewLexer(bufio.NewReader(strings.NewReader("foo. % comment")), nil)
+
+		token, err := l.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, Token{Kind: TokenIdent, Val: "foo"}, token)
+
+		token, err = l.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, Token{Kind: TokenPeriod, Val: "."}, token)
+
+		token, err = l.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, Token{Kind: TokenEOS}, token)
+	})
+
 	t.Run("multi line comment", func(t *testing.T) {
 		l := NewLexer(bufio.NewReader(strings.NewReader("/* comment \n * also comment \n */foo.")), nil)
 
@@ -811,6 +827,38 @@ a quoted ident'.`)), nil)
 					_, err := l.Next()
 					assert.Equal(t, UnexpectedRuneError{rune: '😀'}, err)
 				})
+
+				t.Run("hexadecimal", func(t *testing.T) {
+					l := NewLexer(bufio.NewReader(strings.NewReader(`0'\x41\`)), nil)
+					token, err := l.Next()
+					assert.NoError(t, err)
+					assert.Equal(t, Token{Kind: TokenInteger, Val: "0'A"}, token)
+				})
+
+				t.Run("octal", func(t *testing.T) {
+					l := NewLexer(bufio.NewReader(strings.NewReader(`0'\101\`)), nil)
+					token, err := l.Next()
+					assert.NoError(t, err)
+					assert.Equal(t, Token{Kind: TokenInteger, Val: "0'A"}, token)
+				})
+
+				t.Run("no digits", func(t *testing.T) {
+					l := NewLexer(bufio.NewReader(strings.NewReader(`0'\x\`)), nil)
+					_, err := l.Next()
+					assert.Equal(t, UnexpectedRuneError{rune: '\\'}, err)
+				})
+
+				t.Run("invalid code", func(t *testing.T) {
+					l := NewLexer(bufio.NewReader(strings.NewReader(`0'\xFFFFFFFFF\`)), nil)
+					_, err := l.Next()
+					assert.Equal(t, UnexpectedRuneError{rune: '\\'}, err)
+				})
+
+				t.Run("just past the escape table", func(t *testing.T) {
+					l := NewLexer(bufio.NewReader(strings.NewReader(`0'\w`)), nil)
+					_, err := l.Next()
+					assert.Equal(t, UnexpectedRuneError{rune: 'w'}, err)
+				})
 			})
 		})
 
@@ -1499,4 +1547,66 @@ a quoted ident"`}, token)
 			assert.Equal(t, Token{Kind: TokenEOS}, token)
 		})
 	})
+
+	t.Run("open parenthesis after layout", func(t *testing.T) {
+		l := NewLexer(bufio.NewReader(strings.NewReader("- (a) /* */(b).")), nil)
+
+		token, err := l.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, Token{Kind: TokenIdent, Val: "-"}, token)
+
+		token, err = l.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, Token{Kind: TokenParenL, Val: "(", layout: true}, token)
+
+		token, err = l.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, Token{Kind: TokenIdent, Val: "a"}, token)
+
+		token, err = l.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, Token{Kind: TokenParenR, Val: ")"}, token)
+
+		token, err = l.Next()
+		assert.NoError(t, err)
+		assert.Equal(t, Token{Kind: TokenParenL, Val: "(", layout: true}, token)
+	})
+}
+
+func TestTokenize(t *testing.T) {
+	t.Run("ok", func(t *testing.T) {
+		ts, err := Tokenize(`% comment
+foo('a b', "c") :- /* comment */ X is -1 + 2.5.`)
+		assert.NoError(t, err)
+		assert.Equal(t, []PositionedToken{
+			{Token: Token{Kind: TokenIdent, Val: "foo"}, Pos: 10},
+			{Token: Token{Kind: TokenParenL, Val: "("}, Pos: 13},
+			{Token: Token{Kind: TokenQuotedIdent, Val: "'a b'"}, Pos: 14},
+			{Token: Token{Kind: TokenComma, Val: ","}, Pos: 19},
+			{Token: Token{Kind: TokenDoubleQuoted, Val: `"c"`}, Pos: 21},
+			{Token: Token{Kind: TokenParenR, Val: ")"}, Pos: 24},
+			{Token: Token{Kind: TokenGraphic, Val: ":-"}, Pos: 26},
+			{Token: Token{Kind: TokenVariable, Val: "X"}, Pos: 43},
+			{Token: Token{Kind: TokenIdent, Val: "is"}, Pos: 45},
+			{Token: Token{Kind: TokenSign, Val: "-"}, Pos: 48},
+			{Token: Token{Kind: TokenInteger, Val: "1"}, Pos: 49},
+			{Token: Token{Kind: TokenIdent, Val: "+"}, Pos: 51},
+			{Token: Token{Kind: TokenFloat, Val: "2.5"}, Pos: 53},
+			{Token: Token{Kind: TokenPeriod, Val: "."}, Pos: 56},
+		}, ts)
+	})
+
+	t.Run("integer followed by a period", func(t *testing.T) {
+		ts, err := Tokenize(`1.`)
+		assert.NoError(t, err)
+		assert.Equal(t, []PositionedToken{
+			{Token: Token{Kind: TokenInteger, Val: "1"}, Pos: 0},
+			{Token: Token{Kind: TokenPeriod, Val: "."}, Pos: 1},
+		}, ts)
+	})
+
+	t.Run("unexpected rune", func(t *testing.T) {
+		_, err := Tokenize("foo(\x01).")
+		assert.Error(t, err)
+	})
 }
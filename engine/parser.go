@@ -9,6 +9,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 // Parser turns bytes into Term.
@@ -21,6 +22,65 @@ type Parser struct {
 	args         []Term
 	doubleQuotes doubleQuotes
 	vars         *[]ParsedVariable
+
+	// depth is the current depth of nested expressions and maxDepth is its limit.
+	depth, maxDepth int
+
+	// If positions is true, pos holds the position of the term last parsed. tokenFrom and tokenTo are the character
+	// offsets of the token last accepted.
+	positions          bool
+	pos                *termPosition
+	tokenFrom, tokenTo int
+
+	// err is an error More encountered. Term reports it.
+	err error
+}
+
+type termPositionKind uint8
+
+const (
+	termPositionPrimitive termPositionKind = iota
+	termPositionString
+	termPositionCompound
+	termPositionList
+	termPositionBrace
+	termPositionParentheses
+)
+
+// termPosition is the position of a parsed term in character offsets.
+type termPosition struct {
+	kind       termPositionKind
+	from, to   int
+	ffrom, fto int             // the functor of a compound
+	args       []*termPosition // the arguments of a compound, the elements of a list, or the content of a brace term or parentheses
+	tail       *termPosition   // the tail of a partial list
+}
+
+// term returns the position in the form of read_term/3 option term_position/1.
+func (p *termPosition) term() Term {
+	from, to := Integer(p.from), Integer(p.to)
+	args := make([]Term, len(p.args))
+	for i, a := range p.args {
+		args[i] = a.term()
+	}
+	switch p.kind {
+	case termPositionString:
+		return &Compound{Functor: "string_position", Args: []Term{from, to}}
+	case termPositionCompound:
+		return &Compound{Functor: "term_position", Args: []Term{from, to, Integer(p.ffrom), Integer(p.fto), List(args...)}}
+	case termPositionList:
+		var tail Term = Atom("none")
+		if p.tail != nil {
+			tail = p.tail.term()
+		}
+		return &Compound{Functor: "list_position", Args: []Term{from, to, List(args...), tail}}
+	case termPositionBrace:
+		return &Compound{Functor: "brace_term_position", Args: []Term{from, to, args[0]}}
+	case termPositionParentheses:
+		return &Compound{Functor: "parentheses_term_position", Args: []Term{from, to, args[0]}}
+	default:
+		return &Compound{Functor: "-", Args: []Term{from, to}}
+	}
 }
 
 // ParsedVariable is a set of information regarding a variable in a parsed term.
@@ -30,9 +90,13 @@ type ParsedVariable struct {
 	Count    int
 }
 
+// DefaultMaxParseDepth is the default limit of the depth of nested expressions in a term to parse.
+const DefaultMaxParseDepth = 10000
+
 func newParser(input *bufio.Reader, charConversions map[rune]rune, opts ...parserOption) *Parser {
 	p := Parser{
-		lexer: NewLexer(input, charConversions),
+		lexer:    NewLexer(input, charConversions),
+		maxDepth: DefaultMaxParseDepth,
 	}
 	for _, o := range opts {
 		o(&p)
@@ -60,6 +124,20 @@ func withParsedVars(vars *[]ParsedVariable) parserOption {
 	}
 }
 
+func withPositions(b bool) parserOption {
+	return func(p *Parser) {
+		p.positions = b
+	}
+}
+
+func withMaxDepth(depth int) parserOption {
+	return func(p *Parser) {
+		if depth > 0 {
+			p.maxDepth = depth
+		}
+	}
+}
+
 // Replace registers placeholder and its arguments. Every occurrence of placeholder will be replaced by arguments.
 // Mismatch of the number of occurrences of placeholder and the number of arguments raises an error.
 func (p *Parser) Replace(placeholder Atom, args ...interface{}) error {
@@ -75,6 +153,11 @@ func (p *Parser) Replace(placeholder Atom, args ...interface{}) error {
 	return nil
 }
 
+// TermOf converts a Go value into a term in the same way as the arguments for placeholders.
+func TermOf(o interface{}) (Term, error) {
+	return termOf(reflect.ValueOf(o))
+}
+
 func termOf(o reflect.Value) (Term, error) {
 	if t, ok := o.Interface().(Term); ok {
 		return t, nil
@@ -112,10 +195,19 @@ func (p *Parser) accept(k TokenKind, vals ...string) (string, error) {
 	if len(p.history) > 4 {
 		p.history = p.history[1:]
 	}
+	if p.positions {
+		p.tokenFrom = p.lexer.charPos()
+		p.tokenTo = p.tokenFrom + utf8.RuneCountInString(p.current.Val)
+	}
 	p.current = nil
 	return v, nil
 }
 
+// tokenPosition returns the position of the token last accepted.
+func (p *Parser) tokenPosition(kind termPositionKind) *termPosition {
+	return &termPosition{kind: kind, from: p.tokenFrom, to: p.tokenTo}
+}
+
 func (p *Parser) acceptAtom(allowComma, allowBar bool, vals ...string) (Atom, error) {
 	if v, err := p.accept(TokenIdent, vals...); err == nil {
 		return Atom(v), nil
@@ -180,14 +272,21 @@ func (p *Parser) acceptPrefix(allowComma, allowBar bool) (*operator, error) {
 	return nil, errors.New("no op")
 }
 
-func (p *Parser) expect(k TokenKind, vals ...string) (string, error) {
+func (p *Parser) peek() (*Token, error) {
 	if p.current == nil {
 		t, err := p.lexer.Next()
 		if err != nil {
-			return "", err
+			return nil, err
 		}
 		p.current = &t
 	}
+	return p.current, nil
+}
+
+func (p *Parser) expect(k TokenKind, vals ...string) (string, error) {
+	if _, err := p.peek(); err != nil {
+		return "", err
+	}
 
 	if p.current.Kind != k {
 		return "", p.expectationError(k, vals)
@@ -219,6 +318,11 @@ func (p *Parser) expectationError(k TokenKind, vals []string) error {
 
 // Term parses a term followed by a full stop.
 func (p *Parser) Term() (Term, error) {
+	if err := p.err; err != nil {
+		p.err = nil
+		return nil, err
+	}
+
 	if _, err := p.accept(TokenEOS); err == nil {
 		return nil, io.EOF
 	}
@@ -279,7 +383,13 @@ func (p *Parser) number() (Term, error) {
 		case strings.HasPrefix(i, "-0'"):
 			return Integer(-1 * int64([]rune(i)[3])), nil
 		default:
-			n, _ := strconv.ParseInt(i, 0, 64)
+			n, err := strconv.ParseInt(i, 0, 64)
+			if err != nil {
+				if sign == "-" {
+					return nil, representationError(Atom("min_integer"), Atom(fmt.Sprintf("%s is too small.", i)))
+				}
+				return nil, representationError(Atom("max_integer"), Atom(fmt.Sprintf("%s is too large.", i)))
+			}
 			return Integer(n), nil
 		}
 	}
@@ -289,29 +399,57 @@ func (p *Parser) number() (Term, error) {
 
 // based on Pratt parser explained in this article: https://matklad.github.io/2020/04/13/simple-but-powerful-pratt-parsing.html
 func (p *Parser) expr(min int, allowComma, allowBar bool) (Term, error) {
+	// Deeply nested input, e.g. ((((...)))), would exhaust the Go stack otherwise.
+	p.depth++
+	defer func() {
+		p.depth--
+	}()
+	if p.depth > p.maxDepth {
+		return nil, resourceErrorParseDepth(p.maxDepth)
+	}
+
 	lhs, err := p.lhs(allowComma, allowBar)
 	if err != nil {
 		return nil, err
 	}
+	lhsPos := p.pos
 
 	for {
 		op, err := p.acceptOp(min, allowComma, allowBar)
 		if err != nil {
 			break
 		}
+		opPos := p.tokenPosition(termPositionPrimitive)
 
 		_, r := op.bindingPowers()
 		rhs, err := p.expr(r, allowComma, allowBar)
 		if err != nil {
 			return nil, err
 		}
+		if p.positions {
+			lhsPos = &termPosition{
+				kind:  termPositionCompound,
+				from:  lhsPos.from,
+				to:    p.pos.to,
+				ffrom: opPos.from,
+				fto:   opPos.to,
+				args:  []*termPosition{lhsPos, p.pos},
+			}
+		}
+
+		name := op.name
+		if name == "|" && op.priority >= 1100 {
+			// Infix bar as a disjunction.
+			name = ";"
+		}
 
 		lhs = &Compound{
-			Functor: op.name,
+			Functor: name,
 			Args:    []Term{lhs, rhs},
 		}
 	}
 
+	p.pos = lhsPos
 	return lhs, nil
 }
 
@@ -320,36 +458,37 @@ func (p *Parser) lhs(allowComma, allowBar bool) (Term, error) {
 		return nil, ErrInsufficient
 	}
 
-	if p, err := p.paren(); err == nil {
-		return p, nil
-	}
-
-	if b, err := p.block(); err == nil {
-		return b, nil
-	}
-
-	if t, err := p.number(); err == nil {
-		return t, nil
-	}
-
-	if v, err := p.variable(); err == nil {
-		return v, nil
-	}
-
-	if d, err := p.acceptDoubleQuoted(); err == nil {
-		return d, nil
-	}
-
-	if l, err := p.list(); err == nil {
-		return l, nil
-	}
+	// The parsing functions below set the position of a term with structure. Otherwise, it's the span of the tokens.
+	from := p.lexer.charPos()
+	p.pos = nil
+
+	for _, f := range []func() (Term, error){
+		p.paren,
+		p.block,
+		p.number,
+		p.variable,
+		p.acceptDoubleQuoted,
+		p.list,
+		func() (Term, error) { return p.prefix(allowComma, allowBar) },
+		func() (Term, error) { return p.atomOrCompound(allowComma, allowBar) },
+	} {
+		t, err := f()
+		if err == nil {
+			if p.positions && p.pos == nil {
+				p.pos = &termPosition{from: from, to: p.tokenTo}
+			}
+			return t, nil
+		}
 
-	if p, err := p.prefix(allowComma, allowBar); err == nil {
-		return p, nil
+		// An exception e.g. representation_error(max_integer) is not a mismatch but an error of the whole term.
+		var e *Exception
+		if errors.As(err, &e) {
+			return nil, err
+		}
 	}
 
-	if t, err := p.atomOrCompound(allowComma, allowBar); err == nil {
-		return t, nil
+	if p.current != nil && p.current.Kind == TokenEOS {
+		return nil, ErrInsufficient
 	}
 
 	return nil, fmt.Errorf("failed to parse: %v, history=%#v", p.current, p.history)
@@ -360,6 +499,11 @@ func (p *Parser) atomOrCompound(allowComma bool, allowBar bool) (Term, error) {
 	if err != nil {
 		return nil, err
 	}
+	functorPos := p.tokenPosition(termPositionPrimitive)
+
+	if p.history[len(p.history)-1].Kind == TokenIdent && p.dictFollows() {
+		return p.dict(a)
+	}
 
 	if _, err := p.accept(TokenParenL); err != nil {
 		if p.placeholder != "" && p.placeholder == a {
@@ -373,13 +517,22 @@ func (p *Parser) atomOrCompound(allowComma bool, allowBar bool) (Term, error) {
 		return a, nil
 	}
 
-	var args []Term
+	return p.compound(a, functorPos)
+}
+
+// compound parses the arguments of a compound term in functional notation after the open parenthesis.
+func (p *Parser) compound(functor Atom, functorPos *termPosition) (Term, error) {
+	var (
+		args    []Term
+		argsPos []*termPosition
+	)
 	for {
 		t, err := p.expr(1, false, true)
 		if err != nil {
 			return nil, err
 		}
 		args = append(args, t)
+		argsPos = append(argsPos, p.pos)
 
 		if _, err := p.accept(TokenParenR); err == nil {
 			break
@@ -390,7 +543,17 @@ func (p *Parser) atomOrCompound(allowComma bool, allowBar bool) (Term, error) {
 		}
 	}
 
-	return &Compound{Functor: a, Args: args}, nil
+	if p.positions {
+		p.pos = &termPosition{
+			kind:  termPositionCompound,
+			from:  functorPos.from,
+			to:    p.tokenTo,
+			ffrom: functorPos.from,
+			fto:   functorPos.to,
+			args:  argsPos,
+		}
+	}
+	return &Compound{Functor: functor, Args: args}, nil
 }
 
 func (p *Parser) prefix(allowComma bool, allowBar bool) (Term, error) {
@@ -398,11 +561,34 @@ func (p *Parser) prefix(allowComma bool, allowBar bool) (Term, error) {
 	if err != nil {
 		return nil, err
 	}
+	opPos := p.tokenPosition(termPositionPrimitive)
+
+	// A prefix operator immediately followed by an open parenthesis is a functor e.g. -(1, 2).
+	if t, err := p.peek(); err == nil && t.Kind == TokenParenL && !t.layout {
+		_, _ = p.accept(TokenParenL)
+		return p.compound(op.name, opPos)
+	}
+
 	_, r := op.bindingPowers()
 	rhs, err := p.expr(r, allowComma, allowBar)
 	if err != nil {
+		var e *Exception
+		if errors.As(err, &e) {
+			return nil, err
+		}
+		p.pos = opPos
 		return op.name, nil
 	}
+	if p.positions {
+		p.pos = &termPosition{
+			kind:  termPositionCompound,
+			from:  opPos.from,
+			to:    p.pos.to,
+			ffrom: opPos.from,
+			fto:   opPos.to,
+			args:  []*termPosition{p.pos},
+		}
+	}
 	return &Compound{
 		Functor: op.name,
 		Args:    []Term{rhs},
@@ -413,6 +599,7 @@ func (p *Parser) paren() (Term, error) {
 	if _, err := p.accept(TokenParenL); err != nil {
 		return nil, err
 	}
+	from := p.tokenFrom
 
 	lhs, err := p.expr(1, true, true)
 	if err != nil {
@@ -423,6 +610,9 @@ func (p *Parser) paren() (Term, error) {
 		return nil, err
 	}
 
+	if p.positions {
+		p.pos = &termPosition{kind: termPositionParentheses, from: from, to: p.tokenTo, args: []*termPosition{p.pos}}
+	}
 	return lhs, nil
 }
 
@@ -432,31 +622,101 @@ func (p *Parser) variable() (Term, error) {
 		return nil, err
 	}
 
+	t := p.namedVariable(v)
+	if p.dictFollows() {
+		return p.dict(t)
+	}
+	return t, nil
+}
+
+func (p *Parser) namedVariable(v string) Variable {
 	if v == "_" {
-		return NewVariable(), nil
+		return NewVariable()
 	}
 
 	if p.vars == nil {
-		n := Variable(v)
-		return n, nil
+		return Variable(v)
 	}
 
 	n := Atom(v)
 	for i, v := range *p.vars {
 		if v.Name == n {
 			(*p.vars)[i].Count++
-			return v.Variable, nil
+			return v.Variable
 		}
 	}
 	w := NewVariable()
 	*p.vars = append(*p.vars, ParsedVariable{Name: n, Variable: w, Count: 1})
-	return w, nil
+	return w
+}
+
+// dictFollows reports whether the next token is a curly bracket right after a tag.
+func (p *Parser) dictFollows() bool {
+	t, err := p.peek()
+	if err != nil || t.layout {
+		return false
+	}
+	return t.Kind == TokenBraceL || (t.Kind == TokenIdent && t.Val == "{}")
+}
+
+// dict parses the key-value pairs of a dict Tag{Key1: Value1, ...} after the tag.
+func (p *Parser) dict(tag Term) (Term, error) {
+	from := p.tokenFrom
+	defer func() {
+		if p.positions {
+			p.pos = &termPosition{from: from, to: p.tokenTo}
+		}
+	}()
+
+	var pairs []*Compound
+	if _, err := p.accept(TokenIdent, "{}"); err == nil {
+		return newDict(tag, pairs, nil)
+	}
+
+	if _, err := p.accept(TokenBraceL); err != nil {
+		return nil, err
+	}
+	for {
+		var key Term
+		if k, err := p.accept(TokenIdent); err == nil {
+			key = Atom(k)
+		} else if n, err := p.number(); err == nil {
+			if _, ok := n.(Integer); !ok {
+				return nil, fmt.Errorf("dict: %s is not a key", n)
+			}
+			key = n
+		} else {
+			return nil, fmt.Errorf("dict: %w", err)
+		}
+
+		if _, err := p.accept(TokenGraphic, ":"); err != nil {
+			return nil, fmt.Errorf("dict: %w", err)
+		}
+
+		value, err := p.expr(1, false, true)
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, &Compound{Functor: "-", Args: []Term{key, value}})
+
+		if _, err := p.accept(TokenBraceR); err == nil {
+			break
+		}
+
+		if _, err := p.accept(TokenComma); err != nil {
+			return nil, fmt.Errorf("dict: %w", err)
+		}
+	}
+
+	return newDict(tag, pairs, nil)
 }
 
 func (p *Parser) block() (Term, error) {
 	if _, err := p.accept(TokenBraceL); err != nil {
 		return nil, err
 	}
+	from := p.tokenFrom
+
 	lhs, err := p.expr(1, true, true)
 	if err != nil {
 		return nil, err
@@ -466,6 +726,9 @@ func (p *Parser) block() (Term, error) {
 		return nil, err
 	}
 
+	if p.positions {
+		p.pos = &termPosition{kind: termPositionBrace, from: from, to: p.tokenTo, args: []*termPosition{p.pos}}
+	}
 	return &Compound{
 		Functor: "{}",
 		Args:    []Term{lhs},
@@ -476,6 +739,7 @@ func (p *Parser) list() (Term, error) {
 	if _, err := p.accept(TokenBracketL); err != nil {
 		return nil, err
 	}
+	pos := termPosition{kind: termPositionList, from: p.tokenFrom}
 
 	var es []Term
 	for {
@@ -484,21 +748,25 @@ func (p *Parser) list() (Term, error) {
 			return nil, err
 		}
 		es = append(es, e)
+		pos.args = append(pos.args, p.pos)
 
 		if _, err := p.accept(TokenBar); err == nil {
 			rest, err := p.expr(1, true, true)
 			if err != nil {
 				return nil, err
 			}
+			pos.tail = p.pos
 
 			if _, err := p.accept(TokenBracketR); err != nil {
 				return nil, err
 			}
 
+			p.setListPosition(&pos)
 			return ListRest(rest, es...), nil
 		}
 
 		if _, err := p.accept(TokenBracketR); err == nil {
+			p.setListPosition(&pos)
 			return List(es...), nil
 		}
 
@@ -508,11 +776,21 @@ func (p *Parser) list() (Term, error) {
 	}
 }
 
+func (p *Parser) setListPosition(pos *termPosition) {
+	if p.positions {
+		pos.to = p.tokenTo
+		p.pos = pos
+	}
+}
+
 func (p *Parser) acceptDoubleQuoted() (Term, error) {
 	v, err := p.accept(TokenDoubleQuoted)
 	if err != nil {
 		return nil, err
 	}
+	if p.positions {
+		p.pos = p.tokenPosition(termPositionString)
+	}
 	v = unDoubleQuote(v)
 	switch p.doubleQuotes {
 	case doubleQuotesCodes:
@@ -534,8 +812,13 @@ func (p *Parser) acceptDoubleQuoted() (Term, error) {
 	}
 }
 
-// More checks if the parser has more tokens to read.
+// More checks if the parser has more tokens to read. If it fails to read the next token, it reports true so that Term
+// returns the error.
 func (p *Parser) More() bool {
+	if _, err := p.peek(); err != nil {
+		p.err = err
+		return true
+	}
 	_, err := p.accept(TokenEOS)
 	return err != nil
 }
@@ -564,6 +847,26 @@ func (s operatorSpecifier) term() Term {
 	}[s]
 }
 
+type operatorClass uint8
+
+const (
+	operatorClassPrefix operatorClass = iota
+	operatorClassPostfix
+	operatorClassInfix
+)
+
+func (s operatorSpecifier) class() operatorClass {
+	return [...]operatorClass{
+		operatorSpecifierFX:  operatorClassPrefix,
+		operatorSpecifierFY:  operatorClassPrefix,
+		operatorSpecifierXF:  operatorClassPostfix,
+		operatorSpecifierYF:  operatorClassPostfix,
+		operatorSpecifierXFX: operatorClassInfix,
+		operatorSpecifierXFY: operatorClassInfix,
+		operatorSpecifierYFX: operatorClassInfix,
+	}[s]
+}
+
 type operators []operator
 
 func (ops operators) find(name Atom, arity int) *operator {
@@ -594,6 +897,17 @@ func (ops operators) find(name Atom, arity int) *operator {
 	return nil
 }
 
+// priority returns the highest priority of the operators named name, or 0 if name is not an operator.
+func (ops operators) priority(name Atom) int {
+	var p int
+	for _, op := range ops {
+		if op.name == name && int(op.priority) > p {
+			p = int(op.priority)
+		}
+	}
+	return p
+}
+
 type operator struct {
 	priority  Integer // 1 ~ 1200
 	specifier operatorSpecifier
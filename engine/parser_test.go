@@ -2,6 +2,7 @@ package engine
 
 import (
 	"bufio"
+	"math"
 	"strings"
 	"testing"
 
@@ -359,6 +360,35 @@ append(cons(X,L1),L2,cons(X,L3)) :- append(L1,L2,L3).
 		})
 	})
 
+	t.Run("infix bar", func(t *testing.T) {
+		t.Run("disjunction", func(t *testing.T) {
+			ops := operators{
+				{priority: 1100, specifier: operatorSpecifierXFY, name: `|`},
+				{priority: 1000, specifier: operatorSpecifierXFY, name: `,`},
+			}
+			p := newParser(bufio.NewReader(strings.NewReader(`(a | b), [c|d].`)), nil, withOperators(&ops))
+			term, err := p.Term()
+			assert.NoError(t, err)
+			assert.Equal(t, &Compound{
+				Functor: ",",
+				Args: []Term{
+					&Compound{Functor: ";", Args: []Term{Atom("a"), Atom("b")}},
+					Cons(Atom("c"), Atom("d")),
+				},
+			}, term)
+		})
+
+		t.Run("below 1100", func(t *testing.T) {
+			ops := operators{
+				{priority: 1050, specifier: operatorSpecifierXFY, name: `|`},
+			}
+			p := newParser(bufio.NewReader(strings.NewReader(`a | b.`)), nil, withOperators(&ops))
+			term, err := p.Term()
+			assert.NoError(t, err)
+			assert.Equal(t, &Compound{Functor: "|", Args: []Term{Atom("a"), Atom("b")}}, term)
+		})
+	})
+
 	t.Run("prefix", func(t *testing.T) {
 		ops := operators{
 			{priority: 200, specifier: operatorSpecifierFY, name: `-`},
@@ -379,6 +409,95 @@ append(cons(X,L1),L2,cons(X,L3)) :- append(L1,L2,L3).
 			_, err := p.Term()
 			assert.Error(t, err)
 		})
+
+		t.Run("functional notation", func(t *testing.T) {
+			p := newParser(bufio.NewReader(strings.NewReader(`-(a, b).`)), nil, withOperators(&ops))
+			term, err := p.Term()
+			assert.NoError(t, err)
+			assert.Equal(t, &Compound{
+				Functor: "-",
+				Args:    []Term{Atom("a"), Atom("b")},
+			}, term)
+		})
+
+		t.Run("operand in parentheses", func(t *testing.T) {
+			ops := operators{
+				{priority: 1000, specifier: operatorSpecifierXFY, name: `,`},
+				{priority: 200, specifier: operatorSpecifierFY, name: `-`},
+			}
+			p := newParser(bufio.NewReader(strings.NewReader(`- (a, b).`)), nil, withOperators(&ops))
+			term, err := p.Term()
+			assert.NoError(t, err)
+			assert.Equal(t, &Compound{
+				Functor: "-",
+				Args: []Term{&Compound{
+					Functor: ",",
+					Args:    []Term{Atom("a"), Atom("b")},
+				}},
+			}, term)
+		})
+	})
+
+	t.Run("prefix and infix", func(t *testing.T) {
+		ops := operators{
+			{priority: 200, specifier: operatorSpecifierFY, name: `-`},
+			{priority: 500, specifier: operatorSpecifierYFX, name: `-`},
+		}
+		p := newParser(bufio.NewReader(strings.NewReader(`- a - - b.`)), nil, withOperators(&ops))
+		term, err := p.Term()
+		assert.NoError(t, err)
+		assert.Equal(t, &Compound{
+			Functor: "-",
+			Args: []Term{
+				&Compound{Functor: "-", Args: []Term{Atom("a")}},
+				&Compound{Functor: "-", Args: []Term{Atom("b")}},
+			},
+		}, term)
+	})
+
+	t.Run("negation", func(t *testing.T) {
+		ops := operators{
+			{priority: 1000, specifier: operatorSpecifierXFY, name: `,`},
+			{priority: 900, specifier: operatorSpecifierFY, name: `\+`},
+			{priority: 700, specifier: operatorSpecifierXFX, name: `=`},
+		}
+
+		t.Run("unification", func(t *testing.T) {
+			p := newParser(bufio.NewReader(strings.NewReader(`\+ X = Y.`)), nil, withOperators(&ops))
+			term, err := p.Term()
+			assert.NoError(t, err)
+			assert.Equal(t, &Compound{
+				Functor: `\+`,
+				Args: []Term{
+					&Compound{Functor: "=", Args: []Term{Variable("X"), Variable("Y")}},
+				},
+			}, term)
+		})
+
+		t.Run("conjunction in parentheses", func(t *testing.T) {
+			p := newParser(bufio.NewReader(strings.NewReader(`\+ (a, b).`)), nil, withOperators(&ops))
+			term, err := p.Term()
+			assert.NoError(t, err)
+			assert.Equal(t, &Compound{
+				Functor: `\+`,
+				Args: []Term{
+					&Compound{Functor: ",", Args: []Term{Atom("a"), Atom("b")}},
+				},
+			}, term)
+		})
+
+		t.Run("conjunction", func(t *testing.T) {
+			p := newParser(bufio.NewReader(strings.NewReader(`\+ a, b.`)), nil, withOperators(&ops))
+			term, err := p.Term()
+			assert.NoError(t, err)
+			assert.Equal(t, &Compound{
+				Functor: ",",
+				Args: []Term{
+					&Compound{Functor: `\+`, Args: []Term{Atom("a")}},
+					Atom("b"),
+				},
+			}, term)
+		})
 	})
 
 	t.Run("parenthesis", func(t *testing.T) {
@@ -500,6 +619,68 @@ append(cons(X,L1),L2,cons(X,L3)) :- append(L1,L2,L3).
 		})
 	})
 
+	t.Run("integer too large in an argument", func(t *testing.T) {
+		p := newParser(bufio.NewReader(strings.NewReader(`f(99999999999999999999).`)), nil)
+		_, err := p.Term()
+		assert.Equal(t, representationError(Atom("max_integer"), Atom("99999999999999999999 is too large.")), err)
+	})
+
+	t.Run("dict", func(t *testing.T) {
+		t.Run("ok", func(t *testing.T) {
+			p := newParser(bufio.NewReader(strings.NewReader(`point{y: 2, x: 1}.`)), nil)
+			term, err := p.Term()
+			assert.NoError(t, err)
+			assert.Equal(t, &Compound{
+				Functor: dictFunctor,
+				Args: []Term{
+					Atom("point"),
+					List(
+						&Compound{Functor: "-", Args: []Term{Atom("x"), Integer(1)}},
+						&Compound{Functor: "-", Args: []Term{Atom("y"), Integer(2)}},
+					),
+				},
+			}, term)
+		})
+
+		t.Run("variable tag", func(t *testing.T) {
+			p := newParser(bufio.NewReader(strings.NewReader(`T{1: a}.`)), nil)
+			term, err := p.Term()
+			assert.NoError(t, err)
+			assert.Equal(t, &Compound{
+				Functor: dictFunctor,
+				Args: []Term{
+					Variable("T"),
+					List(&Compound{Functor: "-", Args: []Term{Integer(1), Atom("a")}}),
+				},
+			}, term)
+		})
+
+		t.Run("empty", func(t *testing.T) {
+			p := newParser(bufio.NewReader(strings.NewReader(`point{}.`)), nil)
+			term, err := p.Term()
+			assert.NoError(t, err)
+			assert.Equal(t, &Compound{Functor: dictFunctor, Args: []Term{Atom("point"), Atom("[]")}}, term)
+		})
+
+		t.Run("duplicate key", func(t *testing.T) {
+			p := newParser(bufio.NewReader(strings.NewReader(`point{x: 1, x: 2}.`)), nil)
+			_, err := p.Term()
+			assert.Error(t, err)
+		})
+
+		t.Run("invalid key", func(t *testing.T) {
+			p := newParser(bufio.NewReader(strings.NewReader(`point{f(x): 1}.`)), nil)
+			_, err := p.Term()
+			assert.Error(t, err)
+		})
+
+		t.Run("missing closing brace", func(t *testing.T) {
+			p := newParser(bufio.NewReader(strings.NewReader(`point{x: 1.`)), nil)
+			_, err := p.Term()
+			assert.Error(t, err)
+		})
+	})
+
 	t.Run("principal functor", func(t *testing.T) {
 		ops := operators{
 			{priority: 400, specifier: operatorSpecifierYFX, name: "/"},
@@ -722,6 +903,30 @@ a double-quoted string".`)), nil, withDoubleQuotes(doubleQuotesAtom))
 			})
 		})
 	})
+
+	t.Run("deeply nested", func(t *testing.T) {
+		t.Run("parentheses", func(t *testing.T) {
+			p := newParser(bufio.NewReader(strings.NewReader(strings.Repeat("(", 100000)+"a"+strings.Repeat(")", 100000)+".")), nil)
+			_, err := p.Term()
+			assert.Equal(t, resourceErrorParseDepth(DefaultMaxParseDepth), err)
+		})
+
+		t.Run("prefix operators", func(t *testing.T) {
+			ops := operators{
+				{priority: 200, specifier: operatorSpecifierFY, name: "-"},
+			}
+			p := newParser(bufio.NewReader(strings.NewReader(strings.Repeat("- ", 100)+"a.")), nil, withOperators(&ops), withMaxDepth(50))
+			_, err := p.Term()
+			assert.Equal(t, resourceErrorParseDepth(50), err)
+		})
+
+		t.Run("within the limit", func(t *testing.T) {
+			p := newParser(bufio.NewReader(strings.NewReader("((((a)))).")), nil, withMaxDepth(5))
+			a, err := p.Term()
+			assert.NoError(t, err)
+			assert.Equal(t, Atom("a"), a)
+		})
+	})
 }
 
 func TestParser_Replace(t *testing.T) {
@@ -821,6 +1026,41 @@ func TestParser_Number(t *testing.T) {
 				assert.NoError(t, err)
 				assert.Equal(t, Integer(-33), n)
 			})
+
+			t.Run("escape sequence", func(t *testing.T) {
+				for input, code := range map[string]Integer{
+					`0'\n`:    10,
+					`0'\\`:    92,
+					`0'\t`:    9,
+					`0'\'`:    39,
+					`0'\x41\`: 65,
+					`0'\101\`: 65,
+				} {
+					p := newParser(bufio.NewReader(strings.NewReader(input)), nil)
+					n, err := p.Number()
+					assert.NoError(t, err)
+					assert.Equal(t, code, n, input)
+				}
+			})
+		})
+
+		t.Run("too large", func(t *testing.T) {
+			p := newParser(bufio.NewReader(strings.NewReader(`99999999999999999999`)), nil)
+			_, err := p.Number()
+			assert.Equal(t, representationError(Atom("max_integer"), Atom("99999999999999999999 is too large.")), err)
+		})
+
+		t.Run("too small", func(t *testing.T) {
+			p := newParser(bufio.NewReader(strings.NewReader(`-99999999999999999999`)), nil)
+			_, err := p.Number()
+			assert.Equal(t, representationError(Atom("min_integer"), Atom("-99999999999999999999 is too small.")), err)
+		})
+
+		t.Run("max", func(t *testing.T) {
+			p := newParser(bufio.NewReader(strings.NewReader(`9223372036854775807`)), nil)
+			n, err := p.Number()
+			assert.NoError(t, err)
+			assert.Equal(t, Integer(math.MaxInt64), n)
 		})
 	})
 
@@ -858,4 +1098,24 @@ func TestParser_More(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, Atom("bar"), term)
 	assert.False(t, p.More())
+
+	t.Run("truncated clause", func(t *testing.T) {
+		p := newParser(bufio.NewReader(strings.NewReader(`foo. bar(baz`)), nil)
+		term, err := p.Term()
+		assert.NoError(t, err)
+		assert.Equal(t, Atom("foo"), term)
+		assert.True(t, p.More())
+		_, err = p.Term()
+		assert.Equal(t, ErrInsufficient, err)
+	})
+
+	t.Run("unterminated comment", func(t *testing.T) {
+		p := newParser(bufio.NewReader(strings.NewReader(`foo. /* bar`)), nil)
+		term, err := p.Term()
+		assert.NoError(t, err)
+		assert.Equal(t, Atom("foo"), term)
+		assert.True(t, p.More())
+		_, err = p.Term()
+		assert.Equal(t, ErrInsufficient, err)
+	})
 }
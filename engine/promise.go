@@ -3,6 +3,7 @@ package engine
 import (
 	"context"
 	"errors"
+	"fmt"
 )
 
 // Promise is a delayed execution that results in (bool, error). The zero value for Promise is equivalent to Bool(false).
@@ -104,12 +105,20 @@ func (p *Promise) Force(ctx context.Context) (bool, error) {
 	return false, nil
 }
 
-func (p *Promise) child(ctx context.Context) *Promise {
-	q := p.delayed[0](ctx)
+// child runs the next delayed execution. A panic in it, e.g. in a custom predicate, is turned into a system error
+// which catch/3 can handle.
+func (p *Promise) child(ctx context.Context) (q *Promise) {
+	defer func() {
+		if r := recover(); r != nil {
+			q = Error(SystemError(fmt.Errorf("panic: %v", r)))
+		}
+	}()
+
+	k := p.delayed[0]
 	if !p.repeat {
 		p.delayed, p.delayed[0] = p.delayed[1:], nil
 	}
-	return q
+	return k(ctx)
 }
 
 type promiseStack []*Promise
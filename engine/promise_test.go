@@ -2,6 +2,7 @@ package engine
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -72,4 +73,19 @@ func TestPromise_Force(t *testing.T) {
 		assert.True(t, ok)
 		assert.Equal(t, 10, count)
 	})
+
+	t.Run("panic", func(t *testing.T) {
+		k := Catch(func(err error) *Promise {
+			assert.Equal(t, SystemError(errors.New("panic: oops")), err)
+			return Bool(true)
+		}, func(context.Context) *Promise {
+			return Delay(func(context.Context) *Promise {
+				panic("oops")
+			})
+		})
+
+		ok, err := k.Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
 }
@@ -0,0 +1,48 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// RecordRef is a reference to a term recorded in the internal database by recorda/3 or recordz/3.
+type RecordRef struct {
+	key  Term // atom, integer, or compound with fresh variables as arguments.
+	term Term
+}
+
+func (r *RecordRef) String() string {
+	var sb strings.Builder
+	_ = Write(&sb, r, nil)
+	return sb.String()
+}
+
+// Unify unifies the record reference with t.
+func (r *RecordRef) Unify(t Term, occursCheck bool, env *Env) (*Env, bool) {
+	switch t := env.Resolve(t).(type) {
+	case *RecordRef:
+		return env, r == t
+	case Variable:
+		return t.Unify(r, occursCheck, env)
+	default:
+		return env, false
+	}
+}
+
+// Unparse emits tokens that represent the record reference.
+func (r *RecordRef) Unparse(emit func(Token), _ *Env, _ ...WriteOption) {
+	emit(Token{Kind: TokenIdent, Val: fmt.Sprintf("<record>(%p)", r)})
+}
+
+// Compare compares the record reference to another term.
+func (r *RecordRef) Compare(t Term, env *Env) int64 {
+	switch t := env.Resolve(t).(type) {
+	case *RecordRef:
+		if r == t {
+			return 0
+		}
+		return 1
+	default:
+		return 1
+	}
+}
@@ -2,6 +2,7 @@ package engine
 
 import (
 	"bufio"
+	"bytes"
 	"fmt"
 	"io"
 	"io/fs"
@@ -66,15 +67,77 @@ func (t StreamType) String() string {
 	}[t]
 }
 
+// StreamBuffer describes how the output to the stream is buffered.
+type StreamBuffer int
+
+const (
+	// StreamBufferFalse means the output is written immediately.
+	StreamBufferFalse StreamBuffer = iota
+	// StreamBufferLine means the output is buffered until a newline is written.
+	StreamBufferLine
+	// StreamBufferFull means the output is buffered until the buffer is full or flushed.
+	StreamBufferFull
+)
+
+func (b StreamBuffer) String() string {
+	return [...]string{
+		StreamBufferFalse: "false",
+		StreamBufferLine:  "line",
+		StreamBufferFull:  "full",
+	}[b]
+}
+
 // Stream is a prolog stream.
 type Stream struct {
 	file       io.ReadWriteCloser
 	buf        *bufio.Reader
+	w          flushWriter
 	mode       StreamMode
 	alias      Atom
 	eofAction  EOFAction
 	reposition bool
 	streamType StreamType
+	buffer     StreamBuffer
+
+	// pastEndOfStream is true once an input has reached the end of the stream.
+	pastEndOfStream bool
+
+	// written is the number of bytes written to the stream.
+	written int64
+}
+
+type flushWriter interface {
+	io.Writer
+	Flush() error
+	Buffered() int
+}
+
+// countWriter counts the bytes written to the stream.
+type countWriter struct {
+	io.Writer
+	s *Stream
+}
+
+func (c countWriter) Write(p []byte) (int, error) {
+	n, err := c.Writer.Write(p)
+	c.s.written += int64(n)
+	return n, err
+}
+
+// lineWriter flushes the buffered output on every newline.
+type lineWriter struct {
+	*bufio.Writer
+}
+
+func (l lineWriter) Write(p []byte) (int, error) {
+	n, err := l.Writer.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if bytes.IndexByte(p, '\n') >= 0 {
+		return n, l.Flush()
+	}
+	return n, nil
 }
 
 // NewStream creates a new stream from an opened file.
@@ -96,6 +159,12 @@ func NewStream(f io.ReadWriteCloser, mode StreamMode, opts ...StreamOption) *Str
 	} else {
 		s.buf = bufio.NewReader(f)
 	}
+	switch s.buffer {
+	case StreamBufferLine:
+		s.w = lineWriter{Writer: bufio.NewWriter(f)}
+	case StreamBufferFull:
+		s.w = bufio.NewWriter(f)
+	}
 	return &s
 }
 
@@ -127,6 +196,13 @@ func WithReposition(b bool) StreamOption {
 	}
 }
 
+// WithBuffer sets how the output to the stream is buffered.
+func WithBuffer(buffer StreamBuffer) StreamOption {
+	return func(s *Stream) {
+		s.buffer = buffer
+	}
+}
+
 // WithStreamType sets type of the stream.
 func WithStreamType(streamType StreamType) StreamOption {
 	return func(s *Stream) {
@@ -142,7 +218,7 @@ func Open(name Atom, mode StreamMode, opts ...StreamOption) (*Stream, error) {
 	if err != nil {
 		switch {
 		case os.IsNotExist(err):
-			return nil, existenceErrorSourceSink(name)
+			return nil, existenceErrorSourceSink(name, nil)
 		case os.IsPermission(err):
 			return nil, PermissionError("open", "source_sink", name, "%s cannot be opened.", name)
 		default:
@@ -153,10 +229,30 @@ func Open(name Atom, mode StreamMode, opts ...StreamOption) (*Stream, error) {
 	return NewStream(f, mode, opts...), nil
 }
 
+// writer returns the writer for the output which may be buffered.
+func (s *Stream) writer() io.Writer {
+	if s.w == nil {
+		return countWriter{Writer: s.file, s: s}
+	}
+	return countWriter{Writer: s.w, s: s}
+}
+
+// flush writes any buffered output to the underlying file.
+func (s *Stream) flush() error {
+	if s.w == nil {
+		return nil
+	}
+	return s.w.Flush()
+}
+
 var closeFile = io.Closer.Close
 
-// Close closes the underlying file of the stream.
+// Close flushes the buffered output and closes the underlying file of the stream.
 func (s *Stream) Close() error {
+	if err := s.flush(); err != nil {
+		_ = closeFile(s.file)
+		return err
+	}
 	return closeFile(s.file)
 }
 
@@ -226,6 +322,9 @@ func (s *Stream) properties() ([]Term, error) {
 			return nil, err
 		}
 		pos -= int64(s.buf.Buffered())
+		if s.w != nil {
+			pos += int64(s.w.Buffered())
+		}
 
 		fi, err := fileStat(f)
 		if err != nil {
@@ -234,10 +333,10 @@ func (s *Stream) properties() ([]Term, error) {
 
 		eos := "not"
 		switch {
+		case s.pastEndOfStream || pos > fi.Size():
+			eos = "past"
 		case pos == fi.Size():
 			eos = "at"
-		case pos > fi.Size():
-			eos = "past"
 		}
 
 		properties = append(properties,
@@ -245,6 +344,8 @@ func (s *Stream) properties() ([]Term, error) {
 			&Compound{Functor: "position", Args: []Term{Integer(pos)}},
 			&Compound{Functor: "end_of_stream", Args: []Term{Atom(eos)}},
 		)
+	} else if s.mode != StreamModeRead {
+		properties = append(properties, &Compound{Functor: "position", Args: []Term{Integer(s.written)}})
 	}
 
 	if s.reposition {
@@ -254,6 +355,7 @@ func (s *Stream) properties() ([]Term, error) {
 	}
 
 	properties = append(properties, &Compound{Functor: "type", Args: []Term{Atom(s.streamType.String())}})
+	properties = append(properties, &Compound{Functor: "buffer", Args: []Term{Atom(s.buffer.String())}})
 
 	return properties, nil
 }
@@ -100,7 +100,7 @@ func TestOpen(t *testing.T) {
 		}()
 
 		s, err := Open("/this/file/does/not/exist", StreamModeRead)
-		assert.Equal(t, existenceErrorSourceSink(Atom("/this/file/does/not/exist")), err)
+		assert.Equal(t, existenceErrorSourceSink(Atom("/this/file/does/not/exist"), nil), err)
 		assert.Nil(t, s)
 	})
 
@@ -51,10 +51,13 @@ func Rulify(t Term, env *Env) Term {
 }
 
 type writeTermOptions struct {
-	quoted     bool
-	ops        operators
-	numberVars bool
-	priority   int
+	quoted        bool
+	ops           operators
+	numberVars    bool
+	priority      int
+	floatFormat   string
+	variableNames map[Variable]Atom
+	fullStop      bool
 }
 
 var defaultWriteTermOptions = writeTermOptions{
@@ -99,6 +102,28 @@ func WithNumberVars(b bool) WriteOption {
 	}
 }
 
+// WithFullStop sets if the term is followed by ` .` and a newline so that the output reads back as a clause.
+func WithFullStop(b bool) WriteOption {
+	return func(options *writeTermOptions) {
+		options.fullStop = b
+	}
+}
+
+// WithFloatFormat sets a printf-style format (e.g. `%.15g`) for floating-point numbers.
+// If empty, floats are written in the shortest representation that reads back to the same value.
+func WithFloatFormat(format string) WriteOption {
+	return func(options *writeTermOptions) {
+		options.floatFormat = format
+	}
+}
+
+// WithVariableNames sets names for variables. A variable in names is written as its name.
+func WithVariableNames(names map[Variable]Atom) WriteOption {
+	return func(options *writeTermOptions) {
+		options.variableNames = names
+	}
+}
+
 // WithPriority sets priority which determines if an expression is enclosed by a pair of parentheses.
 func WithPriority(p int) WriteOption {
 	return func(options *writeTermOptions) {
@@ -124,5 +149,16 @@ func Write(w io.Writer, t Term, env *Env, opts ...WriteOption) error {
 		last = token.Kind
 		_, err = fmt.Fprint(w, sb.String())
 	}, env, opts...)
+	if err != nil {
+		return err
+	}
+
+	wto := defaultWriteTermOptions
+	for _, o := range opts {
+		o(&wto)
+	}
+	if wto.fullStop {
+		_, err = fmt.Fprint(w, " .\n")
+	}
 	return err
 }
@@ -14,8 +14,8 @@ var varCounter uint64
 
 // NewVariable creates a new generated variable.
 func NewVariable() Variable {
-	atomic.AddUint64(&varCounter, 1)
-	return Variable(fmt.Sprintf("_%d", varCounter))
+	n := atomic.AddUint64(&varCounter, 1)
+	return Variable(fmt.Sprintf("_%d", n))
 }
 
 var generatedPattern = regexp.MustCompile(`\A_\d+\z`)
@@ -52,6 +52,15 @@ func (v Variable) Unify(t Term, occursCheck bool, env *Env) (*Env, bool) {
 func (v Variable) Unparse(emit func(token Token), env *Env, opts ...WriteOption) {
 	switch v := env.Resolve(v).(type) {
 	case Variable:
+		wto := defaultWriteTermOptions
+		for _, o := range opts {
+			o(&wto)
+		}
+
+		if n, ok := wto.variableNames[v]; ok {
+			emit(Token{Kind: TokenVariable, Val: string(n)})
+			return
+		}
 		emit(Token{Kind: TokenVariable, Val: string(v)})
 	default:
 		v.Unparse(emit, env, opts...)
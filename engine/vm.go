@@ -4,6 +4,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"sort"
+	"strings"
 )
 
 type bytecode []instruction
@@ -99,6 +101,81 @@ func (vm *VM) Register5(name string, p func(Term, Term, Term, Term, Term, func(*
 	vm.procedures[ProcedureIndicator{Name: Atom(name), Arity: 5}] = predicate5(p)
 }
 
+// Register6 registers a predicate of arity 6.
+func (vm *VM) Register6(name string, p func(Term, Term, Term, Term, Term, Term, func(*Env) *Promise, *Env) *Promise) {
+	if vm.procedures == nil {
+		vm.procedures = map[ProcedureIndicator]procedure{}
+	}
+	vm.procedures[ProcedureIndicator{Name: Atom(name), Arity: 6}] = predicate6(p)
+}
+
+// Register7 registers a predicate of arity 7.
+func (vm *VM) Register7(name string, p func(Term, Term, Term, Term, Term, Term, Term, func(*Env) *Promise, *Env) *Promise) {
+	if vm.procedures == nil {
+		vm.procedures = map[ProcedureIndicator]procedure{}
+	}
+	vm.procedures[ProcedureIndicator{Name: Atom(name), Arity: 7}] = predicate7(p)
+}
+
+// Register8 registers a predicate of arity 8.
+func (vm *VM) Register8(name string, p func(Term, Term, Term, Term, Term, Term, Term, Term, func(*Env) *Promise, *Env) *Promise) {
+	if vm.procedures == nil {
+		vm.procedures = map[ProcedureIndicator]procedure{}
+	}
+	vm.procedures[ProcedureIndicator{Name: Atom(name), Arity: 8}] = predicate8(p)
+}
+
+// clone returns a copy of the VM whose database can be modified independently of the original.
+func (vm *VM) clone() VM {
+	c := *vm
+	c.procedures = make(map[ProcedureIndicator]procedure, len(vm.procedures))
+	for pi, p := range vm.procedures {
+		switch p := p.(type) {
+		case clauses:
+			c.procedures[pi] = append(clauses(nil), p...)
+		case builtin:
+			c.procedures[pi] = builtin{append(clauses(nil), p.clauses...)}
+		case static:
+			c.procedures[pi] = static{append(clauses(nil), p.clauses...)}
+		default:
+			c.procedures[pi] = p
+		}
+	}
+	return c
+}
+
+// Rebind calls register to register the predicates implemented in Go again, e.g. for a cloned VM, while it keeps the
+// procedures defined in Prolog including redefinitions of those predicates.
+func (vm *VM) Rebind(register func()) {
+	defined := map[ProcedureIndicator]procedure{}
+	for pi, p := range vm.procedures {
+		switch p.(type) {
+		case clauses, builtin, static:
+			defined[pi] = p
+		}
+	}
+	register()
+	for pi, p := range defined {
+		vm.procedures[pi] = p
+	}
+}
+
+// Complete returns the sorted names of the procedures which start with prefix. This is useful for tab completion in REPLs.
+func (vm *VM) Complete(prefix string) []string {
+	names := map[string]struct{}{}
+	for pi := range vm.procedures {
+		if strings.HasPrefix(string(pi.Name), prefix) {
+			names[string(pi.Name)] = struct{}{}
+		}
+	}
+	ret := make([]string, 0, len(names))
+	for n := range names {
+		ret = append(ret, n)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
 type unknownAction int
 
 const (
@@ -130,7 +207,7 @@ func (vm *VM) Arrive(pi ProcedureIndicator, args []Term, k func(*Env) *Promise,
 	if !ok {
 		switch vm.unknown {
 		case unknownError:
-			return Error(existenceErrorProcedure(pi.Term()))
+			return Error(existenceErrorProcedure(pi.Term(), env))
 		case unknownWarning:
 			vm.OnUnknown(pi, args, env)
 			fallthrough
@@ -406,6 +483,36 @@ func (p predicate5) Call(_ *VM, args []Term, k func(*Env) *Promise, env *Env) *P
 	return p(args[0], args[1], args[2], args[3], args[4], k, env)
 }
 
+type predicate6 func(Term, Term, Term, Term, Term, Term, func(*Env) *Promise, *Env) *Promise
+
+func (p predicate6) Call(_ *VM, args []Term, k func(*Env) *Promise, env *Env) *Promise {
+	if len(args) != 6 {
+		return Error(errors.New("wrong number of arguments"))
+	}
+
+	return p(args[0], args[1], args[2], args[3], args[4], args[5], k, env)
+}
+
+type predicate7 func(Term, Term, Term, Term, Term, Term, Term, func(*Env) *Promise, *Env) *Promise
+
+func (p predicate7) Call(_ *VM, args []Term, k func(*Env) *Promise, env *Env) *Promise {
+	if len(args) != 7 {
+		return Error(errors.New("wrong number of arguments"))
+	}
+
+	return p(args[0], args[1], args[2], args[3], args[4], args[5], args[6], k, env)
+}
+
+type predicate8 func(Term, Term, Term, Term, Term, Term, Term, Term, func(*Env) *Promise, *Env) *Promise
+
+func (p predicate8) Call(_ *VM, args []Term, k func(*Env) *Promise, env *Env) *Promise {
+	if len(args) != 8 {
+		return Error(errors.New("wrong number of arguments"))
+	}
+
+	return p(args[0], args[1], args[2], args[3], args[4], args[5], args[6], args[7], k, env)
+}
+
 // Success is a continuation that leads to true.
 func Success(*Env) *Promise {
 	return Bool(true)
@@ -429,7 +536,7 @@ func NewProcedureIndicator(pi Term, env *Env) (ProcedureIndicator, error) {
 		return ProcedureIndicator{}, InstantiationError(pi)
 	case *Compound:
 		if p.Functor != "/" || len(p.Args) != 2 {
-			return ProcedureIndicator{}, typeErrorPredicateIndicator(pi)
+			return ProcedureIndicator{}, typeErrorPredicateIndicator(pi, env)
 		}
 		switch f := env.Resolve(p.Args[0]).(type) {
 		case Variable:
@@ -442,13 +549,13 @@ func NewProcedureIndicator(pi Term, env *Env) (ProcedureIndicator, error) {
 				pi := ProcedureIndicator{Name: f, Arity: a}
 				return pi, nil
 			default:
-				return ProcedureIndicator{}, typeErrorPredicateIndicator(pi)
+				return ProcedureIndicator{}, typeErrorPredicateIndicator(pi, env)
 			}
 		default:
-			return ProcedureIndicator{}, typeErrorPredicateIndicator(pi)
+			return ProcedureIndicator{}, typeErrorPredicateIndicator(pi, env)
 		}
 	default:
-		return ProcedureIndicator{}, typeErrorPredicateIndicator(pi)
+		return ProcedureIndicator{}, typeErrorPredicateIndicator(pi, env)
 	}
 }
 
@@ -484,6 +591,6 @@ func piArgs(t Term, env *Env) (ProcedureIndicator, []Term, error) {
 	case *Compound:
 		return ProcedureIndicator{Name: f.Functor, Arity: Integer(len(f.Args))}, f.Args, nil
 	default:
-		return ProcedureIndicator{}, nil, typeErrorCallable(t)
+		return ProcedureIndicator{}, nil, typeErrorCallable(t, env)
 	}
 }
@@ -2,6 +2,7 @@ package engine
 
 import (
 	"context"
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -127,6 +128,84 @@ func TestVM_Register5(t *testing.T) {
 	})
 }
 
+func TestVM_Register6(t *testing.T) {
+	var vm VM
+	vm.Register6("foo", func(a, b, c, d, e, f Term, k func(*Env) *Promise, env *Env) *Promise {
+		return k(env)
+	})
+	p := vm.procedures[ProcedureIndicator{Name: "foo", Arity: 6}]
+
+	t.Run("ok", func(t *testing.T) {
+		ok, err := p.Call(&vm, []Term{Atom("a"), Atom("b"), Atom("c"), Atom("d"), Atom("e"), Atom("f")}, Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("wrong number of arguments", func(t *testing.T) {
+		ok, err := p.Call(&vm, []Term{Atom("a"), Atom("b"), Atom("c"), Atom("d"), Atom("e"), Atom("f"), Atom("z")}, Success, nil).Force(context.Background())
+		assert.Error(t, err)
+		assert.False(t, ok)
+	})
+}
+
+func TestVM_Register7(t *testing.T) {
+	var vm VM
+	vm.Register7("foo", func(a, b, c, d, e, f, g Term, k func(*Env) *Promise, env *Env) *Promise {
+		return k(env)
+	})
+	p := vm.procedures[ProcedureIndicator{Name: "foo", Arity: 7}]
+
+	t.Run("ok", func(t *testing.T) {
+		ok, err := p.Call(&vm, []Term{Atom("a"), Atom("b"), Atom("c"), Atom("d"), Atom("e"), Atom("f"), Atom("g")}, Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("wrong number of arguments", func(t *testing.T) {
+		ok, err := p.Call(&vm, []Term{Atom("a"), Atom("b"), Atom("c"), Atom("d"), Atom("e"), Atom("f"), Atom("g"), Atom("z")}, Success, nil).Force(context.Background())
+		assert.Error(t, err)
+		assert.False(t, ok)
+	})
+}
+
+func TestVM_Register8(t *testing.T) {
+	var vm VM
+	vm.Register8("foo", func(a, b, c, d, e, f, g, h Term, k func(*Env) *Promise, env *Env) *Promise {
+		return k(env)
+	})
+	p := vm.procedures[ProcedureIndicator{Name: "foo", Arity: 8}]
+
+	t.Run("ok", func(t *testing.T) {
+		ok, err := p.Call(&vm, []Term{Atom("a"), Atom("b"), Atom("c"), Atom("d"), Atom("e"), Atom("f"), Atom("g"), Atom("h")}, Success, nil).Force(context.Background())
+		assert.NoError(t, err)
+		assert.True(t, ok)
+	})
+
+	t.Run("wrong number of arguments", func(t *testing.T) {
+		ok, err := p.Call(&vm, []Term{Atom("a"), Atom("b"), Atom("c"), Atom("d"), Atom("e"), Atom("f"), Atom("g"), Atom("h"), Atom("z")}, Success, nil).Force(context.Background())
+		assert.Error(t, err)
+		assert.False(t, ok)
+	})
+}
+
+func TestVM_Complete(t *testing.T) {
+	vm := VM{
+		procedures: map[ProcedureIndicator]procedure{
+			{Name: "atom", Arity: 1}:         predicate1(nil),
+			{Name: "atom_length", Arity: 2}:  predicate2(nil),
+			{Name: "atom_chars", Arity: 2}:   predicate2(nil),
+			{Name: "atom_chars", Arity: 3}:   clauses{},
+			{Name: "number_chars", Arity: 2}: predicate2(nil),
+			{Name: "sub_atom", Arity: 5}:     predicate5(nil),
+		},
+	}
+
+	assert.Equal(t, []string{"atom", "atom_chars", "atom_length"}, vm.Complete("atom"))
+	assert.Equal(t, []string{"atom_chars"}, vm.Complete("atom_c"))
+	assert.Equal(t, []string{}, vm.Complete("foo"))
+	assert.Len(t, vm.Complete(""), 5)
+}
+
 func TestVM_Arrive(t *testing.T) {
 	t.Run("success", func(t *testing.T) {
 		vm := VM{
@@ -150,7 +229,7 @@ func TestVM_Arrive(t *testing.T) {
 			assert.Equal(t, existenceErrorProcedure(&Compound{
 				Functor: "/",
 				Args:    []Term{Atom("foo"), Integer(1)},
-			}), err)
+			}, nil), err)
 			assert.False(t, ok)
 		})
 
@@ -180,6 +259,34 @@ func TestVM_Arrive(t *testing.T) {
 			assert.False(t, ok)
 		})
 	})
+	t.Run("panic", func(t *testing.T) {
+		vm := VM{
+			procedures: map[ProcedureIndicator]procedure{
+				{Name: "foo", Arity: 1}: predicate1(func(t Term, k func(*Env) *Promise, env *Env) *Promise {
+					panic("oops")
+				}),
+			},
+		}
+		ok, err := vm.Arrive(ProcedureIndicator{Name: "foo", Arity: 1}, []Term{Atom("a")}, Success, nil).Force(context.Background())
+		assert.Equal(t, SystemError(errors.New("panic: oops")), err)
+		assert.False(t, ok)
+	})
+	t.Run("panic in delayed execution", func(t *testing.T) {
+		vm := VM{
+			procedures: map[ProcedureIndicator]procedure{
+				{Name: "foo", Arity: 1}: predicate1(func(t Term, k func(*Env) *Promise, env *Env) *Promise {
+					return Delay(func(context.Context) *Promise {
+						return k(env)
+					}, func(context.Context) *Promise {
+						panic("oops")
+					})
+				}),
+			},
+		}
+		ok, err := vm.Arrive(ProcedureIndicator{Name: "foo", Arity: 1}, []Term{Atom("a")}, Failure, nil).Force(context.Background())
+		assert.Equal(t, SystemError(errors.New("panic: oops")), err)
+		assert.False(t, ok)
+	})
 }
 
 func TestNewProcedureIndicator(t *testing.T) {
@@ -200,7 +307,7 @@ func TestNewProcedureIndicator(t *testing.T) {
 
 	t.Run("atomic", func(t *testing.T) {
 		pi, err := NewProcedureIndicator(Atom("foo"), nil)
-		assert.Equal(t, typeErrorPredicateIndicator(Atom("foo")), err)
+		assert.Equal(t, typeErrorPredicateIndicator(Atom("foo"), nil), err)
 		assert.Zero(t, pi)
 	})
 
@@ -212,7 +319,7 @@ func TestNewProcedureIndicator(t *testing.T) {
 		assert.Equal(t, typeErrorPredicateIndicator(&Compound{
 			Functor: "foo",
 			Args:    []Term{Atom("a"), Atom("b")},
-		}), err)
+		}, nil), err)
 		assert.Zero(t, pi)
 	})
 
@@ -236,7 +343,7 @@ func TestNewProcedureIndicator(t *testing.T) {
 		assert.Equal(t, typeErrorPredicateIndicator(&Compound{
 			Functor: "/",
 			Args:    []Term{Integer(0), Integer(2)},
-		}), err)
+		}, nil), err)
 		assert.Zero(t, pi)
 	})
 
@@ -260,7 +367,7 @@ func TestNewProcedureIndicator(t *testing.T) {
 		assert.Equal(t, typeErrorPredicateIndicator(&Compound{
 			Functor: "/",
 			Args:    []Term{Atom("foo"), Atom("arity")},
-		}), err)
+		}, nil), err)
 		assert.Zero(t, pi)
 	})
 }
@@ -6,7 +6,12 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/ichiban/prolog/engine"
@@ -17,6 +22,12 @@ var bootstrap string
 
 var libraries = map[string]func(*Interpreter) error{}
 
+// bootstrapLibraries are the libraries whose predicates are already defined by bootstrap.pl.
+var bootstrapLibraries = map[string]struct{}{
+	"lists": {},
+	"apply": {},
+}
+
 // Register registers a library. if there's a library with the same name registered, it panics.
 func Register(name string, library func(*Interpreter) error) {
 	if _, ok := libraries[name]; ok {
@@ -26,9 +37,47 @@ func Register(name string, library func(*Interpreter) error) {
 	libraries[name] = library
 }
 
+// Libraries returns the sorted names of the registered libraries.
+func Libraries() []string {
+	names := make([]string, 0, len(libraries))
+	for n := range libraries {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // Interpreter is a Prolog interpreter. The zero value is a valid interpreter without any predicates/operators defined.
 type Interpreter struct {
 	engine.State
+
+	// LibraryPath is a list of directories to look for library(Name) as Name.pl in addition to the registered
+	// libraries and the directories given by file_search_path(library, Dir).
+	LibraryPath []string
+
+	// LibraryFS is a file system, e.g. embed.FS, to look for library(Name) as Name.pl before LibraryPath.
+	LibraryFS fs.FS
+
+	// OnDirective is a callback that is triggered when Exec or consult reaches a directive :- Goal. If it returns true,
+	// the directive is considered handled and Goal is not executed.
+	OnDirective func(goal engine.Term) (handled bool, err error)
+
+	// OnSingletons is a callback that is triggered when Exec or consult loads a clause or a directive with singleton
+	// variables, i.e. named variables that appear only once. Variables starting with _ are not reported.
+	OnSingletons func(clause engine.Term, vars []string)
+
+	// Prompt and ContinuationPrompt are the prompts Top shows to read a query and the rest of a multi-line query.
+	// If empty, "?- " and "|- " are shown respectively.
+	Prompt, ContinuationPrompt string
+
+	// files being loaded, the innermost last.
+	loading []loadingFile
+
+	// files loaded by use_module/1 and registered libraries installed by either consult/1 or use_module/1.
+	used map[string]struct{}
+
+	// conversions from compounds to Go values registered by RegisterConverter.
+	converters map[engine.ProcedureIndicator]func([]engine.Term) (interface{}, error)
 }
 
 // New creates a new Prolog interpreter with predefined predicates/operators.
@@ -36,12 +85,65 @@ func New(in io.Reader, out io.Writer) *Interpreter {
 	var i Interpreter
 	i.SetUserInput(in)
 	i.SetUserOutput(out)
+	i.SetUserError(os.Stderr)
+	i.register()
+	if err := i.Exec(bootstrap); err != nil {
+		panic(err)
+	}
+
+	return &i
+}
+
+// Clone returns a copy of the interpreter which can be used in another goroutine without synchronization. The copy
+// starts with the same database, operators, and flags as the original but they evolve independently afterwards.
+// Streams are shared with the original. An Interpreter itself is not safe for concurrent use by multiple goroutines.
+//
+// The builtin predicates of the copy are bound to the copy. The predicates registered by the user with Register0 to
+// Register8 are carried over as they are, so the ones that close over the original interpreter keep referring to it.
+// Register them again on the copy to bind them to the copy instead.
+func (i *Interpreter) Clone() *Interpreter {
+	c := Interpreter{
+		State:              i.State.Clone(),
+		LibraryPath:        append([]string(nil), i.LibraryPath...),
+		LibraryFS:          i.LibraryFS,
+		OnDirective:        i.OnDirective,
+		OnSingletons:       i.OnSingletons,
+		Prompt:             i.Prompt,
+		ContinuationPrompt: i.ContinuationPrompt,
+		used:               make(map[string]struct{}, len(i.used)),
+	}
+	for f := range i.used {
+		c.used[f] = struct{}{}
+	}
+	for pi, fn := range i.converters {
+		c.RegisterConverter(string(pi.Name), int(pi.Arity), fn)
+	}
+	c.Rebind(c.register)
+	return &c
+}
+
+// register registers the builtin predicates implemented in Go.
+func (i *Interpreter) register() {
 	i.Register0("repeat", i.Repeat)
 	i.Register1(`\+`, i.Negation)
 	i.Register1("call", i.Call)
+	i.Register2("call", i.Call1)
+	i.Register3("call", i.Call2)
+	i.Register4("call", i.Call3)
+	i.Register5("call", i.Call4)
+	i.Register6("call", i.Call5)
+	i.Register7("call", i.Call6)
+	i.Register8("call", i.Call7)
 	i.Register1("current_predicate", i.CurrentPredicate)
 	i.Register1("assertz", i.Assertz)
+	i.Register1("assertz_all", i.AssertzAll)
 	i.Register1("asserta", i.Asserta)
+	i.Register2("assertz", i.Assertz2)
+	i.Register2("asserta", i.Asserta2)
+	i.Register1("erase", i.Erase)
+	i.Register3("recorda", i.Recorda)
+	i.Register3("recordz", i.Recordz)
+	i.Register3("recorded", i.Recorded)
 	i.Register1("retract", i.Retract)
 	i.Register1("abolish", i.Abolish)
 	i.Register1("var", engine.TypeVar)
@@ -54,11 +156,18 @@ func New(in io.Reader, out io.Writer) *Interpreter {
 	i.Register2("unify_with_occurs_check", engine.UnifyWithOccursCheck)
 	i.Register2("=..", engine.Univ)
 	i.Register2("copy_term", engine.CopyTerm)
+	i.Register2("stream_to_lazy_list", i.StreamToLazyList)
+	i.Register2("term_hash", engine.TermHash)
 	i.Register3("arg", engine.Arg)
 	i.Register3("bagof", i.BagOf)
 	i.Register3("setof", i.SetOf)
 	i.Register3("findall", i.FindAll)
 	i.Register3("catch", i.Catch)
+	i.Register2("call_with_time_limit", i.CallWithTimeLimit)
+	i.Register2("b_setval", i.BSetVal)
+	i.Register2("b_getval", i.BGetVal)
+	i.Register2("nb_setval", i.NbSetVal)
+	i.Register2("nb_getval", i.NbGetVal)
 	i.Register3("functor", engine.Functor)
 	i.Register3("op", i.Op)
 	i.Register3("compare", engine.Compare)
@@ -71,6 +180,9 @@ func New(in io.Reader, out io.Writer) *Interpreter {
 	i.Register2("close", i.Close)
 	i.Register1("flush_output", i.FlushOutput)
 	i.Register3("write_term", i.WriteTerm)
+	i.Register3("format", i.Format)
+	i.Register2("write_to_codes", i.WriteToCodes)
+	i.Register2("write_to_chars", i.WriteToChars)
 	i.Register2("char_code", engine.CharCode)
 	i.Register2("put_byte", i.PutByte)
 	i.Register2("put_code", i.PutCode)
@@ -88,6 +200,10 @@ func New(in io.Reader, out io.Writer) *Interpreter {
 	i.Register2("atom_codes", engine.AtomCodes)
 	i.Register2("number_chars", engine.NumberChars)
 	i.Register2("number_codes", engine.NumberCodes)
+	i.Register3("between", engine.Between)
+	i.Register4("numlist", engine.NumList)
+	i.Register3("get_dict", engine.GetDict)
+	i.Register4("put_dict", engine.PutDict)
 	i.Register2("is", engine.DefaultFunctionSet.Is)
 	i.Register2("=:=", engine.DefaultFunctionSet.Equal)
 	i.Register2("=\\=", engine.DefaultFunctionSet.NotEqual)
@@ -97,20 +213,24 @@ func New(in io.Reader, out io.Writer) *Interpreter {
 	i.Register2(">=", engine.DefaultFunctionSet.GreaterThanOrEqual)
 	i.Register2("stream_property", i.StreamProperty)
 	i.Register2("set_stream_position", i.SetStreamPosition)
+	i.Register4("seek", i.Seek)
 	i.Register2("char_conversion", i.CharConversion)
 	i.Register2("current_char_conversion", i.CurrentCharConversion)
 	i.Register2("set_prolog_flag", i.SetPrologFlag)
 	i.Register2("current_prolog_flag", i.CurrentPrologFlag)
 	i.Register1("dynamic", i.Dynamic)
 	i.Register1("built_in", i.BuiltIn)
+	i.Register1("redefine", i.Redefine)
 	i.Register2("expand_term", i.ExpandTerm)
+	i.Register2("expand_goal", i.ExpandGoal)
 	i.Register1("consult", i.consult)
+	i.Register1("include", i.include)
+	i.Register1("current_library", currentLibrary)
+	i.Register2("module", i.Module)
+	i.Register1("use_module", i.useModule)
+	i.Register1("current_module", i.CurrentModule)
+	i.Register2(":", i.Qualified)
 	i.Register2("environ", engine.Environ)
-	if err := i.Exec(bootstrap); err != nil {
-		panic(err)
-	}
-
-	return &i
 }
 
 // Exec executes a prolog program.
@@ -129,26 +249,184 @@ func (i *Interpreter) ExecContext(ctx context.Context, query string, args ...int
 		query = query[i:]
 	}
 
-	p := i.Parser(strings.NewReader(query), nil)
+	var (
+		vars  []engine.ParsedVariable
+		conds []conditional
+	)
+	p := i.Parser(strings.NewReader(query), &vars)
 	if err := p.Replace("?", args...); err != nil {
 		return err
 	}
 	for p.More() {
 		t, err := p.Term()
+		switch {
+		case errors.Is(err, io.EOF):
+			return endConditionals(conds)
+		case err != nil:
+			return err
+		}
+
+		skip, err := i.conditionalCompilation(ctx, &conds, t)
 		if err != nil {
 			return err
 		}
+		if skip {
+			continue
+		}
+
+		// The rest of the text after end_of_file is ignored.
+		if t == engine.Atom("end_of_file") {
+			return endConditionals(conds)
+		}
+
+		if i.OnSingletons != nil {
+			var singletons []string
+			for _, v := range vars {
+				if v.Count == 1 && !strings.HasPrefix(string(v.Name), "_") {
+					singletons = append(singletons, string(v.Name))
+				}
+			}
+			if len(singletons) > 0 {
+				i.OnSingletons(t, singletons)
+			}
+		}
 
 		v := engine.NewVariable()
 		if _, err := i.ExpandTerm(t, v, func(env *engine.Env) *engine.Promise {
-			return i.AssertStatic(v, engine.Success, env)
+			return i.expandGoals(v, func(t engine.Term, env *engine.Env) *engine.Promise {
+				if c, ok := env.Resolve(t).(*engine.Compound); ok && c.Functor == ":-" && len(c.Args) == 1 && i.OnDirective != nil {
+					handled, err := i.OnDirective(env.Simplify(c.Args[0]))
+					if err != nil {
+						return engine.Error(err)
+					}
+					if handled {
+						return engine.Bool(true)
+					}
+				}
+				return i.AssertStatic(t, engine.Success, env)
+			}, env)
 		}, nil).Force(ctx); err != nil {
 			return err
 		}
 	}
+	return endConditionals(conds)
+}
+
+// conditional is the state of a conditional compilation block from :- if(Cond). to :- endif.
+type conditional int
+
+const (
+	conditionalTaken   conditional = iota // in the branch of which condition succeeded.
+	conditionalPending                    // none of the conditions so far succeeded.
+	conditionalDone                       // a branch was already taken or the whole block is skipped.
+)
+
+// conditionalCompilation handles the directives if/1, elif/1, else/0, and endif/0 for conditional compilation.
+// It reports true if t is one of them or in a branch to be skipped.
+func (i *Interpreter) conditionalCompilation(ctx context.Context, conds *[]conditional, t engine.Term) (bool, error) {
+	n := len(*conds)
+	skipping := n > 0 && (*conds)[n-1] != conditionalTaken
+
+	c, ok := t.(*engine.Compound)
+	if !ok || c.Functor != ":-" || len(c.Args) != 1 {
+		return skipping, nil
+	}
+
+	var (
+		pi   engine.ProcedureIndicator
+		cond engine.Term
+	)
+	switch d := c.Args[0].(type) {
+	case engine.Atom:
+		pi = engine.ProcedureIndicator{Name: d}
+	case *engine.Compound:
+		pi = engine.ProcedureIndicator{Name: d.Functor, Arity: engine.Integer(len(d.Args))}
+		cond = d.Args[0]
+	}
+
+	switch pi {
+	case engine.ProcedureIndicator{Name: "if", Arity: 1}:
+		if skipping {
+			*conds = append(*conds, conditionalDone)
+			return true, nil
+		}
+		ok, err := i.Call(cond, engine.Success, nil).Force(ctx)
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			*conds = append(*conds, conditionalTaken)
+		} else {
+			*conds = append(*conds, conditionalPending)
+		}
+		return true, nil
+	case engine.ProcedureIndicator{Name: "elif", Arity: 1}, engine.ProcedureIndicator{Name: "else"}, engine.ProcedureIndicator{Name: "endif"}:
+		if n == 0 {
+			return false, engine.ExistenceError("directive", engine.Atom("if"), "%s has no matching if.", pi.Name)
+		}
+	default:
+		return skipping, nil
+	}
+
+	top := &(*conds)[n-1]
+	switch pi.Name {
+	case "elif":
+		switch *top {
+		case conditionalTaken:
+			*top = conditionalDone
+		case conditionalPending:
+			ok, err := i.Call(cond, engine.Success, nil).Force(ctx)
+			if err != nil {
+				return false, err
+			}
+			if ok {
+				*top = conditionalTaken
+			}
+		}
+	case "else":
+		switch *top {
+		case conditionalTaken:
+			*top = conditionalDone
+		case conditionalPending:
+			*top = conditionalTaken
+		}
+	case "endif":
+		*conds = (*conds)[:n-1]
+	}
+	return true, nil
+}
+
+// endConditionals reports an error if there's a conditional compilation block without endif.
+func endConditionals(conds []conditional) error {
+	if len(conds) > 0 {
+		return engine.ExistenceError("directive", engine.Atom("endif"), "if has no matching endif.")
+	}
 	return nil
 }
 
+// expandGoals applies goal_expansion/2 to the body of a clause or a directive.
+func (i *Interpreter) expandGoals(clause engine.Term, k func(engine.Term, *engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	c, ok := env.Resolve(clause).(*engine.Compound)
+	if !ok || c.Functor != ":-" {
+		return k(clause, env)
+	}
+
+	switch len(c.Args) {
+	case 1:
+		v := engine.NewVariable()
+		return i.ExpandGoal(c.Args[0], v, func(env *engine.Env) *engine.Promise {
+			return k(&engine.Compound{Functor: ":-", Args: []engine.Term{v}}, env)
+		}, env)
+	case 2:
+		v := engine.NewVariable()
+		return i.ExpandGoal(c.Args[1], v, func(env *engine.Env) *engine.Promise {
+			return k(&engine.Compound{Functor: ":-", Args: []engine.Term{c.Args[0], v}}, env)
+		}, env)
+	default:
+		return k(clause, env)
+	}
+}
+
 // Query executes a prolog query and returns *Solutions.
 func (i *Interpreter) Query(query string, args ...interface{}) (*Solutions, error) {
 	return i.QueryContext(context.Background(), query, args...)
@@ -165,8 +443,10 @@ func (i *Interpreter) QueryContext(ctx context.Context, query string, args ...in
 		return nil, err
 	}
 
-	var env *engine.Env
+	return i.query(ctx, t, nil), nil
+}
 
+func (i *Interpreter) query(ctx context.Context, t engine.Term, env *engine.Env) *Solutions {
 	more := make(chan bool, 1)
 	next := make(chan *engine.Env)
 	sols := Solutions{
@@ -174,27 +454,97 @@ func (i *Interpreter) QueryContext(ctx context.Context, query string, args ...in
 		more: more,
 		next: next,
 	}
+	// The solutions get their own converters so that RegisterConverter doesn't race with Scan.
+	if len(i.converters) > 0 {
+		sols.converters = make(map[engine.ProcedureIndicator]func([]engine.Term) (interface{}, error), len(i.converters))
+		for pi, fn := range i.converters {
+			sols.converters[pi] = fn
+		}
+	}
 
 	go func() {
 		defer close(next)
 		if !<-more {
 			return
 		}
-		if _, err := i.Call(t, func(env *engine.Env) *engine.Promise {
-			next <- env
-			return engine.Bool(!<-more)
+		// Goals in a query are expanded by goal_expansion/2 as well as the ones in a program.
+		g := engine.NewVariable()
+		if _, err := i.ExpandGoal(t, g, func(env *engine.Env) *engine.Promise {
+			return i.Call(g, func(env *engine.Env) *engine.Promise {
+				next <- env
+				return engine.Bool(!<-more)
+			}, env)
 		}, env).Force(ctx); err != nil {
-			sols.err = err
+			sols.err = aborted(ctx, err)
 		}
 	}()
 
-	return &sols, nil
+	return &sols
+}
+
+// RegisterConverter registers a conversion from a compound of functor/arity to a Go value for Scan of the solutions
+// of the interpreter's queries. Scan stores the value returned by fn if it's assignable to the destination, e.g. date/3
+// to time.Time.
+func (i *Interpreter) RegisterConverter(functor string, arity int, fn func([]engine.Term) (interface{}, error)) {
+	if i.converters == nil {
+		i.converters = map[engine.ProcedureIndicator]func([]engine.Term) (interface{}, error){}
+	}
+	i.converters[engine.ProcedureIndicator{Name: engine.Atom(functor), Arity: engine.Integer(arity)}] = fn
+}
+
+// Solve executes goal synchronously in the calling goroutine and calls cb for each solution. If cb returns true,
+// Solve backtracks for the next solution. Otherwise, it stops. Unlike Query, Solve spawns no goroutine nor channels.
+func (i *Interpreter) Solve(ctx context.Context, goal engine.Term, cb func(*engine.Env) bool) error {
+	_, err := i.Call(goal, func(env *engine.Env) *engine.Promise {
+		return engine.Bool(!cb(env))
+	}, nil).Force(ctx)
+	if err != nil {
+		return aborted(ctx, err)
+	}
+	return nil
+}
+
+// ErrAborted indicates the query is aborted either by abort/0 or by the cancellation of its context.
+var ErrAborted = errors.New("aborted")
+
+// aborted returns ErrAborted if err is caused by abort/0 or the cancellation of ctx. Otherwise, it returns err.
+// If ctx is canceled or its deadline is exceeded, the returned error also wraps ctx.Err().
+func aborted(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return contextAborted{cause: ctxErr}
+	}
+	var e *engine.Exception
+	if errors.As(err, &e) && e.Term == engine.Atom("$aborted") {
+		return ErrAborted
+	}
+	return err
+}
+
+// contextAborted is ErrAborted caused by the cancellation of a context.
+type contextAborted struct {
+	cause error
+}
+
+func (e contextAborted) Error() string {
+	return fmt.Sprintf("%s: %s", ErrAborted, e.cause)
+}
+
+// Is reports whether target is ErrAborted.
+func (e contextAborted) Is(target error) bool {
+	return target == ErrAborted
+}
+
+// Unwrap returns the cause, either context.Canceled or context.DeadlineExceeded.
+func (e contextAborted) Unwrap() error {
+	return e.cause
 }
 
 // ErrNoSolutions indicates there's no solutions for the query.
 var ErrNoSolutions = errors.New("no solutions")
 
 // QuerySolution executes a Prolog query for the first solution.
+// If the query throws an exception before the first solution, Solution.Err returns the exception as *engine.Exception.
+// If the query simply fails, Solution.Err returns ErrNoSolutions.
 func (i *Interpreter) QuerySolution(query string, args ...interface{}) *Solution {
 	return i.QuerySolutionContext(context.Background(), query, args...)
 }
@@ -216,10 +566,84 @@ func (i *Interpreter) QuerySolutionContext(ctx context.Context, query string, ar
 	return &Solution{sols: sols, err: sols.Close()}
 }
 
+// PreparedQuery is a query parsed once and executed many times with different arguments for placeholders.
+type PreparedQuery struct {
+	interpreter *Interpreter
+	goal        engine.Term
+	params      []engine.Variable
+}
+
+// Prepare parses a Prolog query so that it can be executed repeatedly without parsing. Every occurrence of ? in the
+// query is a placeholder to be replaced by an argument given to PreparedQuery.Query.
+func (i *Interpreter) Prepare(query string) (*PreparedQuery, error) {
+	t, err := i.Parser(strings.NewReader(query), nil).Term()
+	if err != nil {
+		return nil, err
+	}
+
+	q := PreparedQuery{interpreter: i}
+	q.goal = q.placeholders(t)
+	return &q, nil
+}
+
+func (q *PreparedQuery) placeholders(t engine.Term) engine.Term {
+	switch t := t.(type) {
+	case engine.Atom:
+		if t != "?" {
+			return t
+		}
+		v := engine.NewVariable()
+		q.params = append(q.params, v)
+		return v
+	case *engine.Compound:
+		c := engine.Compound{Functor: t.Functor, Args: make([]engine.Term, len(t.Args))}
+		for i, a := range t.Args {
+			c.Args[i] = q.placeholders(a)
+		}
+		return &c
+	default:
+		return t
+	}
+}
+
+// Query executes the prepared query with arguments for placeholders and returns *Solutions.
+func (q *PreparedQuery) Query(args ...interface{}) (*Solutions, error) {
+	return q.QueryContext(context.Background(), args...)
+}
+
+// QueryContext executes the prepared query with arguments for placeholders and returns *Solutions with context.
+func (q *PreparedQuery) QueryContext(ctx context.Context, args ...interface{}) (*Solutions, error) {
+	switch {
+	case len(args) < len(q.params):
+		return nil, errors.New("not enough arguments for placeholders")
+	case len(args) > len(q.params):
+		return nil, fmt.Errorf("too many arguments for placeholders: %s", args[len(q.params):])
+	}
+
+	var env *engine.Env
+	for i, a := range args {
+		t, err := engine.TermOf(a)
+		if err != nil {
+			return nil, err
+		}
+		env = env.Bind(q.params[i], t)
+	}
+
+	return q.interpreter.query(ctx, q.goal, env), nil
+}
+
 func (i *Interpreter) consult(files engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
 	switch f := env.Resolve(files).(type) {
 	case engine.Variable:
 		return engine.Error(engine.InstantiationError(files))
+	case engine.Atom:
+		if f == "[]" {
+			return k(env)
+		}
+		if err := i.consultOne(f, env); err != nil {
+			return engine.Error(err)
+		}
+		return k(env)
 	case *engine.Compound:
 		if f.Functor == "." && len(f.Args) == 2 {
 			if err := engine.EachList(f, func(elem engine.Term) error {
@@ -244,19 +668,14 @@ func (i *Interpreter) consult(files engine.Term, k func(*engine.Env) *engine.Pro
 func (i *Interpreter) consultOne(file engine.Term, env *engine.Env) error {
 	switch f := env.Resolve(file).(type) {
 	case engine.Atom:
-		for _, f := range []string{string(f), string(f) + ".pl"} {
-			b, err := ioutil.ReadFile(f)
-			if err != nil {
-				continue
-			}
-
-			if err := i.Exec(string(b)); err != nil {
-				return err
-			}
-
-			return nil
+		ok, err := i.load(nil, string(f))
+		if err != nil {
+			return err
 		}
-		return engine.DomainError("source_sink", file, "%s does not exist.", file)
+		if !ok {
+			return engine.DomainError("source_sink", file, "%s does not exist.", file)
+		}
+		return nil
 	case *engine.Compound:
 		if f.Functor != "library" || len(f.Args) != 1 {
 			return engine.TypeError("atom", file, "%s is not an atom.", file)
@@ -267,13 +686,218 @@ func (i *Interpreter) consultOne(file engine.Term, env *engine.Env) error {
 			return engine.TypeError("atom", f.Args[0], "%s is not an atom.", f.Args[0])
 		}
 
-		l, ok := libraries[string(library)]
-		if !ok {
-			return engine.ExistenceError("library", library, "%s is not a library.", library)
+		if _, ok := bootstrapLibraries[string(library)]; ok {
+			return nil
+		}
+
+		if l, ok := libraries[string(library)]; ok {
+			if err := l(i); err != nil {
+				return err
+			}
+			i.markUsed(f)
+			return nil
+		}
+
+		if i.LibraryFS != nil {
+			ok, err := i.load(i.LibraryFS, string(library))
+			if err != nil {
+				return err
+			}
+			if ok {
+				return nil
+			}
+		}
+
+		dirs, err := i.libraryDirs(env)
+		if err != nil {
+			return err
+		}
+		for _, d := range dirs {
+			ok, err := i.load(nil, filepath.Join(d, string(library)))
+			if err != nil {
+				return err
+			}
+			if ok {
+				return nil
+			}
 		}
 
-		return l(i)
+		return engine.ExistenceError("library", library, "%s is not a library.", library)
 	default:
 		return engine.TypeError("atom", file, "%s is not an atom.", file)
 	}
 }
+
+// useModule loads files as consult/1 does but only once. Libraries provided by bootstrap.pl, registered libraries
+// already installed, and libraries named after a module already declared by module/2 are considered to be loaded.
+func (i *Interpreter) useModule(files engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	if err := engine.Each(files, func(file engine.Term) error {
+		file = env.Simplify(file)
+		if _, ok := file.(engine.Variable); ok {
+			return engine.InstantiationError(file)
+		}
+		if _, ok := i.used[file.String()]; ok {
+			return nil
+		}
+
+		if c, ok := file.(*engine.Compound); ok && c.Functor == "library" && len(c.Args) == 1 {
+			if _, ok := c.Args[0].(engine.Atom); ok && i.moduleExists(c.Args[0], env) {
+				return nil
+			}
+		}
+
+		if err := i.consultOne(file, env); err != nil {
+			return err
+		}
+
+		i.markUsed(file)
+		return nil
+	}, env); err != nil {
+		return engine.Error(err)
+	}
+	return k(env)
+}
+
+// markUsed records that file is loaded so that use_module/1 won't load it again.
+func (i *Interpreter) markUsed(file engine.Term) {
+	if i.used == nil {
+		i.used = map[string]struct{}{}
+	}
+	i.used[file.String()] = struct{}{}
+}
+
+// moduleExists checks if there's a module named name.
+func (i *Interpreter) moduleExists(name engine.Term, env *engine.Env) bool {
+	ok, _ := i.CurrentModule(name, engine.Success, env).Force(context.Background())
+	return ok
+}
+
+// currentLibrary succeeds if name is a registered library.
+func currentLibrary(name engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	switch env.Resolve(name).(type) {
+	case engine.Variable, engine.Atom:
+		break
+	default:
+		return engine.Error(engine.TypeError("atom", name, "%s is not an atom.", name))
+	}
+
+	names := Libraries()
+	ks := make([]func(context.Context) *engine.Promise, len(names))
+	for i := range names {
+		n := engine.Atom(names[i])
+		ks[i] = func(context.Context) *engine.Promise {
+			return engine.Unify(name, n, k, env)
+		}
+	}
+	return engine.Delay(ks...)
+}
+
+// libraryDirs returns LibraryPath followed by the directories given by file_search_path(library, Dir).
+func (i *Interpreter) libraryDirs(env *engine.Env) ([]string, error) {
+	dirs := make([]string, len(i.LibraryPath))
+	copy(dirs, i.LibraryPath)
+
+	const fileSearchPath = engine.Atom("file_search_path")
+	if !i.defined(engine.ProcedureIndicator{Name: fileSearchPath, Arity: 2}, env) {
+		return dirs, nil
+	}
+
+	dir := engine.NewVariable()
+	if _, err := i.Call(fileSearchPath.Apply(engine.Atom("library"), dir), func(env *engine.Env) *engine.Promise {
+		if d, ok := env.Resolve(dir).(engine.Atom); ok {
+			dirs = append(dirs, string(d))
+		}
+		return engine.Bool(false) // ask for more solutions
+	}, env).Force(context.Background()); err != nil {
+		return nil, err
+	}
+	return dirs, nil
+}
+
+// defined checks if there's a procedure indicated by pi.
+func (i *Interpreter) defined(pi engine.ProcedureIndicator, env *engine.Env) bool {
+	ok, _ := i.CurrentPredicate(pi.Term(), engine.Success, env).Force(context.Background())
+	return ok
+}
+
+// include loads the clauses of file as if they were written in place of the directive.
+// A relative path is resolved against the directory of the file being loaded.
+func (i *Interpreter) include(file engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+	switch f := env.Resolve(file).(type) {
+	case engine.Variable:
+		return engine.Error(engine.InstantiationError(file))
+	case engine.Atom:
+		var (
+			fsys fs.FS
+			name = string(f)
+		)
+		if n := len(i.loading); n > 0 {
+			fsys, name = i.loading[n-1].fsys, i.loading[n-1].resolve(name)
+		}
+		ok, err := i.load(fsys, name)
+		if err != nil {
+			return engine.Error(err)
+		}
+		if !ok {
+			return engine.Error(engine.DomainError("source_sink", file, "%s does not exist.", file))
+		}
+		return k(env)
+	default:
+		return engine.Error(engine.TypeError("atom", file, "%s is not an atom.", file))
+	}
+}
+
+// ConsultFS loads the Prolog program in the file either named name or name.pl in fsys, e.g. embed.FS.
+// Files included by the program are also looked up in fsys.
+func (i *Interpreter) ConsultFS(fsys fs.FS, name string) error {
+	ok, err := i.load(fsys, name)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return nil
+}
+
+// loadingFile is a file being loaded either from fsys or, if fsys is nil, from the OS file system.
+type loadingFile struct {
+	fsys fs.FS
+	name string
+}
+
+// resolve resolves a relative path name against the directory of the file.
+func (f loadingFile) resolve(name string) string {
+	if f.fsys != nil {
+		return path.Join(path.Dir(f.name), name)
+	}
+	if filepath.IsAbs(name) {
+		return name
+	}
+	return filepath.Join(filepath.Dir(f.name), name)
+}
+
+// load executes the content of the file either named name or name.pl in fsys, or in the OS file system if fsys is nil.
+// It reports false if neither exists.
+func (i *Interpreter) load(fsys fs.FS, name string) (bool, error) {
+	for _, f := range []string{name, name + ".pl"} {
+		var (
+			b   []byte
+			err error
+		)
+		if fsys == nil {
+			b, err = ioutil.ReadFile(f)
+		} else {
+			b, err = fs.ReadFile(fsys, f)
+		}
+		if err != nil {
+			continue
+		}
+
+		i.loading = append(i.loading, loadingFile{fsys: fsys, name: f})
+		err = i.Exec(string(b))
+		i.loading = i.loading[:len(i.loading)-1]
+		return true, err
+	}
+	return false, nil
+}
@@ -1,8 +1,19 @@
 package prolog
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -56,6 +67,211 @@ append(nil, L, L).`))
 		})
 	})
 
+	t.Run("end of input", func(t *testing.T) {
+		t.Run("after a period", func(t *testing.T) {
+			i := New(nil, nil)
+			assert.NoError(t, i.Exec("foo(a).\n% trailing comment"))
+			assert.NoError(t, i.QuerySolution(`foo(a).`).Err())
+		})
+
+		t.Run("in the middle of a clause", func(t *testing.T) {
+			i := New(nil, nil)
+			assert.True(t, errors.Is(i.Exec("foo(a).\nfoo(b"), engine.ErrInsufficient))
+			assert.True(t, errors.Is(i.Exec("foo(a).\nfoo(b)"), engine.ErrInsufficient))
+			assert.True(t, errors.Is(i.Exec("foo(a).\n/* unterminated"), engine.ErrInsufficient))
+		})
+	})
+
+	t.Run("use_module", func(t *testing.T) {
+		i := New(nil, nil)
+		i.LibraryPath = []string{"testdata"}
+		assert.NoError(t, i.Exec(`:- use_module(library(greet)).`))
+		assert.NoError(t, i.Exec(`:- use_module(library(greet)).`))
+		assert.NoError(t, i.QuerySolution(`current_module(greet).`).Err())
+
+		sols, err := i.Query(`greet:hello(X).`)
+		assert.NoError(t, err)
+		var xs []string
+		for sols.Next() {
+			var s struct {
+				X string
+			}
+			assert.NoError(t, sols.Scan(&s))
+			xs = append(xs, s.X)
+		}
+		assert.NoError(t, sols.Close())
+		assert.Equal(t, []string{"world"}, xs)
+
+		assert.NoError(t, i.QuerySolution(`hello(world).`).Err())
+		assert.Error(t, i.Exec(`:- use_module(library(not_defined)).`))
+	})
+
+	t.Run("use_module bootstrap library", func(t *testing.T) {
+		i := New(nil, nil)
+		assert.NoError(t, i.Exec(`:- use_module(library(lists)).`))
+		assert.NoError(t, i.Exec(`:- use_module(library(apply)).`))
+		assert.NoError(t, i.QuerySolution(`append([a], [b], [a, b]).`).Err())
+	})
+
+	t.Run("use_module registered library", func(t *testing.T) {
+		var n int
+		Register("use_module_registered", func(i *Interpreter) error {
+			n++
+			return i.Exec(`registered.`)
+		})
+
+		i := New(nil, nil)
+		assert.NoError(t, i.Exec(`:- consult(library(use_module_registered)).`))
+		assert.NoError(t, i.Exec(`:- use_module(library(use_module_registered)).`))
+		assert.NoError(t, i.Exec(`:- use_module(library(use_module_registered)).`))
+		assert.Equal(t, 1, n)
+
+		sols, err := i.Query(`registered.`)
+		assert.NoError(t, err)
+		var m int
+		for sols.Next() {
+			m++
+		}
+		assert.NoError(t, sols.Close())
+		assert.Equal(t, 1, m)
+	})
+
+	t.Run("directive", func(t *testing.T) {
+		i := New(nil, nil)
+
+		errForbidden := errors.New("forbidden")
+		var modules, allowed []engine.Term
+		i.OnDirective = func(goal engine.Term) (bool, error) {
+			switch g := goal.(type) {
+			case engine.Atom:
+				if g == "forbidden" {
+					return false, errForbidden
+				}
+			case *engine.Compound:
+				switch g.Functor {
+				case "module":
+					modules = append(modules, g.Args[0])
+					return true, nil
+				case "forbidden":
+					return false, errForbidden
+				}
+			}
+			allowed = append(allowed, goal)
+			return false, nil
+		}
+
+		assert.NoError(t, i.Exec(`
+:- module(foo, [bar/1]).
+:- assertz(bar(a)).
+`))
+		assert.Equal(t, []engine.Term{engine.Atom("foo")}, modules)
+		assert.Equal(t, []engine.Term{engine.Atom("assertz").Apply(engine.Atom("bar").Apply(engine.Atom("a")))}, allowed)
+
+		var s struct {
+			X string
+		}
+		assert.NoError(t, i.QuerySolution(`bar(X).`).Scan(&s))
+		assert.Equal(t, "a", s.X)
+
+		assert.Equal(t, errForbidden, i.Exec(`:- forbidden(x).`))
+		assert.Equal(t, errForbidden, i.Exec(`:- forbidden.`))
+	})
+
+	t.Run("singletons", func(t *testing.T) {
+		var warnings [][]string
+		i := New(nil, nil)
+		i.OnSingletons = func(clause engine.Term, vars []string) {
+			warnings = append(warnings, vars)
+		}
+		assert.NoError(t, i.Exec(`
+foo(X) :- bar(Y).
+foo(X) :- bar(X).
+foo(_X) :- bar(_Y, _).
+`))
+		assert.Equal(t, [][]string{{"X", "Y"}}, warnings)
+	})
+
+	t.Run("term_expansion", func(t *testing.T) {
+		i := New(nil, nil)
+		assert.NoError(t, i.Exec(`term_expansion(foo, bar).`))
+		assert.NoError(t, i.Exec(`foo.`))
+
+		sols, err := i.Query(`bar.`)
+		assert.NoError(t, err)
+		assert.True(t, sols.Next())
+		assert.NoError(t, sols.Close())
+
+		sols, err = i.Query(`current_predicate(foo/0).`)
+		assert.NoError(t, err)
+		assert.False(t, sols.Next())
+		assert.NoError(t, sols.Close())
+	})
+
+	t.Run("goal_expansion", func(t *testing.T) {
+		i := New(nil, nil)
+		assert.NoError(t, i.Exec(`
+goal_expansion(double(X, Y), Y is X * 2).
+twice(X, Y) :- X > 0, double(X, Y); \+double(X, 0), Y = X.
+`))
+
+		var s struct {
+			Y int
+		}
+		assert.NoError(t, i.QuerySolution(`twice(2, Y).`).Scan(&s))
+		assert.Equal(t, 4, s.Y)
+		assert.NoError(t, i.QuerySolution(`twice(-3, Y).`).Scan(&s))
+		assert.Equal(t, -3, s.Y)
+	})
+
+	t.Run("op", func(t *testing.T) {
+		t.Run("redefine", func(t *testing.T) {
+			i := New(nil, nil)
+			assert.NoError(t, i.Exec(`:- op(100, yfx, +).`))
+
+			sols, err := i.Query(`X = 1 * 2 + 3, X = 1 * (2 + 3).`)
+			assert.NoError(t, err)
+			assert.True(t, sols.Next())
+			assert.NoError(t, sols.Close())
+		})
+
+		t.Run("comma", func(t *testing.T) {
+			i := New(nil, nil)
+			assert.Error(t, i.Exec(`:- op(0, xfy, ',').`))
+
+			sols, err := i.Query(`X = (a, b), X = ','(a, b).`)
+			assert.NoError(t, err)
+			assert.True(t, sols.Next())
+			assert.NoError(t, sols.Close())
+		})
+	})
+
+	t.Run("include", func(t *testing.T) {
+		i := New(nil, nil)
+
+		t.Run("ok", func(t *testing.T) {
+			assert.NoError(t, i.Exec(`:- consult('testdata/include/main').`))
+
+			var s struct {
+				X, Y string
+			}
+			assert.NoError(t, i.QuerySolution(`rule(X ~> Y).`).Scan(&s))
+			assert.Equal(t, "a", s.X)
+			assert.Equal(t, "b", s.Y)
+		})
+
+		t.Run("variable", func(t *testing.T) {
+			assert.Error(t, i.Exec(`:- include(_).`))
+		})
+
+		t.Run("not an atom", func(t *testing.T) {
+			assert.Error(t, i.Exec(`:- include(1).`))
+		})
+
+		t.Run("not exist", func(t *testing.T) {
+			assert.Error(t, i.Exec(`:- include('testdata/not_exist').`))
+		})
+	})
+
 	t.Run("consult", func(t *testing.T) {
 		i := New(nil, nil)
 
@@ -85,6 +301,12 @@ append(nil, L, L).`))
 			assert.Error(t, i.Exec(":- consult(foo(a, b, c))."))
 		})
 
+		t.Run("operator defined in the file", func(t *testing.T) {
+			i := New(nil, nil)
+			assert.NoError(t, i.Exec(`:- consult('testdata/op.pl').`))
+			assert.NoError(t, i.QuerySolution(`same(a === a).`).Err())
+		})
+
 		t.Run("library", func(t *testing.T) {
 			t.Run("ok", func(t *testing.T) {
 				var called bool
@@ -109,9 +331,129 @@ append(nil, L, L).`))
 			})
 		})
 
+		t.Run("library on disk", func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "library")
+			assert.NoError(t, err)
+			defer func() {
+				assert.NoError(t, os.RemoveAll(dir))
+			}()
+
+			assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "baz.pl"), []byte(`baz(c).`), 0644))
+			assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "qux.pl"), []byte(`qux(d).`), 0644))
+
+			t.Run("file_search_path", func(t *testing.T) {
+				i := New(nil, nil)
+				assert.Error(t, i.Exec(`:- consult(library(baz)).`))
+				assert.NoError(t, i.Exec(`:- assertz(file_search_path(library, ?)).`, dir))
+				assert.NoError(t, i.Exec(`:- consult(library(baz)).`))
+
+				var s struct {
+					X string
+				}
+				assert.NoError(t, i.QuerySolution(`baz(X).`).Scan(&s))
+				assert.Equal(t, "c", s.X)
+			})
+
+			t.Run("LibraryPath", func(t *testing.T) {
+				i := New(nil, nil)
+				i.LibraryPath = []string{"testdata", dir}
+				assert.NoError(t, i.Exec(`:- consult(library(qux)).`))
+
+				var s struct {
+					X string
+				}
+				assert.NoError(t, i.QuerySolution(`qux(X).`).Scan(&s))
+				assert.Equal(t, "d", s.X)
+			})
+		})
+
 		t.Run("neither atom nor library", func(t *testing.T) {
 			assert.Error(t, i.Exec(":- consult(1)."))
 		})
+
+		t.Run("list directive of files and libraries", func(t *testing.T) {
+			var loaded []string
+			libraries = map[string]func(*Interpreter) error{
+				"bar": func(in *Interpreter) error {
+					loaded = append(loaded, "bar")
+					return in.Exec(`bar(b).`)
+				},
+			}
+
+			assert.NoError(t, i.Exec(`:- ['testdata/foo', library(bar), 'testdata/empty.txt'].`))
+			assert.Equal(t, []string{"bar"}, loaded)
+
+			var s struct {
+				X, Y string
+			}
+			assert.NoError(t, i.QuerySolution(`foo(X), bar(Y).`).Scan(&s))
+			assert.Equal(t, "a", s.X)
+			assert.Equal(t, "b", s.Y)
+		})
+
+		t.Run("empty list", func(t *testing.T) {
+			assert.NoError(t, i.Exec(`:- consult([]).`))
+		})
+
+		t.Run("list directive stops at the first error", func(t *testing.T) {
+			assert.Error(t, i.Exec(`:- ['testdata/empty.txt', library(not_defined), 'testdata/abc.txt'].`))
+		})
+	})
+
+	t.Run("conditional compilation", func(t *testing.T) {
+		t.Run("if false", func(t *testing.T) {
+			i := New(nil, nil)
+			assert.NoError(t, i.Exec(`:- dynamic(foo/0).
+:- if(false).
+foo.
+:- endif.`))
+			sols, err := i.Query(`foo.`)
+			assert.NoError(t, err)
+			assert.False(t, sols.Next())
+			assert.NoError(t, sols.Close())
+		})
+
+		t.Run("branches", func(t *testing.T) {
+			i := New(nil, nil)
+			assert.NoError(t, i.Exec(`
+:- if(fail).
+a(1).
+:- elif(true).
+a(2).
+:- if(true).
+a(3).
+:- else.
+a(4).
+:- endif.
+:- elif(true).
+a(5).
+:- else.
+a(6).
+:- endif.
+:- if(false).
+:- if(true).
+a(7).
+:- endif.
+:- else.
+a(8).
+:- endif.
+`))
+			var s struct {
+				L []int
+			}
+			assert.NoError(t, i.QuerySolution(`findall(X, a(X), L).`).Scan(&s))
+			assert.Equal(t, []int{2, 3, 8}, s.L)
+		})
+
+		t.Run("no matching if", func(t *testing.T) {
+			i := New(nil, nil)
+			assert.Equal(t, engine.ExistenceError("directive", engine.Atom("if"), "endif has no matching if."), i.Exec(`:- endif.`))
+		})
+
+		t.Run("no matching endif", func(t *testing.T) {
+			i := New(nil, nil)
+			assert.Equal(t, engine.ExistenceError("directive", engine.Atom("endif"), "if has no matching endif."), i.Exec(`:- if(true).`))
+		})
 	})
 }
 
@@ -209,80 +551,496 @@ func TestInterpreter_Query(t *testing.T) {
 			List: []string{"abc", "def"},
 		}, r)
 	})
-}
 
-func TestMisc(t *testing.T) {
-	t.Run("negation", func(t *testing.T) {
+	t.Run("module qualified", func(t *testing.T) {
 		i := New(nil, nil)
-		sols, err := i.Query(`\+true.`)
+		assert.NoError(t, i.Exec(`foo(X) :- lists:member(X, [c]).`))
+
+		sols, err := i.Query(`user:member(X, [a, b]); foo(X).`)
 		assert.NoError(t, err)
+		var xs []string
+		for sols.Next() {
+			var s struct {
+				X string
+			}
+			assert.NoError(t, sols.Scan(&s))
+			xs = append(xs, s.X)
+		}
+		assert.NoError(t, sols.Close())
+		assert.Equal(t, []string{"a", "b", "c"}, xs)
 
-		assert.False(t, sols.Next())
+		assert.NoError(t, i.QuerySolution(`a:b:c = a:(b:c), X = (a:b, c), X = ','(_, _).`).Err())
 	})
 
-	t.Run("cut", func(t *testing.T) {
-		// https://www.cs.uleth.ca/~gaur/post/prolog-cut-negation/
-		t.Run("p", func(t *testing.T) {
-			i := New(nil, nil)
-			assert.NoError(t, i.Exec(`
-p(a).
-p(b):-!.
-p(c).
+	t.Run("dict", func(t *testing.T) {
+		var out bytes.Buffer
+		i := New(nil, &out)
+		assert.NoError(t, i.Exec(`origin(point{x: 0, y: 0}).`))
+
+		var s struct {
+			X    int
+			Keys []string
+		}
+		assert.NoError(t, i.QuerySolution(`
+origin(O),
+O = point{y: 0, x: 0},
+put_dict(x, O, 3, P),
+get_dict(x, P, X),
+findall(K, get_dict(K, P, _), Keys),
+writeq(P).
+`).Scan(&s))
+		assert.Equal(t, 3, s.X)
+		assert.Equal(t, []string{"x", "y"}, s.Keys)
+		assert.Equal(t, "point{x:3, y:0}", out.String())
+	})
+}
+
+func TestInterpreter_CurrentOperators(t *testing.T) {
+	i := New(nil, nil)
+	ops := i.CurrentOperators()
+	for _, op := range []engine.Operator{
+		{Priority: 1200, Specifier: "xfx", Name: ":-"},
+		{Priority: 1000, Specifier: "xfy", Name: ","},
+		{Priority: 700, Specifier: "xfx", Name: "is"},
+		{Priority: 500, Specifier: "yfx", Name: "+"},
+		{Priority: 200, Specifier: "fy", Name: "-"},
+	} {
+		assert.Contains(t, ops, op)
+	}
+}
+
+func TestInterpreter_Complete(t *testing.T) {
+	i := New(nil, nil)
+	assert.NoError(t, i.Exec(`
+write_all([]).
+write_all([X|Xs]) :- write(X), write_all(Xs).
 `))
+	assert.Equal(t, []string{"write", "write_all", "write_canonical", "write_clause", "write_term", "write_to_chars", "write_to_codes", "writeln", "writeq"}, i.Complete("write"))
+}
 
-			t.Run("single", func(t *testing.T) {
-				sols, err := i.Query(`p(X).`)
-				assert.NoError(t, err)
-				defer sols.Close()
+func TestInterpreter_Prepare(t *testing.T) {
+	i := New(nil, nil)
+	assert.NoError(t, i.Exec(`
+foo(a, 1).
+foo(b, 2).
+`))
 
-				var s struct {
-					X string
-				}
+	q, err := i.Prepare(`foo(?, Y).`)
+	assert.NoError(t, err)
 
-				assert.True(t, sols.Next())
-				assert.NoError(t, sols.Scan(&s))
-				assert.Equal(t, "a", s.X)
+	t.Run("ok", func(t *testing.T) {
+		for _, tc := range []struct {
+			x string
+			y int
+		}{
+			{x: "a", y: 1},
+			{x: "b", y: 2},
+		} {
+			sols, err := q.Query(tc.x)
+			assert.NoError(t, err)
 
-				assert.True(t, sols.Next())
-				assert.NoError(t, sols.Scan(&s))
-				assert.Equal(t, "b", s.X)
+			var s struct {
+				Y int
+			}
+			assert.True(t, sols.Next())
+			assert.NoError(t, sols.Scan(&s))
+			assert.Equal(t, tc.y, s.Y)
+			assert.False(t, sols.Next())
+			assert.NoError(t, sols.Close())
+		}
+	})
 
-				assert.False(t, sols.Next())
-			})
+	t.Run("not enough arguments", func(t *testing.T) {
+		_, err := q.Query()
+		assert.Error(t, err)
+	})
 
-			t.Run("double", func(t *testing.T) {
-				sols, err := i.Query(`p(X), p(Y).`)
-				assert.NoError(t, err)
-				defer sols.Close()
+	t.Run("too many arguments", func(t *testing.T) {
+		_, err := q.Query("a", "b")
+		assert.Error(t, err)
+	})
 
-				var s struct {
-					X string
-					Y string
-				}
+	t.Run("syntax error", func(t *testing.T) {
+		_, err := i.Prepare(`foo(?, .`)
+		assert.Error(t, err)
+	})
+}
 
-				assert.True(t, sols.Next())
-				assert.NoError(t, sols.Scan(&s))
-				assert.Equal(t, "a", s.X)
-				assert.Equal(t, "a", s.Y)
+func TestInterpreter_RegisterConverter(t *testing.T) {
+	i := New(nil, nil)
+	i.RegisterConverter("date", 3, convertDate)
 
-				assert.True(t, sols.Next())
-				assert.NoError(t, sols.Scan(&s))
-				assert.Equal(t, "a", s.X)
-				assert.Equal(t, "b", s.Y)
+	t.Run("QuerySolution", func(t *testing.T) {
+		var d time.Time
+		assert.NoError(t, i.QuerySolution(`D = date(2021, 12, 31).`).Scan(&d))
+		assert.Equal(t, time.Date(2021, 12, 31, 0, 0, 0, 0, time.UTC), d)
+	})
 
-				assert.True(t, sols.Next())
-				assert.NoError(t, sols.Scan(&s))
-				assert.Equal(t, "b", s.X)
-				assert.Equal(t, "a", s.Y)
+	t.Run("Query", func(t *testing.T) {
+		sols, err := i.Query(`member(D, [date(2021, 12, 31), date(2022, 1, 1)]).`)
+		assert.NoError(t, err)
+		var ds []time.Time
+		for sols.Next() {
+			var s struct {
+				D time.Time
+			}
+			assert.NoError(t, sols.Scan(&s))
+			ds = append(ds, s.D)
+		}
+		assert.NoError(t, sols.Close())
+		assert.Equal(t, []time.Time{
+			time.Date(2021, 12, 31, 0, 0, 0, 0, time.UTC),
+			time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC),
+		}, ds)
+	})
 
-				assert.True(t, sols.Next())
-				assert.NoError(t, sols.Scan(&s))
-				assert.Equal(t, "b", s.X)
-				assert.Equal(t, "b", s.Y)
+	t.Run("converter error", func(t *testing.T) {
+		var d time.Time
+		assert.Error(t, i.QuerySolution(`D = date(foo, 12, 31).`).Scan(&d))
+	})
 
-				assert.False(t, sols.Next())
-			})
-		})
+	t.Run("Clone", func(t *testing.T) {
+		var d time.Time
+		assert.NoError(t, i.Clone().QuerySolution(`D = date(2021, 12, 31).`).Scan(&d))
+		assert.Equal(t, time.Date(2021, 12, 31, 0, 0, 0, 0, time.UTC), d)
+	})
+
+	t.Run("registered after Query", func(t *testing.T) {
+		i := New(nil, nil)
+		i.RegisterConverter("date", 3, convertDate)
+
+		sols, err := i.Query(`D = date(2021, 12, 31).`)
+		assert.NoError(t, err)
+		defer func() {
+			assert.NoError(t, sols.Close())
+		}()
+
+		i.RegisterConverter("date", 3, func([]engine.Term) (interface{}, error) {
+			return nil, errors.New("registered after Query")
+		})
+
+		var s struct {
+			D time.Time
+		}
+		assert.True(t, sols.Next())
+		assert.NoError(t, sols.Scan(&s))
+		assert.Equal(t, time.Date(2021, 12, 31, 0, 0, 0, 0, time.UTC), s.D)
+	})
+}
+
+func TestInterpreter_Solve(t *testing.T) {
+	i := New(nil, nil)
+	x := engine.NewVariable()
+
+	t.Run("all solutions", func(t *testing.T) {
+		var xs []engine.Term
+		assert.NoError(t, i.Solve(context.Background(), &engine.Compound{
+			Functor: "member",
+			Args:    []engine.Term{x, engine.List(engine.Atom("a"), engine.Atom("b"), engine.Atom("c"))},
+		}, func(env *engine.Env) bool {
+			xs = append(xs, env.Resolve(x))
+			return true
+		}))
+		assert.Equal(t, []engine.Term{engine.Atom("a"), engine.Atom("b"), engine.Atom("c")}, xs)
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		var xs []engine.Term
+		assert.NoError(t, i.Solve(context.Background(), &engine.Compound{
+			Functor: "member",
+			Args:    []engine.Term{x, engine.List(engine.Atom("a"), engine.Atom("b"), engine.Atom("c"))},
+		}, func(env *engine.Env) bool {
+			xs = append(xs, env.Resolve(x))
+			return len(xs) < 2
+		}))
+		assert.Equal(t, []engine.Term{engine.Atom("a"), engine.Atom("b")}, xs)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		assert.Error(t, i.Solve(context.Background(), &engine.Compound{
+			Functor: "throw",
+			Args:    []engine.Term{engine.Atom("ball")},
+		}, func(*engine.Env) bool {
+			return true
+		}))
+	})
+}
+
+func TestInterpreter_Clone(t *testing.T) {
+	i := New(nil, nil)
+	assert.NoError(t, i.Exec(`
+:- dynamic(counter/1).
+counter(0).
+`))
+
+	t.Run("independent", func(t *testing.T) {
+		c := i.Clone()
+		assert.NoError(t, c.QuerySolution(`retract(counter(0)), assertz(counter(1)), op(700, xfx, ===).`).Err())
+
+		assert.NoError(t, c.QuerySolution(`counter(1), X = (a === b).`).Err())
+		assert.NoError(t, i.QuerySolution(`counter(0).`).Err())
+		assert.Error(t, i.QuerySolution(`X = (a === b).`).Err())
+	})
+
+	t.Run("redefined", func(t *testing.T) {
+		i := New(nil, nil)
+		assert.NoError(t, i.Exec(`
+:- redefine(atom_length/2).
+atom_length(_, 42).
+`))
+
+		c := i.Clone()
+		var s struct {
+			N int
+		}
+		assert.NoError(t, c.QuerySolution(`atom_length(foo, N).`).Scan(&s))
+		assert.Equal(t, 42, s.N)
+	})
+
+	t.Run("registered by the user", func(t *testing.T) {
+		i := New(nil, nil)
+		name := func(i *Interpreter) func(engine.Term, func(*engine.Env) *engine.Promise, *engine.Env) *engine.Promise {
+			return func(n engine.Term, k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+				return engine.Unify(n, engine.Atom(fmt.Sprintf("%p", i)), k, env)
+			}
+		}
+		i.Register1("name", name(i))
+
+		var orig, copied struct {
+			N string
+		}
+		assert.NoError(t, i.QuerySolution(`name(N).`).Scan(&orig))
+
+		c := i.Clone()
+		assert.NoError(t, c.QuerySolution(`name(N).`).Scan(&copied))
+		assert.Equal(t, orig.N, copied.N)
+
+		c.Register1("name", name(c))
+		assert.NoError(t, c.QuerySolution(`name(N).`).Scan(&copied))
+		assert.Equal(t, fmt.Sprintf("%p", c), copied.N)
+		assert.NotEqual(t, orig.N, copied.N)
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for n := 0; n < 8; n++ {
+			c := i.Clone()
+			wg.Add(1)
+			go func(n int) {
+				defer wg.Done()
+				for m := 0; m < 100; m++ {
+					assert.NoError(t, c.QuerySolution(`retract(counter(X)), Y is X + 1, assertz(counter(Y)).`).Err())
+				}
+				var s struct {
+					X int
+				}
+				assert.NoError(t, c.QuerySolution(`counter(X).`).Scan(&s))
+				assert.Equal(t, 100, s.X)
+			}(n)
+		}
+		wg.Wait()
+	})
+}
+
+func TestInterpreter_ConsultFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"prolog/main.pl": &fstest.MapFile{Data: []byte(`
+:- include(facts).
+:- use_module(library(util)).
+greet(X) :- person(X), hello(X).
+`)},
+		"prolog/facts.pl": &fstest.MapFile{Data: []byte(`person(alice).`)},
+		"lib/util.pl":     &fstest.MapFile{Data: []byte(`hello(_).`)},
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		i := New(nil, nil)
+		i.LibraryFS, _ = fs.Sub(fsys, "lib")
+		assert.NoError(t, i.ConsultFS(fsys, "prolog/main"))
+
+		var s struct {
+			X string
+		}
+		assert.NoError(t, i.QuerySolution(`greet(X).`).Scan(&s))
+		assert.Equal(t, "alice", s.X)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		i := New(nil, nil)
+		assert.True(t, errors.Is(i.ConsultFS(fsys, "prolog/foo"), fs.ErrNotExist))
+	})
+
+	t.Run("library not found", func(t *testing.T) {
+		i := New(nil, nil)
+		assert.Error(t, i.ConsultFS(fsys, "prolog/main"))
+	})
+}
+
+func BenchmarkInterpreter_Query(b *testing.B) {
+	i := New(nil, nil)
+	if err := i.Exec(`foo(a, 1).`); err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("parsed every time", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			sols, err := i.Query(`foo(?, Y), Y > 0, atom_length(?, L).`, "a", "abc")
+			if err != nil {
+				b.Fatal(err)
+			}
+			for sols.Next() {
+			}
+			_ = sols.Close()
+		}
+	})
+
+	b.Run("prepared", func(b *testing.B) {
+		q, err := i.Prepare(`foo(?, Y), Y > 0, atom_length(?, L).`)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for n := 0; n < b.N; n++ {
+			sols, err := q.Query("a", "abc")
+			if err != nil {
+				b.Fatal(err)
+			}
+			for sols.Next() {
+			}
+			_ = sols.Close()
+		}
+	})
+}
+
+func BenchmarkInterpreter_Solve(b *testing.B) {
+	i := New(nil, nil)
+	if err := i.Exec(`foo(a, 1).`); err != nil {
+		b.Fatal(err)
+	}
+
+	goal, err := i.Parser(strings.NewReader(`foo(a, Y), Y > 0, atom_length(abc, L).`), nil).Term()
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("query", func(b *testing.B) {
+		q, err := i.Prepare(`foo(a, Y), Y > 0, atom_length(abc, L).`)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for n := 0; n < b.N; n++ {
+			sols, err := q.Query()
+			if err != nil {
+				b.Fatal(err)
+			}
+			for sols.Next() {
+			}
+			_ = sols.Close()
+		}
+	})
+
+	b.Run("solve", func(b *testing.B) {
+		for n := 0; n < b.N; n++ {
+			if err := i.Solve(context.Background(), goal, func(*engine.Env) bool {
+				return true
+			}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestMisc(t *testing.T) {
+	t.Run("negation", func(t *testing.T) {
+		i := New(nil, nil)
+		sols, err := i.Query(`\+true.`)
+		assert.NoError(t, err)
+
+		assert.False(t, sols.Next())
+	})
+
+	t.Run("cut", func(t *testing.T) {
+		t.Run("top-level", func(t *testing.T) {
+			i := New(nil, nil)
+			sols, err := i.Query(`member(X, [1, 2, 3]), !.`)
+			assert.NoError(t, err)
+			defer func() {
+				assert.NoError(t, sols.Close())
+			}()
+
+			var s struct {
+				X int
+			}
+
+			assert.True(t, sols.Next())
+			assert.NoError(t, sols.Scan(&s))
+			assert.Equal(t, 1, s.X)
+
+			assert.False(t, sols.Next())
+			assert.NoError(t, sols.Err())
+		})
+
+		// https://www.cs.uleth.ca/~gaur/post/prolog-cut-negation/
+		t.Run("p", func(t *testing.T) {
+			i := New(nil, nil)
+			assert.NoError(t, i.Exec(`
+p(a).
+p(b):-!.
+p(c).
+`))
+
+			t.Run("single", func(t *testing.T) {
+				sols, err := i.Query(`p(X).`)
+				assert.NoError(t, err)
+				defer sols.Close()
+
+				var s struct {
+					X string
+				}
+
+				assert.True(t, sols.Next())
+				assert.NoError(t, sols.Scan(&s))
+				assert.Equal(t, "a", s.X)
+
+				assert.True(t, sols.Next())
+				assert.NoError(t, sols.Scan(&s))
+				assert.Equal(t, "b", s.X)
+
+				assert.False(t, sols.Next())
+			})
+
+			t.Run("double", func(t *testing.T) {
+				sols, err := i.Query(`p(X), p(Y).`)
+				assert.NoError(t, err)
+				defer sols.Close()
+
+				var s struct {
+					X string
+					Y string
+				}
+
+				assert.True(t, sols.Next())
+				assert.NoError(t, sols.Scan(&s))
+				assert.Equal(t, "a", s.X)
+				assert.Equal(t, "a", s.Y)
+
+				assert.True(t, sols.Next())
+				assert.NoError(t, sols.Scan(&s))
+				assert.Equal(t, "a", s.X)
+				assert.Equal(t, "b", s.Y)
+
+				assert.True(t, sols.Next())
+				assert.NoError(t, sols.Scan(&s))
+				assert.Equal(t, "b", s.X)
+				assert.Equal(t, "a", s.Y)
+
+				assert.True(t, sols.Next())
+				assert.NoError(t, sols.Scan(&s))
+				assert.Equal(t, "b", s.X)
+				assert.Equal(t, "b", s.Y)
+
+				assert.False(t, sols.Next())
+			})
+		})
 
 		// http://www.cse.unsw.edu.au/~billw/dictionaries/prolog/cut.html
 		t.Run("teaches", func(t *testing.T) {
@@ -487,6 +1245,577 @@ studies(alex, physics).
 		assert.NoError(t, sols.Err())
 	})
 
+	t.Run("cut inside call", func(t *testing.T) {
+		i := New(nil, nil)
+
+		var s struct {
+			Xs []int
+		}
+		assert.NoError(t, i.QuerySolution(`findall(X, (member(X, [1, 2, 3]), call((X = 2, !))), Xs).`).Scan(&s))
+		assert.Equal(t, []int{2}, s.Xs)
+
+		// The cut is local to call/1 so that member/2 outside still backtracks.
+		assert.NoError(t, i.QuerySolution(`findall(X-Y, (member(X, [1, 2, 3]), call((member(Y, [a, b]), !))), [1-a, 2-a, 3-a]).`).Err())
+	})
+
+	t.Run("unknown flag", func(t *testing.T) {
+		i := New(nil, nil)
+
+		assert.NoError(t, i.Exec(`:- set_prolog_flag(unknown, fail).`))
+		assert.Equal(t, ErrNoSolutions, i.QuerySolution(`undefined.`).Err())
+
+		assert.NoError(t, i.Exec(`:- set_prolog_flag(unknown, error).`))
+		var ex *engine.Exception
+		assert.True(t, errors.As(i.QuerySolution(`undefined.`).Err(), &ex))
+		assert.Equal(t, "error(existence_error(procedure, undefined/0), 'procedure undefined/0 does not exist.')", ex.Term.String())
+	})
+
+	t.Run("char_conversion", func(t *testing.T) {
+		i := New(nil, nil)
+		assert.NoError(t, i.Exec(`
+:- char_conversion(a, b).
+:- set_prolog_flag(char_conversion, on).
+`))
+		// Quoted atoms are not subject to char conversions.
+		assert.NoError(t, i.QuerySolution(`X = a, 'set_prolog_flag'('char_conversion', off), X == b.`).Err())
+	})
+
+	t.Run("write curly brackets and empty list", func(t *testing.T) {
+		i := New(nil, nil)
+
+		for _, tt := range []struct {
+			term, text string
+		}{
+			{term: "{a, b}", text: "{a, b}"},
+			{term: "'{}'(a)", text: "{a}"},
+			{term: "{}", text: "{}"},
+			{term: "'{}'", text: "{}"},
+			{term: "[]", text: "[]"},
+			{term: "'[]'", text: "[]"},
+		} {
+			var s struct {
+				Text string
+			}
+			assert.NoError(t, i.QuerySolution(fmt.Sprintf(`write_to_chars(%s, Cs), atom_chars(Text, Cs).`, tt.term)).Scan(&s))
+			assert.Equal(t, tt.text, s.Text)
+
+			// The written text reads back as the same term.
+			assert.NoError(t, i.QuerySolution(fmt.Sprintf(`%s == %s.`, tt.term, s.Text)).Err())
+		}
+	})
+
+	t.Run("prefix minus", func(t *testing.T) {
+		i := New(nil, nil)
+
+		for query, want := range map[string]engine.Term{
+			`X is -(2+3).`:  engine.Integer(-5),
+			`X is - (2+3).`: engine.Integer(-5),
+			`X is - -5.`:    engine.Integer(5),
+			`X is -(2.5).`:  engine.Float(-2.5),
+		} {
+			var s struct {
+				X engine.Term
+			}
+			assert.NoError(t, i.QuerySolution(query).Scan(&s), query)
+			assert.Equal(t, want, s.X, query)
+		}
+	})
+
+	t.Run("retract a rule", func(t *testing.T) {
+		i := New(nil, nil)
+		assert.NoError(t, i.Exec(`
+:- dynamic(p/1).
+p(a).
+q(b).
+`))
+		assert.NoError(t, i.QuerySolution(`assertz((p(X) :- q(X))), p(b).`).Err())
+		assert.NoError(t, i.QuerySolution(`retract((p(X) :- q(X))).`).Err())
+		assert.Equal(t, ErrNoSolutions, i.QuerySolution(`clause(p(_), q(_)).`).Err())
+		assert.Equal(t, ErrNoSolutions, i.QuerySolution(`p(b).`).Err())
+		assert.NoError(t, i.QuerySolution(`p(a).`).Err())
+	})
+
+	t.Run("erase", func(t *testing.T) {
+		i := New(nil, nil)
+		assert.NoError(t, i.Exec(`:- dynamic(p/1).`))
+
+		var s struct {
+			L []string
+		}
+		assert.NoError(t, i.QuerySolution(`assertz(p(a), _), assertz(p(b), R), asserta(p(c), _), erase(R), findall(X, p(X), L).`).Scan(&s))
+		assert.Equal(t, []string{"c", "a"}, s.L)
+	})
+
+	t.Run("recorded", func(t *testing.T) {
+		i := New(nil, nil)
+
+		var s struct {
+			L []string
+		}
+		assert.NoError(t, i.QuerySolution(`recordz(k, a), recordz(k, b, R), recorda(k, c), recordz(j, d), erase(R), findall(X, recorded(k, X), L).`).Scan(&s))
+		assert.Equal(t, []string{"c", "a"}, s.L)
+	})
+
+	t.Run("writeln", func(t *testing.T) {
+		var buf bytes.Buffer
+		i := New(nil, &buf)
+		assert.NoError(t, i.QuerySolution(`writeln(hello), writeln(user_output, 'a b'+'$VAR'(1)).`).Err())
+		assert.Equal(t, "hello\na b+B\n", buf.String())
+	})
+
+	t.Run("tab", func(t *testing.T) {
+		var buf bytes.Buffer
+		i := New(nil, &buf)
+		assert.NoError(t, i.QuerySolution(`write(a), tab(2), write(b), tab(user_output, 1+2), write(c), tab(0), tab(-1).`).Err())
+		assert.Equal(t, "a  b   c", buf.String())
+
+		f, err := ioutil.TempFile("", "")
+		assert.NoError(t, err)
+		assert.NoError(t, f.Close())
+		defer func() {
+			assert.NoError(t, os.Remove(f.Name()))
+		}()
+		assert.NoError(t, i.QuerySolution(`open(?, write, _, [alias(out)]), tab(out, 3), write(out, x), close(out).`, f.Name()).Err())
+		b, err := ioutil.ReadFile(f.Name())
+		assert.NoError(t, err)
+		assert.Equal(t, "   x", string(b))
+
+		assert.Error(t, i.QuerySolution(`tab(_).`).Err())
+		assert.NoError(t, i.QuerySolution(`catch(tab(1.5), error(type_error(integer, 1.5), _), true).`).Err())
+	})
+
+	t.Run("write_canonical", func(t *testing.T) {
+		for query, want := range map[string]string{
+			`write_canonical([a,b]).`:                      "[a, b]",
+			`write_canonical(a+b).`:                        "+(a, b)",
+			`write_canonical([a+b|c]).`:                    "[+(a, b)|c]",
+			`write_canonical((a,b)).`:                      "','(a, b)",
+			`write_canonical({a,b}).`:                      "{','(a, b)}",
+			`write_term([- 1, -(a)], [ignore_ops(true)]).`: "[-(1), -(a)]",
+		} {
+			var buf bytes.Buffer
+			i := New(nil, &buf)
+			assert.NoError(t, i.QuerySolution(query).Err(), query)
+			assert.Equal(t, want, buf.String(), query)
+		}
+	})
+
+	t.Run("bar as disjunction", func(t *testing.T) {
+		i := New(nil, nil)
+		assert.NoError(t, i.Exec(`
+p(X) :- (X = a | X = b).
+`))
+
+		var s struct {
+			L []string
+		}
+		assert.NoError(t, i.QuerySolution(`findall(X, p(X), L).`).Scan(&s))
+		assert.Equal(t, []string{"a", "b"}, s.L)
+	})
+
+	t.Run("throw errors", func(t *testing.T) {
+		i := New(nil, nil)
+
+		for goal, formal := range map[string]string{
+			`instantiation_error`:                     `instantiation_error`,
+			`type_error(integer, foo)`:                `type_error(integer, foo)`,
+			`domain_error(not_less_than_zero, -1)`:    `domain_error(not_less_than_zero, -1)`,
+			`existence_error(procedure, foo/1)`:       `existence_error(procedure, foo/1)`,
+			`permission_error(modify, flag, bounded)`: `permission_error(modify, flag, bounded)`,
+		} {
+			assert.NoError(t, i.QuerySolution(fmt.Sprintf(`catch(%s, E, true), E = error(%s, _).`, goal, formal)).Err(), goal)
+		}
+
+		// The same term as the one thrown by Go-side errors.
+		assert.NoError(t, i.QuerySolution(`catch(atom_length(1, _), error(F, _), true), catch(type_error(atom, 1), error(F, _), true).`).Err())
+	})
+
+	t.Run("end_of_file", func(t *testing.T) {
+		t.Run("read", func(t *testing.T) {
+			i := New(strings.NewReader("foo."), nil)
+
+			var s struct {
+				X, Y, Z string
+			}
+			assert.NoError(t, i.QuerySolution(`read(X), read(Y), read(Z).`).Scan(&s))
+			assert.Equal(t, "foo", s.X)
+			assert.Equal(t, "end_of_file", s.Y)
+			assert.Equal(t, "end_of_file", s.Z)
+		})
+
+		t.Run("eof_action(error)", func(t *testing.T) {
+			i := New(nil, nil)
+
+			var s struct {
+				X, Caught string
+			}
+			assert.NoError(t, i.QuerySolution(`
+open('testdata/terms.txt', read, S, [eof_action(error)]),
+read(S, _), read(S, _), read(S, _),
+read(S, X),
+catch(read(S, _), error(permission_error(input, past_end_of_stream, S), _), Caught = true),
+close(S).
+`).Scan(&s))
+			assert.Equal(t, "end_of_file", s.X)
+			assert.Equal(t, "true", s.Caught)
+		})
+
+		t.Run("consult", func(t *testing.T) {
+			i := New(nil, nil)
+			assert.NoError(t, i.Exec(`
+foo.
+end_of_file.
+bar.
+`))
+			assert.NoError(t, i.QuerySolution(`foo.`).Err())
+			assert.Error(t, i.QuerySolution(`bar.`).Err())
+		})
+	})
+
+	t.Run("redefine", func(t *testing.T) {
+		i := New(nil, nil)
+		assert.NoError(t, i.Exec(`
+:- redefine(append/3).
+append(_, _, redefined).
+`))
+
+		sols, err := i.Query(`append([a], [b], X).`)
+		assert.NoError(t, err)
+		defer func() {
+			assert.NoError(t, sols.Close())
+		}()
+
+		var xs []string
+		for sols.Next() {
+			var s struct {
+				X string
+			}
+			assert.NoError(t, sols.Scan(&s))
+			xs = append(xs, s.X)
+		}
+		assert.NoError(t, sols.Err())
+		assert.Equal(t, []string{"redefined"}, xs)
+	})
+
+	t.Run("redefine a control construct", func(t *testing.T) {
+		i := New(nil, nil)
+		var s struct {
+			Formal engine.Term
+		}
+		assert.NoError(t, i.QuerySolution(`catch(redefine(','/2), error(Formal, _), true).`).Scan(&s))
+		assert.Equal(t, engine.Atom("permission_error").Apply(engine.Atom("modify"), engine.Atom("static_procedure"), engine.Atom("/").Apply(engine.Atom(","), engine.Integer(2))), s.Formal)
+	})
+
+	t.Run("nested findall", func(t *testing.T) {
+		i := New(nil, nil)
+		var s struct {
+			L  engine.Term
+			X  engine.Term
+			Y  engine.Term
+			Ls [][]int
+		}
+		assert.NoError(t, i.QuerySolution(`findall(L, (member(X, [1, 2]), findall(Y, between(1, X, Y), L)), Ls).`).Scan(&s))
+		assert.Equal(t, [][]int{{1}, {1, 2}}, s.Ls)
+		assert.IsType(t, engine.Variable(""), s.L)
+		assert.IsType(t, engine.Variable(""), s.X)
+		assert.IsType(t, engine.Variable(""), s.Y)
+	})
+
+	t.Run("variable_names round-trip", func(t *testing.T) {
+		var out bytes.Buffer
+		i := New(strings.NewReader("f(X, Y, X).\n"), &out)
+		assert.NoError(t, i.QuerySolution(`read_term(T, [variable_names(Vs)]), write_term(T, [variable_names(Vs)]).`).Err())
+		assert.Equal(t, "f(X, Y, X)", out.String())
+	})
+
+	t.Run("write_clause", func(t *testing.T) {
+		var out bytes.Buffer
+		i := New(nil, &out)
+		assert.NoError(t, i.QuerySolution(`write_clause((foo(X) :- X = 'a b')).`).Err())
+		assert.True(t, strings.HasSuffix(out.String(), " .\n"))
+
+		// The output reads back as the same clause.
+		assert.NoError(t, i.Exec(out.String()))
+		assert.NoError(t, i.QuerySolution(`foo('a b').`).Err())
+	})
+
+	t.Run("error culprits", func(t *testing.T) {
+		i := New(nil, nil)
+
+		var s struct {
+			Message string
+		}
+		assert.NoError(t, i.QuerySolution(`catch(functor(_, foo, 2.0), error(_, Message), true).`).Scan(&s))
+		assert.Equal(t, "2.0 is not an integer.", s.Message)
+
+		assert.NoError(t, i.QuerySolution(`catch(atom_length(f(x, 2.0), _), error(_, Message), true).`).Scan(&s))
+		assert.Equal(t, "f(x, 2.0) is not an atom.", s.Message)
+
+		assert.NoError(t, i.QuerySolution(`catch(atom_length(f(x, 2.0), _), error(type_error(atom, f(x, 2.0)), Message), true).`).Scan(&s))
+	})
+
+	t.Run("deeply nested", func(t *testing.T) {
+		i := New(nil, nil)
+		err := i.QuerySolution(`X = ` + strings.Repeat("(", 100000) + `a` + strings.Repeat(")", 100000) + `.`).Err()
+		assert.Equal(t, "error(resource_error(parse_depth), 'Term is nested deeper than 10000.')", err.Error())
+
+		i.MaxParseDepth = 3
+		assert.Error(t, i.QuerySolution(`X = f(g(h(a))).`).Err())
+		assert.NoError(t, i.QuerySolution(`X = f(a).`).Err())
+	})
+
+	t.Run("write operators as atoms", func(t *testing.T) {
+		for _, tc := range []struct {
+			term, output string
+		}{
+			{term: `foo(;)`, output: `foo((;))`},
+			{term: `foo(-)`, output: `foo(-)`},
+			{term: `foo(:-)`, output: `foo((:-))`},
+			{term: `foo(',')`, output: `foo((','))`},
+			{term: `- (-)`, output: `-(-)`},
+			{term: `(-) - (-)`, output: `(-)-(-)`},
+			{term: `foo((a, b))`, output: `foo((a, b))`},
+			{term: `[(a :- b)]`, output: `[(a:-b)]`},
+			{term: `- (1)`, output: `-(1)`},
+		} {
+			t.Run(tc.term, func(t *testing.T) {
+				var out bytes.Buffer
+				i := New(nil, &out)
+				assert.NoError(t, i.QuerySolution(fmt.Sprintf(`writeq(%s).`, tc.term)).Err())
+				assert.Equal(t, tc.output, out.String())
+				assert.NoError(t, i.QuerySolution(fmt.Sprintf(`X = %s, X == %s.`, out.String(), tc.term)).Err())
+			})
+		}
+	})
+
+	t.Run("write operators at priority 1200", func(t *testing.T) {
+		for _, tc := range []struct {
+			term, output string
+		}{
+			{term: `foo((a :- b))`, output: `foo((a:-b))`},
+			{term: `foo((:- a))`, output: `foo((:-a))`},
+			{term: `foo((a --> b), c)`, output: `foo((a-->b), c)`},
+			{term: `[(a :- b), (c :- d)]`, output: `[(a:-b), (c:-d)]`},
+			{term: `((a :- b) :- c)`, output: `(a:-b):-c`},
+			{term: `(a :- (b :- c))`, output: `a:-(b:-c)`},
+		} {
+			t.Run(tc.term, func(t *testing.T) {
+				var out bytes.Buffer
+				i := New(nil, &out)
+				assert.NoError(t, i.QuerySolution(fmt.Sprintf(`writeq(%s).`, tc.term)).Err())
+				assert.Equal(t, tc.output, out.String())
+				assert.NoError(t, i.QuerySolution(fmt.Sprintf(`X = (%s), X == (%s).`, out.String(), tc.term)).Err())
+			})
+		}
+	})
+
+	t.Run("write negative numbers", func(t *testing.T) {
+		for _, tc := range []struct {
+			term, output string
+		}{
+			{term: `- -1`, output: `- -1`},
+			{term: `-(1)`, output: `-(1)`},
+			{term: `- (-(1))`, output: `- -(1)`},
+			{term: `f(-1)`, output: `f(-1)`},
+			{term: `a - -1`, output: `a- -1`},
+			{term: `a - (-(1))`, output: `a- -(1)`},
+			{term: `-(1.0)`, output: `-(1.0)`},
+			{term: `-(1^2)`, output: `-(1^2)`},
+			{term: `(-1)^2`, output: `-1^2`},
+		} {
+			t.Run(tc.term, func(t *testing.T) {
+				var out bytes.Buffer
+				i := New(nil, &out)
+				assert.NoError(t, i.QuerySolution(fmt.Sprintf(`writeq(%s).`, tc.term)).Err())
+				assert.Equal(t, tc.output, out.String())
+				assert.NoError(t, i.QuerySolution(fmt.Sprintf(`X = %s, X == %s.`, out.String(), tc.term)).Err())
+			})
+		}
+	})
+
+	t.Run("standard stream aliases", func(t *testing.T) {
+		var out bytes.Buffer
+		i := New(strings.NewReader("foo(bar).\n"), &out)
+
+		var s struct {
+			T engine.Term
+		}
+		assert.NoError(t, i.QuerySolution(`read_term(user_input, T, []), write_term(user_output, T, [quoted(true)]).`).Scan(&s))
+		assert.Equal(t, &engine.Compound{Functor: "foo", Args: []engine.Term{engine.Atom("bar")}}, s.T)
+		assert.Equal(t, "foo(bar)", out.String())
+	})
+
+	t.Run("if-then without else", func(t *testing.T) {
+		i := New(nil, nil)
+
+		sols, err := i.Query(`X = 0, ( fail -> true ).`)
+		assert.NoError(t, err)
+		assert.False(t, sols.Next())
+		assert.NoError(t, sols.Err())
+		assert.NoError(t, sols.Close())
+
+		var s struct {
+			X int
+		}
+		assert.NoError(t, i.QuerySolution(`( true -> X = 1 ).`).Scan(&s))
+		assert.Equal(t, 1, s.X)
+	})
+
+	t.Run("assertz_all", func(t *testing.T) {
+		i := New(nil, nil)
+		assert.NoError(t, i.Exec(`:- dynamic(foo/1).`))
+
+		var s struct {
+			L []int
+		}
+		assert.NoError(t, i.QuerySolution(`assertz_all([foo(1), foo(2)]), findall(X, foo(X), L).`).Scan(&s))
+		assert.Equal(t, []int{1, 2}, s.L)
+
+		assert.Error(t, i.QuerySolution(`assertz_all([foo(3), (foo(4) :- 4)]).`).Err())
+		assert.NoError(t, i.QuerySolution(`findall(X, foo(X), L).`).Scan(&s))
+		assert.Equal(t, []int{1, 2}, s.L)
+	})
+
+	t.Run("goal_expansion in a query", func(t *testing.T) {
+		var out bytes.Buffer
+		i := New(nil, &out)
+		assert.NoError(t, i.Exec(`goal_expansion(greet, writeln(hi)).`))
+		assert.NoError(t, i.QuerySolution(`greet.`).Err())
+		assert.Equal(t, "hi\n", out.String())
+
+		out.Reset()
+		var s struct {
+			X int
+		}
+		assert.NoError(t, i.QuerySolution(`X = 1, \+ \+ greet.`).Scan(&s))
+		assert.Equal(t, 1, s.X)
+		assert.Equal(t, "hi\n", out.String())
+	})
+
+	t.Run("abort", func(t *testing.T) {
+		t.Run("abort/0", func(t *testing.T) {
+			i := New(nil, nil)
+			sols, err := i.Query(`member(X, [1, 2]), X > 1, abort.`)
+			assert.NoError(t, err)
+			assert.False(t, sols.Next())
+			assert.Equal(t, ErrAborted, sols.Err())
+			assert.NoError(t, sols.Close())
+
+			assert.Equal(t, ErrAborted, i.Solve(context.Background(), engine.Atom("abort"), func(*engine.Env) bool {
+				return true
+			}))
+		})
+
+		t.Run("context", func(t *testing.T) {
+			i := New(nil, nil)
+			ctx, cancel := context.WithCancel(context.Background())
+			sols, err := i.QueryContext(ctx, `repeat, fail.`)
+			assert.NoError(t, err)
+			time.AfterFunc(10*time.Millisecond, cancel)
+			assert.False(t, sols.Next())
+			assert.True(t, errors.Is(sols.Err(), ErrAborted))
+			assert.True(t, errors.Is(sols.Err(), context.Canceled))
+			assert.NoError(t, sols.Close())
+		})
+
+		t.Run("deadline", func(t *testing.T) {
+			i := New(nil, nil)
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+			defer cancel()
+			sols, err := i.QueryContext(ctx, `repeat, fail.`)
+			assert.NoError(t, err)
+			assert.False(t, sols.Next())
+			assert.True(t, errors.Is(sols.Err(), ErrAborted))
+			assert.True(t, errors.Is(sols.Err(), context.DeadlineExceeded))
+			assert.NoError(t, sols.Close())
+
+			err = i.Solve(ctx, engine.Atom("true"), func(*engine.Env) bool {
+				return true
+			})
+			assert.True(t, errors.Is(err, ErrAborted))
+			assert.True(t, errors.Is(err, context.DeadlineExceeded))
+		})
+	})
+
+	t.Run("end of file sentinels", func(t *testing.T) {
+		for _, tc := range []struct {
+			query string
+			eof   engine.Term
+		}{
+			{query: `open('testdata/empty.txt', read, S), get_char(S, X), close(S).`, eof: engine.Atom("end_of_file")},
+			{query: `open('testdata/empty.txt', read, S), peek_char(S, X), close(S).`, eof: engine.Atom("end_of_file")},
+			{query: `open('testdata/empty.txt', read, S), get_code(S, X), close(S).`, eof: engine.Integer(-1)},
+			{query: `open('testdata/empty.txt', read, S), peek_code(S, X), close(S).`, eof: engine.Integer(-1)},
+			{query: `open('testdata/empty.txt', read, S, [type(binary)]), get_byte(S, X), close(S).`, eof: engine.Integer(-1)},
+			{query: `open('testdata/empty.txt', read, S, [type(binary)]), peek_byte(S, X), close(S).`, eof: engine.Integer(-1)},
+		} {
+			t.Run(tc.query, func(t *testing.T) {
+				i := New(nil, nil)
+				var s struct {
+					X engine.Term
+				}
+				assert.NoError(t, i.QuerySolution(tc.query).Scan(&s))
+				assert.Equal(t, tc.eof, s.X)
+			})
+		}
+	})
+
+	t.Run("curry", func(t *testing.T) {
+		i := New(nil, nil)
+
+		var s struct {
+			Out []int
+		}
+		assert.NoError(t, i.QuerySolution(`maplist(curry(plus, 1), [1, 2, 3], Out).`).Scan(&s))
+		assert.Equal(t, []int{2, 3, 4}, s.Out)
+		assert.NoError(t, i.QuerySolution(`maplist(curry(plus, 1), Out, [2, 3, 4]).`).Scan(&s))
+		assert.Equal(t, []int{1, 2, 3}, s.Out)
+	})
+
+	t.Run("built-in operators", func(t *testing.T) {
+		i := New(nil, nil)
+
+		var s struct {
+			P int
+		}
+		assert.NoError(t, i.QuerySolution(`current_op(P, xfx, is).`).Scan(&s))
+		assert.Equal(t, 700, s.P)
+		assert.NoError(t, i.QuerySolution(`current_op(P, xfx, :-).`).Scan(&s))
+		assert.Equal(t, 1200, s.P)
+		assert.NoError(t, i.QuerySolution(`current_op(P, xfy, ',').`).Scan(&s))
+		assert.Equal(t, 1000, s.P)
+		assert.NoError(t, i.QuerySolution(`current_op(P, yfx, +).`).Scan(&s))
+		assert.Equal(t, 500, s.P)
+	})
+
+	t.Run("read_terms", func(t *testing.T) {
+		i := New(nil, nil)
+
+		var s struct {
+			Terms []engine.Term
+		}
+		assert.NoError(t, i.QuerySolution(`open('testdata/terms.txt', read, S), read_terms(S, Terms), close(S).`).Scan(&s))
+		assert.Len(t, s.Terms, 3)
+		assert.Equal(t, "[foo(a), bar(b, c), [1, 2]]", engine.List(s.Terms...).String())
+
+		assert.Error(t, i.QuerySolution(`
+open('testdata/terms_error.txt', read, S),
+catch(read_terms(S, _), E, (close(S), throw(E))).
+`).Err())
+	})
+
+	t.Run("anonymous variables", func(t *testing.T) {
+		i := New(nil, nil)
+		assert.NoError(t, i.Exec(`
+p(_, _).
+s(1, a).
+s(2, b).
+r(X, Y) :- s(_, X), s(_, Y).
+`))
+		assert.NoError(t, i.QuerySolution(`p(a, b).`).Err())
+		assert.NoError(t, i.QuerySolution(`r(a, b).`).Err())
+	})
+
 	t.Run("catch cut", func(t *testing.T) {
 		i := New(nil, nil)
 		assert.NoError(t, i.Exec("foo :- catch(true, _, true), !."))
@@ -535,6 +1864,98 @@ studies(alex, physics).
 		assert.NoError(t, sols.Err())
 		assert.NoError(t, sols.Close())
 	})
+
+	t.Run("global variables", func(t *testing.T) {
+		i := New(nil, nil)
+
+		var s struct {
+			B, NB int
+		}
+		assert.NoError(t, i.QuerySolution(`
+b_setval(b, 0), nb_setval(nb, 0),
+(member(X, [1, 2, 3]), b_setval(b, X), nb_setval(nb, X), fail; true),
+b_getval(b, B), nb_getval(nb, NB).
+`).Scan(&s))
+		assert.Equal(t, 0, s.B)
+		assert.Equal(t, 3, s.NB)
+	})
+
+	t.Run("global variables share keys", func(t *testing.T) {
+		i := New(nil, nil)
+
+		var s struct {
+			X int
+		}
+		assert.NoError(t, i.QuerySolution(`nb_setval(k, 1), b_getval(k, X).`).Scan(&s))
+		assert.Equal(t, 1, s.X)
+		assert.NoError(t, i.QuerySolution(`b_setval(k, 2), nb_getval(k, X).`).Scan(&s))
+		assert.Equal(t, 2, s.X)
+		assert.NoError(t, i.QuerySolution(`b_setval(k, 3), nb_setval(k, 4), b_getval(k, X).`).Scan(&s))
+		assert.Equal(t, 4, s.X)
+		assert.NoError(t, i.QuerySolution(`nb_setval(k, 5), (b_setval(k, 6), fail ; nb_getval(k, X)).`).Scan(&s))
+		assert.Equal(t, 5, s.X)
+	})
+
+	t.Run("assertz control constructs", func(t *testing.T) {
+		i := New(nil, nil)
+		assert.NoError(t, i.Exec(`:- assertz((sign(X, Y) :- (X > 0 -> Y = pos ; X < 0 -> Y = neg ; Y = zero))).`))
+		assert.NoError(t, i.Exec(`:- assertz((first(X) :- (X = a, ! ; X = b))).`))
+
+		for _, tc := range []struct {
+			x int
+			y string
+		}{
+			{x: 1, y: "pos"},
+			{x: -1, y: "neg"},
+			{x: 0, y: "zero"},
+		} {
+			var s struct {
+				Y string
+			}
+			sols, err := i.Query(`sign(?, Y).`, tc.x)
+			assert.NoError(t, err)
+			assert.True(t, sols.Next())
+			assert.NoError(t, sols.Scan(&s))
+			assert.Equal(t, tc.y, s.Y)
+			assert.False(t, sols.Next())
+			assert.NoError(t, sols.Close())
+		}
+
+		var s struct {
+			Xs []string
+		}
+		assert.NoError(t, i.QuerySolution(`clause(first(X), Body), Body == ((X = a, !) ; X = b), findall(X, first(X), Xs).`).Scan(&s))
+		assert.Equal(t, []string{"a"}, s.Xs)
+	})
+
+	t.Run("format", func(t *testing.T) {
+		var out bytes.Buffer
+		i := New(nil, &out)
+
+		var s struct {
+			A, B string
+		}
+		assert.NoError(t, i.QuerySolution(`format(atom(A), '~a has ~d item~a', [cart, 3, s]), format_atom(B, '~w', f(x)), format('~q~n', ['X']).`).Scan(&s))
+		assert.Equal(t, "cart has 3 items", s.A)
+		assert.Equal(t, "f(x)", s.B)
+		assert.Equal(t, "'X'\n", out.String())
+	})
+
+	t.Run("print_message", func(t *testing.T) {
+		var out bytes.Buffer
+		i := New(nil, nil)
+		i.SetUserError(&out)
+
+		assert.NoError(t, i.QuerySolution(`catch(atom_length(1, _), E, true), print_message(error, E).`).Err())
+		assert.NoError(t, i.QuerySolution(`print_message(warning, format('~a is deprecated', [foo])).`).Err())
+		assert.NoError(t, i.QuerySolution(`print_message(silent, foo).`).Err())
+		assert.Equal(t, `Error: Type error
+    expected: atom
+    found:    1
+    context:  1 is not an atom.
+Warning: foo is deprecated
+`, out.String())
+	})
 }
 
 func TestInterpreter_QuerySolution(t *testing.T) {
@@ -569,6 +1990,16 @@ foo(c, d).
 		})
 	})
 
+	t.Run("single variable", func(t *testing.T) {
+		i := New(nil, nil)
+
+		var n int
+		assert.NoError(t, i.QuerySolution(`X = 42.`).Scan(&n))
+		assert.Equal(t, 42, n)
+
+		assert.Error(t, i.QuerySolution(`X = 42, Y = 43.`).Scan(&n))
+	})
+
 	t.Run("invalid query", func(t *testing.T) {
 		sol := i.QuerySolution(``)
 		assert.Error(t, sol.Err())
@@ -592,4 +2023,60 @@ foo(c, d).
 		var s struct{}
 		assert.Error(t, sol.Scan(&s))
 	})
+
+	t.Run("panic", func(t *testing.T) {
+		i := New(nil, nil)
+		i.Register0("oops", func(k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+			panic("oops")
+		})
+
+		var s struct {
+			E engine.Term
+		}
+		assert.NoError(t, i.QuerySolution(`catch(oops, error(system_error, E), true).`).Scan(&s))
+		assert.Equal(t, engine.Atom("panic: oops"), s.E)
+	})
+
+	t.Run("panic in delayed execution", func(t *testing.T) {
+		i := New(nil, nil)
+		i.Register0("oops", func(k func(*engine.Env) *engine.Promise, env *engine.Env) *engine.Promise {
+			return engine.Delay(func(context.Context) *engine.Promise {
+				panic("oops")
+			})
+		})
+
+		var s struct {
+			E engine.Term
+		}
+		assert.NoError(t, i.QuerySolution(`catch(oops, error(system_error, E), true).`).Scan(&s))
+		assert.Equal(t, engine.Atom("panic: oops"), s.E)
+	})
+
+	t.Run("time limit exceeded", func(t *testing.T) {
+		i := New(nil, nil)
+
+		var s struct {
+			X string
+		}
+		assert.NoError(t, i.QuerySolution(`catch(call_with_time_limit(0.05, (repeat, fail)), error(E, _), atom(E)), X = E.`).Scan(&s))
+		assert.Equal(t, "time_limit_exceeded", s.X)
+	})
+
+	t.Run("exception", func(t *testing.T) {
+		i.Register1("throw", engine.Throw)
+		sol := i.QuerySolution(`throw(foo(X)).`)
+
+		var e *engine.Exception
+		assert.True(t, errors.As(sol.Err(), &e))
+		assert.False(t, errors.Is(sol.Err(), ErrNoSolutions))
+
+		c, ok := e.Term.(*engine.Compound)
+		assert.True(t, ok)
+		assert.Equal(t, engine.Atom("foo"), c.Functor)
+
+		var s struct {
+			X string
+		}
+		assert.Equal(t, e, sol.Scan(&s))
+	})
 }
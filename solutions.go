@@ -17,6 +17,8 @@ type Solutions struct {
 	next   <-chan *engine.Env
 	err    error
 	closed bool
+
+	converters map[engine.ProcedureIndicator]func([]engine.Term) (interface{}, error)
 }
 
 // ErrClosed indicates the Solutions are already closed and unable to perform the operation.
@@ -45,11 +47,26 @@ func (s *Solutions) Next() bool {
 }
 
 // Scan copies the variable values of the current solution into the specified struct/map.
+// If the query has exactly one variable, Scan also accepts a pointer to a value of the variable e.g. *int.
 func (s *Solutions) Scan(dest interface{}) error {
 	o := reflect.ValueOf(dest)
 	switch o.Kind() {
 	case reflect.Ptr:
 		o = o.Elem()
+
+		// A struct such as time.Time can be the destination of a converter for a single variable.
+		if vs := s.Vars(); len(vs) == 1 {
+			if r, ok, err := s.customConvert(s.env.Simplify(engine.Variable(vs[0]))); ok {
+				if err != nil {
+					return err
+				}
+				if r.IsValid() && r.Type().AssignableTo(o.Type()) {
+					o.Set(r)
+					return nil
+				}
+			}
+		}
+
 		switch o.Kind() {
 		case reflect.Struct:
 			t := o.Type()
@@ -70,12 +87,22 @@ func (s *Solutions) Scan(dest interface{}) error {
 					continue
 				}
 
-				val, err := convert(s.env.Simplify(v), f.Type(), s.env)
+				val, err := s.convert(s.env.Simplify(v), f.Type(), s.env)
 				if err != nil {
 					return err
 				}
 				fields[string(v)].Set(val)
 			}
+		default:
+			vs := s.Vars()
+			if len(vs) != 1 {
+				return fmt.Errorf("can't scan %d variables into %s", len(vs), o.Type())
+			}
+			val, err := s.convert(s.env.Simplify(engine.Variable(vs[0])), o.Type(), s.env)
+			if err != nil {
+				return err
+			}
+			o.Set(val)
 		}
 		return nil
 	case reflect.Map:
@@ -85,7 +112,7 @@ func (s *Solutions) Scan(dest interface{}) error {
 		}
 
 		for _, v := range s.vars {
-			val, err := convert(s.env.Simplify(v), t.Elem(), s.env)
+			val, err := s.convert(s.env.Simplify(v), t.Elem(), s.env)
 			if err != nil {
 				return err
 			}
@@ -97,7 +124,32 @@ func (s *Solutions) Scan(dest interface{}) error {
 	}
 }
 
-func convert(t engine.Term, typ reflect.Type, env *engine.Env) (reflect.Value, error) {
+// customConvert converts t with the converter registered for its functor and arity. It returns false if there's no
+// such converter.
+func (s *Solutions) customConvert(t engine.Term) (reflect.Value, bool, error) {
+	c, ok := t.(*engine.Compound)
+	if !ok {
+		return reflect.Value{}, false, nil
+	}
+	fn, ok := s.converters[engine.ProcedureIndicator{Name: c.Functor, Arity: engine.Integer(len(c.Args))}]
+	if !ok {
+		return reflect.Value{}, false, nil
+	}
+	v, err := fn(c.Args)
+	return reflect.ValueOf(v), true, err
+}
+
+func (s *Solutions) convert(t engine.Term, typ reflect.Type, env *engine.Env) (reflect.Value, error) {
+	if r, ok, err := s.customConvert(t); ok {
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		if !r.IsValid() || !r.Type().AssignableTo(typ) {
+			return reflect.Value{}, fmt.Errorf("failed to convert: %s", typ)
+		}
+		return r, nil
+	}
+
 	switch typ {
 	case reflect.TypeOf((*interface{})(nil)).Elem(), reflect.TypeOf((*engine.Term)(nil)).Elem():
 		return reflect.ValueOf(t), nil
@@ -119,7 +171,7 @@ func convert(t engine.Term, typ reflect.Type, env *engine.Env) (reflect.Value, e
 	case reflect.Slice:
 		r := reflect.MakeSlice(reflect.SliceOf(typ.Elem()), 0, 0)
 		err := engine.EachList(t, func(elem engine.Term) error {
-			e, err := convert(elem, typ.Elem(), env)
+			e, err := s.convert(elem, typ.Elem(), env)
 			r = reflect.Append(r, e)
 			return err
 		}, env)
@@ -152,6 +204,7 @@ type Solution struct {
 }
 
 // Scan copies the variable values of the solution into the specified struct/map.
+// If the query has exactly one variable, Scan also accepts a pointer to a value of the variable e.g. *int.
 func (s *Solution) Scan(dest interface{}) error {
 	if err := s.err; err != nil {
 		return err
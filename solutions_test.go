@@ -2,7 +2,9 @@ package prolog
 
 import (
 	"errors"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/ichiban/prolog/engine"
 
@@ -132,11 +134,95 @@ func TestSolutions_Scan(t *testing.T) {
 		})
 	})
 
+	t.Run("single variable", func(t *testing.T) {
+		sols := Solutions{
+			env:  env,
+			vars: []engine.Variable{"Int"},
+		}
+
+		t.Run("ok", func(t *testing.T) {
+			var i int
+			assert.NoError(t, sols.Scan(&i))
+			assert.Equal(t, 1, i)
+		})
+
+		t.Run("ng", func(t *testing.T) {
+			var s string
+			assert.Error(t, sols.Scan(&s))
+		})
+	})
+
+	t.Run("scalar with multiple variables", func(t *testing.T) {
+		var i int
+		assert.Error(t, sols.Scan(&i))
+	})
+
 	t.Run("other", func(t *testing.T) {
 		assert.Error(t, sols.Scan(1))
 	})
 }
 
+func convertDate(args []engine.Term) (interface{}, error) {
+	var ymd [3]int
+	for i, a := range args {
+		n, ok := a.(engine.Integer)
+		if !ok {
+			return nil, fmt.Errorf("not an integer: %s", a)
+		}
+		ymd[i] = int(n)
+	}
+	return time.Date(ymd[0], time.Month(ymd[1]), ymd[2], 0, 0, 0, 0, time.UTC), nil
+}
+
+func TestSolutions_Scan_converter(t *testing.T) {
+	env := engine.NewEnv().
+		Bind("Date", &engine.Compound{
+			Functor: "date",
+			Args:    []engine.Term{engine.Integer(2021), engine.Integer(12), engine.Integer(31)},
+		}).
+		Bind("Dates", engine.List(&engine.Compound{
+			Functor: "date",
+			Args:    []engine.Term{engine.Integer(2022), engine.Integer(1), engine.Integer(1)},
+		})).
+		Bind("Invalid", &engine.Compound{
+			Functor: "date",
+			Args:    []engine.Term{engine.Atom("foo"), engine.Integer(1), engine.Integer(1)},
+		})
+
+	var i Interpreter
+	i.RegisterConverter("date", 3, convertDate)
+
+	sols := Solutions{
+		env:        env,
+		vars:       []engine.Variable{"Date", "Dates", "Invalid"},
+		converters: i.converters,
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		var s struct {
+			Date  time.Time
+			Dates []time.Time
+		}
+		assert.NoError(t, sols.Scan(&s))
+		assert.Equal(t, time.Date(2021, 12, 31, 0, 0, 0, 0, time.UTC), s.Date)
+		assert.Equal(t, []time.Time{time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)}, s.Dates)
+	})
+
+	t.Run("not assignable", func(t *testing.T) {
+		var s struct {
+			Date string
+		}
+		assert.Error(t, sols.Scan(&s))
+	})
+
+	t.Run("converter error", func(t *testing.T) {
+		var s struct {
+			Invalid time.Time
+		}
+		assert.Error(t, sols.Scan(&s))
+	})
+}
+
 func TestSolutions_Err(t *testing.T) {
 	err := errors.New("ng")
 	sols := Solutions{err: err}
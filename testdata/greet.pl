@@ -0,0 +1,5 @@
+:- module(greet, [hello/1]).
+
+hello(X) :- greeting(X).
+
+greeting(world).
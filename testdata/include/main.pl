@@ -0,0 +1,2 @@
+:- include(ops).
+rule(a ~> b).
@@ -0,0 +1 @@
+:- op(700, xfx, ~>).
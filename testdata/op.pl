@@ -0,0 +1,3 @@
+:- op(700, xfx, ===).
+
+same(X === X).
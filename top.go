@@ -0,0 +1,126 @@
+package prolog
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/ichiban/prolog/engine"
+)
+
+// Top runs a top-level loop which reads queries from in and writes their solutions to out.
+func (i *Interpreter) Top(in io.Reader, out io.Writer) error {
+	return i.TopContext(context.Background(), in, out)
+}
+
+// TopContext runs a top-level loop which reads queries from in and writes their solutions to out with context.
+// A query can span multiple lines. After each solution, it reads a line from in and shows the next solution if the
+// line starts with ; or stops otherwise. The next solution isn't searched for until asked. Bindings are written as
+// writeq/1 does. It returns nil when in reaches the end.
+func (i *Interpreter) TopContext(ctx context.Context, in io.Reader, out io.Writer) error {
+	prompt, contPrompt := i.Prompt, i.ContinuationPrompt
+	if prompt == "" {
+		prompt = "?- "
+	}
+	if contPrompt == "" {
+		contPrompt = "|- "
+	}
+
+	lines := bufio.NewScanner(in)
+	var buf strings.Builder
+	for {
+		p := prompt
+		if buf.Len() > 0 {
+			p = contPrompt
+		}
+		if _, err := fmt.Fprint(out, p); err != nil {
+			return err
+		}
+
+		if !lines.Scan() {
+			return lines.Err()
+		}
+		_, _ = buf.WriteString(lines.Text())
+
+		sols, err := i.QueryContext(ctx, buf.String())
+		switch {
+		case errors.Is(err, engine.ErrInsufficient):
+			// Reads the rest of the query without resetting buf.
+			_, _ = buf.WriteRune('\n')
+			continue
+		case errors.Is(err, io.EOF): // An empty line.
+			buf.Reset()
+			continue
+		case err != nil:
+			buf.Reset()
+			if _, err := fmt.Fprintf(out, "error: %v\n", err); err != nil {
+				return err
+			}
+			continue
+		}
+		buf.Reset()
+
+		if err := i.topSolutions(sols, lines, out); err != nil {
+			return err
+		}
+	}
+}
+
+func (i *Interpreter) topSolutions(sols *Solutions, lines *bufio.Scanner, out io.Writer) error {
+	defer func() {
+		_ = sols.Close()
+	}()
+
+	for sols.Next() {
+		s, err := i.topSolution(sols)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprint(out, s); err != nil {
+			return err
+		}
+
+		if !lines.Scan() || !strings.HasPrefix(strings.TrimSpace(lines.Text()), ";") {
+			_, err := fmt.Fprintf(out, ".\n")
+			return err
+		}
+		if _, err := fmt.Fprintf(out, " ;\n"); err != nil {
+			return err
+		}
+	}
+
+	if err := sols.Err(); err != nil {
+		_, err := fmt.Fprintf(out, "error: %v\n", err)
+		return err
+	}
+
+	_, err := fmt.Fprintf(out, "false.\n")
+	return err
+}
+
+// topSolution formats the bindings of the current solution as writeq/1 does.
+func (i *Interpreter) topSolution(sols *Solutions) (string, error) {
+	m := map[string]engine.Term{}
+	if err := sols.Scan(m); err != nil {
+		return "", err
+	}
+
+	vars := sols.Vars()
+	if len(vars) == 0 {
+		return "true", nil
+	}
+
+	ls := make([]string, len(vars))
+	for j, v := range vars {
+		var sb strings.Builder
+		// The value is the right operand of =/2 which is xfx 700.
+		if err := engine.Write(&sb, m[v], nil, engine.WithQuoted(true), i.WithIgnoreOps(false), engine.WithPriority(699)); err != nil {
+			return "", err
+		}
+		ls[j] = fmt.Sprintf("%s = %s", v, sb.String())
+	}
+	return strings.Join(ls, ",\n"), nil
+}
@@ -0,0 +1,42 @@
+package prolog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInterpreter_Top(t *testing.T) {
+	tests := []struct {
+		title  string
+		in     string
+		out    string
+		prompt string
+	}{
+		{title: "next solutions", in: "member(X, [a, b]).\n;\n;\n", out: "?- X = a ;\nX = b ;\nfalse.\n?- "},
+		{title: "stop", in: "member(X, [a, b]).\n\n", out: "?- X = a.\n?- "},
+		{title: "no variables", in: "true.\n", out: "?- true.\n?- "},
+		{title: "side effects of the next solution", in: "member(X, [a, b, c]), write(side(X)), nl.\n.\n", out: "?- side(a)\nX = a.\n?- "},
+		{title: "non-terminating next solution", in: "X = 1 ; repeat, fail.\n.\n", out: "?- X = 1.\n?- "},
+		{title: "quoted", in: "X = 'hello world', Y = [a|b], Z = (a :- b), W = - (1).\n", out: "?- X = 'hello world',\nY = [a|b],\nZ = (a:-b),\nW = -(1).\n?- "},
+		{title: "exception after a solution", in: "X = 1 ; throw(foo).\n;\n", out: "?- X = 1 ;\nerror: foo\n?- "},
+		{title: "no solutions", in: "fail.\n", out: "?- false.\n?- "},
+		{title: "multiple variables", in: "X = 1, Y = 2.\n", out: "?- X = 1,\nY = 2.\n?- "},
+		{title: "multi-line query", in: "X =\n1.\n", out: "?- |- X = 1.\n?- "},
+		{title: "empty line", in: "\ntrue.\n", out: "?- ?- true.\n?- "},
+		{title: "exception", in: "throw(foo).\n", out: "?- error: foo\n?- "},
+		{title: "prompt", in: "true.\n", out: "> true.\n> ", prompt: "> "},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.title, func(t *testing.T) {
+			var out bytes.Buffer
+			i := New(nil, &out)
+			i.Prompt = tt.prompt
+			assert.NoError(t, i.Top(strings.NewReader(tt.in), &out))
+			assert.Equal(t, tt.out, out.String())
+		})
+	}
+}
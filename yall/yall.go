@@ -0,0 +1,18 @@
+package yall
+
+import (
+	_ "embed"
+
+	"github.com/ichiban/prolog"
+)
+
+//go:embed yall.pl
+var yall string
+
+func init() {
+	prolog.Register("yall", install)
+}
+
+func install(i *prolog.Interpreter) error {
+	return i.Exec(yall)
+}
@@ -0,0 +1,77 @@
+% Lambda expressions compatible with https://www.swi-prolog.org/pldoc/man?section=yall
+%
+% Params>>Lambda calls Lambda with Params unified with the actual arguments. Extra arguments are appended to Lambda.
+% Free/Lambda shares the variables of Free with the context. The other variables of the lambda expression are
+% renamed on each call so that the lambda expression can be called repeatedly e.g. by maplist/3.
+
+:- built_in('>>'/2).
+'>>'(Params, Lambda) :- '$yall'(Params, Lambda, []).
+
+:- built_in('>>'/3).
+'>>'(Params, Lambda, A1) :- '$yall'(Params, Lambda, [A1]).
+
+:- built_in('>>'/4).
+'>>'(Params, Lambda, A1, A2) :- '$yall'(Params, Lambda, [A1, A2]).
+
+:- built_in('>>'/5).
+'>>'(Params, Lambda, A1, A2, A3) :- '$yall'(Params, Lambda, [A1, A2, A3]).
+
+:- built_in('>>'/6).
+'>>'(Params, Lambda, A1, A2, A3, A4) :- '$yall'(Params, Lambda, [A1, A2, A3, A4]).
+
+:- built_in('>>'/7).
+'>>'(Params, Lambda, A1, A2, A3, A4, A5) :- '$yall'(Params, Lambda, [A1, A2, A3, A4, A5]).
+
+:- built_in('>>'/8).
+'>>'(Params, Lambda, A1, A2, A3, A4, A5, A6) :- '$yall'(Params, Lambda, [A1, A2, A3, A4, A5, A6]).
+
+:- built_in('/'/2).
+'/'(Free, Lambda) :- '$yall_free'(Free, Lambda, []).
+
+:- built_in('/'/3).
+'/'(Free, Lambda, A1) :- '$yall_free'(Free, Lambda, [A1]).
+
+:- built_in('/'/4).
+'/'(Free, Lambda, A1, A2) :- '$yall_free'(Free, Lambda, [A1, A2]).
+
+:- built_in('/'/5).
+'/'(Free, Lambda, A1, A2, A3) :- '$yall_free'(Free, Lambda, [A1, A2, A3]).
+
+:- built_in('/'/6).
+'/'(Free, Lambda, A1, A2, A3, A4) :- '$yall_free'(Free, Lambda, [A1, A2, A3, A4]).
+
+:- built_in('/'/7).
+'/'(Free, Lambda, A1, A2, A3, A4, A5) :- '$yall_free'(Free, Lambda, [A1, A2, A3, A4, A5]).
+
+:- built_in('/'/8).
+'/'(Free, Lambda, A1, A2, A3, A4, A5, A6) :- '$yall_free'(Free, Lambda, [A1, A2, A3, A4, A5, A6]).
+
+:- built_in('$yall'/3).
+'$yall'(Free/Params0, Lambda0, Args) :-
+  !,
+  copy_term('$yall'(Free, Params0, Lambda0), '$yall'(Free, Params, Lambda)),
+  '$yall_bind'(Params, Args, Lambda).
+'$yall'(Params0, Lambda0, Args) :-
+  copy_term(Params0>>Lambda0, Params>>Lambda),
+  '$yall_bind'(Params, Args, Lambda).
+
+:- built_in('$yall_free'/3).
+'$yall_free'(Free, Lambda0, Args) :-
+  copy_term('$yall'(Free, Lambda0), '$yall'(Free, Lambda)),
+  '$yall_call'(Lambda, Args).
+
+:- built_in('$yall_bind'/3).
+'$yall_bind'([Param|Params], [Arg|Args], Lambda) :-
+  !,
+  Param = Arg,
+  '$yall_bind'(Params, Args, Lambda).
+'$yall_bind'(_, Args, Lambda) :-
+  '$yall_call'(Lambda, Args).
+
+:- built_in('$yall_call'/2).
+'$yall_call'(Lambda, []) :- !, call(Lambda).
+'$yall_call'(Lambda0, Args) :-
+  Lambda0 =.. List0,
+  append(List0, Args, List),
+  Lambda =.. List,
+  call(Lambda).
@@ -0,0 +1,63 @@
+package yall
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/ichiban/prolog"
+)
+
+func Test_install(t *testing.T) {
+	i := prolog.New(nil, nil)
+	assert.NoError(t, i.Exec(`:- [library(yall)].`))
+}
+
+func TestLambda(t *testing.T) {
+	i := prolog.New(nil, nil)
+	assert.NoError(t, i.Exec(`:- [library(yall)].`))
+
+	t.Run("maplist", func(t *testing.T) {
+		var s struct {
+			Out []int
+		}
+		assert.NoError(t, i.QuerySolution(`maplist([X, Y]>>(Y is X * 2), [1, 2, 3], Out).`).Scan(&s))
+		assert.Equal(t, []int{2, 4, 6}, s.Out)
+	})
+
+	t.Run("foldl", func(t *testing.T) {
+		var s struct {
+			Sum int
+		}
+		assert.NoError(t, i.QuerySolution(`foldl([X, A0, A]>>(A is A0 + X), [1, 2, 3], 0, Sum).`).Scan(&s))
+		assert.Equal(t, 6, s.Sum)
+	})
+
+	t.Run("extra arguments", func(t *testing.T) {
+		var s struct {
+			L []int
+		}
+		assert.NoError(t, i.QuerySolution(`call([X]>>append([X]), 1, [2], L).`).Scan(&s))
+		assert.Equal(t, []int{1, 2}, s.L)
+	})
+
+	t.Run("global variables", func(t *testing.T) {
+		var s struct {
+			Out []int
+		}
+		assert.NoError(t, i.QuerySolution(`N = 10, maplist([X, Y]>>(Y is X + N), [1, 2], Out).`).Scan(&s))
+		assert.Equal(t, []int{11, 12}, s.Out)
+	})
+
+	t.Run("free variables", func(t *testing.T) {
+		var s struct {
+			Xs []int
+		}
+		assert.NoError(t, i.QuerySolution(`call(Xs/append([1]), [2], Xs).`).Scan(&s))
+		assert.Equal(t, []int{1, 2}, s.Xs)
+	})
+
+	t.Run("variables are renamed for each call", func(t *testing.T) {
+		assert.NoError(t, i.QuerySolution(`maplist([X]>>(Y = X, atom(Y)), [a, b]).`).Err())
+	})
+}